@@ -0,0 +1,171 @@
+package rig
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/k0sproject/rig/exec"
+	"github.com/k0sproject/rig/pkg/clock"
+)
+
+// Audit record operations
+const (
+	AuditExec     = "exec"
+	AuditUpload   = "upload"
+	AuditDownload = "download"
+)
+
+// AuditRecord describes a command run or a file transferred on a host
+type AuditRecord struct {
+	// Host is the connection the operation was performed on
+	Host string `json:"host"`
+	// Operation is AuditExec, AuditUpload or AuditDownload
+	Operation string `json:"operation"`
+	// Command is the command as it was sent to the host, including the elevation, with the
+	// redactions applied
+	Command string `json:"command,omitempty"`
+	// Source and Destination are the paths of a file transfer
+	Source      string    `json:"source,omitempty"`
+	Destination string    `json:"destination,omitempty"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	// ExitCode is the exit code of the command, or -1 when the command could not be run or the exit
+	// code is not known
+	ExitCode int `json:"exitCode"`
+	// Bytes is the size of the transferred file
+	Bytes int64 `json:"bytes,omitempty"`
+	// Error is the error the operation failed with
+	Error string `json:"error,omitempty"`
+}
+
+// AuditSink receives a record of every command run and file transferred through a connection. Set
+// it using the Audit field of Connection. Audit is called from the goroutine that performed the
+// operation, so it must be safe for concurrent use when the connection is shared.
+type AuditSink interface {
+	Audit(record AuditRecord)
+}
+
+// AuditFunc is a function that implements AuditSink
+type AuditFunc func(record AuditRecord)
+
+// Audit calls f(record)
+func (f AuditFunc) Audit(record AuditRecord) {
+	f(record)
+}
+
+type jsonAuditSink struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONAuditSink returns an AuditSink that writes the records to w as JSON lines
+func NewJSONAuditSink(w io.Writer) AuditSink {
+	return &jsonAuditSink{enc: json.NewEncoder(w)}
+}
+
+func (s *jsonAuditSink) Audit(record AuditRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_ = s.enc.Encode(record)
+}
+
+// execDone records a finished command in the audit sink and in the metrics, ends its tracing span
+// and calls the OnExecEnd hooks
+func (c Connection) execDone(cmd string, opts []exec.Option, start time.Time, span Span, err error) {
+	c.auditExec(cmd, opts, start, err)
+	endExecSpan(span, start, err)
+	if c.Metrics != nil {
+		c.Metrics.ExecDone(c.Protocol(), clock.Default.Since(start), err)
+	}
+	c.execEnded(cmd, opts, start, clock.Default.Since(start), err)
+}
+
+// transferDone records a finished file transfer in the audit sink and in the metrics, ends its
+// tracing span and calls the OnUpload hooks. The size is taken from the local file.
+func (c Connection) transferDone(operation, src, dst string, start time.Time, span Span, err error) {
+	local := src
+	if operation == AuditDownload {
+		local = dst
+	}
+	var size int64
+	if err == nil {
+		if stat, statErr := os.Stat(local); statErr == nil {
+			size = stat.Size()
+		}
+	}
+	c.auditTransfer(operation, src, dst, size, start, err)
+	span.End(err)
+	if c.Metrics != nil && operation == AuditUpload {
+		c.Metrics.UploadDone(c.Protocol(), size, clock.Default.Since(start), err)
+	}
+	if operation == AuditUpload {
+		event := UploadEvent{Source: src, Destination: dst, Bytes: size, Duration: clock.Default.Since(start), Err: err}
+		for _, fn := range c.hooks.upload {
+			fn(&c, event)
+		}
+	}
+}
+
+// auditExec sends a record of a command that was started at start and returned err to the audit sink
+func (c Connection) auditExec(cmd string, opts []exec.Option, start time.Time, err error) {
+	if c.Audit == nil {
+		return
+	}
+	execOpts := exec.Build(opts...)
+	if rendered, err := execOpts.Command(cmd); err == nil {
+		cmd = rendered
+	}
+	record := AuditRecord{
+		Host:      c.String(),
+		Operation: AuditExec,
+		Command:   execOpts.Redact(cmd),
+		Start:     start,
+		End:       clock.Default.Now(),
+	}
+	if err != nil {
+		record.Error = execOpts.Redact(err.Error())
+		record.ExitCode = -1
+		if code, ok := exec.ExitCode(err); ok {
+			record.ExitCode = code
+		}
+	}
+	c.Audit.Audit(record)
+}
+
+// auditTransfer sends a record of a file transfer of size bytes that was started at start and returned
+// err to the audit sink
+func (c Connection) auditTransfer(operation, src, dst string, size int64, start time.Time, err error) {
+	if c.Audit == nil {
+		return
+	}
+	record := AuditRecord{
+		Host:        c.String(),
+		Operation:   operation,
+		Source:      src,
+		Destination: dst,
+		Start:       start,
+		End:         clock.Default.Now(),
+	}
+	if err != nil {
+		record.Error = err.Error()
+		record.ExitCode = -1
+	}
+	record.Bytes = size
+	c.Audit.Audit(record)
+}
+
+// auditWaiter records the command in the audit sink, as a tracing span and in the metrics when it
+// finishes
+type auditWaiter struct {
+	Waiter
+	done func(err error)
+}
+
+func (w *auditWaiter) Wait() error {
+	err := w.Waiter.Wait()
+	w.done(err)
+	return err //nolint:wrapcheck
+}
@@ -0,0 +1,109 @@
+package rig
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/alessio/shellescape"
+	"github.com/k0sproject/rig/exec"
+	ps "github.com/k0sproject/rig/powershell"
+)
+
+// RemoteProcess is a command running in the background on a remote host, started using
+// Connection.StartBackground
+type RemoteProcess struct {
+	// PID is the process id of the command on the remote host
+	PID int
+	// LogPath is the path of the remote file that receives the output of the command. It is not
+	// removed automatically.
+	LogPath string
+
+	conn *Connection
+	opts []exec.Option
+}
+
+// StartBackground starts a command in the background on the host and returns without waiting for
+// it to finish. The command is detached from the connection using setsid and nohup, so it keeps
+// running after the connection is closed. On windows the process is created through WMI for the
+// same reason, processes started using Start-Process are terminated along with the WinRM shell. The
+// output of the command is written into a temporary file, see RemoteProcess.Tail.
+func (c *Connection) StartBackground(cmd string, opts ...exec.Option) (*RemoteProcess, error) {
+	var script string
+	if c.IsWindows() {
+		script = ps.Cmd(fmt.Sprintf(`$out = [IO.Path]::GetTempFileName(); $r = Invoke-CimMethod -ClassName Win32_Process -MethodName Create -Arguments @{CommandLine = 'cmd.exe /s /c "' + %s + ' > "' + $out + '" 2>&1"'}; if ($r.ReturnValue -ne 0) { throw "process creation failed with code $($r.ReturnValue)" }; "$($r.ProcessId) $out"`, ps.SingleQuote(cmd)))
+	} else {
+		// setsid makes the command the leader of a new process group that can be signaled as a whole
+		script = "sh -c " + shellescape.Quote(fmt.Sprintf(`out=$(mktemp) && { $(command -v setsid) nohup sh -c %s > "$out" 2>&1 < /dev/null & } && echo "$! $out"`, shellescape.Quote(cmd)))
+	}
+
+	out, err := c.ExecOutput(script, opts...)
+	if err != nil {
+		return nil, ErrCommandFailed.Wrapf("start background command: %w", err)
+	}
+	pid, logPath, _ := strings.Cut(strings.TrimSpace(out), " ")
+	p := &RemoteProcess{LogPath: logPath, conn: c, opts: opts}
+	if p.PID, err = strconv.Atoi(pid); err != nil || logPath == "" {
+		return nil, ErrCommandFailed.Wrapf("start background command: unexpected output %q", out)
+	}
+	c.ops.processStarted(p)
+
+	return p, nil
+}
+
+// String returns the process id and the host of the process
+func (p *RemoteProcess) String() string {
+	return fmt.Sprintf("%s: pid %d", p.conn, p.PID)
+}
+
+// Poll returns true if the process is still running
+func (p *RemoteProcess) Poll() (bool, error) {
+	var cmd string
+	if p.conn.IsWindows() {
+		cmd = ps.Cmd(fmt.Sprintf(`[bool](Get-Process -Id %d -ErrorAction SilentlyContinue)`, p.PID))
+	} else {
+		// exited processes that have not been reaped yet show up as zombies in /proc on linux
+		cmd = fmt.Sprintf("kill -0 %[1]d 2> /dev/null && ! grep -qs ') Z' /proc/%[1]d/stat && echo true || echo false", p.PID)
+	}
+	out, err := p.conn.ExecOutput(cmd, p.opts...)
+	if err != nil {
+		return false, ErrCommandFailed.Wrapf("poll %s: %w", p, err)
+	}
+	running := strings.EqualFold(strings.TrimSpace(out), "true")
+	if !running {
+		p.conn.ops.processExited(p)
+	}
+	return running, nil
+}
+
+// Signal sends a signal, such as "TERM" or "KILL", to the process group of the process, or just the
+// process if it is not a group leader. On windows the process tree is terminated regardless of the
+// signal.
+func (p *RemoteProcess) Signal(signal string) error {
+	var cmd string
+	if p.conn.IsWindows() {
+		cmd = fmt.Sprintf("taskkill /T /F /PID %d", p.PID)
+	} else {
+		sig := shellescape.Quote(strings.TrimPrefix(strings.ToUpper(signal), "SIG"))
+		cmd = fmt.Sprintf("kill -s %[1]s -- -%[2]d 2> /dev/null || kill -s %[1]s %[2]d", sig, p.PID)
+	}
+	if err := p.conn.Exec(cmd, p.opts...); err != nil {
+		return ErrCommandFailed.Wrapf("signal %s: %w", p, err)
+	}
+	return nil
+}
+
+// Tail returns the last n lines of the output of the process
+func (p *RemoteProcess) Tail(n int) (string, error) {
+	var cmd string
+	if p.conn.IsWindows() {
+		cmd = ps.Cmd(fmt.Sprintf("Get-Content -LiteralPath %s -Tail %d", ps.SingleQuote(p.LogPath), n))
+	} else {
+		cmd = fmt.Sprintf("tail -n %d -- %s", n, shellescape.Quote(p.LogPath))
+	}
+	out, err := p.conn.ExecOutput(cmd, p.opts...)
+	if err != nil {
+		return "", ErrCommandFailed.Wrapf("read output of %s: %w", p, err)
+	}
+	return out, nil
+}
@@ -0,0 +1,85 @@
+package rig
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/k0sproject/rig/exec"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartBackground(t *testing.T) {
+	client := &scriptClient{respond: func(cmd string) (string, string, error) {
+		switch {
+		case strings.Contains(cmd, "nohup"):
+			return "1234 /tmp/tmp.abc123\n", "", nil
+		case strings.HasPrefix(cmd, "kill -0 1234"):
+			return "true\n", "", nil
+		case strings.HasPrefix(cmd, "tail "):
+			return "line 1\nline 2\n", "", nil
+		}
+		return "", "", nil
+	}}
+	c := newScriptConnection(t, client)
+
+	p, err := c.StartBackground("./server --port 8080")
+	require.NoError(t, err)
+	require.Equal(t, 1234, p.PID)
+	require.Equal(t, "/tmp/tmp.abc123", p.LogPath)
+	require.Contains(t, client.commands[len(client.commands)-1], "setsid")
+	require.Contains(t, client.commands[len(client.commands)-1], "./server --port 8080")
+
+	running, err := p.Poll()
+	require.NoError(t, err)
+	require.True(t, running)
+
+	out, err := p.Tail(2)
+	require.NoError(t, err)
+	require.Equal(t, "line 1\nline 2", out)
+	require.Equal(t, "tail -n 2 -- /tmp/tmp.abc123", client.commands[len(client.commands)-1])
+
+	require.NoError(t, p.Signal("SIGTERM"))
+	require.Equal(t, "kill -s TERM -- -1234 2> /dev/null || kill -s TERM 1234", client.commands[len(client.commands)-1])
+}
+
+func TestStartBackgroundErrors(t *testing.T) {
+	var response string
+	var responseErr error
+	client := &scriptClient{respond: func(cmd string) (string, string, error) {
+		if strings.Contains(cmd, "nohup") {
+			return response, "", responseErr
+		}
+		return "", "", nil
+	}}
+	c := newScriptConnection(t, client)
+
+	response, responseErr = "", errors.New("mktemp: permission denied")
+	_, err := c.StartBackground("./server")
+	require.ErrorIs(t, err, ErrCommandFailed)
+
+	for _, out := range []string{"", "1234", "abc /tmp/tmp.abc123"} {
+		response, responseErr = out, nil
+		_, err = c.StartBackground("./server")
+		require.ErrorIs(t, err, ErrCommandFailed, out)
+	}
+}
+
+func TestStartBackgroundWindows(t *testing.T) {
+	client := &scriptClient{mockClient: mockClient{windows: true}, respond: func(cmd string) (string, string, error) {
+		// the script is encoded, the only powershell command is the one starting the process
+		if strings.HasPrefix(cmd, "powershell.exe") {
+			return `4321 C:\Users\admin\AppData\Local\Temp\tmp1.tmp` + "\n", "", nil
+		}
+		return "", "", nil
+	}}
+	c := newScriptConnection(t, client)
+
+	p, err := c.StartBackground("server.exe", exec.HideOutput())
+	require.NoError(t, err)
+	require.Equal(t, 4321, p.PID)
+	require.Equal(t, `C:\Users\admin\AppData\Local\Temp\tmp1.tmp`, p.LogPath)
+
+	require.NoError(t, p.Signal("TERM"))
+	require.Equal(t, "taskkill /T /F /PID 4321", client.commands[len(client.commands)-1])
+}
@@ -0,0 +1,93 @@
+package rig
+
+import (
+	"crypto/md5"  //nolint:gosec // md5 is offered for hosts that lack better tools, not for security
+	"crypto/sha1" //nolint:gosec // same as above
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+
+	"github.com/alessio/shellescape"
+	"github.com/k0sproject/rig/exec"
+	ps "github.com/k0sproject/rig/powershell"
+)
+
+// Checksum algorithms for exec.Checksum
+const (
+	ChecksumSHA256 = "sha256" // ChecksumSHA256 is the default checksum algorithm
+	ChecksumSHA512 = "sha512" // ChecksumSHA512 uses sha512sum or Get-FileHash -Algorithm SHA512
+	ChecksumSHA1   = "sha1"   // ChecksumSHA1 uses sha1sum or Get-FileHash -Algorithm SHA1
+	ChecksumMD5    = "md5"    // ChecksumMD5 uses md5sum or Get-FileHash -Algorithm MD5
+	ChecksumNone   = "none"   // ChecksumNone disables checksum verification
+)
+
+// newChecksum returns a hash for the algorithm selected using exec.Checksum or nil if verification
+// has been disabled
+func newChecksum(opts ...exec.Option) (hash.Hash, error) {
+	switch algo := exec.Build(opts...).Checksum; algo {
+	case "", ChecksumSHA256:
+		return sha256.New(), nil
+	case ChecksumSHA512:
+		return sha512.New(), nil
+	case ChecksumSHA1:
+		return sha1.New(), nil //nolint:gosec
+	case ChecksumMD5:
+		return md5.New(), nil //nolint:gosec
+	case ChecksumNone:
+		return nil, nil
+	default:
+		return nil, ErrNotSupported.Wrapf("checksum algorithm %q", algo)
+	}
+}
+
+// hashWriter returns the hash as a writer or io.Discard when the hash is nil
+func hashWriter(h hash.Hash) io.Writer {
+	if h == nil {
+		return io.Discard
+	}
+	return h
+}
+
+// remoteChecksum returns the hex encoded checksum of a remote file
+func (c *Connection) remoteChecksum(path string, opts ...exec.Option) (string, error) {
+	algo := exec.Build(opts...).Checksum
+	if algo == "" || algo == ChecksumSHA256 {
+		return c.fsysFor(opts...).Sha256(path) //nolint:wrapcheck
+	}
+
+	// the checksum option is not relevant for the commands themselves
+	if c.IsWindows() {
+		out, err := c.ExecOutput(ps.Cmd(fmt.Sprintf("(Get-FileHash -LiteralPath %s -Algorithm %s).Hash.ToLower()", ps.SingleQuote(path), strings.ToUpper(algo))), opts...)
+		if err != nil {
+			return "", ErrCommandFailed.Wrapf("get %s checksum: %w", algo, err)
+		}
+		return out, nil
+	}
+
+	out, err := c.ExecOutput(fmt.Sprintf("%ssum -- %s", algo, shellescape.Quote(path)), opts...)
+	if err != nil {
+		return "", ErrCommandFailed.Wrapf("get %s checksum: %w", algo, err)
+	}
+	sum, _, _ := strings.Cut(out, " ")
+	return strings.TrimPrefix(sum, "\\"), nil
+}
+
+// verifyChecksum compares the checksum of a remote file to the locally calculated one. Nothing is
+// done when the hash is nil.
+func (c *Connection) verifyChecksum(path string, h hash.Hash, opts ...exec.Option) error {
+	if h == nil {
+		return nil
+	}
+	c.loggerFor(opts).Debugf("%s: validate checksum of %s", c, path)
+	remoteSum, err := c.remoteChecksum(path, opts...)
+	if err != nil {
+		return ErrCommandFailed.Wrapf("validate checksum of %s: %w", path, err)
+	}
+	if localSum := fmt.Sprintf("%x", h.Sum(nil)); remoteSum != localSum {
+		return ErrChecksumMismatch.Wrapf("%s: local %s, remote %s", path, localSum, remoteSum)
+	}
+	return nil
+}
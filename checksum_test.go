@@ -0,0 +1,40 @@
+package rig
+
+import (
+	"crypto/md5" //nolint:gosec
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/k0sproject/rig/exec"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyChecksum(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses unix tools")
+	}
+	c := Connection{Localhost: &Localhost{Enabled: true}}
+	require.NoError(t, c.Connect())
+
+	path := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(path, []byte("hello"), 0o600))
+
+	opts := []exec.Option{exec.Checksum(ChecksumMD5)}
+	h, err := newChecksum(opts...)
+	require.NoError(t, err)
+	_, _ = h.Write([]byte("hello"))
+	require.NoError(t, c.verifyChecksum(path, h, opts...))
+
+	h = md5.New() //nolint:gosec
+	_, _ = h.Write([]byte("world"))
+	require.ErrorIs(t, c.verifyChecksum(path, h, opts...), ErrChecksumMismatch)
+
+	h, err = newChecksum(exec.Checksum(ChecksumNone))
+	require.NoError(t, err)
+	require.Nil(t, h)
+
+	_, err = newChecksum(exec.Checksum("xxhash"))
+	require.ErrorIs(t, err, ErrNotSupported)
+}
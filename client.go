@@ -0,0 +1,136 @@
+package rig
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+)
+
+// ClientFactory returns a new, unconfigured instance of a Client implementation
+type ClientFactory func() Client
+
+var (
+	clientFactories   = map[string]ClientFactory{}
+	clientFactoriesMu sync.RWMutex
+)
+
+// RegisterClient registers a connection protocol implementation under a name. The factory should
+// return a pointer to a struct with yaml tags, it will be used to decode the configuration when
+// the name is used as a key under the Connection's generic "connection" field:
+//
+//	rig.RegisterClient("docker", func() rig.Client { return &Docker{} })
+//
+//	hosts:
+//	  - connection:
+//	      connection:
+//	        docker:
+//	          container: foo
+func RegisterClient(name string, factory func() Client) {
+	clientFactoriesMu.Lock()
+	defer clientFactoriesMu.Unlock()
+	clientFactories[name] = factory
+}
+
+// RegisteredClients returns the names of the registered connection protocols
+func RegisteredClients() []string {
+	clientFactoriesMu.RLock()
+	defer clientFactoriesMu.RUnlock()
+	names := make([]string, 0, len(clientFactories))
+	for name := range clientFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func getClientFactory(name string) (ClientFactory, bool) {
+	clientFactoriesMu.RLock()
+	defer clientFactoriesMu.RUnlock()
+	factory, ok := clientFactories[name]
+	return factory, ok
+}
+
+// ClientConfig holds a Client for a connection type registered with RegisterClient
+// and the name it was registered with
+type ClientConfig struct {
+	Name   string
+	Client Client
+}
+
+// NewClientConfig returns a ClientConfig with a new client built using the factory registered with the name
+func NewClientConfig(name string) (*ClientConfig, error) {
+	factory, ok := getClientFactory(name)
+	if !ok {
+		return nil, ErrNotSupported.Wrapf("unknown connection protocol %q", name)
+	}
+	return &ClientConfig{Name: name, Client: factory()}, nil
+}
+
+// rawYAML captures a yaml node for delayed decoding
+type rawYAML struct {
+	unmarshal func(interface{}) error
+}
+
+// UnmarshalYAML implements the yaml.v2 style Unmarshaler interface, which is also supported by yaml.v3
+func (r *rawYAML) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	r.unmarshal = unmarshal
+	return nil
+}
+
+// UnmarshalYAML decodes a mapping with a single key that is the name of a registered protocol
+func (c *ClientConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	raw := make(map[string]*rawYAML)
+	if err := unmarshal(&raw); err != nil {
+		return ErrValidationFailed.Wrapf("unmarshal connection: %w", err)
+	}
+	if len(raw) != 1 {
+		return ErrValidationFailed.Wrapf("exactly one connection protocol must be configured, got %d", len(raw))
+	}
+
+	for name, value := range raw {
+		config, err := NewClientConfig(name)
+		if err != nil {
+			return ErrValidationFailed.Wrap(err)
+		}
+		if err := value.unmarshal(config.Client); err != nil {
+			return ErrValidationFailed.Wrapf("unmarshal %s: %w", name, err)
+		}
+		*c = *config
+	}
+
+	return nil
+}
+
+// MarshalYAML encodes the client as a mapping with the registered name as the only key
+func (c ClientConfig) MarshalYAML() (interface{}, error) {
+	return map[string]Client{c.Name: c.Client}, nil
+}
+
+// UnmarshalJSON decodes an object with a single key that is the name of a registered protocol
+func (c *ClientConfig) UnmarshalJSON(data []byte) error {
+	raw := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return ErrValidationFailed.Wrapf("unmarshal connection: %w", err)
+	}
+	if len(raw) != 1 {
+		return ErrValidationFailed.Wrapf("exactly one connection protocol must be configured, got %d", len(raw))
+	}
+
+	for name, value := range raw {
+		config, err := NewClientConfig(name)
+		if err != nil {
+			return ErrValidationFailed.Wrap(err)
+		}
+		if err := json.Unmarshal(value, config.Client); err != nil {
+			return ErrValidationFailed.Wrapf("unmarshal %s: %w", name, err)
+		}
+		*c = *config
+	}
+
+	return nil
+}
+
+// MarshalJSON encodes the client as an object with the registered name as the only key
+func (c ClientConfig) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]Client{c.Name: c.Client}) //nolint:wrapcheck
+}
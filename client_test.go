@@ -0,0 +1,61 @@
+package rig
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+type customClient struct {
+	mockClient `yaml:"-"`
+	Target     string `yaml:"target" json:"target"`
+}
+
+func (c *customClient) Protocol() string { return "custom" }
+
+func TestRegisterClient(t *testing.T) {
+	RegisterClient("custom", func() Client { return &customClient{} })
+	require.Contains(t, RegisteredClients(), "custom")
+
+	type host struct {
+		Connection `yaml:"connection"`
+	}
+
+	var hosts []*host
+	data := []byte(`
+- connection:
+    connection:
+      custom:
+        target: foo
+- connection:
+    ssh:
+      address: 10.0.0.1
+`)
+	require.NoError(t, yaml.Unmarshal(data, &hosts))
+	require.Len(t, hosts, 2)
+
+	require.NotNil(t, hosts[0].Custom)
+	require.Equal(t, "custom", hosts[0].Custom.Name)
+	require.Equal(t, "custom", hosts[0].Protocol())
+	custom, ok := hosts[0].Custom.Client.(*customClient)
+	require.True(t, ok)
+	require.Equal(t, "foo", custom.Target)
+
+	require.Nil(t, hosts[1].Custom)
+	require.Equal(t, "10.0.0.1", hosts[1].SSH.Address)
+	require.Equal(t, "SSH", hosts[1].Protocol())
+
+	out, err := yaml.Marshal(hosts[0])
+	require.NoError(t, err)
+	require.Contains(t, string(out), "custom:\n")
+	require.Contains(t, string(out), "target: foo")
+
+	require.Error(t, yaml.Unmarshal([]byte("connection:\n  connection:\n    unknown: {}\n"), &host{}))
+
+	var fromJSON Connection
+	require.NoError(t, json.Unmarshal([]byte(`{"connection": {"custom": {"target": "bar"}}}`), &fromJSON))
+	require.Equal(t, "custom", fromJSON.Custom.Name)
+	require.Equal(t, "bar", fromJSON.Custom.Client.(*customClient).Target)
+}
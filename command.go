@@ -0,0 +1,224 @@
+package rig
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/alessio/shellescape"
+	"github.com/k0sproject/rig/exec"
+	"github.com/k0sproject/rig/pkg/shellfmt"
+	ps "github.com/k0sproject/rig/powershell"
+)
+
+var envNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// envCommand prefixes cmd with assignments of the environment variables in env. On unix hosts the
+// command is run in sh with the assignments in front, as in FOO='bar' sh -c 'cmd', so that they apply
+// to the whole command line. The assignments are understood by the sudo wrapping. On windows the
+// variables are set in cmd.exe using set FOO=bar&& cmd.
+func envCommand(cmd string, env map[string]string, windows bool) (string, error) {
+	if len(env) == 0 {
+		return cmd, nil
+	}
+
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		if !envNameRe.MatchString(k) {
+			return "", ErrValidationFailed.Wrapf("invalid environment variable name %q", k)
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	for _, k := range keys {
+		v := env[k]
+		if !windows {
+			sb.WriteString(k + "=" + shellescape.Quote(v) + " ")
+			continue
+		}
+		if strings.ContainsAny(v, "\r\n") {
+			return "", ErrValidationFailed.Wrapf("environment variable %s: line breaks are not supported on windows", k)
+		}
+		// no space before && or it would end up in the value
+		sb.WriteString("set " + k + "=" + shellfmt.Cmd(v) + "&& ")
+	}
+	if !windows {
+		sb.WriteString("sh -c " + shellescape.Quote(cmd))
+		return sb.String(), nil
+	}
+	sb.WriteString(cmd)
+
+	return sb.String(), nil
+}
+
+// cwdCommand prefixes cmd with a change to the directory dir
+func cwdCommand(cmd, dir string, windows bool) string {
+	if windows {
+		return "cd /d " + shellfmt.Cmd(strings.ReplaceAll(dir, "/", `\`)) + "&& " + cmd
+	}
+	return "cd -- " + shellescape.Quote(dir) + " && " + cmd
+}
+
+// shellCommand wraps cmd for running it in the named shell, see exec.Shell
+func shellCommand(cmd, shell string) (string, error) {
+	switch shell {
+	case "", exec.ShellNone:
+		return cmd, nil
+	case exec.ShellSh, exec.ShellBash:
+		return shell + " -c " + shellescape.Quote(cmd), nil
+	case exec.ShellPowerShell:
+		return ps.Cmd(cmd), nil
+	case exec.ShellPwsh:
+		return "pwsh -NonInteractive -NoProfile -EncodedCommand " + ps.EncodeCmd(cmd), nil
+	case exec.ShellCmd:
+		// with /s the outer quotes are removed and the rest is taken as is
+		return `cmd.exe /s /c "` + cmd + `"`, nil
+	default:
+		return "", ErrValidationFailed.Wrapf("unknown shell %q", shell)
+	}
+}
+
+// shellDefaulter is implemented by the clients that have a default shell of their own, used when
+// neither the exec options nor the connection set one
+type shellDefaulter interface {
+	defaultShell() string
+}
+
+// defaultShell returns the shell set for the connection or the client, if any
+func (c Connection) defaultShell() string {
+	if c.Shell != "" {
+		return c.Shell
+	}
+	if d, ok := c.client.(shellDefaulter); ok {
+		return d.defaultShell()
+	}
+	return ""
+}
+
+// checkShell returns an error when the default shell can't run the commands written for the operating
+// system of the host, see Connection.Shell
+func (c Connection) checkShell() error {
+	shell := c.defaultShell()
+	switch shell {
+	case "", exec.ShellNone:
+		return nil
+	case exec.ShellSh, exec.ShellBash:
+		if !c.IsWindows() {
+			return nil
+		}
+	case exec.ShellCmd:
+		if c.IsWindows() {
+			return nil
+		}
+	}
+	return ErrValidationFailed.Wrapf("%s can't be used as the default shell on this host, use exec.Shell for single commands", shell)
+}
+
+// command asks for the approval of the command when a confirm function is set, wraps cmd in the shell
+// and applies the environment variables of the connection and the exec options, the user and the
+// working directory from the exec options.
+// With a working directory and sudo, the command is elevated here so that the elevation applies to the
+// command instead of the directory change, and sudo is turned off in the returned options.
+func (c Connection) command(cmd string, opts []exec.Option) (string, []exec.Option, error) {
+	if len(c.env) > 0 {
+		// prepended so that the variables given in the options take precedence
+		opts = append([]exec.Option{exec.Env(c.env)}, opts...)
+	}
+	if c.Log != nil {
+		// prepended so that a logger given in the options takes precedence
+		opts = append([]exec.Option{exec.Logger(c.Logger())}, opts...)
+	}
+	opts = withCorrelationID(opts)
+	if c.redactor != nil {
+		opts = append(opts[:len(opts):len(opts)], exec.RedactWith(c.redactor))
+	}
+	if c.elevatePassword != "" {
+		opts = append(opts[:len(opts):len(opts)], exec.RedactString(shellescape.Quote(c.elevatePassword), c.elevatePassword))
+	}
+	execOpts := exec.Build(opts...)
+	if err := execOpts.Confirmed(cmd); err != nil {
+		return "", nil, err //nolint:wrapcheck
+	}
+	windows := c.IsWindows()
+	shell := execOpts.Shell
+	if shell == "" && !execOpts.Internal {
+		// the probes are run before the operating system of the host is known, see checkShell
+		shell = c.defaultShell()
+	}
+	cmd, err := shellCommand(cmd, shell)
+	if err != nil {
+		return "", nil, err
+	}
+	cmd, err = envCommand(cmd, execOpts.Env, windows)
+	if err != nil {
+		return "", nil, err
+	}
+
+	switch {
+	case execOpts.RunAs != "":
+		cmd, err = c.SudoAs(execOpts.RunAs, cmd)
+		if err != nil {
+			return "", nil, err
+		}
+		opts = withoutSudo(opts)
+	case execOpts.Sudo && execOpts.Cwd != "":
+		cmd, err = execOpts.Command(cmd)
+		if err != nil {
+			return "", nil, ErrCommandFailed.Wrapf("build command: %w", err)
+		}
+		opts = withoutSudo(opts)
+	}
+
+	if execOpts.Cwd == "" {
+		return cmd, opts, nil
+	}
+	return cwdCommand(cmd, execOpts.Cwd, windows), opts, nil
+}
+
+// withoutSudo returns a copy of opts with sudo turned off
+func withoutSudo(opts []exec.Option) []exec.Option {
+	return append(opts[:len(opts):len(opts)], func(o *exec.Options) { o.Sudo = false })
+}
+
+// argsCommand builds a command line from argv that runs the program argv[0] with the arguments as is,
+// without the shell interpreting any of them. On windows the program is started using PowerShell, see
+// argsScript.
+func argsCommand(argv []string, windows bool) (string, error) {
+	if len(argv) == 0 || argv[0] == "" {
+		return "", ErrValidationFailed.Wrapf("empty command")
+	}
+	if !windows {
+		return shellescape.QuoteCommand(argv), nil
+	}
+	return ps.Cmd(argsScript(argv)), nil
+}
+
+// argsScript returns a PowerShell script that starts the program argv[0] with a command line built from
+// the arguments using shellfmt.WindowsArg. The process is started through [Diagnostics.Process] because
+// the native command invocation of PowerShell drops empty arguments and mangles quotes in them.
+func argsScript(argv []string) string {
+	args := make([]string, len(argv)-1)
+	for i, arg := range argv[1:] {
+		args[i] = shellfmt.WindowsArg(arg)
+	}
+	return fmt.Sprintf(`$p = New-Object System.Diagnostics.Process
+$p.StartInfo.FileName = %s
+$p.StartInfo.Arguments = %s
+$p.StartInfo.UseShellExecute = $false
+[void]$p.Start()
+$p.WaitForExit()
+exit $p.ExitCode`, ps.SingleQuote(argv[0]), ps.SingleQuote(strings.Join(args, " ")))
+}
+
+// ExecArgs runs the program argv[0] with the arguments argv[1:] on the host. Each argument is quoted
+// for the host so that it reaches the program as is, which makes it safe to pass untrusted values.
+func (c Connection) ExecArgs(argv []string, opts ...exec.Option) error {
+	cmd, err := argsCommand(argv, c.IsWindows())
+	if err != nil {
+		return err
+	}
+	return c.Exec(cmd, opts...)
+}
@@ -0,0 +1,164 @@
+package rig
+
+import (
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+
+	rigexec "github.com/k0sproject/rig/exec"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvCommand(t *testing.T) {
+	cmd, err := envCommand("cmd", nil, false)
+	require.NoError(t, err)
+	require.Equal(t, "cmd", cmd)
+
+	cmd, err = envCommand("cmd", map[string]string{"B": "it's", "A": "a b"}, false)
+	require.NoError(t, err)
+	require.Equal(t, `A='a b' B='it'"'"'s' sh -c cmd`, cmd)
+
+	cmd, err = envCommand("cmd", map[string]string{"B": "x & y", "A": "100%"}, true)
+	require.NoError(t, err)
+	require.Equal(t, `set A=100^%&& set B=x ^& y&& cmd`, cmd)
+
+	_, err = envCommand("cmd", map[string]string{"1A": "x"}, false)
+	require.ErrorIs(t, err, ErrValidationFailed)
+
+	_, err = envCommand("cmd", map[string]string{"A": "x\ny"}, true)
+	require.ErrorIs(t, err, ErrValidationFailed)
+}
+
+func TestEnvCommandShell(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a posix shell")
+	}
+	value := "it's $(id) `id` \"a\" \\ b\nc"
+	cmd, err := envCommand(`printenv FOO`, map[string]string{"FOO": value}, false)
+	require.NoError(t, err)
+	out, err := exec.Command("sh", "-c", cmd).Output()
+	require.NoError(t, err)
+	require.Equal(t, value+"\n", string(out))
+
+	// all of the programs of a compound command get the variables
+	cmd, err = envCommand(`printenv FOO && printenv FOO | cat; echo "$FOO"`, map[string]string{"FOO": "x"}, false)
+	require.NoError(t, err)
+	out, err = exec.Command("sh", "-c", cmd).Output()
+	require.NoError(t, err)
+	require.Equal(t, "x\nx\nx\n", string(out))
+}
+
+func TestCwdCommand(t *testing.T) {
+	require.Equal(t, `cd -- '/tmp/a b' && ls`, cwdCommand("ls", "/tmp/a b", false))
+	require.Equal(t, `cd /d C:\Program Files ^(x86^)&& dir`, cwdCommand("dir", "C:/Program Files (x86)", true))
+}
+
+func TestShellCommand(t *testing.T) {
+	cmd, err := shellCommand("echo $HOME", "")
+	require.NoError(t, err)
+	require.Equal(t, "echo $HOME", cmd)
+
+	cmd, err = shellCommand("echo $HOME", "none")
+	require.NoError(t, err)
+	require.Equal(t, "echo $HOME", cmd)
+
+	cmd, err = shellCommand("echo $HOME", "bash")
+	require.NoError(t, err)
+	require.Equal(t, `bash -c 'echo $HOME'`, cmd)
+
+	cmd, err = shellCommand(`echo "a" & dir`, "cmd")
+	require.NoError(t, err)
+	require.Equal(t, `cmd.exe /s /c "echo "a" & dir"`, cmd)
+
+	cmd, err = shellCommand("Get-Date", "pwsh")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(cmd, "pwsh -NonInteractive -NoProfile -EncodedCommand "))
+
+	_, err = shellCommand("echo", "fish")
+	require.ErrorIs(t, err, ErrValidationFailed)
+}
+
+func TestArgsCommand(t *testing.T) {
+	cmd, err := argsCommand([]string{"echo", "it's", "$(id)", "a b"}, false)
+	require.NoError(t, err)
+	require.Equal(t, `echo 'it'"'"'s' '$(id)' 'a b'`, cmd)
+
+	_, err = argsCommand(nil, false)
+	require.ErrorIs(t, err, ErrValidationFailed)
+
+	script := argsScript([]string{`C:\Program Files\app.exe`, `say "hi"`, `C:\dir\`, "", "it's"})
+	require.Contains(t, script, `$p.StartInfo.FileName = 'C:\Program Files\app.exe'`)
+	require.Contains(t, script, `$p.StartInfo.Arguments = '"say \"hi\"" "C:\dir\\" "" "it''s"'`)
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	argv := []string{"printf", "%s|", "it's", "$(id)", "`id`", "a\nb", ""}
+	cmd, err = argsCommand(argv, false)
+	require.NoError(t, err)
+	out, err := exec.Command("sh", "-c", cmd).Output()
+	require.NoError(t, err)
+	require.Equal(t, "it's|$(id)|`id`|a\nb||", string(out))
+}
+
+func TestSetEnv(t *testing.T) {
+	mc := &mockClient{}
+	c := &Connection{client: mc}
+	c.SetEnv(map[string]string{"LC_ALL": "C", "FOO": "conn"})
+	require.NoError(t, c.Exec("cmd"))
+	require.NoError(t, c.Exec("cmd", rigexec.Env(map[string]string{"FOO": "opt"})))
+	require.Equal(t, []string{"FOO=conn LC_ALL=C sh -c cmd", "FOO=opt LC_ALL=C sh -c cmd"}, mc.commands)
+	require.Equal(t, map[string]string{"LC_ALL": "C", "FOO": "conn"}, c.Env())
+}
+
+func TestLocalhostShell(t *testing.T) {
+	c := &Connection{client: &Localhost{Enabled: true, Shell: "sh"}}
+	cmd, _, err := c.command("echo $HOME", nil)
+	require.NoError(t, err)
+	require.Equal(t, `sh -c 'echo $HOME'`, cmd)
+
+	cmd, _, err = c.command("echo $HOME", []rigexec.Option{rigexec.Shell("none")})
+	require.NoError(t, err)
+	require.Equal(t, "echo $HOME", cmd)
+
+	c.Shell = "bash"
+	cmd, _, err = c.command("echo $HOME", nil)
+	require.NoError(t, err)
+	require.Equal(t, `bash -c 'echo $HOME'`, cmd)
+
+	cmd, _, err = c.command("uname", []rigexec.Option{rigexec.Internal()})
+	require.NoError(t, err)
+	require.Equal(t, "uname", cmd)
+}
+
+func TestCheckShell(t *testing.T) {
+	unix := &Connection{client: &mockClient{}}
+	windows := &Connection{client: &mockClient{windows: true}}
+	for _, shell := range []string{"", "none", "sh", "bash"} {
+		unix.Shell = shell
+		require.NoError(t, unix.checkShell(), shell)
+	}
+	for _, shell := range []string{"powershell", "pwsh", "cmd"} {
+		unix.Shell = shell
+		require.ErrorIs(t, unix.checkShell(), ErrValidationFailed, shell)
+	}
+	windows.Shell = "cmd"
+	require.NoError(t, windows.checkShell())
+	for _, shell := range []string{"powershell", "pwsh", "bash"} {
+		windows.Shell = shell
+		require.ErrorIs(t, windows.checkShell(), ErrValidationFailed, shell)
+	}
+}
+
+func TestEnvCompoundSudo(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a posix shell")
+	}
+	installFakeSudo(t, "")
+	c := elevatedLocalhost(t, elevation{name: ElevateSudo, sudo: sudoSudo, runAs: runAsSudo})
+
+	out, err := c.ExecOutput(`printenv FOO && echo "$FOO"`, rigexec.Env(map[string]string{"FOO": "it's"}), rigexec.Sudo(c))
+	require.NoError(t, err)
+	require.Equal(t, "it's\nit's", out)
+}
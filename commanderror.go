@@ -0,0 +1,110 @@
+package rig
+
+import (
+	"io"
+	"sync"
+
+	"github.com/k0sproject/rig/exec"
+)
+
+// defaultErrorOutputBytes is the amount of output kept for CommandError when exec.ErrorOutputBytes
+// is not given
+const defaultErrorOutputBytes = 4096
+
+// CommandError is in the chain of the error returned when a command run using Exec or ExecOutput
+// fails and carries the end of the output of the command, so that the failure can be diagnosed
+// without running the command again with the output logged:
+//
+//	var cmdErr *rig.CommandError
+//	if errors.As(err, &cmdErr) {
+//	  fmt.Println(cmdErr.Output)
+//	}
+type CommandError struct {
+	// Command is the command that was run, with the redactions applied
+	Command string
+	// Output is the end of the output of the command, the lines written to stdout and stderr in the
+	// order they arrived, with the redactions applied. The amount is set using
+	// exec.ErrorOutputBytes.
+	Output string
+	// Err is the error the command failed with
+	Err error
+}
+
+// Error returns the error the command failed with
+func (e *CommandError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the error the command failed with
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// outputRing keeps the most recent output of a command
+type outputRing struct {
+	mu   sync.Mutex
+	size int
+	buf  []byte
+}
+
+// newOutputRing returns a ring for the output limit in the options, nil when it is turned off
+func newOutputRing(execOpts *exec.Options) *outputRing {
+	size := execOpts.ErrorOutput
+	if size < 0 {
+		return nil
+	}
+	if size == 0 {
+		size = defaultErrorOutputBytes
+	}
+	return &outputRing{size: size}
+}
+
+// Write appends p to the ring, dropping the oldest output when it is full
+func (r *outputRing) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.buf = append(r.buf, p...)
+	// trimming only when the buffer has doubled keeps the copying linear
+	if len(r.buf) > 2*r.size {
+		r.buf = append(r.buf[:0], r.buf[len(r.buf)-r.size:]...)
+	}
+	return len(p), nil
+}
+
+// String returns the kept output
+func (r *outputRing) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.buf) > r.size {
+		return string(r.buf[len(r.buf)-r.size:])
+	}
+	return string(r.buf)
+}
+
+// option returns an exec option that copies the output of the command into the ring, in addition
+// to where it is otherwise going
+func (r *outputRing) option() exec.Option {
+	return func(o *exec.Options) {
+		if o.Writer != nil {
+			o.Writer = io.MultiWriter(o.Writer, r)
+		}
+		if o.ErrWriter != nil {
+			o.ErrWriter = io.MultiWriter(o.ErrWriter, r)
+		}
+		onLine := o.OutputLineFunc
+		o.OutputLineFunc = func(line string, isStderr bool) {
+			_, _ = r.Write([]byte(line + "\n"))
+			if onLine != nil {
+				onLine(line, isStderr)
+			}
+		}
+	}
+}
+
+// commandError returns a CommandError for the command that failed with err
+func (r *outputRing) commandError(cmd string, execOpts *exec.Options, err error) error {
+	if r == nil {
+		return err
+	}
+	return &CommandError{Command: execOpts.Redact(cmd), Output: execOpts.Redact(r.String()), Err: err}
+}
@@ -0,0 +1,256 @@
+package rig
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/alessio/shellescape"
+	"github.com/k0sproject/rig/exec"
+	ps "github.com/k0sproject/rig/powershell"
+)
+
+// CompressionGzip is the name of the gzip compression algorithm for exec.Compress
+const CompressionGzip = "gzip"
+
+// checkCompression returns an error if the compression algorithm is not supported
+func checkCompression(algorithm string) error {
+	if algorithm != CompressionGzip {
+		return ErrNotSupported.Wrapf("compression algorithm %q", algorithm)
+	}
+	return nil
+}
+
+// uploadCompressed uploads a file by streaming it compressed to the remote host where it is
+// decompressed while writing. On windows the compressed file is uploaded to a temporary location
+// and decompressed using powershell.
+func (c *Connection) uploadCompressed(src, dst string, opts ...exec.Option) error {
+	o := exec.Build(opts...)
+	if err := checkCompression(o.Compression); err != nil {
+		return ErrUploadFailed.Wrap(err)
+	}
+
+	local, err := os.Open(src)
+	if err != nil {
+		return ErrInvalidPath.Wrap(err)
+	}
+	defer local.Close()
+
+	stat, err := local.Stat()
+	if err != nil {
+		return ErrInvalidPath.Wrapf("stat local file %s: %w", src, err)
+	}
+
+	shasum, err := newChecksum(opts...)
+	if err != nil {
+		return ErrUploadFailed.Wrap(err)
+	}
+	content := io.TeeReader(local, io.MultiWriter(hashWriter(shasum), exec.ProgressWriter(o.Progress, stat.Size())))
+
+	if c.IsWindows() {
+		err = c.uploadCompressedWindows(content, dst, opts...)
+	} else {
+		err = c.uploadCompressedUnix(content, dst, stat.Mode().Perm(), opts...)
+	}
+	if err != nil {
+		return ErrUploadFailed.Wrap(err)
+	}
+
+	if err := c.verifyChecksum(dst, shasum, opts...); err != nil {
+		return ErrUploadFailed.Wrap(err)
+	}
+
+	return nil
+}
+
+func (c *Connection) uploadCompressedUnix(content io.Reader, dst string, perm os.FileMode, opts ...exec.Option) error {
+	reader, writer := io.Pipe()
+	go func() {
+		gz := gzip.NewWriter(writer)
+		_, err := io.Copy(gz, content)
+		if err == nil {
+			err = gz.Close()
+		}
+		writer.CloseWithError(err)
+	}()
+
+	quoted := shellescape.Quote(dst)
+	cmd := fmt.Sprintf("sh -c %s", shellescape.Quote(fmt.Sprintf("gzip -dc > %s && chmod %04o %s", quoted, perm, quoted)))
+	errbuf := bytes.NewBuffer(nil)
+	waiter, err := c.ExecStreams(cmd, reader, io.Discard, errbuf, opts...)
+	if err != nil {
+		_ = reader.Close()
+		return ErrCommandFailed.Wrapf("start gzip: %w", err)
+	}
+	if err := waiter.Wait(); err != nil {
+		_ = reader.Close()
+		return ErrCommandFailed.Wrapf("gzip: %w (%s)", err, strings.TrimSpace(errbuf.String()))
+	}
+	return nil
+}
+
+// gzipStreamScript returns a powershell script that copies src to dst through a GZipStream
+func gzipStreamScript(src, dst string, compress bool) string {
+	if compress {
+		return fmt.Sprintf(`$in = [System.IO.File]::OpenRead(%s); $out = [System.IO.File]::Create(%s); $gz = New-Object System.IO.Compression.GZipStream($out, [System.IO.Compression.CompressionMode]::Compress); $in.CopyTo($gz); $gz.Close(); $in.Close()`, ps.SingleQuote(src), ps.SingleQuote(dst))
+	}
+	return fmt.Sprintf(`$in = [System.IO.File]::OpenRead(%s); $out = [System.IO.File]::Create(%s); $gz = New-Object System.IO.Compression.GZipStream($in, [System.IO.Compression.CompressionMode]::Decompress); $gz.CopyTo($out); $gz.Close(); $out.Close()`, ps.SingleQuote(src), ps.SingleQuote(dst))
+}
+
+func (c *Connection) uploadCompressedWindows(content io.Reader, dst string, opts ...exec.Option) error {
+	local, err := os.CreateTemp("", "rig-*.gz")
+	if err != nil {
+		return ErrOS.Wrapf("create temporary file: %w", err)
+	}
+	defer os.Remove(local.Name())
+
+	gz := gzip.NewWriter(local)
+	if _, err := io.Copy(gz, content); err != nil {
+		_ = local.Close()
+		return ErrOS.Wrapf("compress: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		_ = local.Close()
+		return ErrOS.Wrapf("compress: %w", err)
+	}
+	if err := local.Close(); err != nil {
+		return ErrOS.Wrapf("close temporary file: %w", err)
+	}
+
+	remote, err := c.windowsTempFile(".gz")
+	if err != nil {
+		return err
+	}
+	defer c.deleteTemp(remote, opts...)
+
+	// the temporary file is transferred without compression and progress reporting
+	if err := c.Upload(local.Name(), remote, append(opts, exec.Compress(""), exec.WithProgress(nil))...); err != nil {
+		return err
+	}
+
+	if err := c.Exec(ps.Cmd(gzipStreamScript(remote, dst, false)), opts...); err != nil {
+		return ErrCommandFailed.Wrapf("decompress: %w", err)
+	}
+	return nil
+}
+
+// downloadCompressed downloads a file by compressing it on the remote host and decompressing it
+// locally while writing. See uploadCompressed.
+func (c *Connection) downloadCompressed(src, dst string, opts ...exec.Option) error {
+	o := exec.Build(opts...)
+	if err := checkCompression(o.Compression); err != nil {
+		return ErrDownloadFailed.Wrap(err)
+	}
+
+	stat, err := c.fsysFor(opts...).Stat(src)
+	if err != nil {
+		return ErrInvalidPath.Wrapf("stat remote file %s: %w", src, err)
+	}
+	if stat.IsDir() {
+		return ErrInvalidPath.Wrapf("%s is a directory", src)
+	}
+
+	local, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, stat.Mode().Perm())
+	if err != nil {
+		return ErrInvalidPath.Wrapf("open local file for writing: %w", err)
+	}
+	defer local.Close()
+
+	shasum, err := newChecksum(opts...)
+	if err != nil {
+		return ErrDownloadFailed.Wrap(err)
+	}
+	content := io.MultiWriter(local, hashWriter(shasum), exec.ProgressWriter(o.Progress, stat.Size()))
+
+	if c.IsWindows() {
+		err = c.downloadCompressedWindows(src, content, opts...)
+	} else {
+		err = c.downloadCompressedUnix(src, content, opts...)
+	}
+	if err != nil {
+		return ErrDownloadFailed.Wrap(err)
+	}
+
+	if err := local.Close(); err != nil {
+		return ErrDownloadFailed.Wrapf("close local file: %w", err)
+	}
+
+	if err := c.verifyChecksum(src, shasum, opts...); err != nil {
+		return ErrDownloadFailed.Wrap(err)
+	}
+
+	return nil
+}
+
+// gunzip decompresses a gzip stream from r into w
+func gunzip(w io.Writer, r io.Reader) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return ErrOS.Wrapf("decompress: %w", err)
+	}
+	if _, err := io.Copy(w, gz); err != nil { //nolint:gosec // the size is limited by the remote file
+		return ErrOS.Wrapf("decompress: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return ErrOS.Wrapf("decompress: %w", err)
+	}
+	return nil
+}
+
+func (c *Connection) downloadCompressedUnix(src string, content io.Writer, opts ...exec.Option) error {
+	reader, writer := io.Pipe()
+	extracted := make(chan error, 1)
+	go func() {
+		err := gunzip(content, reader)
+		_, _ = io.Copy(io.Discard, reader)
+		extracted <- err
+	}()
+
+	errbuf := bytes.NewBuffer(nil)
+	waiter, err := c.ExecStreams("gzip -c -- "+shellescape.Quote(src), nil, writer, errbuf, opts...)
+	if err != nil {
+		_ = writer.Close()
+		return ErrCommandFailed.Wrapf("start gzip: %w", err)
+	}
+	err = waiter.Wait()
+	_ = writer.Close()
+	extractErr := <-extracted
+	if err != nil {
+		return ErrCommandFailed.Wrapf("gzip: %w (%s)", err, strings.TrimSpace(errbuf.String()))
+	}
+	return extractErr
+}
+
+func (c *Connection) downloadCompressedWindows(src string, content io.Writer, opts ...exec.Option) error {
+	remote, err := c.windowsTempFile(".gz")
+	if err != nil {
+		return err
+	}
+	defer c.deleteTemp(remote, opts...)
+
+	if err := c.Exec(ps.Cmd(gzipStreamScript(src, remote, true)), opts...); err != nil {
+		return ErrCommandFailed.Wrapf("compress: %w", err)
+	}
+
+	local, err := os.CreateTemp("", "rig-*.gz")
+	if err != nil {
+		return ErrOS.Wrapf("create temporary file: %w", err)
+	}
+	_ = local.Close()
+	defer os.Remove(local.Name())
+
+	if err := c.Download(remote, local.Name(), append(opts, exec.Compress(""), exec.WithProgress(nil))...); err != nil {
+		return err
+	}
+
+	f, err := os.Open(local.Name())
+	if err != nil {
+		return ErrOS.Wrap(err)
+	}
+	defer f.Close()
+
+	return gunzip(content, f)
+}
@@ -0,0 +1,247 @@
+package rig_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	osexec "os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/creasty/defaults"
+	"github.com/k0sproject/rig"
+	"github.com/k0sproject/rig/exec"
+	"github.com/k0sproject/rig/pkg/ssh/sshtest"
+	"github.com/stretchr/testify/require"
+)
+
+// shellHandler runs the commands received by the test ssh server using the local sh
+func shellHandler(req *sshtest.Request) int {
+	cmd := osexec.Command("sh", "-c", req.Command)
+	cmd.Stdin = req.Stdin
+	cmd.Stdout = req.Stdout
+	cmd.Stderr = req.Stderr
+	var exitErr *osexec.ExitError
+	if err := cmd.Run(); errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	} else if err != nil {
+		return 127
+	}
+	return 0
+}
+
+// conformanceClients returns a connection for each of the clients that can be tested locally
+func conformanceClients(t *testing.T) map[string]*rig.Connection {
+	t.Helper()
+	server, err := sshtest.NewServer(sshtest.WithDefaultHandler(shellHandler))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = server.Close() })
+
+	keyPath := filepath.Join(t.TempDir(), "id_ed25519")
+	_, err = sshtest.GenerateKeyFile(keyPath)
+	require.NoError(t, err)
+
+	conns := map[string]*rig.Connection{
+		"localhost": {Localhost: &rig.Localhost{Enabled: true}},
+		"ssh": {SSH: &rig.SSH{
+			Address: server.Host(),
+			Port:    server.Port(),
+			User:    "test",
+			KeyPath: &keyPath,
+			HostKey: server.HostKeyString(),
+		}},
+	}
+	for name, conn := range conns {
+		require.NoError(t, defaults.Set(conn), name)
+		require.NoError(t, conn.Connect(), name)
+		conn := conn
+		t.Cleanup(func() { _ = conn.Disconnect() })
+	}
+	return conns
+}
+
+// TestClientConformance runs the same commands using each of the clients to make sure the options
+// behave the same regardless of the protocol
+func TestClientConformance(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the commands are for sh")
+	}
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+
+	for name, conn := range conformanceClients(t) {
+		conn := conn
+		t.Run(name, func(t *testing.T) {
+			t.Run("output", func(t *testing.T) {
+				out, err := conn.ExecOutput("echo hello")
+				require.NoError(t, err)
+				require.Equal(t, "hello", out)
+			})
+
+			t.Run("stderr", func(t *testing.T) {
+				// without stdin the ssh client requests a pty, which merges stderr into stdout
+				var stdout, stderr bytes.Buffer
+				require.NoError(t, conn.Exec("echo out; echo err >&2", exec.StdinReader(strings.NewReader("")), exec.StdoutWriter(&stdout), exec.StderrWriter(&stderr)))
+				require.Equal(t, "out\n", stdout.String())
+				require.Equal(t, "err\n", stderr.String())
+			})
+
+			t.Run("exit code", func(t *testing.T) {
+				code, ok := exec.ExitCode(conn.Exec("exit 3"))
+				require.True(t, ok)
+				require.Equal(t, 3, code)
+			})
+
+			t.Run("env", func(t *testing.T) {
+				out, err := conn.ExecOutput("printenv RIG_TEST", exec.Env(map[string]string{"RIG_TEST": "a b"}))
+				require.NoError(t, err)
+				require.Equal(t, "a b", out)
+			})
+
+			t.Run("cwd", func(t *testing.T) {
+				out, err := conn.ExecOutput("pwd", exec.Cwd(dir))
+				require.NoError(t, err)
+				require.Equal(t, dir, out)
+			})
+
+			t.Run("stdin", func(t *testing.T) {
+				out, err := conn.ExecOutput("tr a-z A-Z", exec.StdinReader(strings.NewReader("hello")))
+				require.NoError(t, err)
+				require.Equal(t, "HELLO", out)
+			})
+
+			t.Run("streams", func(t *testing.T) {
+				var stdout bytes.Buffer
+				waiter, err := conn.ExecStreams("tr a-z A-Z", io.NopCloser(strings.NewReader("hello")), &stdout, io.Discard)
+				require.NoError(t, err)
+				require.NoError(t, waiter.Wait())
+				require.Equal(t, "HELLO", stdout.String())
+			})
+
+			t.Run("timeout", func(t *testing.T) {
+				start := time.Now()
+				err := conn.Exec("sleep 10; true", exec.Timeout(200*time.Millisecond))
+				require.ErrorIs(t, err, rig.ErrTimeout)
+				require.Less(t, time.Since(start), 5*time.Second)
+			})
+		})
+	}
+}
+
+// zeroReader produces size zero bytes without holding them in memory
+type zeroReader struct {
+	size int64
+}
+
+func (r *zeroReader) Read(p []byte) (int, error) {
+	if r.size <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.size {
+		p = p[:r.size]
+	}
+	for i := range p {
+		p[i] = 0
+	}
+	r.size -= int64(len(p))
+	return len(p), nil
+}
+
+func TestStdinReader(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the commands are for sh")
+	}
+	for name, conn := range conformanceClients(t) {
+		conn := conn
+		t.Run(name, func(t *testing.T) {
+			const size = 64 << 20
+			out, err := conn.ExecOutput("wc -c", exec.StdinReader(&zeroReader{size: size}))
+			require.NoError(t, err)
+			require.Equal(t, "67108864", strings.TrimSpace(out))
+
+			out, err = conn.ExecOutput("cat", exec.Stdin("string"), exec.StdinReader(strings.NewReader("reader")))
+			require.NoError(t, err)
+			require.Equal(t, "reader", out, "StdinReader takes precedence over Stdin")
+		})
+	}
+}
+
+func TestOutputStreams(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the commands are for sh")
+	}
+	// without stdin the ssh client requests a pty, which merges stderr into stdout
+	noStdin := exec.StdinReader(strings.NewReader(""))
+	cmd := "echo a; sleep 0.1; echo b >&2; sleep 0.1; echo c"
+	for name, conn := range conformanceClients(t) {
+		conn := conn
+		t.Run(name, func(t *testing.T) {
+			out, err := conn.ExecOutput(cmd, noStdin)
+			require.NoError(t, err)
+			require.Equal(t, "a\nc", out)
+
+			out, err = conn.ExecOutput(cmd, noStdin, exec.OutputStderr())
+			require.NoError(t, err)
+			require.Equal(t, "a\nb\nc", out, "the lines of both streams are in the order they arrived")
+
+			var output string
+			var stderr bytes.Buffer
+			require.NoError(t, conn.Exec(cmd, noStdin, exec.Output(&output), exec.StderrWriter(&stderr)))
+			require.Equal(t, "a\nc\n", output)
+			require.Equal(t, "b\n", stderr.String())
+
+			var stdout bytes.Buffer
+			stderr.Reset()
+			require.NoError(t, conn.Exec(cmd, noStdin, exec.StdoutWriter(&stdout), exec.StderrWriter(&stderr)))
+			require.Equal(t, "a\nc\n", stdout.String())
+			require.Equal(t, "b\n", stderr.String())
+		})
+	}
+}
+
+func TestOnOutputLine(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the commands are for sh")
+	}
+	for name, conn := range conformanceClients(t) {
+		conn := conn
+		t.Run(name, func(t *testing.T) {
+			// the command waits for input that is only given once the first line has been seen
+			stdinR, stdinW := io.Pipe()
+			type line struct {
+				text     string
+				isStderr bool
+			}
+			var lines []line
+			done := make(chan error, 1)
+			go func() {
+				done <- conn.Exec("echo ready; read x; echo got $x >&2", exec.StdinReader(stdinR), exec.OnOutputLine(func(text string, isStderr bool) {
+					lines = append(lines, line{text, isStderr})
+					if text == "ready" {
+						_, _ = stdinW.Write([]byte("input\n"))
+						_ = stdinW.Close()
+					}
+				}))
+			}()
+			select {
+			case err := <-done:
+				require.NoError(t, err)
+			case <-time.After(10 * time.Second):
+				_ = stdinW.Close()
+				t.Fatal("the line was not passed to the callback while the command was running")
+			}
+			require.Equal(t, []line{{"ready", false}, {"got input", true}}, lines)
+
+			lines = nil
+			var stdout bytes.Buffer
+			require.NoError(t, conn.Exec("echo out; echo err >&2", exec.StdinReader(strings.NewReader("")), exec.StdoutWriter(&stdout), exec.OnOutputLine(func(text string, isStderr bool) {
+				lines = append(lines, line{text, isStderr})
+			})))
+			require.Equal(t, "out\n", stdout.String())
+			require.Equal(t, []line{{"err", true}}, lines, "the lines of a redirected stream are not passed")
+		})
+	}
+}
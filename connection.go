@@ -3,12 +3,14 @@
 package rig
 
 import (
-	"crypto/sha256"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/alessio/shellescape"
 	"github.com/creasty/defaults"
@@ -16,6 +18,9 @@ import (
 	"github.com/k0sproject/rig/exec"
 	"github.com/k0sproject/rig/log"
 	rigos "github.com/k0sproject/rig/os"
+	"github.com/k0sproject/rig/pkg/clock"
+	"github.com/k0sproject/rig/pkg/redact"
+	"github.com/k0sproject/rig/pkg/shellfmt"
 )
 
 var _ rigos.Host = &Connection{}
@@ -25,9 +30,11 @@ type Waiter interface {
 	Wait() error
 }
 
-type client interface {
+// Client is the interface a connection protocol implementation must satisfy. Implement it and register
+// the implementation using RegisterClient to add support for new connection types.
+type Client interface {
 	Connect() error
-	Disconnect()
+	Disconnect() error
 	IsWindows() bool
 	Exec(string, ...exec.Option) error
 	ExecStreams(string, io.ReadCloser, io.Writer, io.Writer, ...exec.Option) (Waiter, error)
@@ -40,6 +47,9 @@ type client interface {
 
 type sudofn func(string) string
 
+// runasfn formats a command to be run as another user
+type runasfn func(user, cmd string) string
+
 // Connection is a Struct you can embed into your application's "Host" types
 // to give them multi-protocol connectivity.
 //
@@ -73,16 +83,78 @@ type sudofn func(string) string
 //	  output, err := h.ExecOutput("echo hello")
 //	}
 type Connection struct {
-	WinRM     *WinRM     `yaml:"winRM,omitempty"`
-	SSH       *SSH       `yaml:"ssh,omitempty"`
-	Localhost *Localhost `yaml:"localhost,omitempty"`
-
-	OSVersion *OSVersion `yaml:"-"`
+	WinRM     *WinRM     `yaml:"winRM,omitempty" json:"winRM,omitempty" mapstructure:"winRM"`
+	SSH       *SSH       `yaml:"ssh,omitempty" json:"ssh,omitempty" mapstructure:"ssh"`
+	Localhost *Localhost `yaml:"localhost,omitempty" json:"localhost,omitempty" mapstructure:"localhost"`
+
+	// Custom holds the configuration for a connection type registered with RegisterClient
+	Custom *ClientConfig `yaml:"connection,omitempty" json:"connection,omitempty" mapstructure:"connection"`
+
+	// Shell is the default shell commands are wrapped in, such as "bash", see exec.Shell. The commands
+	// rig runs on its own, such as the ones of the file system functions and the os support modules,
+	// are written for sh and cmd.exe, so only sh or bash can be used on unix hosts and only cmd on
+	// windows hosts. Connecting fails with other shells, use exec.Shell to run single commands in
+	// PowerShell. The commands that probe the host when connecting are not wrapped in the shell.
+	Shell string `yaml:"shell,omitempty" json:"shell,omitempty" mapstructure:"shell"`
+
+	// RootPassword is called for the password of root when neither sudo nor doas is available, to
+	// elevate the privileges using su instead. The password is piped to su, builds of su that only
+	// accept it from a terminal are detected when connecting and not used.
+	RootPassword func() (string, error) `yaml:"-" json:"-" mapstructure:"-"`
+
+	// Credentials provides the passwords and key passphrases that are not in the configuration,
+	// DefaultCredentialSource is used when nil
+	Credentials CredentialSource `yaml:"-" json:"-" mapstructure:"-"`
+
+	// Elevate overrides the automatically detected privilege elevation method
+	Elevate *Elevate `yaml:"elevate,omitempty" json:"elevate,omitempty" mapstructure:"elevate"`
+
+	// Log is the logger for the messages about this connection, including the commands run and
+	// their output. The logger set using SetLogger is used when nil.
+	Log log.Logger `yaml:"-" json:"-" mapstructure:"-"`
+
+	// Audit receives a record of every command run and file transferred, see NewJSONAuditSink
+	Audit AuditSink `yaml:"-" json:"-" mapstructure:"-"`
+
+	// Tracer enables the tracing spans for connecting, running commands, transferring files and the
+	// filesystem operations. Use exec.TraceContext to set the parent span of an operation.
+	Tracer Tracer `yaml:"-" json:"-" mapstructure:"-"`
+
+	// Metrics receives the counts and durations of the connection attempts, commands and uploads
+	Metrics Metrics `yaml:"-" json:"-" mapstructure:"-"`
+
+	OSVersion *OSVersion `yaml:"-" json:"-" mapstructure:"-"`
+
+	deprecatedConnectionFields `yaml:",inline" mapstructure:",squash"`
+
+	client          Client `yaml:"-"`
+	sudofunc        sudofn
+	runasfunc       runasfn
+	elevationMethod string
+	// elevatePassword is the password used by the su or sudo elevation, redacted from the logged
+	// commands
+	elevatePassword string
+	// askpassPath is the remote helper that gives sudo the password, see sudoAskpass
+	askpassPath string
+	// redactor holds the secrets masked in the logs and errors of the connection, see RedactValue
+	redactor *redact.Redactor
 
-	client   client `yaml:"-"`
-	sudofunc sudofn
 	fsys     FS
 	sudofsys FS
+
+	transfer TransferStrategy
+	// sessionOpen is true between a successful Connect and Disconnect, for the session metrics
+	sessionOpen bool
+	// traceContext carries the span of Connect while connecting, so that the spans of the commands
+	// run to set up the connection become its children
+	traceContext context.Context
+
+	hooks connectionHooks
+	// ops tracks the running commands and background processes, see ActiveOperations
+	ops *operations
+
+	// env is set for every command, see SetEnv
+	env map[string]string
 }
 
 // File is a file on a remote host
@@ -96,7 +168,10 @@ type File interface {
 	Close() error
 }
 
-// FS is a fs.FS compatible filesystem interface for filesystems on remote hosts
+// FS is a fs.FS compatible filesystem interface for filesystems on remote hosts. It also implements
+// fs.ReadDirFS, fs.StatFS, fs.ReadFileFS, fs.GlobFS and fs.SubFS, so the helpers in the io/fs package
+// work on it directly. Unlike with fs.FS, the names can be absolute paths. Use Sub to get a filesystem
+// that only accepts the relative paths io/fs expects.
 type FS interface {
 	Open(name string) (fs.File, error)
 	OpenFile(name string, mode FileMode, perm int) (File, error)
@@ -104,15 +179,62 @@ type FS interface {
 	Sha256(name string) (string, error)
 	ReadDir(name string) ([]fs.DirEntry, error)
 	Delete(name string) error
+	DeleteMany(names []string, progress DeleteProgressFunc) error
+	Remove(name string) error
+	RemoveAll(name string) error
+	MkdirAll(name string, perm fs.FileMode) error
+	Rename(oldname, newname string) error
+	Chmod(name string, mode fs.FileMode) error
+	Chown(name, owner, group string) error
+	Chtimes(name string, atime, mtime time.Time) error
+	Symlink(oldname, newname string) error
+	Readlink(name string) (string, error)
+	Lstat(name string) (fs.FileInfo, error)
+	WalkDir(root string, fn fs.WalkDirFunc) error
+	Glob(pattern string) ([]string, error)
+	Find(root string, opts FindOptions) ([]string, error)
+	Watch(name string, interval time.Duration) (<-chan FileEvent, func())
+	Sub(dir string) (fs.FS, error)
+	Manifest(root string) (Manifest, error)
+	MkdirTemp(dir, pattern string) (string, error)
+	CreateTemp(dir, pattern string) (string, error)
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+	WriteFileAtomic(name string, data []byte, perm fs.FileMode) error
+}
+
+// loggerSetter is implemented by the clients that can log to the logger of the connection
+type loggerSetter interface {
+	SetLogger(l log.Logger)
+}
+
+// Logger returns the logger of the connection, the one set using SetLogger when Log is nil
+func (c Connection) Logger() log.Logger {
+	if c.Log != nil {
+		return log.RedactedWith(c.Log, c.redactor)
+	}
+	if c.redactor != nil {
+		return log.RedactedWith(log.Global, c.redactor)
+	}
+	return log.Global
+}
+
+// setClientLogger passes Log to the client
+func (c *Connection) setClientLogger() {
+	if ls, ok := c.client.(loggerSetter); ok && c.Log != nil {
+		ls.SetLogger(c.Logger())
+	}
 }
 
 // SetDefaults sets a connection
 func (c *Connection) SetDefaults() {
+	c.applyDeprecatedFields()
 	if c.client == nil {
 		c.client = c.configuredClient()
 		if c.client == nil {
 			c.client = defaultClient()
 		}
+		c.setClientLogger()
 		_ = defaults.Set(c.client)
 	}
 }
@@ -178,9 +300,9 @@ func (c Connection) String() string {
 func (c *Connection) Fsys() FS {
 	if c.fsys == nil {
 		if c.IsWindows() {
-			c.fsys = newWindowsFsys(c)
+			c.fsys = c.withTracing(newWindowsFsys(c))
 		} else {
-			c.fsys = newUnixFsys(c)
+			c.fsys = c.withTracing(newUnixFsys(c))
 		}
 	}
 
@@ -191,15 +313,38 @@ func (c *Connection) Fsys() FS {
 func (c *Connection) SudoFsys() FS {
 	if c.sudofsys == nil {
 		if c.IsWindows() {
-			c.sudofsys = newWindowsFsys(c, exec.Sudo(c))
+			c.sudofsys = c.withTracing(newWindowsFsys(c, exec.Sudo(c)))
 		} else {
-			c.sudofsys = newUnixFsys(c, exec.Sudo(c))
+			c.sudofsys = c.withTracing(newUnixFsys(c, exec.Sudo(c)))
 		}
 	}
 
 	return c.sudofsys
 }
 
+// ReadFile reads the named remote file and returns its contents. Pass exec.Sudo(conn) to read the
+// file with elevated privileges.
+func (c *Connection) ReadFile(name string, opts ...exec.Option) ([]byte, error) {
+	if err := c.checkConnected(); err != nil {
+		return nil, err
+	}
+	return c.fsysFor(opts...).ReadFile(name) //nolint:wrapcheck
+}
+
+// WriteFile writes data to the named remote file, creating it with the permissions perm if
+// necessary. Pass exec.Sudo(conn) to write the file with elevated privileges or exec.Atomic to
+// replace the file atomically.
+func (c *Connection) WriteFile(name string, data []byte, perm fs.FileMode, opts ...exec.Option) error {
+	if err := c.checkConnected(); err != nil {
+		return err
+	}
+	fsys := c.fsysFor(opts...)
+	if exec.Build(opts...).Atomic {
+		return fsys.WriteFileAtomic(name, data, perm) //nolint:wrapcheck
+	}
+	return fsys.WriteFile(name, data, perm) //nolint:wrapcheck
+}
+
 // IsWindows returns true on windows hosts
 func (c *Connection) IsWindows() bool {
 	if !c.IsConnected() {
@@ -216,26 +361,102 @@ func (c Connection) ExecStreams(cmd string, stdin io.ReadCloser, stdout, stderr
 	if err := c.checkConnected(); err != nil {
 		return nil, ErrNotConnected.Wrapf("exec streams")
 	}
+	opts = withCorrelationID(opts)
+	cmd, opts, err := c.command(cmd, opts)
+	if err != nil {
+		return nil, c.correlateError(opts, err)
+	}
+	opts, span := c.startExecSpan(cmd, opts)
+	start := clock.Default.Now()
+	c.execStarted(cmd, opts, start)
+	c.ops.sessionStarted()
 	waiter, err := c.client.ExecStreams(cmd, stdin, stdout, stderr, opts...)
 	if err != nil {
-		return nil, ErrCommandFailed.Wrapf("exec (with streams): %w", err)
+		c.ops.sessionDone()
+		c.execDone(cmd, opts, start, span, err)
+		return nil, c.correlateError(opts, ErrCommandFailed.Wrapf("exec (with streams): %w", err))
+	}
+	if c.ops != nil || c.Audit != nil || c.Tracer != nil || c.Metrics != nil || len(c.hooks.execEnd) > 0 {
+		waiter = &auditWaiter{Waiter: waiter, done: func(err error) {
+			c.ops.sessionDone()
+			c.execDone(cmd, opts, start, span, err)
+		}}
 	}
-	return waiter, nil
+	return &correlatedWaiter{Waiter: waiter, conn: c, opts: opts}, nil
 }
 
 // Exec runs a command on the host
 func (c Connection) Exec(cmd string, opts ...exec.Option) error {
+	opts = withCorrelationID(opts)
+	return c.correlateError(opts, c.withRetries(opts, func() error {
+		return c.exec(cmd, opts...)
+	}))
+}
+
+func (c Connection) exec(cmd string, opts ...exec.Option) error {
 	if err := c.checkConnected(); err != nil {
 		return err
 	}
 
-	if err := c.client.Exec(cmd, opts...); err != nil {
-		return ErrCommandFailed.Wrapf("client exec: %w", err)
+	cmd, opts, err := c.command(cmd, opts)
+	if err != nil {
+		return err
+	}
+
+	execOpts := exec.Build(opts...)
+	ring := newOutputRing(execOpts)
+	if ring != nil {
+		opts = append(opts[:len(opts):len(opts)], ring.option())
+	}
+
+	opts, span := c.startExecSpan(cmd, opts)
+	start := clock.Default.Now()
+	c.execStarted(cmd, opts, start)
+	c.ops.sessionStarted()
+	err = c.client.Exec(cmd, opts...)
+	c.ops.sessionDone()
+	c.execDone(cmd, opts, start, span, err)
+	if err != nil {
+		return ErrCommandFailed.Wrapf("client exec: %w", ring.commandError(cmd, execOpts, err))
 	}
 
 	return nil
 }
 
+// withRetries calls fn until it succeeds or the retries set using exec.Retries run out. A reader set
+// using exec.StdinReader is rewound before each retry, so it has to be an io.Seeker.
+func (c Connection) withRetries(opts []exec.Option, fn func() error) error {
+	execOpts := exec.Build(opts...)
+	rewind := func() error { return nil }
+	if execOpts.Retries > 0 && execOpts.StdinReader != nil {
+		seeker, ok := execOpts.StdinReader.(io.Seeker)
+		if !ok {
+			return ErrValidationFailed.Wrapf("exec.Retries can't be used with an exec.StdinReader that is not an io.Seeker")
+		}
+		start, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return ErrValidationFailed.Wrapf("exec.Retries: stdin can't be rewound: %w", err)
+		}
+		rewind = func() error {
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				return ErrCommandFailed.Wrapf("rewind stdin for retrying: %w", err)
+			}
+			return nil
+		}
+	}
+	err := fn()
+	for attempt := 1; execOpts.ShouldRetry(err, attempt); attempt++ {
+		c.loggerFor(opts).Debugf("%s: command failed, retrying (%d/%d): %v", c, attempt, execOpts.Retries, err)
+		// can't fail without a deadline
+		_ = execOpts.Backoff().Wait(context.Background(), attempt)
+		if rewindErr := rewind(); rewindErr != nil {
+			return rewindErr
+		}
+		err = fn()
+	}
+	return err
+}
+
 // ExecOutput runs a command on the host and returns the output as a String
 func (c Connection) ExecOutput(cmd string, opts ...exec.Option) (string, error) {
 	if err := c.checkConnected(); err != nil {
@@ -243,22 +464,51 @@ func (c Connection) ExecOutput(cmd string, opts ...exec.Option) (string, error)
 	}
 
 	var output string
-	opts = append(opts, exec.Output(&output))
-	err := c.Exec(cmd, opts...)
-	return strings.TrimSpace(output), err
+	opts = append(withCorrelationID(opts), exec.Output(&output))
+	err := c.withRetries(opts, func() error {
+		// only keep the output of the last attempt
+		output = ""
+		return c.exec(cmd, opts...)
+	})
+	return strings.TrimSpace(output), c.correlateError(opts, err)
 }
 
 // Connect to the host and identify the operating system and sudo capability
-func (c *Connection) Connect() error {
+func (c *Connection) Connect() (err error) {
+	spanOpts, span := c.startSpan("rig.Connect", nil)
+	c.traceContext = exec.Build(spanOpts...).TraceContext
+	defer func() {
+		c.traceContext = nil
+		span.End(err)
+		if c.Metrics != nil {
+			c.Metrics.ConnectDone(c.Protocol(), err)
+			if err == nil && !c.sessionOpen {
+				c.Metrics.SessionOpened(c.Protocol())
+			}
+		}
+		c.sessionOpen = c.sessionOpen || err == nil
+		for _, fn := range c.hooks.connect {
+			fn(c, err)
+		}
+	}()
+
+	if c.ops == nil {
+		c.ops = &operations{}
+	}
+
 	if c.client == nil {
 		if err := defaults.Set(c); err != nil {
 			return ErrValidationFailed.Wrapf("set defaults: %w", err)
 		}
 	}
 
+	c.setClientRedactor()
+	c.setClientLogger()
+	c.setClientCredentials()
+
 	if err := c.client.Connect(); err != nil {
 		c.client = nil
-		log.Debugf("%s: failed to connect: %v", c, err)
+		c.Logger().Debugf("%s: failed to connect: %v", c, err)
 		return ErrNotConnected.Wrapf("client connect: %w", err)
 	}
 
@@ -267,10 +517,21 @@ func (c *Connection) Connect() error {
 		if err != nil {
 			return err
 		}
+		if err := resolveHostDetails(c, &o); err != nil {
+			c.Logger().Debugf("%s: %v", c, err)
+		}
 		c.OSVersion = &o
 	}
 
-	c.configureSudo()
+	if err := c.checkShell(); err != nil {
+		_ = c.Disconnect()
+		return err
+	}
+
+	if err := c.configureSudo(); err != nil {
+		_ = c.Disconnect()
+		return err
+	}
 
 	return nil
 }
@@ -280,9 +541,34 @@ func sudoNoop(cmd string) string {
 }
 
 func sudoSudo(cmd string) string {
+	return sudoWith("sudo", cmd)
+}
+
+// sudoSudoPassword returns a sudofn that has sudo read the password using the askpass helper, see
+// Connection.sudoAskpass. The password is passed to the helper in the environment, so that the stdin of
+// the command is left alone.
+func sudoSudoPassword(password, askpass string) sudofn {
+	return func(cmd string) string {
+		return askpassEnv(password, askpass) + sudoWith("sudo -A -p ''", cmd)
+	}
+}
+
+// askpassEnv returns the variable assignments for running sudo with the askpass helper
+func askpassEnv(password, askpass string) string {
+	return fmt.Sprintf("RIG_ASKPASS=%s SUDO_ASKPASS=%s ", shellescape.Quote(password), shellescape.Quote(askpass))
+}
+
+// sudoDzdo elevates using Centrify dzdo, which takes the same arguments as sudo
+func sudoDzdo(cmd string) string {
+	return sudoWith("dzdo", cmd)
+}
+
+// sudoWith wraps the command using sudo or a sudo compatible program, passing the leading environment
+// variable assignments as arguments
+func sudoWith(bin, cmd string) string {
 	parts, err := shlex.Split(cmd)
 	if err != nil {
-		return "sudo -s -- " + cmd
+		return bin + " -s -- " + cmd
 	}
 
 	var idx int
@@ -295,24 +581,87 @@ func sudoSudo(cmd string) string {
 	}
 
 	if idx == 0 {
-		return "sudo -s -- " + cmd
+		return bin + " -s -- " + cmd
 	}
 
 	for i, p := range parts {
 		parts[i] = shellescape.Quote(p)
 	}
 
-	return fmt.Sprintf("sudo -s %s -- %s", strings.Join(parts[0:idx], " "), strings.Join(parts[idx:], " "))
+	return fmt.Sprintf("%s -s %s -- %s", bin, strings.Join(parts[0:idx], " "), strings.Join(parts[idx:], " "))
 }
 
 func sudoDoas(cmd string) string {
 	return "doas -s -- " + cmd
 }
 
-var sudoChecks = map[string]sudofn{
-	`[ "$(id -u)" = 0 ]`: sudoNoop,
-	"sudo -n true":       sudoSudo,
-	"doas -n true":       sudoDoas,
+// sudoSu returns a sudofn that runs commands as root using su, which reads the password from stdin.
+// The password is piped to su while the original stdin is passed on as fd 3 and restored for the
+// command, so that elevated commands can still read their input. The password prompt goes to stderr,
+// so the stderr of su is discarded and the original one is passed on as fd 4.
+func sudoSu(password string) sudofn {
+	return func(cmd string) string {
+		// printf is a shell builtin, the password does not show up in the process list
+		return fmt.Sprintf("{ printf '%%s\\n' %s | su root -c %s 4>&2 2> /dev/null; } 3<&0", shellescape.Quote(password), shellescape.Quote("exec 0<&3 3<&- 2>&4 4>&-; "+cmd))
+	}
+}
+
+func runAsSu(user, cmd string) string {
+	return fmt.Sprintf("su -s /bin/sh %s -c %s", shellescape.Quote(user), shellescape.Quote(cmd))
+}
+
+func runAsSudo(user, cmd string) string {
+	return fmt.Sprintf("sudo -n -u %s -- sh -c %s", shellescape.Quote(user), shellescape.Quote(cmd))
+}
+
+// runAsSudoPassword returns a runasfn that has sudo read the password using the askpass helper
+func runAsSudoPassword(password, askpass string) runasfn {
+	return func(user, cmd string) string {
+		return fmt.Sprintf("%ssudo -A -p '' -u %s -- sh -c %s", askpassEnv(password, askpass), shellescape.Quote(user), shellescape.Quote(cmd))
+	}
+}
+
+func runAsDoas(user, cmd string) string {
+	return fmt.Sprintf("doas -n -u %s -- sh -c %s", shellescape.Quote(user), shellescape.Quote(cmd))
+}
+
+func runAsDzdo(user, cmd string) string {
+	return fmt.Sprintf("dzdo -n -u %s -- sh -c %s", shellescape.Quote(user), shellescape.Quote(cmd))
+}
+
+// sudoPbrun elevates using BeyondTrust pbrun, which runs the command as root unless the policy says otherwise
+func sudoPbrun(cmd string) string {
+	return "pbrun sh -c " + shellescape.Quote(cmd)
+}
+
+func runAsPbrun(user, cmd string) string {
+	return fmt.Sprintf("pbrun -u %s sh -c %s", shellescape.Quote(user), shellescape.Quote(cmd))
+}
+
+// elevation is a method for running commands with the privileges of other users
+type elevation struct {
+	name  string
+	sudo  sudofn
+	runAs runasfn
+}
+
+// sudoCheck is a command that succeeds when the elevation method can be used
+type sudoCheck struct {
+	check  string
+	method elevation
+	// timeout stops a check that can block, such as one that contacts a policy server
+	timeout time.Duration
+}
+
+// sudoChecks are probed in order, the first one that succeeds is used
+var sudoChecks = []sudoCheck{
+	{check: `[ "$(id -u)" = 0 ]`, method: elevation{name: ElevateNone, sudo: sudoNoop, runAs: runAsSu}},
+	{check: "sudo -n true", method: elevation{name: ElevateSudo, sudo: sudoSudo, runAs: runAsSudo}},
+	{check: "doas -n true", method: elevation{name: ElevateDoas, sudo: sudoDoas, runAs: runAsDoas}},
+	{check: "dzdo -n true", method: elevation{name: ElevateDzdo, sudo: sudoDzdo, runAs: runAsDzdo}},
+	// pbrun has no non-interactive mode, stdin is closed to make it fail instead of asking for a password
+	// and the timeout keeps an unreachable policy server from blocking the connection
+	{check: "command -v pbrun > /dev/null && pbrun true < /dev/null", method: elevation{name: ElevatePbrun, sudo: sudoPbrun, runAs: runAsPbrun}, timeout: 5 * time.Second},
 }
 
 const sudoCheckWindows = `whoami | findstr /i "administrator"`
@@ -321,19 +670,108 @@ func sudoWindows(cmd string) string {
 	return "runas /user:Administrator " + cmd
 }
 
-func (c *Connection) configureSudo() {
+func runAsWindows(user, cmd string) string {
+	return fmt.Sprintf("runas /user:%s %s", shellfmt.CmdArg(user), shellfmt.CmdArg(cmd))
+}
+
+func (c *Connection) configureSudo() error {
+	if c.Elevate != nil {
+		method, err := c.Elevate.elevation(c)
+		if err != nil {
+			return err
+		}
+		c.setElevation(method)
+		return nil
+	}
 	if c.OSVersion.ID == "windows" {
-		if c.Exec(sudoCheckWindows) == nil {
-			c.sudofunc = sudoWindows
+		if c.Exec(sudoCheckWindows, exec.Internal()) == nil {
+			c.setElevation(elevation{name: ElevateRunas, sudo: sudoWindows, runAs: runAsWindows})
 		}
-		return
+		return nil
 	}
-	for check, fn := range sudoChecks {
-		if c.Exec(check) == nil {
-			c.sudofunc = fn
-			return
+	for _, check := range sudoChecks {
+		if c.Exec(check.check, exec.Internal(), exec.Timeout(check.timeout)) == nil {
+			c.setElevation(check.method)
+			return nil
 		}
 	}
+	if method, ok, err := c.sudoPasswordElevation(); ok {
+		c.setElevation(method)
+		return nil
+	} else if err != nil {
+		c.Logger().Warnf("%s: %v", c, err)
+	}
+	c.configureSu()
+	return nil
+}
+
+func (c *Connection) setElevation(method elevation) {
+	c.elevationMethod = method.name
+	c.sudofunc = method.sudo
+	c.runasfunc = method.runAs
+}
+
+// configureSu sets up the su elevation when a root password callback or a credential source has
+// been set
+func (c *Connection) configureSu() {
+	if c.RootPassword == nil && c.Credentials == nil && DefaultCredentialSource == nil {
+		return
+	}
+	if c.Exec("command -v su", exec.Internal()) != nil {
+		return
+	}
+	method, err := c.suElevation("root")
+	if err != nil {
+		c.Logger().Warnf("%s: su elevation failed: %v", c, err)
+		return
+	}
+	c.setElevation(method)
+}
+
+// ElevationMethod returns the method used for running commands with elevated privileges, such as
+// "sudo" or "doas", "none" when the user already is root or an empty string when the privileges
+// can't be elevated. The method is detected when connecting, see RedetectSudo.
+func (c *Connection) ElevationMethod() string {
+	return c.elevationMethod
+}
+
+// RedetectSudo detects the privilege elevation method again, for example after installing sudo on
+// the host
+func (c *Connection) RedetectSudo() error {
+	if err := c.checkConnected(); err != nil {
+		return err
+	}
+	c.setElevation(elevation{})
+	c.elevatePassword = ""
+	return c.configureSudo()
+}
+
+// SetEnv sets environment variables for every command run on the connection, such as http_proxy
+// or LC_ALL, replacing the ones set before. The variables given using exec.Env take precedence. The
+// values are quoted like with exec.Env, so a PATH addition has to spell out the whole value.
+func (c *Connection) SetEnv(env map[string]string) {
+	c.env = make(map[string]string, len(env))
+	for k, v := range env {
+		c.env[k] = v
+	}
+}
+
+// Env returns a copy of the environment variables set using SetEnv
+func (c *Connection) Env() map[string]string {
+	env := make(map[string]string, len(c.env))
+	for k, v := range c.env {
+		env[k] = v
+	}
+	return env
+}
+
+// SudoAs formats a command string to be run as another user, such as the account of a service. The
+// command is passed to the user's shell as a single quoted argument, see also exec.RunAs.
+func (c Connection) SudoAs(user, cmd string) (string, error) {
+	if c.runasfunc == nil {
+		return "", ErrSudoRequired.Wrapf("user is not an administrator and passwordless access elevation has not been configured")
+	}
+	return c.runasfunc(user, cmd), nil
 }
 
 // Sudo formats a command string to be run with elevated privileges
@@ -345,6 +783,17 @@ func (c Connection) Sudo(cmd string) (string, error) {
 	return c.sudofunc(cmd), nil
 }
 
+// SudoExec runs a command on the host with elevated privileges, the same as Exec with exec.Sudo
+func (c Connection) SudoExec(cmd string, opts ...exec.Option) error {
+	return c.Exec(cmd, append(opts[:len(opts):len(opts)], exec.Sudo(c))...)
+}
+
+// SudoExecOutput runs a command on the host with elevated privileges and returns the output, the same
+// as ExecOutput with exec.Sudo
+func (c Connection) SudoExecOutput(cmd string, opts ...exec.Option) (string, error) {
+	return c.ExecOutput(cmd, append(opts[:len(opts):len(opts)], exec.Sudo(c))...)
+}
+
 // Execf is just like `Exec` but you can use Sprintf templating for the command
 func (c Connection) Execf(s string, params ...any) error {
 	opts, args := GroupParams(params...)
@@ -359,33 +808,226 @@ func (c Connection) ExecOutputf(s string, params ...any) (string, error) {
 }
 
 // ExecInteractive executes a command on the host and passes control of
-// local input to the remote command
-func (c Connection) ExecInteractive(cmd string) error {
+// local input to the remote command. Pass exec.Asciicast to record the
+// session.
+func (c Connection) ExecInteractive(cmd string, opts ...exec.Option) error {
 	if err := c.checkConnected(); err != nil {
 		return err
 	}
 
-	if err := c.client.ExecInteractive(cmd); err != nil {
+	execOpts := exec.Build(opts...)
+	var recorder interactiveRecorder
+	if execOpts.Asciicast != nil {
+		r, ok := c.client.(interactiveRecorder)
+		if !ok {
+			return ErrNotSupported.Wrapf("%s: recording interactive sessions", c.Protocol())
+		}
+		recorder = r
+	}
+
+	opts, span := c.startExecSpan(cmd, opts)
+	start := clock.Default.Now()
+	c.ops.sessionStarted()
+	var err error
+	if recorder != nil {
+		err = c.execInteractiveRecorded(recorder, cmd, execOpts)
+	} else {
+		err = c.client.ExecInteractive(cmd)
+	}
+	c.ops.sessionDone()
+	c.execDone(cmd, opts, start, span, err)
+	if err != nil {
 		return ErrCommandFailed.Wrapf("client exec interactive: %w", err)
 	}
 
 	return nil
 }
 
-// Disconnect from the host
-func (c *Connection) Disconnect() {
+// Disconnect from the host. The connection is considered closed even when closing it fails. It is
+// safe to call Disconnect when not connected and more than once.
+func (c *Connection) Disconnect() error {
+	var err error
 	if c.client != nil {
-		c.client.Disconnect()
+		c.removeAskpass()
+		err = c.client.Disconnect()
+		for _, fn := range c.hooks.disconnect {
+			fn(c)
+		}
+	}
+	if c.sessionOpen && c.Metrics != nil {
+		c.Metrics.SessionClosed(c.Protocol())
 	}
+	c.sessionOpen = false
 	c.client = nil
+	c.transfer = nil
+	if err != nil {
+		return fmt.Errorf("disconnect: %w", err)
+	}
+	return nil
+}
+
+// Reset disconnects and clears all of the state that was set up when connecting, such as the detected
+// operating system, sudo method and file transfer strategy. Clients that have a Reset() function are
+// reset too. After changing the configuration of a connection that has been used before, call Reset
+// before calling Connect again. Use Clone instead to get a copy of a Connection that is still in use.
+func (c *Connection) Reset() {
+	_ = c.Disconnect()
+	c.clearState()
+
+	if c.SSH != nil {
+		c.SSH.Reset()
+	}
+	if c.WinRM != nil {
+		c.WinRM.Reset()
+	}
+	if c.Custom != nil {
+		if r, ok := c.Custom.Client.(interface{ Reset() }); ok {
+			r.Reset()
+		}
+	}
+}
+
+// Clone returns a disconnected copy of the connection that does not share any of the connection
+// state with c, so it can be changed and connected without affecting c, which is left connected. A
+// custom client is cloned when it has a Clone() Client function and shared with c otherwise.
+func (c *Connection) Clone() *Connection {
+	clone := *c
+	clone.client = nil
+	clone.sessionOpen = false
+	clone.traceContext = nil
+	clone.askpassPath = ""
+	clone.clearState()
+
+	if c.SSH != nil {
+		clone.SSH = c.SSH.Clone()
+	}
+	if c.WinRM != nil {
+		clone.WinRM = c.WinRM.Clone()
+	}
+	if c.Localhost != nil {
+		localhost := *c.Localhost
+		clone.Localhost = &localhost
+	}
+	if c.Elevate != nil {
+		elevate := *c.Elevate
+		clone.Elevate = &elevate
+	}
+	if c.Custom != nil {
+		custom := *c.Custom
+		if cl, ok := c.Custom.Client.(interface{ Clone() Client }); ok {
+			custom.Client = cl.Clone()
+		}
+		clone.Custom = &custom
+	}
+	return &clone
+}
+
+// clearState forgets the state that was set up when connecting without disconnecting
+func (c *Connection) clearState() {
+	c.OSVersion = nil
+	c.setElevation(elevation{})
+	c.elevatePassword = ""
+	c.fsys = nil
+	c.sudofsys = nil
+	c.transfer = nil
+	c.ops = nil
 }
 
 // Upload copies a file from a local path src to the remote host path dst. For
-// smaller files you should probably use os.WriteFile
-func (c *Connection) Upload(src, dst string, opts ...exec.Option) error {
+// smaller files you should probably use os.WriteFile. The transfer mechanism is
+// chosen automatically, see TransferStrategy. Pass exec.Compress to compress the
+// data while in transit. Pass exec.Atomic to make the file appear at dst only
+// once it has been completely written and verified. The file mode is always
+// copied, pass exec.PreserveOwner and exec.PreserveTimes to also copy the owner
+// and the modification time. Pass exec.Sparse to skip sending the zero blocks
+// of sparse files such as disk images.
+func (c *Connection) Upload(src, dst string, opts ...exec.Option) (err error) {
 	if err := c.checkConnected(); err != nil {
 		return err
 	}
+	opts = withCorrelationID(opts)
+	opts, span := c.startTransferSpan(AuditUpload, src, dst, opts)
+	defer func(start time.Time) {
+		err = c.correlateError(opts, err)
+		c.transferDone(AuditUpload, src, dst, start, span, err)
+	}(clock.Default.Now())
+	if exec.Build(opts...).Atomic {
+		return c.uploadAtomic(src, dst, opts...)
+	}
+	return c.upload(src, dst, opts...)
+}
+
+// uploadAtomic uploads into a temporary file next to dst and renames it over dst
+func (c *Connection) uploadAtomic(src, dst string, opts ...exec.Option) error {
+	fsys := c.fsysFor(opts...)
+	tmp := atomicTempName(dst)
+	if err := c.upload(src, tmp, opts...); err != nil {
+		_ = fsys.Delete(tmp)
+		return err
+	}
+	if err := fsys.Rename(tmp, dst); err != nil {
+		_ = fsys.Delete(tmp)
+		return ErrUploadFailed.Wrap(err)
+	}
+	return nil
+}
+
+func (c *Connection) upload(src, dst string, opts ...exec.Option) error {
+	if exec.Build(opts...).Compression != "" {
+		if err := c.uploadCompressed(src, dst, opts...); err != nil {
+			return err
+		}
+	} else {
+		strategy, err := c.transferStrategy(opts...)
+		if err != nil {
+			return ErrUploadFailed.Wrap(err)
+		}
+		if err := strategy.Upload(c, src, dst, opts...); err != nil {
+			return err //nolint:wrapcheck
+		}
+	}
+	return c.preserve(src, dst, opts...)
+}
+
+// preserve applies the owner and modification times of the local file src to the remote file dst
+// when requested through exec.PreserveOwner or exec.PreserveTimes
+func (c *Connection) preserve(src, dst string, opts ...exec.Option) error {
+	execOpts := exec.Build(opts...)
+	if !execOpts.PreserveOwner && !execOpts.PreserveTimes {
+		return nil
+	}
+	stat, err := os.Stat(src)
+	if err != nil {
+		return ErrInvalidPath.Wrapf("stat local file %s: %w", src, err)
+	}
+	fsys := c.fsysFor(opts...)
+	if execOpts.PreserveOwner {
+		owner, group, ok := localOwner(stat)
+		if !ok {
+			return ErrNotSupported.Wrapf("preserve owner: unable to get the owner of %s", src)
+		}
+		if err := fsys.Chown(dst, owner, group); err != nil {
+			return ErrUploadFailed.Wrap(err)
+		}
+	}
+	if execOpts.PreserveTimes {
+		if err := fsys.Chtimes(dst, stat.ModTime(), stat.ModTime()); err != nil {
+			return ErrUploadFailed.Wrap(err)
+		}
+	}
+	return nil
+}
+
+// uploadFsys uploads a file using the remote filesystem interface
+func (c *Connection) uploadFsys(src, dst string, opts ...exec.Option) error {
+	if exec.Build(opts...).Sparse {
+		return c.uploadSparse(src, dst, opts...)
+	}
+	if exec.Build(opts...).Parallel > 1 {
+		if stat, err := os.Stat(src); err == nil && stat.Size() >= 2*minParallelChunkSize {
+			return c.uploadParallel(src, dst, opts...)
+		}
+	}
 	local, err := os.Open(src)
 	if err != nil {
 		return ErrInvalidPath.Wrap(err)
@@ -397,49 +1039,136 @@ func (c *Connection) Upload(src, dst string, opts ...exec.Option) error {
 		return ErrInvalidPath.Wrapf("stat local file %s: %w", src, err)
 	}
 
-	shasum := sha256.New()
+	shasum, err := newChecksum(opts...)
+	if err != nil {
+		return ErrUploadFailed.Wrap(err)
+	}
 
-	fsys := c.Fsys()
+	fsys := c.fsysFor(opts...)
 	remote, err := fsys.OpenFile(dst, ModeCreate, int(stat.Mode()))
 	if err != nil {
 		return ErrInvalidPath.Wrapf("open remote file for writing: %w", err)
 	}
 	defer remote.Close()
 
-	if _, err := remote.CopyFromN(local, stat.Size(), shasum); err != nil {
+	progress := exec.ProgressWriter(exec.Build(opts...).Progress, stat.Size())
+	if _, err := remote.CopyFromN(local, stat.Size(), io.MultiWriter(hashWriter(shasum), progress)); err != nil {
 		return ErrUploadFailed.Wrapf("copy file to remote host: %w", err)
 	}
 
-	log.Debugf("%s: post-upload validate checksum of %s", c, dst)
-	remoteSum, err := fsys.Sha256(dst)
+	if err := c.verifyChecksum(dst, shasum, opts...); err != nil {
+		return ErrUploadFailed.Wrap(err)
+	}
+
+	return nil
+}
+
+// Download copies a file from the remote host path src to a local path dst. Unless the scp fallback
+// is in use, the checksum of the downloaded file is validated against the remote file. Pass
+// exec.Sudo(conn) to read the remote file with elevated privileges. The transfer mechanism is
+// chosen automatically, see TransferStrategy. Pass exec.Compress to compress the data while
+// in transit.
+func (c *Connection) Download(src, dst string, opts ...exec.Option) (err error) {
+	if err := c.checkConnected(); err != nil {
+		return err
+	}
+	opts = withCorrelationID(opts)
+	opts, span := c.startTransferSpan(AuditDownload, src, dst, opts)
+	defer func(start time.Time) {
+		err = c.correlateError(opts, err)
+		c.transferDone(AuditDownload, src, dst, start, span, err)
+	}(clock.Default.Now())
+	if exec.Build(opts...).Compression != "" {
+		return c.downloadCompressed(src, dst, opts...)
+	}
+	strategy, err := c.transferStrategy(opts...)
 	if err != nil {
-		return ErrUploadFailed.Wrapf("validate checksum of %s: %w", dst, err)
+		return ErrDownloadFailed.Wrap(err)
 	}
+	return strategy.Download(c, src, dst, opts...)
+}
+
+// downloadFsys downloads a file using the remote filesystem interface
+func (c *Connection) downloadFsys(src, dst string, opts ...exec.Option) error {
 
-	if remoteSum != fmt.Sprintf("%x", shasum.Sum(nil)) {
-		return ErrUploadFailed.Wrapf("checksum mismatch")
+	fsys := c.fsysFor(opts...)
+	remote, err := fsys.OpenFile(src, ModeRead, 0)
+	if err != nil {
+		return ErrInvalidPath.Wrapf("open remote file for reading: %w", err)
+	}
+	defer remote.Close()
+
+	stat, err := remote.Stat()
+	if err != nil {
+		return ErrInvalidPath.Wrapf("stat remote file %s: %w", src, err)
+	}
+	if stat.IsDir() {
+		return ErrInvalidPath.Wrapf("%s is a directory", src)
+	}
+
+	local, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, stat.Mode().Perm())
+	if err != nil {
+		return ErrInvalidPath.Wrapf("open local file for writing: %w", err)
+	}
+	defer local.Close()
+
+	shasum, err := newChecksum(opts...)
+	if err != nil {
+		return ErrDownloadFailed.Wrap(err)
+	}
+
+	if stat.Size() > 0 {
+		progress := exec.ProgressWriter(exec.Build(opts...).Progress, stat.Size())
+		if _, err := remote.Copy(io.MultiWriter(local, hashWriter(shasum), progress)); err != nil && !errors.Is(err, io.EOF) {
+			return ErrDownloadFailed.Wrapf("copy file from remote host: %w", err)
+		}
+	}
+
+	if err := c.verifyChecksum(src, shasum, opts...); err != nil {
+		return ErrDownloadFailed.Wrap(err)
+	}
+
+	if err := local.Close(); err != nil {
+		return ErrDownloadFailed.Wrapf("close local file: %w", err)
 	}
 
 	return nil
 }
 
-func (c *Connection) configuredClient() client {
-	if c.WinRM != nil {
-		return c.WinRM
+// fsysFor returns the sudo enabled filesystem if the options include exec.Sudo, otherwise the regular one.
+// The operations are traced as children of the span in the exec.TraceContext of the options.
+func (c *Connection) fsysFor(opts ...exec.Option) FS {
+	execOpts := exec.Build(opts...)
+	fsys := c.Fsys()
+	if execOpts.Sudo {
+		fsys = c.SudoFsys()
 	}
+	return bindTraceContext(fsys, execOpts.TraceContext)
+}
 
-	if c.Localhost != nil {
-		return c.Localhost
+// configuredClient returns the client selected by the configuration. The deprecated fields that
+// SetDefaults hasn't moved into the current ones yet are taken into account, but left as they are.
+func (c *Connection) configuredClient() Client {
+	if c.Custom != nil && c.Custom.Client != nil {
+		return c.Custom.Client
 	}
 
-	if c.SSH != nil {
-		return c.SSH
+	if winRM := firstSet(c.WinRM, c.DeprecatedWinRM, c.DeprecatedWinrm); winRM != nil {
+		return winRM
+	}
+
+	if localhost := firstSet(c.Localhost, c.DeprecatedLocal); localhost != nil {
+		return localhost
+	}
+
+	if ssh := firstSet(c.SSH, c.DeprecatedSSH); ssh != nil {
+		return ssh
 	}
 
 	return nil
 }
 
-func defaultClient() client {
+func defaultClient() Client {
 	return &Localhost{Enabled: true}
 }
 
@@ -2,12 +2,26 @@ package rig
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/alessio/shellescape"
 	"github.com/creasty/defaults"
 	"github.com/k0sproject/rig/exec"
+	"github.com/k0sproject/rig/log"
+	"github.com/k0sproject/rig/pkg/clock"
+	"github.com/k0sproject/rig/pkg/redact"
 	"github.com/stretchr/testify/require"
 )
 
@@ -17,12 +31,13 @@ type Host struct {
 
 type mockClient struct {
 	commands []string
+	windows  bool
 }
 
 func (m *mockClient) Connect() error                             { return nil }
-func (m *mockClient) Disconnect()                                {}
+func (m *mockClient) Disconnect() error                          { return nil }
 func (m *mockClient) Upload(_, _ string, _ ...exec.Option) error { return nil }
-func (m *mockClient) IsWindows() bool                            { return false }
+func (m *mockClient) IsWindows() bool                            { return m.windows }
 func (m *mockClient) ExecInteractive(_ string) error             { return nil }
 func (m *mockClient) String() string                             { return "mockclient" }
 func (m *mockClient) Protocol() string                           { return "null" }
@@ -43,6 +58,71 @@ func (m *mockClient) ExecStreams(cmd string, stdin io.ReadCloser, stdout, stderr
 	return nil, fmt.Errorf("not implemented")
 }
 
+// scriptClient is a mockClient that is connected like a real client and answers the commands using
+// a function. Connect fails with the errors in connectErrs until they run out.
+type scriptClient struct {
+	mockClient
+	connected   bool
+	connects    int
+	connectErrs []error
+	respond     func(cmd string) (stdout, stderr string, err error)
+}
+
+func (m *scriptClient) Connect() error {
+	if len(m.connectErrs) > 0 {
+		err := m.connectErrs[0]
+		m.connectErrs = m.connectErrs[1:]
+		return err
+	}
+	m.connected = true
+	m.connects++
+	return nil
+}
+
+func (m *scriptClient) Disconnect() error {
+	m.connected = false
+	return nil
+}
+
+func (m *scriptClient) IsConnected() bool { return m.connected }
+
+func (m *scriptClient) Exec(cmd string, opts ...exec.Option) error {
+	o := exec.Build(opts...)
+	cmd, err := o.Command(cmd)
+	if err != nil {
+		return err
+	}
+	m.commands = append(m.commands, cmd)
+	if m.respond == nil {
+		return nil
+	}
+	stdout, stderr, err := m.respond(cmd)
+	for _, line := range strings.SplitAfter(stdout, "\n") {
+		if line != "" {
+			o.AddOutput(m.String(), line, "")
+		}
+	}
+	for _, line := range strings.SplitAfter(stderr, "\n") {
+		if line != "" {
+			o.AddOutput(m.String(), "", line)
+		}
+	}
+	o.FlushOutput()
+	return err
+}
+
+// newScriptConnection returns a connected connection to a scriptClient
+func newScriptConnection(t *testing.T, client *scriptClient) *Connection {
+	t.Helper()
+	osVersion := OSVersion{ID: "linux"}
+	if client.windows {
+		osVersion.ID = "windows"
+	}
+	c := &Connection{Custom: &ClientConfig{Name: "script", Client: client}, OSVersion: &osVersion}
+	require.NoError(t, c.Connect())
+	return c
+}
+
 var stubSudofunc = func(in string) string {
 	return "sudo-goes-here " + in
 }
@@ -121,4 +201,805 @@ func TestSudo(t *testing.T) {
 
 	require.NoError(t, h.Execf("ls %s", "/tmp", exec.Sudo(h)))
 	require.Contains(t, mc.commands, "sudo-goes-here ls /tmp")
+
+	require.NoError(t, h.SudoExec("ls /var"))
+	require.Contains(t, mc.commands, "sudo-goes-here ls /var")
+}
+
+func TestRunAs(t *testing.T) {
+	mc := mockClient{}
+	h := Host{
+		Connection: Connection{
+			client:    &mc,
+			sudofunc:  stubSudofunc,
+			runasfunc: runAsSudo,
+		},
+	}
+
+	require.NoError(t, h.Exec("ls /tmp", exec.RunAs("postgres"), exec.Sudo(h)))
+	require.Contains(t, mc.commands, "sudo -n -u postgres -- sh -c 'ls /tmp'")
+
+	cmd, err := h.SudoAs("postgres", "psql -c 'select 1'")
+	require.NoError(t, err)
+	require.Equal(t, `sudo -n -u postgres -- sh -c 'psql -c '"'"'select 1'"'"''`, cmd)
+
+	require.ErrorIs(t, Connection{client: &mc}.Exec("ls", exec.RunAs("postgres")), ErrSudoRequired)
+}
+
+func TestElevate(t *testing.T) {
+	c := &Connection{}
+	method, err := (&Elevate{Method: ElevateCustom, Template: "priv --as {{.User}} -- sh -c {{.Command}}"}).elevation(c)
+	require.NoError(t, err)
+	require.Equal(t, "priv --as root -- sh -c 'ls /tmp'", method.sudo("ls /tmp"))
+	require.Equal(t, "priv --as etcd -- sh -c 'ls /tmp'", method.runAs("etcd", "ls /tmp"))
+
+	method, err = (&Elevate{Method: ElevateDoas, User: "postgres"}).elevation(c)
+	require.NoError(t, err)
+	require.Equal(t, "doas -n -u postgres -- sh -c 'ls /tmp'", method.sudo("ls /tmp"))
+
+	method, err = (&Elevate{Method: ElevateDzdo}).elevation(c)
+	require.NoError(t, err)
+	require.Equal(t, "dzdo -s FOO=bar -- ls /tmp", method.sudo("FOO=bar ls /tmp"))
+
+	method, err = (&Elevate{Method: ElevatePbrun}).elevation(c)
+	require.NoError(t, err)
+	require.Equal(t, "pbrun sh -c 'ls /tmp'", method.sudo("ls /tmp"))
+	require.Equal(t, "pbrun -u etcd sh -c 'ls /tmp'", method.runAs("etcd", "ls /tmp"))
+
+	_, err = (&Elevate{Method: ElevateCustom, Template: "{{.Foo}}"}).elevation(c)
+	require.ErrorIs(t, err, ErrValidationFailed)
+	_, err = (&Elevate{Method: "runas"}).elevation(c)
+	require.ErrorIs(t, err, ErrValidationFailed)
+	_, err = (&Elevate{Method: ElevateSu}).elevation(c)
+	require.ErrorIs(t, err, ErrValidationFailed)
+}
+
+// failingClient is a mockClient where every command fails, recording the timeouts they are run with
+type failingClient struct {
+	mockClient
+	timeouts map[string]time.Duration
+}
+
+func (m *failingClient) Exec(cmd string, opts ...exec.Option) error {
+	m.timeouts[cmd] = exec.Build(opts...).Timeout
+	return fmt.Errorf("failed")
+}
+
+func TestSudoChecksTimeout(t *testing.T) {
+	fc := &failingClient{timeouts: make(map[string]time.Duration)}
+	c := &Connection{client: fc, OSVersion: &OSVersion{ID: "linux"}}
+	require.NoError(t, c.configureSudo())
+	for _, check := range sudoChecks {
+		timeout, ok := fc.timeouts[check.check]
+		require.True(t, ok, check.check)
+		if strings.Contains(check.check, "pbrun") {
+			require.Positive(t, timeout, "the pbrun check can block on its policy server")
+		}
+	}
+}
+
+func TestOSVersionProbe(t *testing.T) {
+	defer func() { osVersionProbes = nil }()
+	RegisterOSVersionProbe(func(Connection) (OSVersion, bool) { return OSVersion{ID: "first"}, true })
+	RegisterOSVersionProbe(func(c Connection) (OSVersion, bool) {
+		if c.Exec("test -f /etc/embedded-release") != nil {
+			return OSVersion{}, false
+		}
+		return OSVersion{ID: "embedded", Version: "1.0"}, true
+	})
+
+	mc := mockClient{}
+	os, err := GetOSVersion(&Connection{client: &mc})
+	require.NoError(t, err)
+	require.Equal(t, "embedded", os.ID)
+	require.Equal(t, []string{"test -f /etc/embedded-release"}, mc.commands)
+}
+
+// elevatedLocalhost returns a localhost connection that elevates using method
+func elevatedLocalhost(t *testing.T, method elevation) *Connection {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+	c := &Connection{Localhost: &Localhost{Enabled: true}}
+	require.NoError(t, defaults.Set(c))
+	require.NoError(t, c.Connect())
+	t.Cleanup(func() { _ = c.Disconnect() })
+	c.setElevation(method)
+	return c
+}
+
+// fakeSudo is a sudo that runs the command as the current user. Like sudo, it sets the variables
+// given before the command and passes the arguments of the command on as they are. With a password,
+// sudo -n fails and sudo -A checks the password given by the askpass helper.
+const fakeSudo = `#!/bin/sh
+while [ $# -gt 0 ]; do
+	case "$1" in
+		-n) [ -z %[1]s ] || exit 1; shift ;;
+		-A) [ "$("$SUDO_ASKPASS")" = %[1]s ] || { echo "sudo: incorrect password" >&2; exit 1; }; shift ;;
+		-p|-u) shift 2 ;;
+		-s) shift ;;
+		--) shift; break ;;
+		*=*) export "$1"; shift ;;
+		*) break ;;
+	esac
+done
+exec "$@"
+`
+
+// installFakeSudo puts fakeSudo first in the PATH
+func installFakeSudo(t *testing.T, password string) {
+	t.Helper()
+	bin := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "sudo"), []byte(fmt.Sprintf(fakeSudo, shellescape.Quote(password))), 0o755))
+	t.Setenv("PATH", bin+string(filepath.ListSeparator)+os.Getenv("PATH"))
+}
+
+func TestSuElevationStdin(t *testing.T) {
+	if os.Getuid() != 0 {
+		// su doesn't ask root for the password
+		t.Skip("requires root")
+	}
+	if _, err := osexec.LookPath("su"); err != nil {
+		t.Skip("su is not available")
+	}
+	c := elevatedLocalhost(t, elevation{name: ElevateSu, sudo: sudoSu("rootpw"), runAs: runAsSu})
+
+	out, err := c.ExecOutput("cat", exec.Stdin("hello"), exec.Sudo(c))
+	require.NoError(t, err)
+	require.Equal(t, "hello", out, "stdin is passed on to the command instead of the password")
+
+	path := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, c.SudoFsys().WriteFile(path, []byte("data\n"), 0o600))
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "data\n", string(content))
+	data, err := c.SudoFsys().ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "data\n", string(data))
+}
+
+// fakeSu is a su that runs the command as the current user, setting FAKE_SU_USER to the target user.
+// Like su, it reads the password from stdin unless it is run by root, that is, by another fakeSu.
+const fakeSu = `#!/bin/sh
+shell=/bin/sh
+while [ $# -gt 0 ]; do
+	case "$1" in
+		-s) shell="$2"; shift 2 ;;
+		-c) cmd="$2"; shift 2 ;;
+		*) user="$1"; shift ;;
+	esac
+done
+if [ "$FAKE_SU_USER" != root ]; then
+	printf 'Password: ' >&2
+	read -r pw
+	[ "$pw" = %[1]s ] || { echo "su: Authentication failure" >&2; exit 1; }
+fi
+FAKE_SU_USER=$user exec "$shell" -c "$cmd"
+`
+
+// installFakeSu puts fakeSu first in the PATH
+func installFakeSu(t *testing.T, password string) {
+	t.Helper()
+	bin := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "su"), []byte(fmt.Sprintf(fakeSu, shellescape.Quote(password))), 0o755))
+	t.Setenv("PATH", bin+string(filepath.ListSeparator)+os.Getenv("PATH"))
+}
+
+func TestSuElevation(t *testing.T) {
+	installFakeSu(t, "root pw's")
+	c := elevatedLocalhost(t, elevation{})
+	c.RootPassword = func() (string, error) { return "wrong", nil }
+	_, err := c.suElevation("root")
+	require.ErrorIs(t, err, ErrAuthFailed)
+
+	c.RootPassword = func() (string, error) { return "root pw's", nil }
+	method, err := c.suElevation("root")
+	require.NoError(t, err)
+	c.setElevation(method)
+	require.Equal(t, ElevateSu, c.ElevationMethod())
+
+	out, err := c.ExecOutput(`echo "$FAKE_SU_USER"; echo "it's"; cat`, exec.Stdin("input"), exec.Sudo(c))
+	require.NoError(t, err)
+	require.Equal(t, "root\nit's\ninput", out)
+
+	var stderr bytes.Buffer
+	require.NoError(t, c.Exec("echo err >&2", exec.Sudo(c), exec.StderrWriter(&stderr)))
+	require.Equal(t, "err\n", stderr.String(), "the stderr of the command is passed on without the password prompt")
+
+	out, err = c.ExecOutput(`echo "$FAKE_SU_USER"`, exec.RunAs("postgres"))
+	require.NoError(t, err)
+	require.Equal(t, "postgres", out)
+
+	method, err = c.suElevation("admin")
+	require.NoError(t, err)
+	require.Equal(t, "admin", strings.TrimSpace(runShell(t, method.sudo(`echo "$FAKE_SU_USER"`))))
+}
+
+// runShell runs cmd using the local sh and returns the output
+func runShell(t *testing.T, cmd string) string {
+	t.Helper()
+	out, err := osexec.Command("sh", "-c", cmd).Output()
+	require.NoError(t, err)
+	return string(out)
+}
+
+func TestSuElevationDetection(t *testing.T) {
+	respond := func(cmd string) (string, string, error) {
+		if cmd == "command -v su" || strings.Contains(cmd, "| su root -c") {
+			return "", "", nil
+		}
+		return "", "", fmt.Errorf("failed")
+	}
+
+	client := &scriptClient{respond: respond}
+	c := newScriptConnection(t, client)
+	require.Empty(t, c.ElevationMethod(), "su is not used without a root password")
+
+	client = &scriptClient{respond: respond}
+	c = &Connection{Custom: &ClientConfig{Name: "script", Client: client}, OSVersion: &OSVersion{ID: "linux"}}
+	c.RootPassword = func() (string, error) { return "rootpw", nil }
+	require.NoError(t, c.Connect())
+	require.Equal(t, ElevateSu, c.ElevationMethod())
+	cmd, err := c.Sudo("id")
+	require.NoError(t, err)
+	require.Equal(t, sudoSu("rootpw")("id"), cmd)
+}
+
+// fakePbrun is a pbrun that runs the command as the current user, setting FAKE_PBRUN_USER to the
+// target user
+const fakePbrun = `#!/bin/sh
+user=root
+if [ "$1" = -u ]; then
+	user="$2"
+	shift 2
+fi
+FAKE_PBRUN_USER=$user exec "$@"
+`
+
+func TestPbrunElevation(t *testing.T) {
+	bin := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "pbrun"), []byte(fakePbrun), 0o755))
+	t.Setenv("PATH", bin+string(filepath.ListSeparator)+os.Getenv("PATH"))
+	c := elevatedLocalhost(t, elevation{name: ElevatePbrun, sudo: sudoPbrun, runAs: runAsPbrun})
+
+	out, err := c.ExecOutput(`echo "$FAKE_PBRUN_USER"; echo "it's"; cat`, exec.Stdin("input"), exec.Sudo(c))
+	require.NoError(t, err)
+	require.Equal(t, "root\nit's\ninput", out)
+
+	out, err = c.ExecOutput(`echo "$FAKE_PBRUN_USER"`, exec.RunAs("etcd"))
+	require.NoError(t, err)
+	require.Equal(t, "etcd", out)
+
+	client := &scriptClient{respond: func(cmd string) (string, string, error) {
+		if strings.Contains(cmd, "pbrun true") {
+			return "", "", nil
+		}
+		return "", "", fmt.Errorf("failed")
+	}}
+	require.Equal(t, ElevatePbrun, newScriptConnection(t, client).ElevationMethod())
+}
+
+func TestRedetectSudo(t *testing.T) {
+	installed := false
+	client := &scriptClient{respond: func(cmd string) (string, string, error) {
+		if cmd == "sudo -n true" && installed {
+			return "", "", nil
+		}
+		return "", "", fmt.Errorf("failed")
+	}}
+	c := newScriptConnection(t, client)
+	require.Empty(t, c.ElevationMethod())
+	_, err := c.Sudo("id")
+	require.ErrorIs(t, err, ErrSudoRequired)
+
+	installed = true
+	require.NoError(t, c.RedetectSudo())
+	require.Equal(t, ElevateSudo, c.ElevationMethod())
+	cmd, err := c.Sudo("id")
+	require.NoError(t, err)
+	require.Equal(t, "sudo -s -- id", cmd)
+
+	installed = false
+	require.NoError(t, c.RedetectSudo())
+	require.Empty(t, c.ElevationMethod(), "the previous method is forgotten")
+
+	require.NoError(t, c.Disconnect())
+	require.ErrorIs(t, c.RedetectSudo(), ErrNotConnected)
+
+	root := newScriptConnection(t, &scriptClient{respond: func(cmd string) (string, string, error) {
+		if cmd == `[ "$(id -u)" = 0 ]` {
+			return "", "", nil
+		}
+		return "", "", fmt.Errorf("failed")
+	}})
+	require.Equal(t, ElevateNone, root.ElevationMethod())
+}
+
+func TestKernelModule(t *testing.T) {
+	mc := mockClient{}
+	h := Host{
+		Connection: Connection{
+			client:   &mc,
+			sudofunc: stubSudofunc,
+		},
+	}
+
+	require.NoError(t, h.LoadKernelModule("br_netfilter"))
+	require.Equal(t, []string{"sudo-goes-here sh -c 'modprobe br_netfilter && mkdir -p /etc/modules-load.d && echo br_netfilter > /etc/modules-load.d/br_netfilter.conf'"}, mc.commands)
+	require.ErrorIs(t, h.LoadKernelModule("foo; reboot"), ErrValidationFailed)
+	require.ErrorIs(t, h.SetSysctl("net.ipv4.ip_forward=1 #", "1"), ErrValidationFailed)
+	for _, kv := range [][2]string{
+		{"net.ipv4.ip_forward\nkernel.panic", "1"},
+		{"net.ipv4.ip_forward\r", "1"},
+		{"net.ipv4.ip_forward", "1\nkernel.panic = 0"},
+		{"net.ipv4.ip_forward", "1\r"},
+	} {
+		require.ErrorIs(t, h.SetSysctl(kv[0], kv[1]), ErrValidationFailed, kv)
+	}
+	require.Len(t, mc.commands, 1)
+}
+
+type captureLogger struct {
+	messages []string
+}
+
+func (l *captureLogger) Debugf(t string, args ...interface{}) {
+	l.messages = append(l.messages, fmt.Sprintf(t, args...))
+}
+func (l *captureLogger) Infof(t string, args ...interface{})  { l.Debugf(t, args...) }
+func (l *captureLogger) Warnf(t string, args ...interface{})  { l.Debugf(t, args...) }
+func (l *captureLogger) Errorf(t string, args ...interface{}) { l.Debugf(t, args...) }
+
+func TestConnectionLogger(t *testing.T) {
+	logger := &captureLogger{}
+	h := Host{
+		Connection: Connection{
+			Localhost: &Localhost{
+				Enabled: true,
+			},
+			Log: log.Sugared(logger),
+		},
+	}
+	require.NoError(t, defaults.Set(&h))
+	require.NoError(t, h.Connect())
+	require.NoError(t, h.Exec("echo hello", exec.CorrelationID("abc")))
+	require.Contains(t, logger.messages, "[abc] [local] localhost: executing `echo hello`")
+	require.Contains(t, logger.messages, "[abc] [local] localhost: hello")
+}
+
+func TestRedactValue(t *testing.T) {
+	defer redact.Reset()
+	RedactValue("hunter2")
+	RedactPattern(regexp.MustCompile(`token=\w+`))
+	logger := &captureLogger{}
+	h := Host{
+		Connection: Connection{
+			Localhost: &Localhost{
+				Enabled: true,
+			},
+			Log: log.Sugared(logger),
+		},
+	}
+	require.NoError(t, defaults.Set(&h))
+	require.NoError(t, h.Connect())
+	require.NoError(t, h.Exec("echo hunter2 token=abc", exec.CorrelationID("abc")))
+	require.Contains(t, logger.messages, "[abc] [local] localhost: executing `echo [REDACTED] [REDACTED]`")
+	require.Contains(t, logger.messages, "[abc] [local] localhost: [REDACTED] [REDACTED]")
+	err := h.Exec("echo hunter2 >&2; false")
+	require.Error(t, err)
+	require.NotContains(t, err.Error(), "hunter2")
+}
+
+func TestConnectionRedactValue(t *testing.T) {
+	newHost := func(logger *captureLogger) *Host {
+		h := &Host{
+			Connection: Connection{
+				Localhost: &Localhost{
+					Enabled: true,
+				},
+				Log: log.Sugared(logger),
+			},
+		}
+		require.NoError(t, defaults.Set(h))
+		require.NoError(t, h.Connect())
+		return h
+	}
+	logger1 := &captureLogger{}
+	logger2 := &captureLogger{}
+	h1 := newHost(logger1)
+	h2 := newHost(logger2)
+	h1.RedactValue("conn-secret")
+	h1.RedactValue("42")
+
+	require.NoError(t, h1.Exec("echo conn-secret 42", exec.CorrelationID("abc")))
+	require.Contains(t, logger1.messages, "[abc] [local] localhost: executing `echo [REDACTED] 42`")
+	err := h1.Exec("echo conn-secret >&2; false")
+	require.Error(t, err)
+	require.NotContains(t, err.Error(), "conn-secret")
+
+	require.NoError(t, h2.Exec("echo conn-secret", exec.CorrelationID("def")))
+	require.Contains(t, logger2.messages, "[def] [local] localhost: executing `echo conn-secret`")
+
+	h1.RemoveRedactValue("conn-secret")
+	require.NoError(t, h1.Exec("echo conn-secret", exec.CorrelationID("ghi")))
+	require.Contains(t, logger1.messages, "[ghi] [local] localhost: executing `echo conn-secret`")
+}
+
+func TestCorrelationID(t *testing.T) {
+	logger := &captureLogger{}
+	h := Host{
+		Connection: Connection{
+			Localhost: &Localhost{
+				Enabled: true,
+			},
+			Log: log.Sugared(logger),
+		},
+	}
+	require.NoError(t, defaults.Set(&h))
+	require.NoError(t, h.Connect())
+	err := h.Exec("false")
+	require.ErrorIs(t, err, ErrCommandFailed)
+	var ce *CorrelatedError
+	require.ErrorAs(t, err, &ce)
+	require.Regexp(t, `^[0-9a-f]{8}$`, ce.ID)
+	require.NotContains(t, err.Error(), ce.ID)
+	require.Contains(t, logger.messages, "["+ce.ID+"] [local] localhost: executing `false`")
+
+	err = h.Exec("false", exec.CorrelationID("abc"), exec.Retries(1, &clock.Backoff{}))
+	require.ErrorAs(t, err, &ce)
+	require.Equal(t, "abc", ce.ID)
+	var inner *CorrelatedError
+	require.False(t, errors.As(ce.Err, &inner), "the id is added only once")
+
+	waiter, err := h.ExecStreams("false", nil, io.Discard, io.Discard, exec.CorrelationID("def"))
+	require.NoError(t, err)
+	err = waiter.Wait()
+	require.ErrorAs(t, err, &ce)
+	require.Equal(t, "def", ce.ID)
+}
+
+func TestAudit(t *testing.T) {
+	var records []AuditRecord
+	h := Host{
+		Connection: Connection{
+			Localhost: &Localhost{
+				Enabled: true,
+			},
+			Audit: AuditFunc(func(r AuditRecord) { records = append(records, r) }),
+		},
+	}
+	require.NoError(t, defaults.Set(&h))
+	require.NoError(t, h.Connect())
+	records = nil
+
+	require.NoError(t, h.Exec("echo hello"))
+	require.Len(t, records, 1)
+	require.Equal(t, AuditExec, records[0].Operation)
+	require.Equal(t, "echo hello", records[0].Command)
+	require.Equal(t, "[local] localhost", records[0].Host)
+	require.False(t, records[0].End.Before(records[0].Start))
+
+	src := filepath.Join(t.TempDir(), "src")
+	require.NoError(t, os.WriteFile(src, []byte("hello"), 0o600))
+	dst := filepath.Join(t.TempDir(), "dst")
+	require.NoError(t, h.Upload(src, dst))
+	last := records[len(records)-1]
+	require.Equal(t, AuditUpload, last.Operation)
+	require.Equal(t, dst, last.Destination)
+	require.Equal(t, int64(5), last.Bytes)
+
+	var buf bytes.Buffer
+	NewJSONAuditSink(&buf).Audit(last)
+	require.Contains(t, buf.String(), `"operation":"upload"`)
+}
+
+type spanKey struct{}
+
+// recordingTracer records the started spans and the names of their parents
+type recordingTracer struct {
+	mu      sync.Mutex
+	spans   []string
+	parents map[string]string
+	ended   int
+}
+
+type recordingSpan struct {
+	tracer *recordingTracer
+}
+
+func (s recordingSpan) SetAttributes(...TraceAttribute) {}
+
+func (s recordingSpan) End(error) {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.tracer.ended++
+}
+
+func (r *recordingTracer) Start(ctx context.Context, name string, _ ...TraceAttribute) (context.Context, Span) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.parents == nil {
+		r.parents = make(map[string]string)
+	}
+	r.spans = append(r.spans, name)
+	if parent, ok := ctx.Value(spanKey{}).(string); ok {
+		r.parents[name] = parent
+	}
+	return context.WithValue(ctx, spanKey{}, name), recordingSpan{tracer: r}
+}
+
+func TestTracing(t *testing.T) {
+	tracer := &recordingTracer{}
+	h := Host{
+		Connection: Connection{
+			Localhost: &Localhost{
+				Enabled: true,
+			},
+			Tracer: tracer,
+		},
+	}
+	require.NoError(t, defaults.Set(&h))
+	require.NoError(t, h.Connect())
+	require.Equal(t, "rig.Connect", tracer.spans[0])
+	require.Contains(t, tracer.spans, "rig.Exec")
+	require.Equal(t, "rig.Connect", tracer.parents["rig.Exec"], "the commands run while connecting are children of the connect span")
+	require.Equal(t, len(tracer.spans), tracer.ended)
+
+	tracer.spans = nil
+	tracer.parents = nil
+	require.NoError(t, h.Exec("true"))
+	require.Equal(t, []string{"rig.Exec"}, tracer.spans)
+	require.Empty(t, tracer.parents)
+
+	tracer.spans = nil
+	_, err := h.Fsys().Stat(t.TempDir())
+	require.NoError(t, err)
+	require.Equal(t, "rig.FS.Stat", tracer.spans[0])
+
+	tracer.spans = nil
+	src := filepath.Join(t.TempDir(), "src")
+	require.NoError(t, os.WriteFile(src, []byte("hello"), 0o644))
+	ctx := context.WithValue(context.Background(), spanKey{}, "parent")
+	require.NoError(t, h.Upload(src, filepath.Join(t.TempDir(), "dst"), exec.TraceContext(ctx)))
+	require.Equal(t, "rig.Upload", tracer.spans[0])
+	require.Equal(t, "parent", tracer.parents["rig.Upload"])
+	require.Contains(t, tracer.spans, "rig.Exec")
+	require.Equal(t, "rig.Upload", tracer.parents["rig.Exec"], "the commands of an upload are children of the upload span")
+}
+
+type countingMetrics struct {
+	connects, execs, sessions int
+}
+
+func (m *countingMetrics) ConnectDone(string, error)                      { m.connects++ }
+func (m *countingMetrics) ExecDone(string, time.Duration, error)          { m.execs++ }
+func (m *countingMetrics) UploadDone(string, int64, time.Duration, error) {}
+func (m *countingMetrics) SessionOpened(string)                           { m.sessions++ }
+func (m *countingMetrics) SessionClosed(string)                           { m.sessions-- }
+
+func TestMetrics(t *testing.T) {
+	m := &countingMetrics{}
+	h := Host{
+		Connection: Connection{
+			Localhost: &Localhost{
+				Enabled: true,
+			},
+			Metrics: m,
+		},
+	}
+	require.NoError(t, defaults.Set(&h))
+	require.NoError(t, h.Connect())
+	require.Equal(t, 1, m.connects)
+	require.Equal(t, 1, m.sessions)
+	execs := m.execs
+	require.NoError(t, h.Exec("echo hello"))
+	require.Equal(t, execs+1, m.execs)
+	h.Disconnect()
+	h.Disconnect()
+	require.Equal(t, 0, m.sessions)
+}
+
+func TestHooks(t *testing.T) {
+	h := Host{
+		Connection: Connection{
+			Localhost: &Localhost{
+				Enabled: true,
+			},
+		},
+	}
+	var events []string
+	h.OnConnect(func(c *Connection, err error) {
+		require.NoError(t, err)
+		events = append(events, "connect")
+	})
+	h.OnExecStart(func(c *Connection, e ExecEvent) {
+		if e.Command == "echo hello" {
+			events = append(events, "start "+e.Command)
+		}
+	})
+	h.OnExecEnd(func(c *Connection, e ExecEvent) {
+		if e.Command == "echo hello" {
+			require.NoError(t, e.Err)
+			events = append(events, "end "+e.Command)
+		}
+	})
+	h.OnUpload(func(c *Connection, e UploadEvent) {
+		require.NoError(t, e.Err)
+		events = append(events, fmt.Sprintf("upload %d", e.Bytes))
+	})
+	h.OnDisconnect(func(c *Connection) { events = append(events, "disconnect") })
+
+	require.NoError(t, defaults.Set(&h))
+	require.NoError(t, h.Connect())
+	require.NoError(t, h.Exec("echo hello"))
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	require.NoError(t, os.WriteFile(src, []byte("hello"), 0o600))
+	require.NoError(t, h.Upload(src, filepath.Join(dir, "dst")))
+	h.Disconnect()
+	h.Disconnect()
+	require.Equal(t, []string{"connect", "start echo hello", "end echo hello", "upload 5", "disconnect"}, events)
+}
+
+func TestPing(t *testing.T) {
+	h := Host{Connection: Connection{Localhost: &Localhost{Enabled: true}}}
+	require.NoError(t, defaults.Set(&h))
+	require.NoError(t, h.Connect())
+	require.NoError(t, h.Ping(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, h.Ping(ctx), ErrNotConnected)
+	require.False(t, h.IsConnected())
+
+	mc := &mockClient{}
+	c := &Connection{client: mc}
+	require.NoError(t, c.Ping(context.Background()))
+	require.Equal(t, []string{"true"}, mc.commands)
+}
+
+func TestExecScript(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a posix shell")
+	}
+	h := Host{Connection: Connection{Localhost: &Localhost{Enabled: true}}}
+	require.NoError(t, defaults.Set(&h))
+	require.NoError(t, h.Connect())
+
+	script := "x='it'\"'\"'s'\nif [ -n \"$x\" ]; then\n  echo \"$x \\\"quoted\\\"\"\nfi\n"
+	var out string
+	require.NoError(t, h.ExecScript(script, "", exec.Output(&out)))
+	require.Equal(t, "it's \"quoted\"\n", out)
+
+	out = ""
+	require.NoError(t, h.ExecScript("read line\necho \"got $line\"\n", "sh", exec.Stdin("input\n"), exec.Output(&out)))
+	require.Equal(t, "got input\n", out)
+}
+
+func TestActiveOperations(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses cat")
+	}
+	h := Host{Connection: Connection{Localhost: &Localhost{Enabled: true}}}
+	require.NoError(t, defaults.Set(&h))
+	require.NoError(t, h.Connect())
+	require.Equal(t, 0, h.ActiveOperations().Sessions)
+
+	stdin, w := io.Pipe()
+	waiter, err := h.ExecStreams("cat", stdin, io.Discard, io.Discard)
+	require.NoError(t, err)
+	require.Equal(t, 1, h.ActiveOperations().Sessions)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, h.WaitIdle(ctx), ErrTimeout)
+
+	require.NoError(t, w.Close())
+	require.NoError(t, waiter.Wait())
+	require.NoError(t, h.WaitIdle(context.Background()))
+	require.Equal(t, 0, h.ActiveOperations().Sessions)
+}
+
+type recordingMockClient struct {
+	mockClient
+}
+
+func (m *recordingMockClient) ExecInteractiveWithOutput(_ string, output io.Writer) error {
+	_, err := output.Write([]byte("hello\r\n"))
+	return err
+}
+
+func TestExecInteractiveAsciicast(t *testing.T) {
+	var cast bytes.Buffer
+	c := &Connection{client: &Localhost{Enabled: true}}
+	require.ErrorIs(t, c.ExecInteractive("bash", exec.Asciicast(&cast)), ErrNotSupported)
+
+	c = &Connection{client: &recordingMockClient{}}
+	require.NoError(t, c.ExecInteractive("bash", exec.Asciicast(&cast)))
+	lines := strings.Split(strings.TrimSpace(cast.String()), "\n")
+	require.Len(t, lines, 2)
+	require.Contains(t, lines[0], `"version":2`)
+	require.Contains(t, lines[0], `"command":"bash"`)
+	require.Contains(t, lines[1], `"o","hello\r\n"]`)
+}
+
+func TestCommandErrorOutput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh commands")
+	}
+	h := Host{Connection: Connection{Localhost: &Localhost{Enabled: true}}}
+	require.NoError(t, defaults.Set(&h))
+	require.NoError(t, h.Connect())
+
+	err := h.Exec("echo hunter2 >&2; echo failed; exit 2", exec.RedactString("hunter2"))
+	var cmdErr *CommandError
+	require.ErrorAs(t, err, &cmdErr)
+	require.Contains(t, cmdErr.Output, "[REDACTED]\n")
+	require.Contains(t, cmdErr.Output, "failed\n")
+	require.NotContains(t, cmdErr.Output, "hunter2")
+	code, ok := exec.ExitCode(err)
+	require.True(t, ok)
+	require.Equal(t, 2, code)
+
+	var stdout bytes.Buffer
+	err = h.Exec("for i in $(seq 1 1000); do echo line$i; done; exit 1", exec.StdoutWriter(&stdout), exec.ErrorOutputBytes(16))
+	require.ErrorAs(t, err, &cmdErr)
+	require.Equal(t, "ine999\nline1000\n", cmdErr.Output)
+	require.True(t, strings.HasPrefix(stdout.String(), "line1\n"))
+
+	err = h.Exec("exit 1", exec.ErrorOutputBytes(0))
+	require.False(t, errors.As(err, &cmdErr))
+}
+
+func TestRetriesStdinReader(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a posix shell")
+	}
+	h := Host{Connection: Connection{Localhost: &Localhost{Enabled: true}}}
+	require.NoError(t, defaults.Set(&h))
+	require.NoError(t, h.Connect())
+
+	out := filepath.Join(t.TempDir(), "out")
+	cmd := "cat >> " + shellescape.Quote(out) + "; exit 1"
+	retries := exec.Retries(2, &clock.Backoff{})
+
+	err := h.Exec(cmd, retries, exec.StdinReader(strings.NewReader("data")))
+	require.ErrorIs(t, err, ErrCommandFailed)
+	content, err := os.ReadFile(out)
+	require.NoError(t, err)
+	require.Equal(t, "datadatadata", string(content), "stdin is rewound for each retry")
+
+	err = h.Exec(cmd, retries, exec.StdinReader(io.MultiReader(strings.NewReader("data"))))
+	require.ErrorIs(t, err, ErrValidationFailed)
+	content, err = os.ReadFile(out)
+	require.NoError(t, err)
+	require.Equal(t, "datadatadata", string(content), "the command is not run")
+}
+
+func TestConnectionClone(t *testing.T) {
+	c := &Connection{Localhost: &Localhost{Enabled: true}}
+	require.NoError(t, defaults.Set(c))
+	require.NoError(t, c.Connect())
+	t.Cleanup(func() { _ = c.Disconnect() })
+	_, err := c.ExecOutput("echo hello")
+	require.NoError(t, err)
+	require.NotNil(t, c.OSVersion)
+
+	clone := c.Clone()
+	require.False(t, clone.IsConnected())
+	require.Nil(t, clone.OSVersion)
+	clone.Localhost.Cwd = t.TempDir()
+	require.Empty(t, c.Localhost.Cwd)
+
+	clone.Reset()
+	require.True(t, c.IsConnected(), "resetting the clone must not disconnect the original")
+	_, err = c.ExecOutput("echo hello")
+	require.NoError(t, err)
+
+	require.NoError(t, clone.Connect())
+	t.Cleanup(func() { _ = clone.Disconnect() })
+	out, err := clone.ExecOutput("pwd")
+	require.NoError(t, err)
+	require.Equal(t, clone.Localhost.Cwd, out)
 }
@@ -0,0 +1,56 @@
+package rig
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/creasty/defaults"
+	"github.com/stretchr/testify/require"
+)
+
+type urlClient struct {
+	mockClient
+	Target string
+}
+
+func (c *urlClient) ConfigureFromURL(u *url.URL) error {
+	c.Target = u.Host
+	return nil
+}
+
+func TestParseConnectionString(t *testing.T) {
+	c, err := ParseConnectionString("ssh://admin@10.0.0.1:2222?key=~/.ssh/id_ed25519&bastion=ssh://jump.example.com")
+	require.NoError(t, err)
+	require.NoError(t, defaults.Set(c))
+	require.Equal(t, "10.0.0.1", c.SSH.Address)
+	require.Equal(t, "admin", c.SSH.User)
+	require.Equal(t, 2222, c.SSH.Port)
+	require.Equal(t, "~/.ssh/id_ed25519", *c.SSH.KeyPath)
+	require.Equal(t, "jump.example.com", c.SSH.Bastion.Address)
+	require.Equal(t, 22, c.SSH.Bastion.Port)
+	require.Equal(t, "root", c.SSH.Bastion.User)
+
+	c, err = ParseConnectionString("winrms://Administrator:p%40ss@[fe80::1]?insecure")
+	require.NoError(t, err)
+	require.Equal(t, "fe80::1", c.WinRM.Address)
+	require.Equal(t, "p@ss", c.WinRM.Password)
+	require.True(t, c.WinRM.UseHTTPS)
+	require.True(t, c.WinRM.Insecure)
+	require.Equal(t, 5986, c.WinRM.Port)
+
+	c, err = ParseConnectionString("localhost://")
+	require.NoError(t, err)
+	require.True(t, c.Localhost.Enabled)
+
+	RegisterClient("urltest", func() Client { return &urlClient{} })
+	c, err = ParseConnectionString("urltest://foo")
+	require.NoError(t, err)
+	require.Equal(t, "foo", c.Custom.Client.(*urlClient).Target)
+
+	_, err = ParseConnectionString("custom://foo")
+	require.ErrorIs(t, err, ErrNotSupported)
+	_, err = ParseConnectionString("10.0.0.1")
+	require.ErrorIs(t, err, ErrValidationFailed)
+	_, err = ParseConnectionString("ssh://host:99999")
+	require.ErrorIs(t, err, ErrValidationFailed)
+}
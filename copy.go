@@ -0,0 +1,103 @@
+package rig
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/k0sproject/rig/exec"
+)
+
+// Copy copies the file srcPath on the host of srcConn to dstPath on the host of dstConn. The data is
+// streamed through the controller without storing it locally. The file mode is copied and the
+// checksums of both files are validated against the transferred data, see exec.Checksum. Pass
+// exec.Sudo to access the files on both hosts with elevated privileges.
+func Copy(srcConn *Connection, srcPath string, dstConn *Connection, dstPath string, opts ...exec.Option) error {
+	if err := srcConn.checkConnected(); err != nil {
+		return err
+	}
+	if err := dstConn.checkConnected(); err != nil {
+		return err
+	}
+	srcConn.Logger().Debugf("copying %s:%s to %s:%s", srcConn, srcPath, dstConn, dstPath)
+	srcOpts := sudoFor(srcConn, opts)
+	dstOpts := sudoFor(dstConn, opts)
+
+	src, err := srcConn.fsysFor(srcOpts...).OpenFile(srcPath, ModeRead, 0)
+	if err != nil {
+		return ErrInvalidPath.Wrapf("open source file for reading: %w", err)
+	}
+	defer src.Close()
+
+	stat, err := src.Stat()
+	if err != nil {
+		return ErrInvalidPath.Wrapf("stat source file %s: %w", srcPath, err)
+	}
+	if stat.IsDir() {
+		return ErrInvalidPath.Wrapf("%s is a directory", srcPath)
+	}
+	perm := stat.Mode().Perm()
+	if perm == 0 {
+		perm = 0o644
+	}
+
+	dst, err := dstConn.fsysFor(dstOpts...).OpenFile(dstPath, ModeCreate, int(perm))
+	if err != nil {
+		return ErrInvalidPath.Wrapf("open destination file for writing: %w", err)
+	}
+	defer dst.Close()
+
+	shasum, err := newChecksum(opts...)
+	if err != nil {
+		return ErrCopyFailed.Wrap(err)
+	}
+
+	if stat.Size() > 0 {
+		pr, pw := io.Pipe()
+		go func() {
+			_, err := src.Copy(pw)
+			if errors.Is(err, io.EOF) {
+				err = nil
+			}
+			_ = pw.CloseWithError(err)
+		}()
+		progress := exec.ProgressWriter(exec.Build(opts...).Progress, stat.Size())
+		_, err := dst.CopyFromN(pr, stat.Size(), io.MultiWriter(hashWriter(shasum), progress))
+		_ = pr.CloseWithError(err)
+		if err != nil {
+			return ErrCopyFailed.Wrapf("copy %s to %s: %w", srcPath, dstPath, err)
+		}
+	}
+
+	if err := dst.Close(); err != nil {
+		return ErrCopyFailed.Wrapf("close destination file: %w", err)
+	}
+
+	if shasum != nil {
+		sum := fmt.Sprintf("%x", shasum.Sum(nil))
+		for _, side := range []struct {
+			conn *Connection
+			path string
+			opts []exec.Option
+		}{{srcConn, srcPath, srcOpts}, {dstConn, dstPath, dstOpts}} {
+			remoteSum, err := side.conn.remoteChecksum(side.path, side.opts...)
+			if err != nil {
+				return ErrCopyFailed.Wrapf("validate checksum of %s: %w", side.path, err)
+			}
+			if remoteSum != sum {
+				return ErrCopyFailed.Wrap(ErrChecksumMismatch.Wrapf("%s:%s: transferred %s, file %s", side.conn, side.path, sum, remoteSum))
+			}
+		}
+	}
+
+	return nil
+}
+
+// sudoFor returns opts with the elevation of conn when they ask for sudo, so that the commands run on
+// conn aren't elevated using the method of the host given to exec.Sudo
+func sudoFor(conn *Connection, opts []exec.Option) []exec.Option {
+	if !exec.Build(opts...).Sudo {
+		return opts
+	}
+	return append(opts[:len(opts):len(opts)], exec.Sudo(conn))
+}
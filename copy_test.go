@@ -0,0 +1,24 @@
+package rig
+
+import (
+	"testing"
+
+	"github.com/k0sproject/rig/exec"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopySudoFor(t *testing.T) {
+	src := &Connection{client: &mockClient{}, sudofunc: sudoSudo}
+	dst := &Connection{client: &mockClient{}, sudofunc: sudoDoas}
+	opts := []exec.Option{exec.Sudo(src)}
+
+	cmd, err := exec.Build(sudoFor(dst, opts)...).Command("true")
+	require.NoError(t, err)
+	require.Equal(t, sudoDoas("true"), cmd)
+
+	cmd, err = exec.Build(sudoFor(src, opts)...).Command("true")
+	require.NoError(t, err)
+	require.Equal(t, sudoSudo("true"), cmd)
+
+	require.False(t, exec.Build(sudoFor(dst, nil)...).Sudo)
+}
@@ -0,0 +1,97 @@
+package rig
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/k0sproject/rig/exec"
+	"github.com/k0sproject/rig/log"
+)
+
+// withCorrelationID prepends a new correlation id to opts unless they already have one, so that the
+// log lines and errors of an operation can be told apart from the ones running in parallel, see
+// CorrelatedError
+func withCorrelationID(opts []exec.Option) []exec.Option {
+	if exec.Build(opts...).CorrelationID != "" {
+		return opts
+	}
+	return append([]exec.Option{exec.CorrelationID(exec.NewCorrelationID())}, opts...)
+}
+
+// CorrelatedError is returned by the commands and file transfers of a connection. ID is the correlation
+// id of the operation, which is also in its log lines, see exec.CorrelationID. The id is not included in
+// the error message, use errors.As to get it:
+//
+//	var ce *rig.CorrelatedError
+//	if errors.As(err, &ce) {
+//		fmt.Println("see the log lines starting with", "["+ce.ID+"]")
+//	}
+type CorrelatedError struct {
+	ID  string
+	Err error
+
+	redact func(string) string
+}
+
+// Error returns the redacted message of the wrapped error
+func (e *CorrelatedError) Error() string {
+	if e.redact == nil {
+		return e.Err.Error()
+	}
+	return e.redact(e.Err.Error())
+}
+
+// Unwrap returns the wrapped error
+func (e *CorrelatedError) Unwrap() error {
+	return e.Err
+}
+
+// correlateError adds the correlation id of opts to err unless it already has it. The message of the
+// error is redacted using the redact options and the secrets of the connection.
+func (c Connection) correlateError(opts []exec.Option, err error) error {
+	if err == nil {
+		return nil
+	}
+	execOpts := exec.Build(append(opts[:len(opts):len(opts)], exec.RedactWith(c.redactor))...)
+	if execOpts.CorrelationID == "" {
+		return err
+	}
+	var ce *CorrelatedError
+	if errors.As(err, &ce) && ce.ID == execOpts.CorrelationID {
+		return err
+	}
+	return &CorrelatedError{ID: execOpts.CorrelationID, Err: err, redact: execOpts.Redact}
+}
+
+// correlatedWaiter adds the correlation id of the command to the error returned by Wait
+type correlatedWaiter struct {
+	Waiter
+	conn Connection
+	opts []exec.Option
+}
+
+func (w *correlatedWaiter) Wait() error {
+	return w.conn.correlateError(w.opts, w.Waiter.Wait())
+}
+
+// correlatedLogger prefixes the log messages with a correlation id
+type correlatedLogger struct {
+	log.Logger
+	prefix string
+}
+
+func (l correlatedLogger) Tracef(t string, args ...interface{}) { l.Logger.Tracef(l.prefix+t, args...) }
+func (l correlatedLogger) Debugf(t string, args ...interface{}) { l.Logger.Debugf(l.prefix+t, args...) }
+func (l correlatedLogger) Infof(t string, args ...interface{})  { l.Logger.Infof(l.prefix+t, args...) }
+func (l correlatedLogger) Warnf(t string, args ...interface{})  { l.Logger.Warnf(l.prefix+t, args...) }
+func (l correlatedLogger) Errorf(t string, args ...interface{}) { l.Logger.Errorf(l.prefix+t, args...) }
+
+// loggerFor returns the logger of the connection, prefixing the messages with the correlation id of
+// opts when there is one
+func (c Connection) loggerFor(opts []exec.Option) log.Logger {
+	id := exec.Build(opts...).CorrelationID
+	if id == "" {
+		return c.Logger()
+	}
+	return correlatedLogger{Logger: c.Logger(), prefix: "[" + strings.ReplaceAll(id, "%", "%%") + "] "}
+}
@@ -0,0 +1,206 @@
+package rig
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/k0sproject/rig/pkg/redact"
+	"golang.org/x/term"
+)
+
+// CredentialKind identifies the secret asked from a CredentialSource
+type CredentialKind string
+
+const (
+	CredentialPassword      CredentialKind = "password"       // CredentialPassword is the password of the WinRM user
+	CredentialKeyPassphrase CredentialKind = "key-passphrase" // CredentialKeyPassphrase decrypts an encrypted SSH private key
+	CredentialSudoPassword  CredentialKind = "sudo-password"  // CredentialSudoPassword is the password of the user for sudo
+	CredentialRootPassword  CredentialKind = "root-password"  // CredentialRootPassword is the password of root for su
+)
+
+// CredentialSource provides the passwords and passphrases needed for connecting to a host and for
+// elevating privileges on it. Lookup returns an error wrapping ErrNotFound when it doesn't have the
+// secret, the secret is then treated as not configured.
+//
+// A source can be set for a single connection in Connection.Credentials or for all of them in
+// DefaultCredentialSource. The values in the configuration, SSH.PasswordCallback and
+// Connection.RootPassword take precedence.
+type CredentialSource interface {
+	Lookup(kind CredentialKind, host string) (string, error)
+}
+
+// CredentialSourceFunc is a function that implements CredentialSource
+type CredentialSourceFunc func(kind CredentialKind, host string) (string, error)
+
+// Lookup calls the function
+func (f CredentialSourceFunc) Lookup(kind CredentialKind, host string) (string, error) {
+	return f(kind, host)
+}
+
+// DefaultCredentialSource is used by the connections that don't have Credentials set
+var DefaultCredentialSource CredentialSource
+
+// CredentialChain returns a source that tries each of the sources in order until one of them has
+// the secret
+func CredentialChain(sources ...CredentialSource) CredentialSource {
+	return CredentialSourceFunc(func(kind CredentialKind, host string) (string, error) {
+		for _, source := range sources {
+			secret, err := source.Lookup(kind, host)
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			return secret, err //nolint:wrapcheck
+		}
+		return "", ErrNotFound.Wrapf("no %s for %s", kind, host)
+	})
+}
+
+// credentialKey turns s into an uppercase environment variable name component, such as
+// 10_0_0_1 for 10.0.0.1 or ROOT_PASSWORD for root-password
+func credentialKey(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// EnvCredentials returns a source that reads the secrets from environment variables named after
+// the prefix, the kind and the host, falling back to one without the host. For example, with the
+// prefix RIG the root password for 10.0.0.1 is read from RIG_ROOT_PASSWORD_10_0_0_1 or
+// RIG_ROOT_PASSWORD.
+func EnvCredentials(prefix string) CredentialSource {
+	return CredentialSourceFunc(func(kind CredentialKind, host string) (string, error) {
+		name := credentialKey(prefix) + "_" + credentialKey(string(kind))
+		if value, ok := os.LookupEnv(name + "_" + credentialKey(host)); ok && host != "" {
+			return value, nil
+		}
+		if value, ok := os.LookupEnv(name); ok {
+			return value, nil
+		}
+		return "", ErrNotFound.Wrapf("environment variable %s is not set", name)
+	})
+}
+
+// FileCredentials returns a source that reads the secrets from files named after the kind in a
+// directory named after the host under dir, falling back to the one directly in dir. For example
+// the root password for 10.0.0.1 is read from dir/10.0.0.1/root-password or dir/root-password. A
+// trailing line break in the file is ignored.
+func FileCredentials(dir string) CredentialSource {
+	return CredentialSourceFunc(func(kind CredentialKind, host string) (string, error) {
+		paths := []string{filepath.Join(dir, string(kind))}
+		if host := strings.Map(hostPathRune, host); host != "" && strings.Trim(host, ".") != "" {
+			paths = append([]string{filepath.Join(dir, host, string(kind))}, paths...)
+		}
+		for _, path := range paths {
+			data, err := os.ReadFile(path)
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return "", ErrOS.Wrapf("read %s: %w", path, err)
+			}
+			return strings.TrimRight(string(data), "\r\n"), nil
+		}
+		return "", ErrNotFound.Wrapf("no %s file for %s in %s", kind, host, dir)
+	})
+}
+
+// hostPathRune replaces the characters that can't be used in a directory name on every platform
+func hostPathRune(r rune) rune {
+	if strings.ContainsRune(`/\:*?"<>|`, r) || r < ' ' {
+		return '_'
+	}
+	return r
+}
+
+// promptMu keeps the prompts of connections made in parallel from getting mixed up
+var promptMu sync.Mutex
+
+// PromptCredentials is a source that asks for the secrets on the terminal. The secrets are treated
+// as not configured when stdin is not a terminal.
+var PromptCredentials CredentialSource = CredentialSourceFunc(func(kind CredentialKind, host string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", ErrNotFound.Wrapf("can't prompt for %s, stdin is not a terminal", kind)
+	}
+	promptMu.Lock()
+	defer promptMu.Unlock()
+	fmt.Fprintf(os.Stderr, "%s for %s: ", strings.ReplaceAll(string(kind), "-", " "), host)
+	secret, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", ErrOS.Wrapf("read %s: %w", kind, err)
+	}
+	return string(secret), nil
+})
+
+// lookupCredential asks the source, or DefaultCredentialSource when source is nil, for a secret.
+// It returns false when there is no source or the source doesn't have the secret. The secret is
+// registered for redaction in r.
+func lookupCredential(r *redact.Redactor, source CredentialSource, kind CredentialKind, host string) (string, bool, error) {
+	if source == nil {
+		source = DefaultCredentialSource
+	}
+	if source == nil {
+		return "", false, nil
+	}
+	secret, err := source.Lookup(kind, host)
+	if errors.Is(err, ErrNotFound) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, ErrAuthFailed.Wrapf("get %s for %s: %w", kind, host, err)
+	}
+	r.Value(secret)
+	return secret, true, nil
+}
+
+// credentialSetter is implemented by the clients that use a CredentialSource
+type credentialSetter interface {
+	setCredentials(source CredentialSource)
+}
+
+// setCredentials sets the source of the key passphrases for the connection and its bastion
+func (c *SSH) setCredentials(source CredentialSource) {
+	c.credentials = source
+	if c.Bastion != nil {
+		c.Bastion.setCredentials(source)
+	}
+}
+
+// setCredentials sets the source of the password for the connection and its bastion
+func (c *WinRM) setCredentials(source CredentialSource) {
+	c.credentials = source
+	if c.Bastion != nil {
+		c.Bastion.setCredentials(source)
+	}
+}
+
+// setClientCredentials passes Credentials to the client
+func (c *Connection) setClientCredentials() {
+	if cs, ok := c.client.(credentialSetter); ok && c.Credentials != nil {
+		cs.setCredentials(c.Credentials)
+	}
+}
+
+// rootPassword returns the root password for su from RootPassword or the credential source. It
+// returns false when neither has it.
+func (c *Connection) rootPassword() (string, bool, error) {
+	if c.RootPassword != nil {
+		password, err := c.RootPassword()
+		if err != nil {
+			return "", false, ErrAuthFailed.Wrapf("get root password: %w", err)
+		}
+		return password, true, nil
+	}
+	return lookupCredential(c.secrets(), c.Credentials, CredentialRootPassword, c.Address())
+}
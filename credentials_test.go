@@ -0,0 +1,107 @@
+package rig
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/creasty/defaults"
+	"github.com/k0sproject/rig/exec"
+	"github.com/k0sproject/rig/pkg/redact"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCredentialSources(t *testing.T) {
+	t.Setenv("RIGTEST_ROOT_PASSWORD_10_0_0_1", "host-secret")
+	t.Setenv("RIGTEST_ROOT_PASSWORD", "secret")
+	env := EnvCredentials("rigtest")
+	secret, err := env.Lookup(CredentialRootPassword, "10.0.0.1")
+	require.NoError(t, err)
+	require.Equal(t, "host-secret", secret)
+	secret, err = env.Lookup(CredentialRootPassword, "10.0.0.2")
+	require.NoError(t, err)
+	require.Equal(t, "secret", secret)
+	_, err = env.Lookup(CredentialKeyPassphrase, "10.0.0.1")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "10.0.0.1"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "10.0.0.1", "key-passphrase"), []byte("from-file\n"), 0o600))
+	files := FileCredentials(dir)
+	secret, err = files.Lookup(CredentialKeyPassphrase, "10.0.0.1")
+	require.NoError(t, err)
+	require.Equal(t, "from-file", secret)
+	_, err = files.Lookup(CredentialKeyPassphrase, "10.0.0.2")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	chain := CredentialChain(files, env)
+	secret, err = chain.Lookup(CredentialKeyPassphrase, "10.0.0.1")
+	require.NoError(t, err)
+	require.Equal(t, "from-file", secret)
+	secret, err = chain.Lookup(CredentialRootPassword, "10.0.0.1")
+	require.NoError(t, err)
+	require.Equal(t, "host-secret", secret)
+	_, err = chain.Lookup(CredentialPassword, "10.0.0.1")
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestCredentialsElevate(t *testing.T) {
+	defer redact.Reset()
+	mc := mockClient{}
+	c := &Connection{
+		client: &mc,
+		Credentials: CredentialSourceFunc(func(kind CredentialKind, host string) (string, error) {
+			require.Equal(t, CredentialRootPassword, kind)
+			require.Equal(t, "127.0.0.1", host)
+			return "rootpw", nil
+		}),
+	}
+	method, err := (&Elevate{Method: ElevateSu}).elevation(c)
+	require.NoError(t, err)
+	require.Contains(t, method.sudo("ls"), "printf '%s\\n' rootpw | su root -c")
+	require.Equal(t, "rootpw", c.elevatePassword)
+
+	require.Equal(t, `RIG_ASKPASS='pass word' SUDO_ASKPASS=/tmp/askpass sudo -A -p '' -s -- ls /tmp`, sudoSudoPassword("pass word", "/tmp/askpass")("ls /tmp"))
+}
+
+func TestSudoPasswordStdin(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+	defer redact.Reset()
+	installFakeSudo(t, "sudopw")
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	c := &Connection{
+		Localhost: &Localhost{Enabled: true},
+		Elevate:   &Elevate{Method: ElevateSudo},
+		Credentials: CredentialSourceFunc(func(kind CredentialKind, _ string) (string, error) {
+			require.Equal(t, CredentialSudoPassword, kind)
+			return "sudopw", nil
+		}),
+	}
+	require.NoError(t, defaults.Set(c))
+	require.NoError(t, c.Connect())
+	require.Equal(t, ElevateSudo, c.ElevationMethod())
+	require.NotEmpty(t, c.askpassPath)
+
+	out, err := c.ExecOutput("cat", exec.Stdin("hello"), exec.Sudo(c))
+	require.NoError(t, err)
+	require.Equal(t, "hello", out, "stdin is passed on to the command instead of the password")
+	out, err = c.ExecOutput("cat", exec.Stdin("hello"), exec.RunAs("nobody"))
+	require.NoError(t, err)
+	require.Equal(t, "hello", out)
+
+	path := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, c.SudoFsys().WriteFile(path, []byte("data\n"), 0o600))
+	data, err := c.SudoFsys().ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "data\n", string(data))
+
+	require.NoError(t, c.Disconnect())
+	entries, err := os.ReadDir(home)
+	require.NoError(t, err)
+	require.Empty(t, entries, "the askpass helper is removed when disconnecting")
+}
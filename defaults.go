@@ -0,0 +1,76 @@
+package rig
+
+import "sync"
+
+// The defaults used by SetDefaults of the SSH and WinRM configurations for the fields that have not
+// been set. Change them using the SetDefault functions before the configurations are loaded.
+var (
+	defaultsMu            sync.RWMutex
+	defaultKeypaths       = []string{"~/.ssh/id_rsa", "~/.ssh/identity", "~/.ssh/id_dsa"}
+	defaultSSHUser        = "root"
+	defaultSSHPort        = 22
+	defaultWinRMUser      = "Administrator"
+	defaultWinRMPort      = 5985
+	defaultWinRMHTTPSPort = 5986
+)
+
+// SetDefaultSSHKeyPaths sets the identity files tried when an SSH configuration has no KeyPath and
+// the ssh config does not have any for the host. The default is ~/.ssh/id_rsa, ~/.ssh/identity and
+// ~/.ssh/id_dsa.
+func SetDefaultSSHKeyPaths(paths ...string) {
+	defaultsMu.Lock()
+	defer defaultsMu.Unlock()
+	defaultKeypaths = append([]string(nil), paths...)
+}
+
+// SetDefaultSSHUser sets the user of the SSH configurations that don't have one, root by default
+func SetDefaultSSHUser(user string) {
+	defaultsMu.Lock()
+	defer defaultsMu.Unlock()
+	defaultSSHUser = user
+}
+
+// SetDefaultSSHPort sets the port of the SSH configurations that don't have one, 22 by default
+func SetDefaultSSHPort(port int) {
+	defaultsMu.Lock()
+	defer defaultsMu.Unlock()
+	defaultSSHPort = port
+}
+
+// SetDefaultWinRMUser sets the user of the WinRM configurations that don't have one, Administrator
+// by default
+func SetDefaultWinRMUser(user string) {
+	defaultsMu.Lock()
+	defer defaultsMu.Unlock()
+	defaultWinRMUser = user
+}
+
+// SetDefaultWinRMPort sets the port of the WinRM configurations that don't have one, 5985 by
+// default
+func SetDefaultWinRMPort(port int) {
+	defaultsMu.Lock()
+	defer defaultsMu.Unlock()
+	defaultWinRMPort = port
+}
+
+// SetDefaultWinRMHTTPSPort sets the port of the WinRM configurations that use HTTPS and don't have
+// one, 5986 by default
+func SetDefaultWinRMHTTPSPort(port int) {
+	defaultsMu.Lock()
+	defer defaultsMu.Unlock()
+	defaultWinRMHTTPSPort = port
+}
+
+// sshDefaults returns the current defaults for SSH configurations
+func sshDefaults() (user string, port int, keyPaths []string) {
+	defaultsMu.RLock()
+	defer defaultsMu.RUnlock()
+	return defaultSSHUser, defaultSSHPort, append([]string(nil), defaultKeypaths...)
+}
+
+// winrmDefaults returns the current defaults for WinRM configurations
+func winrmDefaults() (user string, port, httpsPort int) {
+	defaultsMu.RLock()
+	defer defaultsMu.RUnlock()
+	return defaultWinRMUser, defaultWinRMPort, defaultWinRMHTTPSPort
+}
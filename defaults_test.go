@@ -0,0 +1,41 @@
+package rig
+
+import (
+	"testing"
+
+	"github.com/creasty/defaults"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultOverrides(t *testing.T) {
+	SetDefaultSSHUser("admin")
+	SetDefaultSSHPort(2222)
+	SetDefaultWinRMUser("winadmin")
+	SetDefaultWinRMHTTPSPort(8443)
+	defer func() {
+		SetDefaultSSHUser("root")
+		SetDefaultSSHPort(22)
+		SetDefaultWinRMUser("Administrator")
+		SetDefaultWinRMHTTPSPort(5986)
+	}()
+
+	key := "/nonexistent"
+	s := &SSH{Address: "10.0.0.1", KeyPath: &key}
+	require.NoError(t, defaults.Set(s))
+	require.Equal(t, "admin", s.User)
+	require.Equal(t, 2222, s.Port)
+
+	s = &SSH{Address: "10.0.0.1", User: "root", Port: 22, KeyPath: &key}
+	require.NoError(t, defaults.Set(s))
+	require.Equal(t, "root", s.User, "an explicitly set user is kept")
+	require.Equal(t, 22, s.Port, "an explicitly set port is kept")
+
+	w := &WinRM{Address: "10.0.0.1"}
+	require.NoError(t, defaults.Set(w))
+	require.Equal(t, "winadmin", w.User)
+	require.Equal(t, 5985, w.Port)
+
+	w = &WinRM{Address: "10.0.0.1", UseHTTPS: true}
+	require.NoError(t, defaults.Set(w))
+	require.Equal(t, 8443, w.Port)
+}
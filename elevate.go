@@ -0,0 +1,208 @@
+package rig
+
+import (
+	"strings"
+	"text/template"
+
+	"github.com/alessio/shellescape"
+	"github.com/k0sproject/rig/exec"
+)
+
+// Privilege elevation methods for Elevate and the values returned by Connection.ElevationMethod
+const (
+	ElevateNone   = "none"   // ElevateNone is used when the user already has the privileges
+	ElevateRunas  = "runas"  // ElevateRunas elevates using runas on windows
+	ElevateSudo   = "sudo"   // ElevateSudo elevates using sudo, with the CredentialSudoPassword when one is available
+	ElevateDoas   = "doas"   // ElevateDoas elevates using doas
+	ElevateSu     = "su"     // ElevateSu elevates using su, see Connection.RootPassword
+	ElevateDzdo   = "dzdo"   // ElevateDzdo elevates using Centrify dzdo
+	ElevatePbrun  = "pbrun"  // ElevatePbrun elevates using BeyondTrust pbrun
+	ElevateCustom = "custom" // ElevateCustom elevates using the command in Elevate.Template
+)
+
+// Elevate configures how the privileges are elevated on a host, overriding the automatic detection
+//
+// For example, to use doas even when sudo is available:
+//
+//	connection:
+//	  elevate:
+//	    method: doas
+//
+// or to use a custom command:
+//
+//	connection:
+//	  elevate:
+//	    method: custom
+//	    template: "priv-run --as {{.User}} -- sh -c {{.Command}}"
+type Elevate struct {
+	// Method is one of sudo, doas, dzdo, pbrun, su or custom
+	Method string `yaml:"method" json:"method" mapstructure:"method" validate:"required,oneof=sudo doas dzdo pbrun su custom"`
+	// Template is a text/template for the command of the custom method. {{.Command}} is replaced
+	// with the shell quoted command and {{.User}} with the user.
+	Template string `yaml:"template,omitempty" json:"template,omitempty" mapstructure:"template"`
+	// User is the user to elevate to. Defaults to root.
+	User string `yaml:"user,omitempty" json:"user,omitempty" mapstructure:"user"`
+}
+
+// elevateTemplateData is the data for Elevate.Template
+type elevateTemplateData struct {
+	Command string
+	User    string
+}
+
+// templateRunAs returns a runasfn that renders the command using a custom template
+func templateRunAs(text string) (runasfn, error) {
+	tmpl, err := template.New("elevate").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, ErrValidationFailed.Wrapf("parse elevate template: %w", err)
+	}
+	// render once to catch the errors that only show up when executing
+	if err := tmpl.Execute(&strings.Builder{}, elevateTemplateData{}); err != nil {
+		return nil, ErrValidationFailed.Wrapf("execute elevate template: %w", err)
+	}
+	return func(user, cmd string) string {
+		var sb strings.Builder
+		// can't fail, the template was validated above
+		_ = tmpl.Execute(&sb, elevateTemplateData{Command: shellescape.Quote(cmd), User: user})
+		return sb.String()
+	}, nil
+}
+
+// elevateMethods are the Elevate methods that wrap commands using a program
+var elevateMethods = map[string]elevation{
+	ElevateSudo:  {name: ElevateSudo, sudo: sudoSudo, runAs: runAsSudo},
+	ElevateDoas:  {name: ElevateDoas, sudo: sudoDoas, runAs: runAsDoas},
+	ElevateDzdo:  {name: ElevateDzdo, sudo: sudoDzdo, runAs: runAsDzdo},
+	ElevatePbrun: {name: ElevatePbrun, sudo: sudoPbrun, runAs: runAsPbrun},
+}
+
+// elevation returns the functions for the configured elevation method
+func (e *Elevate) elevation(c *Connection) (elevation, error) {
+	user := e.User
+	if user == "" {
+		user = "root"
+	}
+	method, ok := elevateMethods[e.Method]
+	if e.Method == ElevateSudo {
+		if withPassword, found, err := c.sudoPasswordElevation(); err != nil {
+			return elevation{}, err
+		} else if found {
+			method = withPassword
+		}
+	}
+	switch {
+	case ok:
+	case e.Method == ElevateSu:
+		return c.suElevation(user)
+	case e.Method == ElevateCustom:
+		if e.Template == "" {
+			return elevation{}, ErrValidationFailed.Wrapf("elevate method custom requires a template")
+		}
+		runAs, err := templateRunAs(e.Template)
+		if err != nil {
+			return elevation{}, err
+		}
+		method = elevation{name: ElevateCustom, runAs: runAs}
+	default:
+		return elevation{}, ErrValidationFailed.Wrapf("unknown elevate method %q", e.Method)
+	}
+	if user != "root" || method.sudo == nil {
+		runAs := method.runAs
+		method.sudo = func(cmd string) string { return runAs(user, cmd) }
+	}
+	return method, nil
+}
+
+// suElevation returns the elevation using su with the password from RootPassword or the credential
+// source, elevating to user
+func (c *Connection) suElevation(user string) (elevation, error) {
+	password, ok, err := c.rootPassword()
+	if err != nil {
+		return elevation{}, err
+	}
+	if !ok {
+		return elevation{}, ErrValidationFailed.Wrapf("elevating using su requires a root password")
+	}
+	c.elevatePassword = password
+	c.RedactValue(password)
+	c.RedactValue(shellescape.Quote(password))
+	su := sudoSu(password)
+	if err := c.Exec(su("true"), exec.Internal()); err != nil {
+		c.elevatePassword = ""
+		return elevation{}, ErrAuthFailed.Wrapf("su: %w", err)
+	}
+	runAs := func(user, cmd string) string {
+		return su(runAsSu(user, cmd))
+	}
+	if user == "root" {
+		return elevation{name: ElevateSu, sudo: su, runAs: runAs}, nil
+	}
+	return elevation{name: ElevateSu, sudo: func(cmd string) string { return runAs(user, cmd) }, runAs: runAs}, nil
+}
+
+// sudoPasswordElevation returns the elevation using sudo with the CredentialSudoPassword from the
+// credential source. It returns false when sudo works without a password, there is no password or
+// sudo does not accept it.
+func (c *Connection) sudoPasswordElevation() (elevation, bool, error) {
+	if c.Credentials == nil && DefaultCredentialSource == nil {
+		return elevation{}, false, nil
+	}
+	// no password is needed when passwordless sudo works and none can be used without sudo
+	if c.Exec("command -v sudo", exec.Internal()) != nil || c.Exec("sudo -n true", exec.Internal()) == nil {
+		return elevation{}, false, nil
+	}
+	password, ok, err := lookupCredential(c.secrets(), c.Credentials, CredentialSudoPassword, c.Address())
+	if err != nil || !ok {
+		return elevation{}, false, err
+	}
+	c.elevatePassword = password
+	c.RedactValue(shellescape.Quote(password))
+	askpass, err := c.sudoAskpass()
+	if err != nil {
+		c.elevatePassword = ""
+		c.Logger().Warnf("%s: sudo with a password failed: %v", c, err)
+		return elevation{}, false, nil
+	}
+	sudo := sudoSudoPassword(password, askpass)
+	if err := c.Exec(sudo("true"), exec.Internal()); err != nil {
+		c.elevatePassword = ""
+		c.removeAskpass()
+		c.Logger().Warnf("%s: sudo with a password failed: %v", c, err)
+		return elevation{}, false, nil
+	}
+	return elevation{name: ElevateSudo, sudo: sudo, runAs: runAsSudoPassword(password, askpass)}, true, nil
+}
+
+// askpassScript creates the askpass helper for sudo and prints its path. The helper prints the
+// password from the environment, it doesn't contain the password itself. It is created in the home
+// directory because the temporary directory is often mounted noexec.
+const askpassScript = `umask 077 && f=$(mktemp "${HOME:-/tmp}/.rig-askpass.XXXXXX") && printf '#!/bin/sh\nprintf "%%s\\n" "$RIG_ASKPASS"\n' > "$f" && chmod 700 "$f" && echo "$f"`
+
+// sudoAskpass creates the askpass helper that gives sudo the password when it is run with -A and the
+// password in RIG_ASKPASS, and returns its path. The helper is removed when disconnecting.
+func (c *Connection) sudoAskpass() (string, error) {
+	if c.askpassPath != "" {
+		return c.askpassPath, nil
+	}
+	path, err := c.ExecOutput("sh -c "+shellescape.Quote(askpassScript), exec.Internal())
+	if err != nil {
+		return "", ErrCommandFailed.Wrapf("create askpass helper: %w", err)
+	}
+	c.askpassPath = path
+	return path, nil
+}
+
+// removeAskpass removes the askpass helper created by sudoAskpass
+func (c *Connection) removeAskpass() {
+	if c.askpassPath == "" {
+		return
+	}
+	if !c.IsConnected() {
+		c.askpassPath = ""
+		return
+	}
+	if err := c.Exec("rm -f -- "+shellescape.Quote(c.askpassPath), exec.Internal()); err != nil {
+		c.Logger().Debugf("%s: failed to remove the askpass helper %s: %v", c, c.askpassPath, err)
+	}
+	c.askpassPath = ""
+}
@@ -0,0 +1,50 @@
+package rig
+
+import (
+	"os"
+	"regexp"
+)
+
+// ExpandEnv enables the expansion of ${VAR} references to environment variables in the address,
+// alias, user, key path, host key, password and certificate path fields when unmarshalling SSH and
+// WinRM configurations from YAML or JSON. Referencing a variable that is not set is an error. Only
+// the ${VAR} form is expanded, a plain $VAR is left as is.
+var ExpandEnv = false
+
+var envRefRe = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnvFields replaces the ${VAR} references in the fields with the values of the environment
+// variables when ExpandEnv is enabled
+func expandEnvFields(fields ...*string) error {
+	if !ExpandEnv {
+		return nil
+	}
+	for _, field := range fields {
+		if field == nil {
+			continue
+		}
+		var missing string
+		*field = envRefRe.ReplaceAllStringFunc(*field, func(ref string) string {
+			name := envRefRe.FindStringSubmatch(ref)[1]
+			value, ok := os.LookupEnv(name)
+			if !ok && missing == "" {
+				missing = name
+			}
+			return value
+		})
+		if missing != "" {
+			return ErrValidationFailed.Wrapf("environment variable %s is not set", missing)
+		}
+	}
+	return nil
+}
+
+// expandEnv expands the environment variable references in the SSH configuration
+func (c *SSH) expandEnv() error {
+	return expandEnvFields(&c.Address, &c.User, c.KeyPath, &c.HostKey, &c.Alias)
+}
+
+// expandEnv expands the environment variable references in the WinRM configuration
+func (c *WinRM) expandEnv() error {
+	return expandEnvFields(&c.Address, &c.User, &c.Password, &c.CACertPath, &c.CertPath, &c.KeyPath, &c.TLSServerName)
+}
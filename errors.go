@@ -14,7 +14,11 @@ var (
 	ErrNotSupported     = errstring.New("not supported")         // ErrNotSupported is returned when a feature is not supported
 	ErrAuthFailed       = errstring.New("authentication failed") // ErrAuthFailed is returned when authentication fails
 	ErrUploadFailed     = errstring.New("upload failed")         // ErrUploadFailed is returned when an upload fails
+	ErrDownloadFailed   = errstring.New("download failed")       // ErrDownloadFailed is returned when a download fails
+	ErrCopyFailed       = errstring.New("copy failed")           // ErrCopyFailed is returned when copying a file between hosts fails
 	ErrNotConnected     = errstring.New("not connected")         // ErrNotConnected is returned when a connection is not established
 	ErrCantConnect      = errstring.New("can't connect")         // ErrCantConnect is returned when a connection is not established and retrying will fail
 	ErrCommandFailed    = errstring.New("command failed")        // ErrCommandFailed is returned when a command fails
+	ErrChecksumMismatch = errstring.New("checksum mismatch")     // ErrChecksumMismatch is returned when the checksum of a transferred file does not match expectation
+	ErrTimeout          = errstring.New("timeout")               // ErrTimeout is returned when a command does not finish within the time set using exec.Timeout
 )
@@ -4,6 +4,8 @@ package errstring
 import (
 	"errors"
 	"fmt"
+
+	"github.com/k0sproject/rig/pkg/redact"
 )
 
 // Error is the base type for rig errors
@@ -13,7 +15,7 @@ type Error struct {
 
 // Error implements the error interface
 func (e *Error) Error() string {
-	return e.msg
+	return redact.String(e.msg)
 }
 
 func (e *Error) Unwrap() error {
@@ -53,7 +55,7 @@ type wrappedError struct {
 }
 
 func (e *wrappedError) Error() string {
-	return e.errA.Error() + ": " + e.errB.Error()
+	return redact.String(e.errA.Error() + ": " + e.errB.Error())
 }
 
 func (e *wrappedError) Is(err error) bool {
@@ -0,0 +1,38 @@
+package rig
+
+import (
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// FuzzArgsCommand verifies that the arguments of a command line built by argsCommand for unix hosts
+// reach the program intact through a real shell
+func FuzzArgsCommand(f *testing.F) {
+	if runtime.GOOS == "windows" {
+		f.Skip("requires a posix shell")
+	}
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		f.Skip("requires a posix shell")
+	}
+
+	for _, s := range []string{"", "plain", "with space", "it's", `"double"`, "$(id)", "`id`", "a;b|c&d", "new\nline", "-n", "*", "~root", "\\", "!", "ä"} {
+		f.Add(s, "second")
+	}
+
+	f.Fuzz(func(t *testing.T, a, b string) {
+		if strings.ContainsRune(a+b, 0) {
+			t.Skip("arguments can't contain NUL")
+		}
+		// prints each of the arguments terminated by a NUL
+		cmd, err := argsCommand([]string{"sh", "-c", `for a; do printf '%s\0' "$a"; done`, "sh", a, b}, false)
+		require.NoError(t, err)
+		out, err := exec.Command(sh, "-c", cmd).Output()
+		require.NoError(t, err)
+		require.Equal(t, a+"\x00"+b+"\x00", string(out))
+	})
+}
@@ -3,14 +3,22 @@ package exec
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"regexp"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/k0sproject/rig/log"
+	"github.com/k0sproject/rig/pkg/clock"
+	"github.com/k0sproject/rig/pkg/redact"
 )
 
 var (
@@ -44,7 +52,20 @@ var (
 		return text == "" || text == "Y" || text == "y"
 	}
 
+	// DefaultConfirmFunc is called with each command before it is run when no function has been set
+	// using the ConfirmWith exec option. The command is not run when it returns false. Unlike with
+	// Confirm, the program is not terminated and an error is returned instead.
+	DefaultConfirmFunc func(cmd string) bool
+
 	mutex sync.Mutex
+
+	// confirmMutex keeps the confirm functions from being called concurrently. A separate mutex is used
+	// so that the output of the other commands isn't blocked while waiting for an answer.
+	confirmMutex sync.Mutex
+
+	// outputLineMutex keeps the output line functions from being called concurrently from the stdout and
+	// stderr readers, so that they don't need to be safe for concurrent use.
+	outputLineMutex sync.Mutex
 )
 
 // Option is a functional option for the exec package
@@ -53,6 +74,7 @@ type Option func(*Options)
 // Options is a collection of exec options
 type Options struct {
 	Stdin          string
+	StdinReader    io.Reader
 	AllowWinStderr bool
 	LogInfo        bool
 	LogDebug       bool
@@ -64,8 +86,42 @@ type Options struct {
 	RedactFunc     func(string) string
 	Output         *string
 	Writer         io.Writer
+	ErrWriter      io.Writer
+	Asciicast      io.Writer
+	OutputStderr   bool
+	OutputLineFunc func(line string, isStderr bool)
+	MaxOutput      int
+	ErrorOutput    int
+	Truncated      *bool
+	ConfirmFunc    func(cmd string) bool
+	Internal       bool
+	Progress       ProgressFunc
+	Transfer       string
+	Compression    string
+	Parallel       int
+	Checksum       string
+	Atomic         bool
+	PreserveOwner  bool
+	PreserveTimes  bool
+	Sparse         bool
+	Env            map[string]string
+	Cwd            string
+	Timeout        time.Duration
+	Retries        int
+	RetryBackoff   *clock.Backoff
+	RetryFunc      func(error) bool
+	Shell          string
+	RunAs          string
+	Logger         log.Logger
+	TraceContext   context.Context
+	CorrelationID  string
 
 	host host
+
+	// the state of output limiting, see MaxOutputBytes
+	outputHead    int
+	outputTail    []byte
+	outputDropped int
 }
 
 type host interface {
@@ -97,14 +153,51 @@ func (o *Options) LogCmd(prefix, cmd string) {
 	}
 
 	if o.LogCommand {
-		DebugFunc("%s: executing `%s`", prefix, o.Redact(cmd))
+		o.debugf("%s: executing `%s`", prefix, o.Redact(cmd))
 	} else {
-		DebugFunc("%s: executing [REDACTED]", prefix)
+		o.debugf("%s: executing [REDACTED]", prefix)
+	}
+}
+
+// Confirmed returns an error matching ErrRejected if running the command was not approved by the
+// function set using ConfirmWith or DefaultConfirmFunc. The command is redacted before it is passed to
+// the function. Internal commands are not passed to the function.
+func (o *Options) Confirmed(cmd string) error {
+	if o.Internal {
+		return nil
+	}
+	fn := o.ConfirmFunc
+	if fn == nil {
+		fn = DefaultConfirmFunc
+	}
+	if fn == nil {
+		return nil
+	}
+	confirmMutex.Lock()
+	defer confirmMutex.Unlock()
+	if !fn(o.Redact(cmd)) {
+		return ErrRejected.Wrapf("`%s`", o.Redact(cmd))
+	}
+	return nil
+}
+
+// StdinSource returns a reader for the data to send to the command stdin or nil when there is none
+func (o *Options) StdinSource() io.Reader {
+	if o.StdinReader != nil {
+		return o.StdinReader
+	}
+	if o.Stdin != "" {
+		return strings.NewReader(o.Stdin)
 	}
+	return nil
 }
 
 // LogStdin is for logging information about command stdin input
 func (o *Options) LogStdin(prefix string) {
+	if o.StdinReader != nil {
+		o.LogDebugf("%s: streaming command stdin from a reader", prefix)
+		return
+	}
 	if o.Stdin == "" || !o.LogDebug {
 		return
 	}
@@ -116,51 +209,153 @@ func (o *Options) LogStdin(prefix string) {
 	}
 }
 
+// correlate prefixes the log message format s with the correlation id when there is one
+func (o *Options) correlate(s string) string {
+	if o.CorrelationID == "" {
+		return s
+	}
+	return "[" + strings.ReplaceAll(o.CorrelationID, "%", "%%") + "] " + s
+}
+
+// debugf logs to the Logger set using the Logger option or to DebugFunc when there is none
+func (o *Options) debugf(s string, args ...interface{}) {
+	s = o.correlate(s)
+	if o.Logger != nil {
+		o.Logger.Debugf(s, args...)
+		return
+	}
+	DebugFunc(s, args...)
+}
+
+// infof logs to the Logger set using the Logger option or to InfoFunc when there is none
+func (o *Options) infof(s string, args ...interface{}) {
+	s = o.correlate(s)
+	if o.Logger != nil {
+		o.Logger.Infof(s, args...)
+		return
+	}
+	InfoFunc(s, args...)
+}
+
+// errorf logs to the Logger set using the Logger option or to ErrorFunc when there is none
+func (o *Options) errorf(s string, args ...interface{}) {
+	s = o.correlate(s)
+	if o.Logger != nil {
+		o.Logger.Errorf(s, args...)
+		return
+	}
+	ErrorFunc(s, args...)
+}
+
 // LogDebugf is a conditional debug logger
 func (o *Options) LogDebugf(s string, args ...interface{}) {
 	if o.LogDebug {
-		DebugFunc(s, args...)
+		o.debugf(s, args...)
 	}
 }
 
 // LogInfof is a conditional info logger
 func (o *Options) LogInfof(s string, args ...interface{}) {
 	if o.LogInfo {
-		InfoFunc(s, args...)
+		o.infof(s, args...)
 	}
 }
 
 // LogErrorf is a conditional error logger
 func (o *Options) LogErrorf(s string, args ...interface{}) {
 	if o.LogError {
-		ErrorFunc(s, args...)
+		o.errorf(s, args...)
 	}
 }
 
 // AddOutput is for appending / displaying output of the command
 func (o *Options) AddOutput(prefix, stdout, stderr string) {
+	if o.OutputLineFunc != nil {
+		outputLineMutex.Lock()
+		if stdout != "" {
+			o.OutputLineFunc(strings.TrimSuffix(stdout, "\n"), false)
+		}
+		if stderr != "" {
+			o.OutputLineFunc(strings.TrimSuffix(stderr, "\n"), true)
+		}
+		outputLineMutex.Unlock()
+	}
+
 	mutex.Lock()
 	defer mutex.Unlock()
 
 	if o.Output != nil && stdout != "" {
-		*o.Output += stdout
+		o.appendOutput(stdout)
+	}
+	if o.Output != nil && o.OutputStderr && stderr != "" {
+		o.appendOutput(stderr)
 	}
 
 	if o.StreamOutput {
 		if stdout != "" {
-			InfoFunc("%s: %s", prefix, strings.TrimSpace(o.Redact(stdout)))
+			o.infof("%s: %s", prefix, strings.TrimSpace(o.Redact(stdout)))
 		} else if stderr != "" {
-			ErrorFunc("%s: %s", prefix, strings.TrimSpace(o.Redact(stderr)))
+			o.errorf("%s: %s", prefix, strings.TrimSpace(o.Redact(stderr)))
 		}
 		return
 	}
 	if o.LogOutput {
 		if stdout != "" {
-			DebugFunc("%s: %s", prefix, strings.TrimSpace(o.Redact(stdout)))
+			o.debugf("%s: %s", prefix, strings.TrimSpace(o.Redact(stdout)))
 		} else if stderr != "" {
-			DebugFunc("%s: (stderr) %s", prefix, strings.TrimSpace(o.Redact(stderr)))
+			o.debugf("%s: (stderr) %s", prefix, strings.TrimSpace(o.Redact(stderr)))
+		}
+	}
+}
+
+// appendOutput appends s to Output. When the output is limited using MaxOutputBytes, the first half
+// of the limit is filled directly and the rest is kept in a buffer of the most recent output until
+// FlushOutput is called.
+func (o *Options) appendOutput(s string) {
+	if o.MaxOutput <= 0 {
+		*o.Output += s
+		return
+	}
+	if o.outputTail == nil && o.outputHead+len(s) <= o.MaxOutput/2 {
+		*o.Output += s
+		o.outputHead += len(s)
+		return
+	}
+	o.outputTail = append(o.outputTail, s...)
+	// trimming only when the buffer has doubled keeps the copying linear
+	if keep := o.MaxOutput - o.outputHead; len(o.outputTail) > 2*keep {
+		o.outputDropped += len(o.outputTail) - keep
+		o.outputTail = append(o.outputTail[:0], o.outputTail[len(o.outputTail)-keep:]...)
+	}
+}
+
+// FlushOutput writes the output buffered because of MaxOutputBytes into Output, marking the place
+// where output was dropped. Called by the clients once the command has finished.
+func (o *Options) FlushOutput() {
+	if o.Output == nil || o.outputTail == nil {
+		return
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if keep := o.MaxOutput - o.outputHead; len(o.outputTail) > keep {
+		o.outputDropped += len(o.outputTail) - keep
+		o.outputTail = o.outputTail[len(o.outputTail)-keep:]
+	}
+	if o.outputDropped > 0 {
+		// start the tail from a whole line
+		if i := bytes.IndexByte(o.outputTail, '\n'); i >= 0 && i < len(o.outputTail)-1 {
+			o.outputDropped += i + 1
+			o.outputTail = o.outputTail[i+1:]
 		}
+		*o.Output += fmt.Sprintf(TruncatedMarker, o.outputDropped)
+		if o.Truncated != nil {
+			*o.Truncated = true
+		}
+		o.LogDebugf("output exceeded %d bytes, %d bytes were dropped", o.MaxOutput, o.outputDropped)
 	}
+	*o.Output += string(o.outputTail)
+	o.outputTail = nil
 }
 
 // AllowWinStderr exec option allows command to output to stderr without failing
@@ -170,12 +365,17 @@ func AllowWinStderr() Option {
 	}
 }
 
-// Redact is for filtering out sensitive text using a regexp
+// Redact is for filtering out sensitive text using the redact options and the values and patterns
+// registered using rig.RedactValue and rig.RedactPattern. The secrets of a connection are added by the
+// connection using RedactWith.
 func (o *Options) Redact(s string) string {
-	if DisableRedact || o.RedactFunc == nil {
+	if DisableRedact {
 		return s
 	}
-	return o.RedactFunc(s)
+	if o.RedactFunc != nil {
+		s = o.RedactFunc(s)
+	}
+	return redact.String(s)
 }
 
 // Stdin exec option for sending data to the command through stdin
@@ -185,6 +385,15 @@ func Stdin(t string) Option {
 	}
 }
 
+// StdinReader exec option for streaming data from r to the command through stdin. Unlike with Stdin,
+// the data does not need to fit in memory. Takes precedence over Stdin. See Retries for using it with
+// retries.
+func StdinReader(r io.Reader) Option {
+	return func(o *Options) {
+		o.StdinReader = r
+	}
+}
+
 // Output exec option for setting output string target
 func Output(output *string) Option {
 	return func(o *Options) {
@@ -231,17 +440,47 @@ func Sudo(h host) Option {
 	}
 }
 
-// Redact exec option for defining a redact regexp pattern that will be replaced with [REDACTED] in the logs
+// addRedactFunc chains fn after the redact functions set so far
+func (o *Options) addRedactFunc(fn func(string) string) {
+	prev := o.RedactFunc
+	if prev == nil {
+		o.RedactFunc = fn
+		return
+	}
+	o.RedactFunc = func(s string) string {
+		return fn(prev(s))
+	}
+}
+
+// RedactWith exec option for masking the values and patterns registered in r, such as the secrets of a
+// connection. Can be combined with the other redact options.
+func RedactWith(r *redact.Redactor) Option {
+	return func(o *Options) {
+		o.addRedactFunc(r.String)
+	}
+}
+
+// Redact exec option for defining a redact regexp pattern that will be replaced with [REDACTED] in the logs.
+// Can be combined with the other redact options, all of them are applied.
 func Redact(rexp string) Option {
+	return RedactRegexp(regexp.MustCompile(rexp))
+}
+
+// RedactRegexp exec option for defining one or more regular expressions whose matches will be replaced with
+// [REDACTED] in the logged commands, stdin and output. Can be combined with the other redact options.
+func RedactRegexp(res ...*regexp.Regexp) Option {
 	return func(o *Options) {
-		re := regexp.MustCompile(rexp)
-		o.RedactFunc = func(s2 string) string {
-			return re.ReplaceAllString(s2, "[REDACTED]")
-		}
+		o.addRedactFunc(func(s2 string) string {
+			for _, re := range res {
+				s2 = re.ReplaceAllString(s2, "[REDACTED]")
+			}
+			return s2
+		})
 	}
 }
 
-// RedactString exec option for defining one or more strings to replace with [REDACTED] in the log output
+// RedactString exec option for defining one or more strings to replace with [REDACTED] in the log output.
+// Can be combined with the other redact options, all of them are applied.
 func RedactString(s ...string) Option {
 	var newS []string
 	for _, str := range s {
@@ -251,13 +490,13 @@ func RedactString(s ...string) Option {
 	}
 
 	return func(o *Options) {
-		o.RedactFunc = func(s2 string) string {
+		o.addRedactFunc(func(s2 string) string {
 			newstr := s2
 			for _, r := range newS {
 				newstr = strings.ReplaceAll(newstr, r, "[REDACTED]")
 			}
 			return newstr
-		}
+		})
 	}
 }
 
@@ -268,6 +507,351 @@ func Writer(w io.Writer) Option {
 	}
 }
 
+// StdoutWriter exec option for sending command stdout to an io.Writer, same as Writer
+func StdoutWriter(w io.Writer) Option {
+	return Writer(w)
+}
+
+// StderrWriter exec option for sending command stderr to an io.Writer. On windows hosts, any data in
+// stderr still fails the command unless AllowWinStderr is used.
+func StderrWriter(w io.Writer) Option {
+	return func(o *Options) {
+		o.ErrWriter = w
+	}
+}
+
+// Asciicast exec option for recording the terminal output of ExecInteractive into w in the asciicast
+// v2 format of asciinema, with the timing of the output, so that the session can be replayed using
+// "asciinema play". Recording is supported over SSH and WinRM.
+func Asciicast(w io.Writer) Option {
+	return func(o *Options) {
+		o.Asciicast = w
+	}
+}
+
+// OutputStderr exec option for making Output and the output returned by ExecOutput also include the
+// lines the command writes to stderr. The lines from both streams are stored in the order they arrive.
+func OutputStderr() Option {
+	return func(o *Options) {
+		o.OutputStderr = true
+	}
+}
+
+// WithProgress exec option for receiving progress updates during file transfers
+func WithProgress(fn ProgressFunc) Option {
+	return func(o *Options) {
+		o.Progress = fn
+	}
+}
+
+// TransferStrategy exec option for overriding the automatically chosen file transfer mechanism by name
+func TransferStrategy(name string) Option {
+	return func(o *Options) {
+		o.Transfer = name
+	}
+}
+
+// Compress exec option for compressing the data stream of file transfers using the named algorithm,
+// such as "gzip". An empty name disables compression.
+func Compress(algorithm string) Option {
+	return func(o *Options) {
+		o.Compression = algorithm
+	}
+}
+
+// Parallel exec option for uploading large files in n chunks concurrently over separate sessions, which
+// can multiply the throughput on high latency links
+func Parallel(n int) Option {
+	return func(o *Options) {
+		o.Parallel = n
+	}
+}
+
+// Checksum exec option for selecting the algorithm used for verifying file transfers, such as "sha512"
+// or "md5" for hosts that lack sha256sum, or "none" to skip the verification
+func Checksum(algorithm string) Option {
+	return func(o *Options) {
+		o.Checksum = algorithm
+	}
+}
+
+// Atomic exec option for making uploads write into a temporary file in the destination directory and
+// rename it into place once complete, so that readers never observe a partially written file
+func Atomic() Option {
+	return func(o *Options) {
+		o.Atomic = true
+	}
+}
+
+// PreserveOwner exec option for making uploads copy the numeric owner and group of the local file to the
+// remote file. Changing the owner usually requires elevated privileges, see Sudo.
+func PreserveOwner() Option {
+	return func(o *Options) {
+		o.PreserveOwner = true
+	}
+}
+
+// PreserveTimes exec option for making uploads copy the modification time of the local file to the
+// remote file
+func PreserveTimes() Option {
+	return func(o *Options) {
+		o.PreserveTimes = true
+	}
+}
+
+// Sparse exec option for skipping the transfer of zero blocks when uploading files with holes, such as
+// virtual machine disk images. The holes are recreated on the remote host by seeking past them.
+func Sparse() Option {
+	return func(o *Options) {
+		o.Sparse = true
+	}
+}
+
+// Env exec option for setting environment variables for the command. The values are quoted for the
+// shell of the remote host, cmd.exe on windows. The variables apply to all of the programs of a
+// compound command such as "a && b". On unix hosts the command is run in sh with the variables set,
+// so references to them in the command string see the new values. On windows the references are
+// expanded by cmd.exe before the variables are set. Can be given multiple times.
+func Env(env map[string]string) Option {
+	return func(o *Options) {
+		if o.Env == nil {
+			o.Env = make(map[string]string, len(env))
+		}
+		for k, v := range env {
+			o.Env[k] = v
+		}
+	}
+}
+
+// Envs exec option for setting environment variables for the command from "KEY=value" strings, see Env
+func Envs(kv ...string) Option {
+	env := make(map[string]string, len(kv))
+	for _, s := range kv {
+		k, v, _ := strings.Cut(s, "=")
+		env[k] = v
+	}
+	return Env(env)
+}
+
+// Cwd exec option for running the command in the directory dir on the remote host
+func Cwd(dir string) Option {
+	return func(o *Options) {
+		o.Cwd = dir
+	}
+}
+
+// Timeout exec option for terminating the command if it has not finished within the duration d. The
+// command returns an error matching rig.ErrTimeout when the timeout is exceeded.
+func Timeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.Timeout = d
+	}
+}
+
+// OnOutputLine exec option for calling fn with each line of output as it arrives, for example to parse
+// progress information while the command is still running. Lines of the streams redirected using
+// Writer or StderrWriter are not passed to fn. The calls are serialized, fn is never called concurrently
+// for the stdout and stderr lines.
+func OnOutputLine(fn func(line string, isStderr bool)) Option {
+	return func(o *Options) {
+		o.OutputLineFunc = fn
+	}
+}
+
+// ConfirmWith exec option for calling fn with the command before it is run, for example to show each
+// command to the user for approval. The command is not run and an error matching ErrRejected is
+// returned when fn returns false. Overrides DefaultConfirmFunc.
+func ConfirmWith(fn func(cmd string) bool) Option {
+	return func(o *Options) {
+		o.ConfirmFunc = fn
+	}
+}
+
+// Internal exec option for marking a command that rig runs on its own to probe the host, such as the
+// detection of the operating system and the privilege elevation method. Internal commands are not
+// passed to the confirm function.
+func Internal() Option {
+	return func(o *Options) {
+		o.Internal = true
+	}
+}
+
+// TruncatedMarker is the format of the line that replaces the output dropped because of MaxOutputBytes
+const TruncatedMarker = "\n[... %d bytes of output truncated ...]\n"
+
+// MaxOutputBytes exec option for limiting the amount of output collected into Output and returned by
+// ExecOutput to about n bytes. When the command outputs more, the beginning and the end of the output
+// are kept and the part in between is replaced with a TruncatedMarker line. This protects the caller
+// from running out of memory when a command unexpectedly outputs gigabytes of data. Use
+// OutputTruncated to find out if the output was truncated.
+func MaxOutputBytes(n int) Option {
+	return func(o *Options) {
+		o.MaxOutput = n
+	}
+}
+
+// OutputTruncated exec option for setting truncated to true when output was dropped because of
+// MaxOutputBytes
+func OutputTruncated(truncated *bool) Option {
+	return func(o *Options) {
+		o.Truncated = truncated
+	}
+}
+
+// ErrorOutputBytes exec option for setting how many bytes of the most recent output of a failed
+// command are kept in the rig.CommandError it returns, 4096 by default. Zero or less turns keeping
+// the output off.
+func ErrorOutputBytes(n int) Option {
+	return func(o *Options) {
+		if n <= 0 {
+			n = -1
+		}
+		o.ErrorOutput = n
+	}
+}
+
+// DefaultRetryBackoff is the backoff used between retries when Retries is given a nil backoff
+var DefaultRetryBackoff = &clock.Backoff{Initial: time.Second, Max: 30 * time.Second, Multiplier: 2, Jitter: 0.1}
+
+// Retries exec option for running a failed command again up to n times, waiting between the attempts
+// according to backoff or DefaultRetryBackoff when nil. Commands run using ExecStreams are not retried
+// as their streams can't be rewound. A reader given using StdinReader is rewound for each retry, so it
+// has to be an io.Seeker, such as an *os.File, or the command fails without running. See RetryIf and
+// RetryOnExitCodes for limiting the errors that are retried.
+func Retries(n int, backoff *clock.Backoff) Option {
+	return func(o *Options) {
+		o.Retries = n
+		o.RetryBackoff = backoff
+	}
+}
+
+// RetryIf exec option for only retrying the failures for which fn returns true, see Retries
+func RetryIf(fn func(error) bool) Option {
+	return func(o *Options) {
+		o.RetryFunc = fn
+	}
+}
+
+// RetryOnExitCodes exec option for only retrying the failures where the command exited with one of
+// the exit codes, see Retries
+func RetryOnExitCodes(codes ...int) Option {
+	return RetryIf(func(err error) bool {
+		code, ok := ExitCode(err)
+		if !ok {
+			return false
+		}
+		for _, c := range codes {
+			if c == code {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// ShouldRetry returns true if a command that failed with err on the given attempt, where the first
+// retry is 1, should be run again
+func (o *Options) ShouldRetry(err error, attempt int) bool {
+	if err == nil || attempt > o.Retries {
+		return false
+	}
+	return o.RetryFunc == nil || o.RetryFunc(err)
+}
+
+// Backoff returns the backoff to use between retries
+func (o *Options) Backoff() *clock.Backoff {
+	if o.RetryBackoff == nil {
+		return DefaultRetryBackoff
+	}
+	return o.RetryBackoff
+}
+
+// ExitCode returns the exit code of a command from the error returned when running it failed. The
+// second return value is false when the error does not carry an exit code, for example when the
+// command could not be started at all.
+func ExitCode(err error) (int, bool) {
+	var coder interface{ ExitCode() int }
+	if errors.As(err, &coder) {
+		return coder.ExitCode(), true
+	}
+	// ssh.ExitError
+	var status interface{ ExitStatus() int }
+	if errors.As(err, &status) {
+		return status.ExitStatus(), true
+	}
+	return 0, false
+}
+
+// Shells for the Shell exec option
+const (
+	ShellSh         = "sh"         // ShellSh runs the command using sh -c
+	ShellBash       = "bash"       // ShellBash runs the command using bash -c
+	ShellPowerShell = "powershell" // ShellPowerShell runs the command as a Windows PowerShell script
+	ShellPwsh       = "pwsh"       // ShellPwsh runs the command as a PowerShell 7 script
+	ShellCmd        = "cmd"        // ShellCmd runs the command using cmd.exe /c
+	ShellNone       = "none"       // ShellNone passes the command to the connection as is
+)
+
+// Shell exec option for wrapping the command in the named shell, one of the Shell* constants. This
+// overrides the default shell of the connection. Without a shell the command is passed as is to the
+// connection, which runs it using the login shell of the user over SSH, cmd.exe over WinRM and bash or
+// cmd.exe on localhost.
+func Shell(name string) Option {
+	return func(o *Options) {
+		o.Shell = name
+	}
+}
+
+// NoShell exec option for passing the command as is to the connection, ignoring the default shell of
+// the connection, see Shell
+func NoShell() Option {
+	return Shell(ShellNone)
+}
+
+// RunAs exec option for running the command as another user, such as the account of a service. The
+// command is wrapped using sudo -u, doas -u or su, depending on the privilege elevation method detected
+// on the host, or runas on windows. Takes precedence over Sudo.
+func RunAs(user string) Option {
+	return func(o *Options) {
+		o.RunAs = user
+	}
+}
+
+// TraceContext exec option sets the context whose span becomes the parent of the tracing spans of the
+// operation when a Tracer is set for the connection. It is not used for cancellation.
+func TraceContext(ctx context.Context) Option {
+	return func(o *Options) {
+		o.TraceContext = ctx
+	}
+}
+
+// Logger exec option directs the logging of the command to a logger instead of DebugFunc, InfoFunc
+// and ErrorFunc
+func Logger(l log.Logger) Option {
+	return func(o *Options) {
+		o.Logger = l
+	}
+}
+
+// CorrelationID exec option sets the id that is included in the log lines of the command to tell apart
+// the output of operations running in parallel. The errors returned by the connection carry the id in
+// a rig.CorrelatedError. Connection generates one for each command and file transfer when none is given.
+func CorrelationID(id string) Option {
+	return func(o *Options) {
+		o.CorrelationID = id
+	}
+}
+
+// NewCorrelationID returns a new random 8 character correlation id
+func NewCorrelationID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		// the id is only used for telling log lines apart, a clock based one will do
+		return fmt.Sprintf("%08x", uint32(clock.Default.Now().UnixNano()))
+	}
+	return hex.EncodeToString(b)
+}
+
 // Build returns an instance of Options
 func Build(opts ...Option) *Options {
 	options := &Options{
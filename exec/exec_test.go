@@ -0,0 +1,142 @@
+package exec
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedact(t *testing.T) {
+	o := Build(
+		RedactString("hunter2", "s3cret"),
+		Redact(`token=\S+`),
+		RedactRegexp(regexp.MustCompile(`Bearer \w+`)),
+	)
+	require.Equal(t, "login [REDACTED] [REDACTED] [REDACTED] Authorization: [REDACTED]", o.Redact("login hunter2 s3cret token=abc Authorization: Bearer xyz"))
+
+	require.Equal(t, "nothing to hide", Build().Redact("nothing to hide"))
+}
+
+type exitCodeErr int
+
+func (e exitCodeErr) Error() string { return "exit" }
+func (e exitCodeErr) ExitCode() int { return int(e) }
+
+func TestShouldRetry(t *testing.T) {
+	err := fmt.Errorf("wrapped: %w", exitCodeErr(3))
+	code, ok := ExitCode(err)
+	require.True(t, ok)
+	require.Equal(t, 3, code)
+	_, ok = ExitCode(errors.New("no exit code"))
+	require.False(t, ok)
+
+	o := Build(Retries(2, nil))
+	require.True(t, o.ShouldRetry(err, 1))
+	require.True(t, o.ShouldRetry(err, 2))
+	require.False(t, o.ShouldRetry(err, 3))
+	require.False(t, o.ShouldRetry(nil, 1))
+	require.Equal(t, DefaultRetryBackoff, o.Backoff())
+
+	o = Build(Retries(2, nil), RetryOnExitCodes(1, 2))
+	require.False(t, o.ShouldRetry(err, 1))
+	require.True(t, o.ShouldRetry(exitCodeErr(2), 1))
+
+	require.False(t, Build().ShouldRetry(err, 1))
+}
+
+func TestMaxOutputBytes(t *testing.T) {
+	debugFunc := DebugFunc
+	DebugFunc = func(string, ...interface{}) {}
+	defer func() { DebugFunc = debugFunc }()
+
+	var out string
+	var truncated bool
+	o := Build(Output(&out), MaxOutputBytes(20), OutputTruncated(&truncated), HideOutput())
+	for i := 0; i < 100; i++ {
+		o.AddOutput("test", fmt.Sprintf("%d\n", i), "")
+	}
+	o.FlushOutput()
+	require.True(t, truncated)
+	require.Equal(t, "0\n1\n2\n3\n4\n"+fmt.Sprintf(TruncatedMarker, 271)+"97\n98\n99\n", out)
+
+	out, truncated = "", false
+	o = Build(Output(&out), MaxOutputBytes(20), OutputTruncated(&truncated), HideOutput())
+	o.AddOutput("test", "short\n", "")
+	o.AddOutput("test", "output\n", "")
+	o.FlushOutput()
+	require.False(t, truncated)
+	require.Equal(t, "short\noutput\n", out)
+}
+
+func TestOnOutputLineSerialized(t *testing.T) {
+	debugFunc := DebugFunc
+	DebugFunc = func(string, ...interface{}) {}
+	defer func() { DebugFunc = debugFunc }()
+
+	// not safe for concurrent use, the race detector and the counters catch overlapping calls
+	var active, overlaps, stdoutLines, stderrLines int
+	o := Build(HideOutput(), OnOutputLine(func(_ string, isStderr bool) {
+		active++
+		if active > 1 {
+			overlaps++
+		}
+		if isStderr {
+			stderrLines++
+		} else {
+			stdoutLines++
+		}
+		active--
+	}))
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			o.AddOutput("test", "out\n", "")
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			o.AddOutput("test", "", "err\n")
+		}
+	}()
+	wg.Wait()
+
+	require.Zero(t, overlaps)
+	require.Equal(t, 1000, stdoutLines)
+	require.Equal(t, 1000, stderrLines)
+}
+
+func TestConfirmed(t *testing.T) {
+	var asked []string
+	o := Build(RedactString("s3cret"), ConfirmWith(func(cmd string) bool {
+		asked = append(asked, cmd)
+		return cmd != "rm -rf /"
+	}))
+	require.NoError(t, o.Confirmed("echo s3cret"))
+	require.ErrorIs(t, o.Confirmed("rm -rf /"), ErrRejected)
+	require.Equal(t, []string{"echo [REDACTED]", "rm -rf /"}, asked)
+
+	require.NoError(t, Build(Internal(), ConfirmWith(func(string) bool { return false })).Confirmed("uname"))
+
+	// other commands can log their output while waiting for an answer
+	o = Build(ConfirmWith(func(string) bool {
+		done := make(chan struct{})
+		go func() {
+			var out string
+			Build(Output(&out), HideOutput()).AddOutput("host", "output\n", "")
+			close(done)
+		}()
+		<-done
+		return true
+	}))
+	require.NoError(t, o.Confirmed("echo"))
+
+	require.NoError(t, Build().Confirmed("rm -rf /"))
+}
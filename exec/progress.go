@@ -0,0 +1,62 @@
+package exec
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/k0sproject/rig/pkg/clock"
+)
+
+// ProgressFunc is called during file transfers with the number of bytes transferred so far and the
+// total number of bytes to transfer
+type ProgressFunc func(written, total int64)
+
+// ProgressWriter returns an io.Writer that reports the number of bytes written to it to fn. It can be
+// used as the alt writer of CopyFromN or in an io.MultiWriter. A nil fn returns io.Discard.
+func ProgressWriter(fn ProgressFunc, total int64) io.Writer {
+	if fn == nil {
+		return io.Discard
+	}
+	return &progressWriter{fn: fn, total: total}
+}
+
+type progressWriter struct {
+	fn      ProgressFunc
+	total   int64
+	written int64
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.written += int64(len(p))
+	w.fn(w.written, w.total)
+	return len(p), nil
+}
+
+// RateProgress returns a ProgressFunc that calls fn with the average transfer rate in bytes per second
+// in addition to the progress. Calls are throttled to at most one per interval, except for the final
+// call when the transfer completes. The rate is measured from the time RateProgress is called, so
+// create a new one right before each transfer.
+func RateProgress(interval time.Duration, fn func(written, total int64, rate float64)) ProgressFunc {
+	var (
+		mu    sync.Mutex
+		start = clock.Default.Now()
+		last  time.Time
+	)
+	return func(written, total int64) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		now := clock.Default.Now()
+		if written < total && now.Sub(last) < interval {
+			return
+		}
+		last = now
+
+		var rate float64
+		if elapsed := now.Sub(start).Seconds(); elapsed > 0 {
+			rate = float64(written) / elapsed
+		}
+		fn(written, total, rate)
+	}
+}
@@ -0,0 +1,54 @@
+package exec
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/k0sproject/rig/pkg/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgressWriter(t *testing.T) {
+	require.Equal(t, io.Discard, ProgressWriter(nil, 10))
+
+	var calls [][2]int64
+	w := ProgressWriter(func(written, total int64) {
+		calls = append(calls, [2]int64{written, total})
+	}, 10)
+	_, err := w.Write([]byte("abcd"))
+	require.NoError(t, err)
+	n, err := w.Write([]byte("efghij"))
+	require.NoError(t, err)
+	require.Equal(t, 6, n)
+	require.Equal(t, [][2]int64{{4, 10}, {10, 10}}, calls)
+}
+
+func TestRateProgress(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	clock.Default = fake
+	defer func() { clock.Default = clock.Real{} }()
+
+	type call struct {
+		written int64
+		rate    float64
+	}
+	var calls []call
+	progress := RateProgress(time.Second, func(written, total int64, rate float64) {
+		require.Equal(t, int64(400), total)
+		calls = append(calls, call{written, rate})
+	})
+
+	// the time before the first write counts towards the rate
+	fake.Advance(time.Second)
+	progress(100, 400)
+	// throttled
+	fake.Advance(500 * time.Millisecond)
+	progress(150, 400)
+	fake.Advance(500 * time.Millisecond)
+	progress(200, 400)
+	// the final call is not throttled
+	progress(400, 400)
+
+	require.Equal(t, []call{{100, 100}, {200, 100}, {400, 200}}, calls)
+}
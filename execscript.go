@@ -0,0 +1,80 @@
+package rig
+
+import (
+	"path"
+	"strings"
+
+	"github.com/alessio/shellescape"
+	"github.com/k0sproject/rig/exec"
+	"github.com/k0sproject/rig/pkg/shellfmt"
+	ps "github.com/k0sproject/rig/powershell"
+)
+
+// maxEncodedScriptLength is the longest powershell -EncodedCommand command line that is sent as is,
+// cmd.exe does not accept command lines longer than 8191 characters
+const maxEncodedScriptLength = 8000
+
+// stdinShells are the interpreters that read the script from stdin using -s
+var stdinShells = map[string]bool{"sh": true, "bash": true, "dash": true, "ash": true, "ksh": true, "zsh": true}
+
+// scriptExtensions are the file name extensions windows interpreters require
+var scriptExtensions = map[string]string{"powershell": ".ps1", "powershell.exe": ".ps1", "pwsh": ".ps1", "pwsh.exe": ".ps1", "cmd": ".cmd", "cmd.exe": ".cmd"}
+
+// ExecScript runs a multi-line script on the host using the interpreter, such as "bash" or
+// "python3 -u", without having to quote the script into a single command. The interpreter defaults
+// to sh on unix hosts and powershell on windows hosts.
+//
+// Scripts for sh compatible shells are sent through stdin unless the options include stdin of
+// their own. Short powershell scripts are sent as an -EncodedCommand. Other scripts are written into
+// a temporary file that is passed to the interpreter and removed afterwards.
+func (c *Connection) ExecScript(script, interpreter string, opts ...exec.Option) error {
+	if err := c.checkConnected(); err != nil {
+		return err
+	}
+	if interpreter == "" {
+		interpreter = "sh"
+		if c.IsWindows() {
+			interpreter = "powershell"
+		}
+	}
+	name := strings.ToLower(path.Base(strings.ReplaceAll(strings.Fields(interpreter)[0], `\`, "/")))
+
+	switch {
+	case c.IsWindows() && (name == "powershell" || name == "powershell.exe"):
+		if cmd := ps.Cmd(script); len(cmd) <= maxEncodedScriptLength {
+			return c.Exec(cmd, opts...)
+		}
+	case !c.IsWindows() && stdinShells[name] && exec.Build(opts...).StdinSource() == nil:
+		return c.Exec(interpreter+" -s", append(opts[:len(opts):len(opts)], exec.Stdin(script))...)
+	}
+
+	return c.execScriptFile(script, interpreter, scriptExtensions[name], opts...)
+}
+
+// execScriptFile writes the script into a temporary file and runs it using the interpreter
+func (c *Connection) execScriptFile(script, interpreter, ext string, opts ...exec.Option) error {
+	fsys := c.fsysFor(opts...)
+	tmp, err := fsys.CreateTemp("", "rig-script-*"+ext)
+	if err != nil {
+		return ErrCommandFailed.Wrapf("create script file: %w", err)
+	}
+	defer func() {
+		if err := fsys.Remove(tmp); err != nil {
+			c.loggerFor(opts).Warnf("%s: failed to remove script file %s: %v", c, tmp, err)
+		}
+	}()
+	if err := fsys.WriteFile(tmp, []byte(script), 0o600); err != nil {
+		return ErrCommandFailed.Wrapf("write script file: %w", err)
+	}
+
+	if !c.IsWindows() {
+		return c.Exec(interpreter+" "+shellescape.Quote(tmp), opts...)
+	}
+	switch ext {
+	case ".ps1":
+		return c.Exec(interpreter+" -NonInteractive -ExecutionPolicy Unrestricted -NoProfile -File "+shellfmt.CmdArg(tmp), opts...)
+	case ".cmd":
+		return c.Exec(interpreter+" /c "+shellfmt.CmdArg(tmp), opts...)
+	}
+	return c.Exec(interpreter+" "+shellfmt.CmdArg(tmp), opts...)
+}
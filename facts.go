@@ -0,0 +1,302 @@
+package rig
+
+import (
+	"bufio"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/alessio/shellescape"
+	"github.com/k0sproject/rig/exec"
+	ps "github.com/k0sproject/rig/powershell"
+)
+
+// Facts describes the hardware and the environment of a host
+type Facts struct {
+	// CPUs is the number of logical processors
+	CPUs int `json:"cpus"`
+	// Memory is the total amount of memory in bytes
+	Memory int64 `json:"memory"`
+	// Kernel is the kernel release on unix hosts and the operating system version on windows
+	Kernel string `json:"kernel"`
+	// Virtualization is the virtualization technology the host runs on, such as "kvm", "vmware",
+	// "microsoft" or "docker", using the names of systemd-detect-virt, or "vm" for a hypervisor that
+	// can't be identified. It is "none" on bare metal and empty when it can't be detected.
+	Virtualization string `json:"virtualization"`
+	// CloudProvider is a hint of the cloud the host runs in, such as "aws", "azure" or "gcp", based on
+	// the hardware vendor information. It is empty when no known cloud is detected.
+	CloudProvider string `json:"cloudProvider"`
+	// Disks are the block devices of the host
+	Disks []Disk `json:"disks"`
+	// Mounts are the mounted filesystems
+	Mounts []Mount `json:"mounts"`
+	// Interfaces are the network interfaces of the host
+	Interfaces []NetworkInterface `json:"interfaces"`
+	// SELinux is the SELinux mode, "enforcing", "permissive" or "disabled". It is empty when the host
+	// has no SELinux support.
+	SELinux string `json:"selinux"`
+	// AppArmor is true when AppArmor is enabled
+	AppArmor bool `json:"apparmor"`
+}
+
+// Disk is a block device
+type Disk struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// Mount is a mounted filesystem. The sizes are in bytes.
+type Mount struct {
+	Device string `json:"device"`
+	Path   string `json:"path"`
+	FSType string `json:"fsType"`
+	Size   int64  `json:"size"`
+	Free   int64  `json:"free"`
+}
+
+// NetworkInterface is a network interface and its addresses in CIDR notation
+type NetworkInterface struct {
+	Name      string   `json:"name"`
+	MAC       string   `json:"mac"`
+	Addresses []string `json:"addresses"`
+}
+
+// factsScriptUnix prints the facts in sections that start with a "### name" line
+const factsScriptUnix = `echo "### cpus"; getconf _NPROCESSORS_ONLN 2> /dev/null || nproc
+echo "### memory"; if [ -r /proc/meminfo ]; then awk '/^MemTotal:/ { print $2 "k" }' /proc/meminfo; else sysctl -n hw.memsize; fi
+echo "### kernel"; uname -r
+echo "### virt"; if command -v systemd-detect-virt > /dev/null 2>&1; then systemd-detect-virt; elif [ -f /.dockerenv ]; then echo docker; elif grep -qw hypervisor /proc/cpuinfo 2> /dev/null; then echo vm; elif [ -r /proc/cpuinfo ]; then echo none; fi
+echo "### dmi"; for f in sys_vendor product_name bios_vendor chassis_asset_tag; do printf '%s=' "$f"; cat "/sys/class/dmi/id/$f" 2> /dev/null || echo; done
+echo "### disks"; for d in /sys/block/*; do [ -f "$d/size" ] && echo "${d##*/} $(cat "$d/size")"; done
+echo "### fstypes"; cat /proc/mounts 2> /dev/null
+echo "### df"; df -Pk 2> /dev/null
+echo "### interfaces"; for i in /sys/class/net/*; do [ -e "$i" ] && echo "${i##*/} $(cat "$i/address" 2> /dev/null)"; done
+echo "### addresses"; ip -o addr show 2> /dev/null
+echo "### selinux"; ` + selinuxModeScript + `
+echo "### apparmor"; cat /sys/module/apparmor/parameters/enabled 2> /dev/null
+true`
+
+const factsScriptWindows = `$cs = Get-CimInstance Win32_ComputerSystem
+$os = Get-CimInstance Win32_OperatingSystem
+@{
+  cpus = [int]$cs.NumberOfLogicalProcessors
+  memory = [int64]$cs.TotalPhysicalMemory
+  kernel = $os.Version
+  sysVendor = $cs.Manufacturer
+  productName = $cs.Model
+  biosVendor = (Get-CimInstance Win32_BIOS).Manufacturer
+  assetTag = (Get-CimInstance Win32_SystemEnclosure).SMBIOSAssetTag
+  disks = @(Get-CimInstance Win32_DiskDrive | ForEach-Object { @{ name = $_.DeviceID; size = [int64]$_.Size } })
+  mounts = @(Get-CimInstance Win32_LogicalDisk -Filter 'DriveType=3' | ForEach-Object { @{ device = $_.DeviceID; path = $_.DeviceID + '\'; fsType = $_.FileSystem; size = [int64]$_.Size; free = [int64]$_.FreeSpace } })
+  interfaces = @(Get-NetAdapter | ForEach-Object { @{ name = $_.Name; mac = "$($_.MacAddress)".Replace('-', ':').ToLower(); addresses = @(Get-NetIPAddress -InterfaceIndex $_.ifIndex -ErrorAction SilentlyContinue | ForEach-Object { $_.IPAddress + '/' + $_.PrefixLength }) } })
+} | ConvertTo-Json -Depth 4 -Compress`
+
+// Facts gathers information about the hardware and the environment of the host, for example for
+// preflight checks and inventories. Facts that can't be determined are left empty.
+func (c *Connection) Facts() (*Facts, error) {
+	if c.IsWindows() {
+		out, err := c.ExecOutput(ps.Cmd(factsScriptWindows), exec.HideOutput())
+		if err != nil {
+			return nil, ErrCommandFailed.Wrapf("gather facts: %w", err)
+		}
+		return parseWindowsFacts(out)
+	}
+	out, err := c.ExecOutput("sh -c "+shellescape.Quote(factsScriptUnix), exec.HideOutput())
+	if err != nil {
+		return nil, ErrCommandFailed.Wrapf("gather facts: %w", err)
+	}
+	return parseUnixFacts(out), nil
+}
+
+func parseWindowsFacts(out string) (*Facts, error) {
+	var raw struct {
+		Facts
+		SysVendor   string `json:"sysVendor"`
+		ProductName string `json:"productName"`
+		BiosVendor  string `json:"biosVendor"`
+		AssetTag    string `json:"assetTag"`
+	}
+	if err := json.Unmarshal([]byte(out), &raw); err != nil {
+		return nil, ErrCommandFailed.Wrapf("parse facts: %w", err)
+	}
+	facts := raw.Facts
+	dmi := map[string]string{"sys_vendor": raw.SysVendor, "product_name": raw.ProductName, "bios_vendor": raw.BiosVendor, "chassis_asset_tag": raw.AssetTag}
+	facts.Virtualization = virtualizationFromDMI(dmi)
+	facts.CloudProvider = cloudProviderFromDMI(dmi)
+	return &facts, nil
+}
+
+// factSections splits the output of factsScriptUnix into its sections
+func factSections(out string) map[string][]string {
+	sections := make(map[string][]string)
+	var current string
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.HasPrefix(line, "### ") {
+			current = strings.TrimPrefix(line, "### ")
+			continue
+		}
+		if current != "" && strings.TrimSpace(line) != "" {
+			sections[current] = append(sections[current], line)
+		}
+	}
+	return sections
+}
+
+func firstLine(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(lines[0])
+}
+
+func parseUnixFacts(out string) *Facts {
+	sections := factSections(out)
+	facts := &Facts{Kernel: firstLine(sections["kernel"])}
+	facts.CPUs, _ = strconv.Atoi(firstLine(sections["cpus"]))
+	if mem := firstLine(sections["memory"]); strings.HasSuffix(mem, "k") {
+		kb, _ := strconv.ParseInt(strings.TrimSuffix(mem, "k"), 10, 64)
+		facts.Memory = kb * 1024
+	} else {
+		facts.Memory, _ = strconv.ParseInt(mem, 10, 64)
+	}
+
+	dmi := make(map[string]string)
+	for _, line := range sections["dmi"] {
+		if k, v, ok := strings.Cut(line, "="); ok {
+			dmi[k] = strings.TrimSpace(v)
+		}
+	}
+	facts.Virtualization = firstLine(sections["virt"])
+	if facts.Virtualization == "vm" {
+		// a hypervisor without systemd-detect-virt, try to tell which one from the hardware vendor
+		if v := virtualizationFromDMI(dmi); v != "none" {
+			facts.Virtualization = v
+		}
+	}
+	facts.CloudProvider = cloudProviderFromDMI(dmi)
+
+	for _, line := range sections["disks"] {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || strings.HasPrefix(fields[0], "loop") || strings.HasPrefix(fields[0], "ram") {
+			continue
+		}
+		// the size in /sys/block is in 512 byte sectors
+		sectors, _ := strconv.ParseInt(fields[1], 10, 64)
+		if sectors > 0 {
+			facts.Disks = append(facts.Disks, Disk{Name: fields[0], Size: sectors * 512})
+		}
+	}
+
+	facts.Mounts = parseMounts(sections["df"], sections["fstypes"])
+	facts.Interfaces = parseInterfaces(sections["interfaces"], sections["addresses"])
+	facts.SELinux = strings.ToLower(firstLine(sections["selinux"]))
+	facts.AppArmor = firstLine(sections["apparmor"]) == "Y"
+	return facts
+}
+
+// parseMounts parses the output of df -Pk, taking the filesystem types from /proc/mounts
+func parseMounts(df, fstypes []string) []Mount {
+	types := make(map[string]string)
+	for _, line := range fstypes {
+		if fields := strings.Fields(line); len(fields) >= 3 {
+			types[fields[1]] = fields[2]
+		}
+	}
+	var mounts []Mount
+	for _, line := range df {
+		fields := strings.Fields(line)
+		if len(fields) < 6 || fields[0] == "Filesystem" {
+			continue
+		}
+		size, _ := strconv.ParseInt(fields[1], 10, 64)
+		free, _ := strconv.ParseInt(fields[3], 10, 64)
+		path := strings.Join(fields[5:], " ")
+		mounts = append(mounts, Mount{Device: fields[0], Path: path, FSType: types[path], Size: size * 1024, Free: free * 1024})
+	}
+	return mounts
+}
+
+// parseInterfaces parses the interface names and mac addresses and the output of ip -o addr show
+func parseInterfaces(names, addresses []string) []NetworkInterface {
+	var interfaces []NetworkInterface
+	index := make(map[string]int)
+	for _, line := range names {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		iface := NetworkInterface{Name: fields[0]}
+		if len(fields) > 1 {
+			iface.MAC = fields[1]
+		}
+		index[iface.Name] = len(interfaces)
+		interfaces = append(interfaces, iface)
+	}
+	for _, line := range addresses {
+		// 2: eth0    inet 10.0.0.2/24 brd 10.0.0.255 scope global eth0\       valid_lft forever
+		fields := strings.Fields(line)
+		if len(fields) < 4 || (fields[2] != "inet" && fields[2] != "inet6") {
+			continue
+		}
+		name, _, _ := strings.Cut(fields[1], "@")
+		i, ok := index[name]
+		if !ok {
+			index[name] = len(interfaces)
+			i = len(interfaces)
+			interfaces = append(interfaces, NetworkInterface{Name: name})
+		}
+		interfaces[i].Addresses = append(interfaces[i].Addresses, fields[3])
+	}
+	return interfaces
+}
+
+// virtualizationFromDMI guesses the hypervisor from the hardware vendor information
+func virtualizationFromDMI(dmi map[string]string) string {
+	vendor := strings.ToLower(dmi["sys_vendor"] + " " + dmi["product_name"] + " " + dmi["bios_vendor"])
+	for _, v := range []struct{ match, name string }{
+		{"amazon ec2", "amazon"},
+		{"vmware", "vmware"},
+		{"virtualbox", "oracle"},
+		{"virtual machine", "microsoft"},
+		{"kvm", "kvm"},
+		{"qemu", "qemu"},
+		{"google compute engine", "kvm"},
+		{"xen", "xen"},
+		{"parallels", "parallels"},
+	} {
+		if strings.Contains(vendor, v.match) {
+			return v.name
+		}
+	}
+	return "none"
+}
+
+// azureAssetTag is the chassis asset tag of the virtual machines in Azure
+const azureAssetTag = "7783-7084-3265-9085-8269-3286-77"
+
+// cloudProviderFromDMI guesses the cloud provider from the hardware vendor information
+func cloudProviderFromDMI(dmi map[string]string) string {
+	if dmi["chassis_asset_tag"] == azureAssetTag {
+		return "azure"
+	}
+	vendor := strings.ToLower(dmi["sys_vendor"] + " " + dmi["product_name"] + " " + dmi["bios_vendor"] + " " + dmi["chassis_asset_tag"])
+	for _, p := range []struct{ match, name string }{
+		{"amazon", "aws"},
+		{"google", "gcp"},
+		{"digitalocean", "digitalocean"},
+		{"hetzner", "hetzner"},
+		{"alibaba", "alibaba"},
+		{"oraclecloud", "oracle"},
+		{"openstack", "openstack"},
+		{"scaleway", "scaleway"},
+		{"linode", "linode"},
+		{"vultr", "vultr"},
+	} {
+		if strings.Contains(vendor, p.match) {
+			return p.name
+		}
+	}
+	return ""
+}
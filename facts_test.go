@@ -0,0 +1,62 @@
+package rig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const factsOutput = `### cpus
+4
+### memory
+8048216k
+### kernel
+6.1.0-18-cloud-amd64
+### virt
+vm
+### dmi
+sys_vendor=Amazon EC2
+product_name=t3.large
+bios_vendor=Amazon EC2
+chassis_asset_tag=
+### disks
+loop0 0
+nvme0n1 16777216
+### fstypes
+/dev/nvme0n1p1 / ext4 rw,relatime 0 0
+tmpfs /run tmpfs rw,nosuid 0 0
+### df
+Filesystem     1024-blocks    Used Available Capacity Mounted on
+/dev/nvme0n1p1     8123456 2000000   6123456      25% /
+tmpfs               804820     100    804720       1% /run
+### interfaces
+ens5 0a:1b:2c:3d:4e:5f
+lo 00:00:00:00:00:00
+### addresses
+1: lo    inet 127.0.0.1/8 scope host lo\       valid_lft forever preferred_lft forever
+2: ens5    inet 172.31.1.10/20 brd 172.31.15.255 scope global dynamic ens5\       valid_lft 3000sec preferred_lft 3000sec
+2: ens5    inet6 fe80::81b:2cff:fe3d:4e5f/64 scope link \       valid_lft forever preferred_lft forever
+### selinux
+Enforcing
+### apparmor
+`
+
+func TestParseUnixFacts(t *testing.T) {
+	facts := parseUnixFacts(factsOutput)
+	require.Equal(t, 4, facts.CPUs)
+	require.Equal(t, int64(8048216*1024), facts.Memory)
+	require.Equal(t, "6.1.0-18-cloud-amd64", facts.Kernel)
+	require.Equal(t, "amazon", facts.Virtualization)
+	require.Equal(t, "aws", facts.CloudProvider)
+	require.Equal(t, "enforcing", facts.SELinux)
+	require.False(t, facts.AppArmor)
+	require.Equal(t, []Disk{{Name: "nvme0n1", Size: 16777216 * 512}}, facts.Disks)
+	require.Equal(t, []Mount{
+		{Device: "/dev/nvme0n1p1", Path: "/", FSType: "ext4", Size: 8123456 * 1024, Free: 6123456 * 1024},
+		{Device: "tmpfs", Path: "/run", FSType: "tmpfs", Size: 804820 * 1024, Free: 804720 * 1024},
+	}, facts.Mounts)
+	require.Equal(t, []NetworkInterface{
+		{Name: "ens5", MAC: "0a:1b:2c:3d:4e:5f", Addresses: []string{"172.31.1.10/20", "fe80::81b:2cff:fe3d:4e5f/64"}},
+		{Name: "lo", MAC: "00:00:00:00:00:00", Addresses: []string{"127.0.0.1/8"}},
+	}, facts.Interfaces)
+}
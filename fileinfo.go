@@ -13,10 +13,10 @@ type FileMode int
 
 const (
 	ModeRead      FileMode = 1                    // ModeRead = Read only
-	ModeWrite     FileMode = 2                    // ModeWrite = Write only
-	ModeReadWrite FileMode = ModeRead | ModeWrite // ModeReadWrite = Read and Write
+	ModeWrite     FileMode = 2                    // ModeWrite = Write only. Writes go to the current position without truncating the file.
+	ModeReadWrite FileMode = ModeRead | ModeWrite // ModeReadWrite = Read and Write. Writes go to the current position without truncating the file.
 	ModeCreate    FileMode = 4 | ModeWrite        // ModeCreate = Create a new file or truncate an existing one. Includes write permission.
-	ModeAppend    FileMode = 8 | ModeCreate       // ModeAppend = Append to an existing file. Includes create and write permissions.
+	ModeAppend    FileMode = 8 | ModeCreate       // ModeAppend = Append to an existing file. Includes create and write permissions. Writes always go to the end of the file.
 )
 
 // Check interfaces
@@ -27,20 +27,22 @@ var (
 
 // FileInfo implements fs.FileInfo for stat on remote files
 type FileInfo struct {
-	FName    string      `json:"name"`
-	FSize    int64       `json:"size"`
-	FMode    fs.FileMode `json:"mode"`
-	FUnix    fs.FileMode `json:"unixMode"`
-	FModTime time.Time   `json:"-"`
-	FIsDir   bool        `json:"isDir"`
-	ModtimeS int64       `json:"modTime"`
-	fsys     fs.FS
+	FName     string      `json:"name"`
+	FSize     int64       `json:"size"`
+	FMode     fs.FileMode `json:"mode"`
+	FUnix     fs.FileMode `json:"unixMode"`
+	FModTime  time.Time   `json:"-"`
+	FIsDir    bool        `json:"isDir"`
+	FIsLink   bool        `json:"isLink"`
+	FLinkType string      `json:"linkType,omitempty"`
+	ModtimeS  int64       `json:"modTime"`
+	fsys      fs.FS
 }
 
 // UnmarshalJSON implements json.Unmarshaler
 func (f *FileInfo) UnmarshalJSON(b []byte) error {
-	type fileInfo *FileInfo
-	fi := fileInfo(f)
+	type fileInfo FileInfo
+	fi := (*fileInfo)(f)
 	if err := json.Unmarshal(b, fi); err != nil {
 		return ErrCommandFailed.Wrapf("unmarshal fileinfo: %w", err)
 	}
@@ -61,9 +63,8 @@ func (f *FileInfo) UnmarshalJSON(b []byte) error {
 	if f.FMode&4096 != 0 { // "Offline"
 		newmode |= fs.ModeIrregular
 	}
-	if f.FMode&1024 != 0 { // "ReparsePoint"
+	if f.FMode&1024 != 0 && !f.FIsLink { // "ReparsePoint" other than a symbolic link or a junction
 		newmode |= fs.ModeIrregular
-		newmode |= fs.ModeSymlink
 	}
 	if f.FMode&256 != 0 { // "Temporary"
 		newmode |= fs.ModeTemporary
@@ -89,10 +90,17 @@ func (f *FileInfo) Size() int64 {
 
 // Mode returns the file permission mode
 func (f *FileInfo) Mode() fs.FileMode {
+	mode := f.FMode
 	if f.FUnix != 0 {
-		return f.FUnix
+		mode = f.FUnix
 	}
-	return f.FMode
+	if f.FIsDir {
+		mode |= fs.ModeDir
+	}
+	if f.FIsLink {
+		mode |= fs.ModeSymlink
+	}
+	return mode
 }
 
 // ModTime returns the last modification time of a file
@@ -0,0 +1,18 @@
+//go:build !windows
+
+package rig
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// localOwner returns the numeric user and group ids of a local file
+func localOwner(info os.FileInfo) (string, string, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", "", false
+	}
+	return strconv.FormatUint(uint64(stat.Uid), 10), strconv.FormatUint(uint64(stat.Gid), 10), true
+}
@@ -0,0 +1,11 @@
+//go:build windows
+
+package rig
+
+import "os"
+
+// localOwner is not supported on windows, where files are owned by security principals that do not
+// map to the remote host
+func localOwner(_ os.FileInfo) (string, string, bool) {
+	return "", "", false
+}
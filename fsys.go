@@ -0,0 +1,466 @@
+package rig
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/k0sproject/rig/errstring"
+	"github.com/k0sproject/rig/pkg/clock"
+)
+
+var (
+	_ fs.ReadDirFS  = FS(nil)
+	_ fs.StatFS     = FS(nil)
+	_ fs.ReadFileFS = FS(nil)
+	_ fs.GlobFS     = FS(nil)
+	_ fs.SubFS      = FS(nil)
+	_ fs.ReadDirFS  = &DirFS{}
+	_ fs.StatFS     = &DirFS{}
+	_ fs.ReadFileFS = &DirFS{}
+	_ fs.GlobFS     = &DirFS{}
+	_ fs.SubFS      = &DirFS{}
+)
+
+// FindType is a file type filter for Find
+type FindType string
+
+const (
+	FindFile    FindType = "f" // FindFile matches regular files
+	FindDir     FindType = "d" // FindDir matches directories
+	FindSymlink FindType = "l" // FindSymlink matches symbolic links
+)
+
+// FindOptions are the filters for FS.Find. The zero value matches everything under the root.
+type FindOptions struct {
+	Name           string        // Name is a glob pattern matched against the base name of each file, such as "*.conf"
+	Type           FindType      // Type limits the results to files of the given type
+	MaxDepth       int           // MaxDepth limits how many levels below the root are searched, 0 for no limit
+	ModifiedWithin time.Duration // ModifiedWithin matches files modified within the duration, with minute precision
+	ModifiedBefore time.Duration // ModifiedBefore matches files last modified longer than the duration ago, with minute precision
+	MinSize        int64         // MinSize matches files that are at least MinSize bytes
+	MaxSize        int64         // MaxSize matches files that are at most MaxSize bytes, 0 for no limit
+}
+
+// minutes returns the duration in whole minutes, rounded up
+func minutes(d time.Duration) int64 {
+	return int64((d + time.Minute - 1) / time.Minute)
+}
+
+// DeleteProgressFunc is called by DeleteMany after each path has been processed. The err is nil
+// when the path was deleted successfully.
+type DeleteProgressFunc func(name string, err error)
+
+// PathErrors is returned by operations that process multiple paths and continue after failures.
+// It holds an error for each path that failed.
+type PathErrors []*fs.PathError
+
+// Error implements the error interface
+func (e PathErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Is returns true when any of the path errors matches target. Implemented for errors.Is on the go
+// versions that don't know about Unwrap returning multiple errors.
+func (e PathErrors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first path error that matches target, see errors.As
+func (e PathErrors) As(target interface{}) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Unwrap returns the individual path errors
+func (e PathErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// batchPaths splits a list of paths into batches where the combined length of the paths in a batch
+// does not exceed maxBytes, to keep command lines below the target's argument length limits
+func batchPaths(paths []string, maxBytes int) [][]string {
+	var batches [][]string
+	var batch []string
+	var size int
+	for _, p := range paths {
+		if len(batch) > 0 && size+len(p) > maxBytes {
+			batches = append(batches, batch)
+			batch = nil
+			size = 0
+		}
+		batch = append(batch, p)
+		size += len(p) + 3 // quotes and separator
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+// rmResponse is the result of removing a single path as returned by the fsys helper scripts
+type rmResponse struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// rmResults calls the progress function for each result and returns the failed paths
+func rmResults(results []*rmResponse, progress DeleteProgressFunc) PathErrors {
+	var errs PathErrors
+	for _, res := range results {
+		var err error
+		if res.Error != "" {
+			pathErr := &fs.PathError{Op: "delete", Path: res.Path, Err: errstring.New(res.Error)}
+			errs = append(errs, pathErr)
+			err = pathErr
+		}
+		if progress != nil {
+			progress(res.Path, err)
+		}
+	}
+	return errs
+}
+
+// atomicTempName returns a hidden temporary file name in the same directory as name, so that
+// renaming it over name is atomic on the remote filesystem
+func atomicTempName(name string) string {
+	idx := strings.LastIndexAny(name, `/\`)
+	dir, base := name[:idx+1], name[idx+1:]
+	return fmt.Sprintf("%s.%s.rig-%s.tmp", dir, base, strconv.FormatInt(clock.DefaultRand.Int63n(1<<40), 36))
+}
+
+// readFile reads the named file and returns its contents
+func readFile(fsys FS, name string) ([]byte, error) {
+	f, err := fsys.OpenFile(name, ModeRead, 0)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	defer f.Close()
+	buf := bytes.NewBuffer(nil)
+	if _, err := f.Copy(buf); err != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+	return buf.Bytes(), nil
+}
+
+// writeFile writes data to the named file, creating it with the permissions perm if necessary
+func writeFile(fsys FS, name string, data []byte, perm fs.FileMode) error {
+	f, err := fsys.OpenFile(name, ModeCreate, int(perm))
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	if _, err := f.CopyFromN(bytes.NewReader(data), int64(len(data)), nil); err != nil {
+		_ = f.Close()
+		return &fs.PathError{Op: "write", Path: name, Err: err}
+	}
+	if err := f.Close(); err != nil {
+		return &fs.PathError{Op: "write", Path: name, Err: err}
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file next to name and renames it over name
+func writeFileAtomic(fsys FS, name string, data []byte, perm fs.FileMode) error {
+	tmp := atomicTempName(name)
+	if err := writeFile(fsys, tmp, data, perm); err != nil {
+		_ = fsys.Delete(tmp)
+		return &fs.PathError{Op: "writeatomic", Path: name, Err: err}
+	}
+	if err := fsys.Rename(tmp, name); err != nil {
+		_ = fsys.Delete(tmp)
+		return err
+	}
+	return nil
+}
+
+// lister is implemented by filesystems that can list the contents of a directory tree in one go
+type lister interface {
+	Stat(name string) (fs.FileInfo, error)
+	Lstat(name string) (fs.FileInfo, error)
+	// list returns the files and directories under root, up to depth levels deep or all of them
+	// when depth is 0. Symbolic links are not followed.
+	list(root string, depth int) ([]*FileInfo, error)
+	// dir returns the parent directory of the path name, using the path separators of the host
+	dir(name string) string
+}
+
+// walkDir walks the file tree rooted at root like fs.WalkDir, using a single recursive listing
+func walkDir(fsys lister, root string, depth int, fn fs.WalkDirFunc) error {
+	info, err := fsys.Stat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else if rootInfo, ok := info.(*FileInfo); ok && info.IsDir() {
+		err = walkTree(fsys, root, rootInfo, depth, fn)
+	} else {
+		err = fn(root, fs.FileInfoToDirEntry(info), nil)
+	}
+	if errors.Is(err, fs.SkipDir) {
+		return nil
+	}
+	return err
+}
+
+func walkTree(fsys lister, root string, rootInfo *FileInfo, depth int, fn fs.WalkDirFunc) error {
+	if err := fn(root, rootInfo, nil); err != nil {
+		return err
+	}
+	entries, err := fsys.list(root, depth)
+	if err != nil {
+		return fn(root, rootInfo, err)
+	}
+
+	children := make(map[string][]*FileInfo)
+	for _, entry := range entries {
+		parent := fsys.dir(entry.FullPath())
+		children[parent] = append(children[parent], entry)
+	}
+	for _, list := range children {
+		sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	}
+
+	var walk func(name string, entry *FileInfo) error
+	walk = func(name string, entry *FileInfo) error {
+		// the trailing separator makes dir return the directory itself, in the same form as the parent
+		// directories of its children
+		for _, child := range children[fsys.dir(entry.FullPath()+"/")] {
+			childName := path.Join(name, child.Name())
+			err := fn(childName, child, nil)
+			if err == nil && child.IsDir() {
+				err = walk(childName, child)
+			}
+			if err != nil {
+				if errors.Is(err, fs.SkipDir) {
+					if child.IsDir() {
+						continue
+					}
+					return nil
+				}
+				return err
+			}
+		}
+		return nil
+	}
+	return walk(root, rootInfo)
+}
+
+// glob returns the names of the files matching pattern like fs.Glob, using a single recursive
+// listing of the deepest directory in the pattern that has no meta characters
+func glob(fsys lister, pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	parts := strings.Split(pattern, "/")
+	base := len(parts)
+	for i, part := range parts {
+		if strings.ContainsAny(part, `*?[\`) {
+			base = i
+			break
+		}
+	}
+	if base == len(parts) {
+		if _, err := fsys.Lstat(pattern); err != nil {
+			return nil, nil //nolint:nilerr // fs.Glob ignores I/O errors
+		}
+		return []string{pattern}, nil
+	}
+
+	dir := strings.Join(parts[:base], "/")
+	switch {
+	case dir == "" && base > 0:
+		dir = "/"
+	case dir == "":
+		dir = "."
+	}
+	var matches []string
+	err := walkDir(fsys, dir, len(parts)-base, func(name string, _ fs.DirEntry, err error) error {
+		if err != nil {
+			return fs.SkipDir
+		}
+		if name != dir {
+			if ok, _ := path.Match(pattern, name); ok {
+				matches = append(matches, name)
+			}
+		}
+		return nil
+	})
+	return matches, err
+}
+
+// splitTempPattern splits a temporary file name pattern into the parts before and after the last "*"
+// like os.CreateTemp
+func splitTempPattern(pattern string) (string, string, error) {
+	if strings.ContainsAny(pattern, `/\`) {
+		return "", "", ErrInvalidPath.Wrapf("pattern %q contains a path separator", pattern)
+	}
+	if pos := strings.LastIndexByte(pattern, '*'); pos != -1 {
+		return pattern[:pos], pattern[pos+1:], nil
+	}
+	return pattern, "", nil
+}
+
+// sortedEntries returns the file infos as directory entries sorted by name
+func sortedEntries(infos []*FileInfo) []fs.DirEntry {
+	entries := make([]fs.DirEntry, len(infos))
+	for i, info := range infos {
+		entries[i] = info
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries
+}
+
+// DirFS is an fs.FS rooted at a directory of a remote filesystem, returned by FS.Sub. Unlike FS, it only
+// accepts paths that are valid according to fs.ValidPath: unrooted, slash-separated and relative to the
+// root. The paths in the returned errors are relative to the root as well.
+type DirFS struct {
+	fsys FS
+	root string
+}
+
+// NewDirFS returns a DirFS for the directory root of fsys. With an empty root the names are passed to
+// fsys as is.
+func NewDirFS(fsys FS, root string) *DirFS {
+	return &DirFS{fsys: fsys, root: root}
+}
+
+// fullPath returns the path of name on the remote filesystem
+func (d *DirFS) fullPath(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if d.root == "" {
+		return name, nil
+	}
+	return path.Join(d.root, name), nil
+}
+
+// pathError returns err as a path error for name. The underlying error of a path error from the remote
+// filesystem is rewrapped with the path relative to the root.
+func pathError(op, name string, err error) error {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		err = pathErr.Err
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// Open opens the named file for reading
+func (d *DirFS) Open(name string) (fs.File, error) {
+	full, err := d.fullPath("open", name)
+	if err != nil {
+		return nil, err
+	}
+	file, err := d.fsys.Open(full)
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+	return file, nil
+}
+
+// Stat returns a fs.FileInfo describing the named file
+func (d *DirFS) Stat(name string) (fs.FileInfo, error) {
+	full, err := d.fullPath("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := d.fsys.Stat(full)
+	if err != nil {
+		return nil, pathError("stat", name, err)
+	}
+	return info, nil
+}
+
+// ReadDir reads the named directory and returns its entries sorted by name
+func (d *DirFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	full, err := d.fullPath("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := d.fsys.ReadDir(full)
+	if err != nil {
+		return nil, pathError("readdir", name, err)
+	}
+	return entries, nil
+}
+
+// ReadFile reads the named file and returns its contents
+func (d *DirFS) ReadFile(name string) ([]byte, error) {
+	full, err := d.fullPath("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := d.fsys.ReadFile(full)
+	if err != nil {
+		return nil, pathError("readfile", name, err)
+	}
+	return data, nil
+}
+
+// WriteFile writes data to the named file, creating it if necessary. If the file does not exist, it is
+// created with permissions perm, otherwise it is truncated.
+func (d *DirFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	full, err := d.fullPath("writefile", name)
+	if err != nil {
+		return err
+	}
+	if err := d.fsys.WriteFile(full, data, perm); err != nil {
+		return pathError("writefile", name, err)
+	}
+	return nil
+}
+
+// Glob returns the names of all files matching pattern
+func (d *DirFS) Glob(pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	if pattern == "." {
+		return []string{"."}, nil
+	}
+	if d.root == "" {
+		return d.fsys.Glob(pattern) //nolint:wrapcheck
+	}
+	matches, err := d.fsys.Glob(path.Join(d.root, pattern))
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	prefix := strings.TrimSuffix(d.root, "/") + "/"
+	names := make([]string, 0, len(matches))
+	for _, match := range matches {
+		if name := strings.TrimPrefix(match, prefix); name != match && fs.ValidPath(name) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// Sub returns a DirFS corresponding to the subtree rooted at dir
+func (d *DirFS) Sub(dir string) (fs.FS, error) {
+	full, err := d.fullPath("sub", dir)
+	if err != nil {
+		return nil, err
+	}
+	return &DirFS{fsys: d.fsys, root: full}, nil
+}
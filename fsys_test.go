@@ -0,0 +1,231 @@
+package rig
+
+import (
+	"encoding/json"
+	"io/fs"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAtomicTempName(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		prefix string
+	}{
+		{"/etc/app/config.yaml", "/etc/app/.config.yaml.rig-"},
+		{"config.yaml", ".config.yaml.rig-"},
+		{`C:\ProgramData\app\config.yaml`, `C:\ProgramData\app\.config.yaml.rig-`},
+	} {
+		tmp := atomicTempName(tc.name)
+		require.True(t, strings.HasPrefix(tmp, tc.prefix), tmp)
+		require.True(t, strings.HasSuffix(tmp, ".tmp"), tmp)
+		require.NotEqual(t, tmp, atomicTempName(tc.name))
+	}
+}
+
+func TestFileTime(t *testing.T) {
+	require.Equal(t, int64(116444736000000000), fileTime(time.Unix(0, 0)))
+	require.Equal(t, int64(132223104000000000), fileTime(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)))
+}
+
+type fakeLister []*FileInfo
+
+func (f fakeLister) Stat(name string) (fs.FileInfo, error) {
+	return f.Lstat(name)
+}
+
+func (f fakeLister) Lstat(name string) (fs.FileInfo, error) {
+	for _, info := range f {
+		if info.FName == name {
+			return info, nil
+		}
+	}
+	return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
+
+func (f fakeLister) list(root string, depth int) ([]*FileInfo, error) {
+	var entries []*FileInfo
+	for _, info := range f {
+		rel := strings.TrimPrefix(info.FName, root+"/")
+		if rel != info.FName && (depth == 0 || strings.Count(rel, "/") < depth) {
+			entries = append(entries, info)
+		}
+	}
+	return entries, nil
+}
+
+func (f fakeLister) dir(name string) string {
+	return path.Dir(name)
+}
+
+// fakeWindowsLister is a fakeLister that splits the paths like windowsFsys
+type fakeWindowsLister struct {
+	fakeLister
+}
+
+func (f fakeWindowsLister) dir(name string) string {
+	return (&windowsFsys{}).dir(name)
+}
+
+func TestWalkDirWindowsPaths(t *testing.T) {
+	var entries []*FileInfo
+	require.NoError(t, json.Unmarshal([]byte(`[
+		{"name": "C:\\root", "isDir": true},
+		{"name": "C:\\root\\a.txt"},
+		{"name": "C:\\root\\c", "isDir": true},
+		{"name": "C:\\root\\c\\d.txt"},
+		{"name": "C:\\root\\c\\e", "isDir": true},
+		{"name": "C:\\root\\c\\e\\f.txt"}
+	]`), &entries))
+	fsys := fakeWindowsLister{fakeLister(entries)}
+
+	var visited []string
+	err := walkDir(fsys, "C:/root", 0, func(name string, _ fs.DirEntry, err error) error {
+		require.NoError(t, err)
+		visited = append(visited, name)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"C:/root", "C:/root/a.txt", "C:/root/c", "C:/root/c/d.txt", "C:/root/c/e", "C:/root/c/e/f.txt"}, visited)
+
+	matches, err := glob(fsys, "C:/root/*/*.txt")
+	require.NoError(t, err)
+	require.Equal(t, []string{"C:/root/c/d.txt"}, matches)
+
+	require.Equal(t, "C:/root/c", fsys.dir(`C:\root\c\d.txt`))
+	require.Equal(t, "C:/root/c", fsys.dir(`C:\root\c\`))
+	require.Equal(t, "C:", fsys.dir(`C:\root`))
+}
+
+func TestWalkDirAndGlob(t *testing.T) {
+	fsys := fakeLister{
+		{FName: "/root", FIsDir: true},
+		{FName: "/root/b", FIsDir: true},
+		{FName: "/root/b/skip.txt"},
+		{FName: "/root/a.txt"},
+		{FName: "/root/c", FIsDir: true},
+		{FName: "/root/c/d.txt"},
+		{FName: "/root/c/e.go"},
+	}
+
+	var visited []string
+	err := walkDir(fsys, "/root", 0, func(name string, d fs.DirEntry, err error) error {
+		require.NoError(t, err)
+		visited = append(visited, name)
+		if name == "/root/b" {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"/root", "/root/a.txt", "/root/b", "/root/c", "/root/c/d.txt", "/root/c/e.go"}, visited)
+
+	matches, err := glob(fsys, "/root/*/*.txt")
+	require.NoError(t, err)
+	require.Equal(t, []string{"/root/b/skip.txt", "/root/c/d.txt"}, matches)
+
+	matches, err = glob(fsys, "/root/a.txt")
+	require.NoError(t, err)
+	require.Equal(t, []string{"/root/a.txt"}, matches)
+
+	_, err = glob(fsys, "/root/[")
+	require.ErrorIs(t, err, path.ErrBadPattern)
+}
+
+func TestSplitTempPattern(t *testing.T) {
+	prefix, suffix, err := splitTempPattern("conf-*.yaml")
+	require.NoError(t, err)
+	require.Equal(t, "conf-", prefix)
+	require.Equal(t, ".yaml", suffix)
+
+	prefix, suffix, err = splitTempPattern("rig-")
+	require.NoError(t, err)
+	require.Equal(t, "rig-", prefix)
+	require.Empty(t, suffix)
+
+	_, _, err = splitTempPattern("a/b*")
+	require.ErrorIs(t, err, ErrInvalidPath)
+}
+
+func TestMinutes(t *testing.T) {
+	require.Equal(t, int64(1), minutes(time.Second))
+	require.Equal(t, int64(60), minutes(time.Hour))
+	require.Equal(t, int64(61), minutes(time.Hour+time.Second))
+}
+
+// fakeGlobber is an FS with only Stat and Glob implemented
+type fakeGlobber struct {
+	FS
+	paths []string
+}
+
+func (f fakeGlobber) Stat(name string) (fs.FileInfo, error) {
+	for _, p := range f.paths {
+		if p == name {
+			return &FileInfo{FName: path.Base(name)}, nil
+		}
+	}
+	return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
+
+func (f fakeGlobber) Glob(pattern string) ([]string, error) {
+	var matches []string
+	for _, p := range f.paths {
+		if ok, _ := path.Match(pattern, p); ok {
+			matches = append(matches, p)
+		}
+	}
+	return matches, nil
+}
+
+func TestDirFS(t *testing.T) {
+	dir := NewDirFS(fakeGlobber{paths: []string{"/etc/app/a.yaml", "/etc/app/b.yaml", "/etc/other.yaml"}}, "/etc/app")
+
+	info, err := dir.Stat("a.yaml")
+	require.NoError(t, err)
+	require.Equal(t, "a.yaml", info.Name())
+
+	_, err = dir.Stat("c.yaml")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	var pathErr *fs.PathError
+	require.ErrorAs(t, err, &pathErr)
+	require.Equal(t, "c.yaml", pathErr.Path)
+
+	_, err = dir.Stat("../other.yaml")
+	require.ErrorIs(t, err, fs.ErrInvalid)
+
+	matches, err := fs.Glob(dir, "*.yaml")
+	require.NoError(t, err)
+	require.Equal(t, []string{"a.yaml", "b.yaml"}, matches)
+
+	sub, err := fs.Sub(NewDirFS(dir.fsys, "/etc"), "app")
+	require.NoError(t, err)
+	_, err = fs.Stat(sub, "b.yaml")
+	require.NoError(t, err)
+}
+
+func TestPathErrors(t *testing.T) {
+	errs := PathErrors{
+		{Op: "remove", Path: "/a", Err: fs.ErrPermission},
+		{Op: "remove", Path: "/b", Err: fs.ErrNotExist},
+	}
+	// the methods are called directly so that the test doesn't pass only because of the multiple error
+	// unwrapping of newer go versions
+	require.True(t, errs.Is(fs.ErrNotExist))
+	require.True(t, errs.Is(fs.ErrPermission))
+	require.False(t, errs.Is(fs.ErrExist))
+	var pathErr *fs.PathError
+	require.True(t, errs.As(&pathErr))
+	require.Equal(t, "/a", pathErr.Path)
+	require.Equal(t, "remove /a: permission denied; remove /b: file does not exist", errs.Error())
+
+	err := ErrCommandFailed.Wrap(errs)
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	var target PathErrors
+	require.ErrorAs(t, err, &target)
+	require.Len(t, target, 2)
+}
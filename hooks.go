@@ -0,0 +1,98 @@
+package rig
+
+import (
+	"time"
+
+	"github.com/k0sproject/rig/exec"
+)
+
+// ExecEvent describes a command for the OnExecStart and OnExecEnd hooks
+type ExecEvent struct {
+	// Command is the command as it is sent to the host, including the elevation, with the
+	// redactions applied
+	Command       string
+	CorrelationID string
+	Start         time.Time
+	// Duration and Err are only set for OnExecEnd
+	Duration time.Duration
+	Err      error
+}
+
+// UploadEvent describes a finished file upload for the OnUpload hooks
+type UploadEvent struct {
+	Source      string
+	Destination string
+	Bytes       int64
+	Duration    time.Duration
+	Err         error
+}
+
+// connectionHooks are the functions registered using the On methods of Connection
+type connectionHooks struct {
+	connect    []func(*Connection, error)
+	disconnect []func(*Connection)
+	execStart  []func(*Connection, ExecEvent)
+	execEnd    []func(*Connection, ExecEvent)
+	upload     []func(*Connection, UploadEvent)
+}
+
+// OnConnect registers fn to be called after each connection attempt with the error it failed with.
+// The hooks are called in the order they were registered, from the goroutine performing the
+// operation. The same applies to the other On methods.
+func (c *Connection) OnConnect(fn func(c *Connection, err error)) {
+	c.hooks.connect = append(c.hooks.connect, fn)
+}
+
+// OnDisconnect registers fn to be called when the connection is closed
+func (c *Connection) OnDisconnect(fn func(c *Connection)) {
+	c.hooks.disconnect = append(c.hooks.disconnect, fn)
+}
+
+// OnExecStart registers fn to be called before a command is sent to the host
+func (c *Connection) OnExecStart(fn func(c *Connection, event ExecEvent)) {
+	c.hooks.execStart = append(c.hooks.execStart, fn)
+}
+
+// OnExecEnd registers fn to be called when a command has finished. For commands started using
+// ExecStreams it is called when the Waiter returns.
+func (c *Connection) OnExecEnd(fn func(c *Connection, event ExecEvent)) {
+	c.hooks.execEnd = append(c.hooks.execEnd, fn)
+}
+
+// OnUpload registers fn to be called when a file upload has finished
+func (c *Connection) OnUpload(fn func(c *Connection, event UploadEvent)) {
+	c.hooks.upload = append(c.hooks.upload, fn)
+}
+
+// execEvent returns the event for the hooks of a command
+func execEvent(cmd string, opts []exec.Option, start time.Time) ExecEvent {
+	execOpts := exec.Build(opts...)
+	if rendered, err := execOpts.Command(cmd); err == nil {
+		cmd = rendered
+	}
+	return ExecEvent{Command: execOpts.Redact(cmd), CorrelationID: execOpts.CorrelationID, Start: start}
+}
+
+// execStarted calls the OnExecStart hooks
+func (c Connection) execStarted(cmd string, opts []exec.Option, start time.Time) {
+	if len(c.hooks.execStart) == 0 {
+		return
+	}
+	event := execEvent(cmd, opts, start)
+	for _, fn := range c.hooks.execStart {
+		fn(&c, event)
+	}
+}
+
+// execEnded calls the OnExecEnd hooks
+func (c Connection) execEnded(cmd string, opts []exec.Option, start time.Time, duration time.Duration, err error) {
+	if len(c.hooks.execEnd) == 0 {
+		return
+	}
+	event := execEvent(cmd, opts, start)
+	event.Duration = duration
+	event.Err = err
+	for _, fn := range c.hooks.execEnd {
+		fn(&c, event)
+	}
+}
@@ -0,0 +1,240 @@
+package rig
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/k0sproject/rig/exec"
+	"github.com/k0sproject/rig/pkg/clock"
+)
+
+// HostGroup runs the same operation on many connections concurrently
+//
+//	group := &rig.HostGroup{Hosts: hosts, Concurrency: 10, Timeout: time.Minute}
+//	results := group.ExecOutput("uname -r")
+//	for _, result := range results {
+//	  fmt.Println(result.Host, result.Output, result.Err)
+//	}
+//	if err := results.Err(); err != nil {
+//	  ...
+//	}
+type HostGroup struct {
+	Hosts []*Connection
+
+	// Concurrency limits the number of hosts the operation runs on at the same time, zero means no
+	// limit
+	Concurrency int
+
+	// Timeout limits the time the operation may take on a single host, zero means no limit. The
+	// commands run by Exec and ExecOutput are terminated when it is exceeded. The functions run by
+	// Each can't be interrupted, their result is reported as ErrTimeout while they are left running.
+	// They keep counting against Concurrency until they return.
+	Timeout time.Duration
+
+	// FailFast stops starting the operation on more hosts after it has failed on one of them. The
+	// hosts that were not started are marked as skipped.
+	FailFast bool
+
+	// Output receives the output of the commands run by Exec and ExecOutput as it arrives, with the
+	// lines prefixed with the host and the stream name, see HostOutputWriters. The streams redirected
+	// using exec.StdoutWriter or exec.StderrWriter are not included.
+	Output io.Writer
+}
+
+// HostResult is the outcome of a HostGroup operation on a single host
+type HostResult struct {
+	Host     *Connection
+	Output   string // Output is the output of ExecOutput
+	Err      error
+	Duration time.Duration
+	Skipped  bool // Skipped is true when the operation was not started because of FailFast
+}
+
+// HostResults are the results of a HostGroup operation in the order of HostGroup.Hosts
+type HostResults []HostResult
+
+// Failed returns the results of the hosts where the operation failed
+func (r HostResults) Failed() HostResults {
+	var failed HostResults
+	for _, result := range r {
+		if result.Err != nil {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// Err returns an error listing the hosts where the operation failed or nil when it succeeded on
+// all the hosts that were not skipped. The error wraps the error of the first failed host.
+func (r HostResults) Err() error {
+	failed := r.Failed()
+	if len(failed) == 0 {
+		return nil
+	}
+	return &hostGroupError{failed: failed}
+}
+
+// hostGroupError describes the failures of a HostGroup operation
+type hostGroupError struct {
+	failed HostResults
+}
+
+func (e *hostGroupError) Error() string {
+	lines := make([]string, len(e.failed))
+	for i, result := range e.failed {
+		lines[i] = fmt.Sprintf("%s: %v", result.Host, result.Err)
+	}
+	return fmt.Sprintf("failed on %d hosts:\n%s", len(e.failed), strings.Join(lines, "\n"))
+}
+
+func (e *hostGroupError) Unwrap() error {
+	return e.failed[0].Err
+}
+
+// run calls fn for each host observing the concurrency limit, the timeout and fail-fast
+func (g *HostGroup) run(fn func(*Connection) (string, error)) HostResults {
+	results := make(HostResults, len(g.Hosts))
+	limit := g.Concurrency
+	if limit <= 0 || limit > len(g.Hosts) {
+		limit = len(g.Hosts)
+	}
+	slots := make(chan struct{}, limit)
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed bool
+	)
+	for i, host := range g.Hosts {
+		slots <- struct{}{}
+		mu.Lock()
+		skip := failed && g.FailFast
+		mu.Unlock()
+		if skip {
+			<-slots
+			results[i] = HostResult{Host: host, Skipped: true}
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, host *Connection) {
+			result, finished := g.runHost(host, fn)
+			if result.Err != nil {
+				mu.Lock()
+				failed = true
+				mu.Unlock()
+			}
+			results[i] = result
+			wg.Done()
+			// a function left running after the timeout keeps its slot until it returns
+			<-finished
+			<-slots
+		}(i, host)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// runHost calls fn for a single host and gives up waiting for it when the timeout is exceeded. The
+// returned channel is closed when fn returns, which can be after runHost has returned.
+func (g *HostGroup) runHost(host *Connection, fn func(*Connection) (string, error)) (HostResult, <-chan struct{}) {
+	start := clock.Default.Now()
+	done := make(chan HostResult, 1)
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		output, err := fn(host)
+		done <- HostResult{Host: host, Output: output, Err: err}
+	}()
+
+	var result HostResult
+	if g.Timeout > 0 {
+		select {
+		case result = <-done:
+		case <-clock.Default.After(g.Timeout):
+			result = HostResult{Host: host, Err: ErrTimeout.Wrapf("%s: operation did not finish in %s", host, g.Timeout)}
+		}
+	} else {
+		result = <-done
+	}
+	result.Duration = clock.Default.Since(start)
+	return result, finished
+}
+
+// execOpts adds the timeout of the group to the options of a command
+func (g *HostGroup) execOpts(opts []exec.Option) []exec.Option {
+	if g.Timeout <= 0 {
+		return opts
+	}
+	return append([]exec.Option{exec.Timeout(g.Timeout)}, opts...)
+}
+
+// hostOpts adds writing the output lines into Output to the options of a command run on the host,
+// keeping a function set using exec.OnOutputLine. The returned function flushes the writers.
+func (g *HostGroup) hostOpts(c *Connection, opts []exec.Option) ([]exec.Option, func()) {
+	if g.Output == nil {
+		return opts, func() {}
+	}
+	execOpts := exec.Build(opts...)
+	onLine := execOpts.OutputLineFunc
+	stdout, stderr := HostOutputWriters(c, g.Output)
+	opts = append(opts[:len(opts):len(opts)], exec.OnOutputLine(func(line string, isStderr bool) {
+		w := stdout
+		if isStderr {
+			w = stderr
+		}
+		_, _ = w.Write([]byte(execOpts.Redact(line) + "\n"))
+		if onLine != nil {
+			onLine(line, isStderr)
+		}
+	}))
+	return opts, func() {
+		_ = stdout.Close()
+		_ = stderr.Close()
+	}
+}
+
+// Each calls fn for each of the hosts
+func (g *HostGroup) Each(fn func(*Connection) error) HostResults {
+	return g.run(func(c *Connection) (string, error) {
+		return "", fn(c)
+	})
+}
+
+// Connect connects to each of the hosts
+func (g *HostGroup) Connect() HostResults {
+	return g.Each(func(c *Connection) error {
+		return c.Connect()
+	})
+}
+
+// Exec runs the command on each of the hosts
+func (g *HostGroup) Exec(cmd string, opts ...exec.Option) HostResults {
+	opts = g.execOpts(opts)
+	return g.Each(func(c *Connection) error {
+		hostOpts, flush := g.hostOpts(c, opts)
+		defer flush()
+		return c.Exec(cmd, hostOpts...)
+	})
+}
+
+// ExecOutput runs the command on each of the hosts and collects the outputs into the results
+func (g *HostGroup) ExecOutput(cmd string, opts ...exec.Option) HostResults {
+	opts = g.execOpts(opts)
+	return g.run(func(c *Connection) (string, error) {
+		hostOpts, flush := g.hostOpts(c, opts)
+		defer flush()
+		return c.ExecOutput(cmd, hostOpts...)
+	})
+}
+
+// Upload uploads the local file src to dst on each of the hosts
+func (g *HostGroup) Upload(src, dst string, opts ...exec.Option) HostResults {
+	return g.Each(func(c *Connection) error {
+		return c.Upload(src, dst, opts...)
+	})
+}
@@ -0,0 +1,68 @@
+package rig
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostGroup(t *testing.T) {
+	errFail := errors.New("fail")
+	hosts := []*Connection{{client: &mockClient{}}, {client: &mockClient{}}, {client: &mockClient{}}}
+
+	results := (&HostGroup{Hosts: hosts}).Exec("true")
+	require.Len(t, results, 3)
+	require.NoError(t, results.Err())
+	for i, result := range results {
+		require.Same(t, hosts[i], result.Host)
+		require.Contains(t, result.Host.client.(*mockClient).commands, "true")
+	}
+
+	group := &HostGroup{Hosts: hosts, Concurrency: 1, FailFast: true}
+	results = group.Each(func(c *Connection) error {
+		if c == hosts[1] {
+			return errFail
+		}
+		return nil
+	})
+	require.NoError(t, results[0].Err)
+	require.ErrorIs(t, results[1].Err, errFail)
+	require.True(t, results[2].Skipped)
+	require.ErrorIs(t, results.Err(), errFail)
+	require.Len(t, results.Failed(), 1)
+
+	group = &HostGroup{Hosts: hosts[:1], Timeout: 10 * time.Millisecond}
+	results = group.Each(func(c *Connection) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+	require.ErrorIs(t, results.Err(), ErrTimeout)
+
+	// the function left running after the timeout keeps its slot
+	release := make(chan struct{})
+	started := make(chan *Connection, len(hosts))
+	group = &HostGroup{Hosts: hosts[:2], Concurrency: 1, Timeout: 10 * time.Millisecond}
+	resultsCh := make(chan HostResults, 1)
+	go func() {
+		resultsCh <- group.Each(func(c *Connection) error {
+			started <- c
+			if c == hosts[0] {
+				<-release
+			}
+			return nil
+		})
+	}()
+	require.Same(t, hosts[0], <-started)
+	select {
+	case <-started:
+		t.Fatal("the next host was started while the timed out function was still running")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	require.Same(t, hosts[1], <-started)
+	results = <-resultsCh
+	require.ErrorIs(t, results[0].Err, ErrTimeout)
+	require.NoError(t, results[1].Err)
+}
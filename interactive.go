@@ -0,0 +1,37 @@
+package rig
+
+import (
+	"io"
+	"os"
+
+	"github.com/k0sproject/rig/exec"
+	"github.com/k0sproject/rig/pkg/asciicast"
+	"golang.org/x/term"
+)
+
+// interactiveRecorder is implemented by the clients that can copy the output of an interactive
+// session into a writer in addition to the terminal, for exec.Asciicast
+type interactiveRecorder interface {
+	ExecInteractiveWithOutput(cmd string, output io.Writer) error
+}
+
+// execInteractiveRecorded runs the interactive session and records its output as an asciicast
+func (c Connection) execInteractiveRecorded(recorder interactiveRecorder, cmd string, execOpts *exec.Options) error {
+	width, height, err := term.GetSize(int(os.Stdin.Fd()))
+	if err != nil {
+		width, height = ptyWidth, ptyHeight
+	}
+	header := asciicast.Header{Width: width, Height: height, Command: execOpts.Redact(cmd), Title: c.String()}
+	if t := os.Getenv("TERM"); t != "" {
+		header.Env = map[string]string{"TERM": t}
+	}
+	cast, err := asciicast.NewWriter(execOpts.Asciicast, header)
+	if err != nil {
+		return ErrOS.Wrapf("start recording: %w", err)
+	}
+	err = recorder.ExecInteractiveWithOutput(cmd, cast)
+	if closeErr := cast.Close(); closeErr != nil {
+		c.Logger().Warnf("%s: failed to finish recording: %v", c, closeErr)
+	}
+	return err //nolint:wrapcheck
+}
@@ -0,0 +1,91 @@
+package rig
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/alessio/shellescape"
+	"github.com/k0sproject/rig/exec"
+)
+
+const (
+	// SysctlConfigPath is the file where the values set with SetSysctl are persisted
+	SysctlConfigPath = "/etc/sysctl.d/99-rig.conf"
+	// ModulesLoadDir is the directory where the kernel modules loaded with LoadKernelModule are
+	// persisted, one file per module
+	ModulesLoadDir = "/etc/modules-load.d"
+)
+
+var (
+	sysctlKeyRe    = regexp.MustCompile(`^[\w.*/-]+$`)
+	kernelModuleRe = regexp.MustCompile(`^[\w-]+$`)
+)
+
+func (c *Connection) checkLinuxName(kind, name string, re *regexp.Regexp) error {
+	if c.IsWindows() {
+		return ErrNotSupported.Wrapf("%s on windows", kind)
+	}
+	if !re.MatchString(name) {
+		return ErrValidationFailed.Wrapf("invalid %s name %q", kind, name)
+	}
+	return nil
+}
+
+// Sysctl returns the current value of a kernel parameter, such as "net.ipv4.ip_forward"
+func (c *Connection) Sysctl(key string) (string, error) {
+	if err := c.checkLinuxName("sysctl", key, sysctlKeyRe); err != nil {
+		return "", err
+	}
+	value, err := c.ExecOutput("sysctl -n "+key, exec.HideOutput())
+	if err != nil {
+		return "", ErrCommandFailed.Wrapf("read sysctl %s: %w", key, err)
+	}
+	return value, nil
+}
+
+// SetSysctl sets a kernel parameter and persists it in SysctlConfigPath so that it survives a reboot.
+// An earlier value of the same parameter in the file is replaced. The key and the value can't contain
+// line breaks.
+func (c *Connection) SetSysctl(key, value string) error {
+	if err := c.checkLinuxName("sysctl", key, sysctlKeyRe); err != nil {
+		return err
+	}
+	if strings.ContainsAny(key+value, "\r\n") {
+		// a line break would add lines of its own to the config file
+		return ErrValidationFailed.Wrapf("sysctl %q: line breaks are not allowed", key)
+	}
+	setting := shellescape.Quote(key + " = " + value)
+	script := fmt.Sprintf(
+		`f=%[1]s; mkdir -p "$(dirname "$f")" && touch "$f" && { grep -v %[2]s "$f" || true; } > "$f.tmp" && echo %[3]s >> "$f.tmp" && mv "$f.tmp" "$f" && sysctl -q -w %[4]s`,
+		SysctlConfigPath,
+		shellescape.Quote("^[[:space:]]*"+strings.ReplaceAll(key, ".", `\.`)+"[[:space:]]*="),
+		setting,
+		shellescape.Quote(key+"="+value),
+	)
+	if err := c.Exec("sh -c "+shellescape.Quote(script), exec.Sudo(c)); err != nil {
+		return ErrCommandFailed.Wrapf("set sysctl %s: %w", key, err)
+	}
+	return nil
+}
+
+// KernelModuleLoaded returns true if a kernel module is loaded or built into the kernel
+func (c *Connection) KernelModuleLoaded(name string) (bool, error) {
+	if err := c.checkLinuxName("kernel module", name, kernelModuleRe); err != nil {
+		return false, err
+	}
+	// module names use dashes and underscores interchangeably but /sys/module only has underscores
+	return c.Exec("test -d /sys/module/"+strings.ReplaceAll(name, "-", "_"), exec.HideOutput()) == nil, nil
+}
+
+// LoadKernelModule loads a kernel module and adds it to ModulesLoadDir so that it gets loaded on boot
+func (c *Connection) LoadKernelModule(name string) error {
+	if err := c.checkLinuxName("kernel module", name, kernelModuleRe); err != nil {
+		return err
+	}
+	script := fmt.Sprintf(`modprobe %[1]s && mkdir -p %[2]s && echo %[1]s > %[2]s/%[1]s.conf`, name, ModulesLoadDir)
+	if err := c.Exec("sh -c "+shellescape.Quote(script), exec.Sudo(c)); err != nil {
+		return ErrCommandFailed.Wrapf("load kernel module %s: %w", name, err)
+	}
+	return nil
+}
@@ -2,23 +2,57 @@ package rig
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	osexec "os/exec"
+	"os/user"
 	"runtime"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/k0sproject/rig/exec"
+	"github.com/k0sproject/rig/pkg/clock"
 	"github.com/kballard/go-shellquote"
 )
 
 const name = "[local] localhost"
 
-// Localhost is a direct localhost connection
+// Localhost is a direct localhost connection. The commands are run using bash on unix and cmd.exe
+// on windows, see Shell for wrapping them in another shell, and support the same options as the SSH and WinRM connections: the environment and
+// the working directory are applied by Connection, stdin is read from exec.Stdin or exec.StdinReader
+// and a command that exceeds exec.Timeout is killed along with the processes it has started.
+// ExecInteractive runs the command attached to the local terminal.
 type Localhost struct {
-	Enabled bool `yaml:"enabled" validate:"required,eq=true" default:"true"`
+	Enabled bool `yaml:"enabled" json:"enabled" mapstructure:"enabled" validate:"required,eq=true" default:"true"`
+
+	// User runs the commands as another user using passwordless sudo, so that they are run like
+	// they would be over SSH as that user. Not supported on windows.
+	User string `yaml:"user,omitempty" json:"user,omitempty" mapstructure:"user"`
+
+	// CleanEnv runs the commands with only the essential variables of the environment, such as
+	// PATH and HOME, instead of the whole environment of the current process
+	CleanEnv bool `yaml:"cleanEnv,omitempty" json:"cleanEnv,omitempty" mapstructure:"cleanEnv"`
+
+	// Cwd is the working directory of the commands, the working directory of the current process
+	// by default. The exec.Cwd option takes precedence.
+	Cwd string `yaml:"cwd,omitempty" json:"cwd,omitempty" mapstructure:"cwd"`
+
+	// Shell is the shell the commands are wrapped in when neither Connection.Shell nor exec.Shell
+	// is set, one of the exec.Shell* constants. Like with Connection.Shell, only sh and bash can be
+	// used on unix and only cmd on windows.
+	Shell string `yaml:"shell,omitempty" json:"shell,omitempty" mapstructure:"shell" validate:"omitempty,oneof=sh bash cmd none"`
+
+	// deprecations are the warnings about deprecated fields found while decoding, logged by Connection
+	deprecations deprecationWarnings
+}
+
+// cleanEnvKeys are the environment variables kept when CleanEnv is set
+var cleanEnvKeys = []string{
+	"PATH", "HOME", "USER", "LOGNAME", "SHELL", "LANG", "LC_ALL", "TERM", "TMPDIR",
+	"SYSTEMROOT", "WINDIR", "COMSPEC", "PATHEXT", "TEMP", "TMP", "USERPROFILE", "PROGRAMFILES",
 }
 
 // Protocol returns the protocol name, "Local"
@@ -52,7 +86,7 @@ func (c *Localhost) Connect() error {
 }
 
 // Disconnect on local connection does nothing
-func (c *Localhost) Disconnect() {}
+func (c *Localhost) Disconnect() error { return nil }
 
 // ExecStreams executes a command on the remote host and uses the passed in streams for stdin, stdout and stderr. It returns a Waiter with a .Wait() function that
 // blocks until the command finishes and returns an error if the exit code is not zero.
@@ -63,17 +97,109 @@ func (c *Localhost) ExecStreams(cmd string, stdin io.ReadCloser, stdout, stderr
 		return nil, ErrCommandFailed.Wrapf("failed to build command: %w", err)
 	}
 
-	command.Stdin = stdin
-	command.Stdout = stdout
-	command.Stderr = stderr
+	if stdin != nil {
+		command.Stdin = stdin
+	}
+	pipes := &outputPipes{}
+	if stdout != nil {
+		w, err := pipes.copyTo(stdout)
+		if err != nil {
+			pipes.close()
+			return nil, ErrCommandFailed.Wrapf("failed to create stdout pipe: %w", err)
+		}
+		command.Stdout = w
+	}
+	if stderr != nil {
+		w, err := pipes.copyTo(stderr)
+		if err != nil {
+			pipes.close()
+			return nil, ErrCommandFailed.Wrapf("failed to create stderr pipe: %w", err)
+		}
+		command.Stderr = w
+	}
 
 	execOpts.LogCmd(name, cmd)
 
 	if err := command.Start(); err != nil {
+		pipes.close()
 		return nil, ErrCommandFailed.Wrapf("failed to start command: %w", err)
 	}
+	pipes.started()
 
-	return command, nil
+	waiter := &localWaiter{cmd: command, pipes: pipes}
+	return withTimeout(waiter, execOpts.Timeout, func() {
+		killProcess(command)
+		closeAfter(killWaitDelay, pipes.readers...)
+	}), nil
+}
+
+// killWaitDelay is how long the output of a command that has been killed for exceeding exec.Timeout
+// is still read. A process started by the command can leave the process group, like daemons do,
+// and keep the output pipes open after the command has been killed.
+const killWaitDelay = time.Second
+
+// closeAfter closes the files once the delay has passed
+func closeAfter(d time.Duration, closers ...io.Closer) {
+	go func() {
+		<-clock.Default.After(d)
+		for _, c := range closers {
+			_ = c.Close()
+		}
+	}()
+}
+
+// outputPipes connects the output streams of a local command to writers through pipes of its own
+// instead of the ones os/exec would create, so that reading them can be stopped by closing the read
+// ends after the command has been killed
+type outputPipes struct {
+	readers []io.Closer
+	writers []*os.File
+	wg      sync.WaitGroup
+}
+
+// copyTo returns the write end of a pipe whose contents are copied to dst
+func (p *outputPipes) copyTo(dst io.Writer) (*os.File, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	p.readers = append(p.readers, r)
+	p.writers = append(p.writers, w)
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer r.Close()
+		_, _ = io.Copy(dst, r)
+	}()
+	return w, nil
+}
+
+// started closes the write ends that have been passed on to the started command
+func (p *outputPipes) started() {
+	for _, w := range p.writers {
+		_ = w.Close()
+	}
+}
+
+// close closes both ends of the pipes when the command could not be started
+func (p *outputPipes) close() {
+	p.started()
+	for _, r := range p.readers {
+		_ = r.Close()
+	}
+}
+
+// localWaiter waits for a local command and for its output to be copied
+type localWaiter struct {
+	cmd   *osexec.Cmd
+	pipes *outputPipes
+}
+
+// Wait blocks until the command has exited and its output has been copied
+func (w *localWaiter) Wait() error {
+	err := w.cmd.Wait()
+	w.pipes.wg.Wait()
+	return err //nolint:wrapcheck
 }
 
 // Exec executes a command on the host
@@ -84,10 +210,10 @@ func (c *Localhost) Exec(cmd string, opts ...exec.Option) error {
 		return err
 	}
 
-	if execOpts.Stdin != "" {
+	if src := execOpts.StdinSource(); src != nil {
 		execOpts.LogStdin(name)
 
-		command.Stdin = strings.NewReader(execOpts.Stdin)
+		command.Stdin = src
 	}
 
 	stdout, err := command.StdoutPipe()
@@ -104,6 +230,11 @@ func (c *Localhost) Exec(cmd string, opts ...exec.Option) error {
 	if err := command.Start(); err != nil {
 		return fmt.Errorf("failed to start command: %w", err)
 	}
+	timedOut := startTimeout(execOpts.Timeout, func() {
+		killProcess(command)
+		closeAfter(killWaitDelay, stdout, stderr)
+	})
+
 	var wg sync.WaitGroup
 	wg.Add(1)
 	go func() {
@@ -115,28 +246,57 @@ func (c *Localhost) Exec(cmd string, opts ...exec.Option) error {
 			for outputScanner.Scan() {
 				execOpts.AddOutput(name, outputScanner.Text()+"\n", "")
 			}
+
+			if err := outputScanner.Err(); err != nil && !errors.Is(err, os.ErrClosed) {
+				execOpts.LogErrorf("%s: %s", c, err.Error())
+			}
 		} else {
-			if _, err := io.Copy(execOpts.Writer, stdout); err != nil {
+			if _, err := io.Copy(execOpts.Writer, stdout); err != nil && !errors.Is(err, os.ErrClosed) {
 				execOpts.LogErrorf("%s: failed to stream stdout: %v", c, err)
 			}
 		}
 	}()
+	gotErrors := false
+
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 
+		if execOpts.ErrWriter != nil {
+			n, err := io.Copy(execOpts.ErrWriter, stderr)
+			gotErrors = n > 0
+			if err != nil && !errors.Is(err, os.ErrClosed) {
+				execOpts.LogErrorf("%s: failed to stream stderr: %v", c, err)
+			}
+			return
+		}
+
 		outputScanner := bufio.NewScanner(stderr)
 
 		for outputScanner.Scan() {
+			gotErrors = true
 			execOpts.AddOutput(name, "", outputScanner.Text()+"\n")
 		}
+
+		if err := outputScanner.Err(); err != nil && !errors.Is(err, os.ErrClosed) {
+			gotErrors = true
+			execOpts.LogErrorf("%s: %s", c, err.Error())
+		}
 	}()
 
-	err = command.Wait()
+	// all reads from the pipes must be completed before calling Wait
 	wg.Wait()
+	err = command.Wait()
+	execOpts.FlushOutput()
+	if timedOut() {
+		return ErrTimeout.Wrapf("command did not finish in %s", execOpts.Timeout)
+	}
 	if err != nil {
 		return fmt.Errorf("command wait: %w", err)
 	}
+	if c.IsWindows() && !execOpts.AllowWinStderr && gotErrors {
+		return ErrCommandFailed.Wrapf("data in stderr")
+	}
 	return nil
 }
 
@@ -146,31 +306,78 @@ func (c *Localhost) command(cmd string, o *exec.Options) (*osexec.Cmd, error) {
 		return nil, fmt.Errorf("build command: %w", err)
 	}
 
+	args, err := c.asUser(shellArgs(cmd))
+	if err != nil {
+		return nil, err
+	}
+
+	command := newLocalCommand(args)
+	command.Dir = c.Cwd
+	command.Env = c.environ()
+
+	return command, nil
+}
+
+// defaultShell returns the shell the commands are wrapped in when no other shell has been set
+func (c *Localhost) defaultShell() string {
+	return c.Shell
+}
+
+// asUser wraps the command line in a sudo when the commands are run as another user
+func (c *Localhost) asUser(args []string) ([]string, error) {
+	if c.User == "" {
+		return args, nil
+	}
+	if current, err := user.Current(); err == nil && current.Username == c.User {
+		return args, nil
+	}
 	if c.IsWindows() {
-		return osexec.Command("cmd.exe", "/c", cmd), nil
+		return nil, ErrNotSupported.Wrapf("running local commands as another user on windows")
 	}
+	return append([]string{"sudo", "-n", "-H", "-u", c.User, "--"}, args...), nil
+}
 
-	return osexec.Command("bash", "-c", "--", cmd), nil
+// environ returns the environment of the commands, nil for the environment of the current process
+func (c *Localhost) environ() []string {
+	if !c.CleanEnv {
+		return nil
+	}
+	env := []string{}
+	for _, kv := range os.Environ() {
+		k, _, _ := strings.Cut(kv, "=")
+		for _, keep := range cleanEnvKeys {
+			// the names are case-insensitive on windows
+			if k == keep || (c.IsWindows() && strings.EqualFold(k, keep)) {
+				env = append(env, kv)
+				break
+			}
+		}
+	}
+	return env
 }
 
 // ExecInteractive executes a command on the host and copies stdin/stdout/stderr from local host
 func (c *Localhost) ExecInteractive(cmd string) error {
 	if cmd == "" {
-		cmd = os.Getenv("SHELL") + " -l"
-	}
-
-	if cmd == " -l" {
-		cmd = "cmd"
+		cmd = defaultInteractiveShell()
+		if shell := os.Getenv("SHELL"); shell != "" {
+			cmd = shell + " -l"
+		}
 	}
 
-	cwd, err := os.Getwd()
-	if err != nil {
-		return fmt.Errorf("failed to get current working directory: %w", err)
+	cwd := c.Cwd
+	if cwd == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get current working directory: %w", err)
+		}
+		cwd = wd
 	}
 
 	pa := os.ProcAttr{
 		Files: []*os.File{os.Stdin, os.Stdout, os.Stderr},
 		Dir:   cwd,
+		Env:   c.environ(),
 	}
 
 	parts, err := shellquote.Split(cmd)
@@ -178,7 +385,21 @@ func (c *Localhost) ExecInteractive(cmd string) error {
 		return fmt.Errorf("failed to parse command: %w", err)
 	}
 
-	proc, err := os.StartProcess(parts[0], parts[1:], &pa)
+	if len(parts) == 0 {
+		return ErrValidationFailed.Wrapf("empty command")
+	}
+
+	if parts, err = c.asUser(parts); err != nil {
+		return err
+	}
+
+	// StartProcess does not search the PATH
+	path, err := osexec.LookPath(parts[0])
+	if err != nil {
+		return ErrCommandFailed.Wrapf("find %s: %w", parts[0], err)
+	}
+
+	proc, err := os.StartProcess(path, parts, &pa)
 	if err != nil {
 		return fmt.Errorf("failed to start process: %w", err)
 	}
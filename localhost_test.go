@@ -0,0 +1,77 @@
+package rig
+
+import (
+	"io"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/k0sproject/rig/exec"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalhostExecOutputComplete(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses seq")
+	}
+	// the output is several times the size of a pipe buffer, the end of it is lost if the pipes
+	// are closed by Wait before they have been read
+	c := &Localhost{Enabled: true}
+	for i := 0; i < 3; i++ {
+		var out string
+		require.NoError(t, c.Exec("seq 1 30000", exec.Output(&out)))
+		require.True(t, strings.HasSuffix(out, "\n30000\n"))
+	}
+}
+
+func TestLocalhostOptions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh commands")
+	}
+	t.Setenv("RIG_TEST_SECRET", "secret")
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	current, err := user.Current()
+	require.NoError(t, err)
+
+	c := &Localhost{Enabled: true, Cwd: dir, User: current.Username}
+	var out string
+	require.NoError(t, c.Exec("pwd; echo ${RIG_TEST_SECRET:-unset}", exec.Output(&out)))
+	require.Equal(t, dir+"\nsecret\n", out)
+
+	c.CleanEnv = true
+	out = ""
+	require.NoError(t, c.Exec(`echo ${RIG_TEST_SECRET:-unset}; [ -n "$PATH" ] && echo path`, exec.Output(&out)))
+	require.Equal(t, "unset\npath\n", out)
+
+	args, err := (&Localhost{User: "rig-test-user"}).asUser([]string{"bash", "-c", "--", "id"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"sudo", "-n", "-H", "-u", "rig-test-user", "--", "bash", "-c", "--", "id"}, args)
+}
+
+func TestLocalhostTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh commands")
+	}
+	c := &Localhost{Enabled: true}
+	for _, cmd := range []string{
+		"sh -c 'sleep 100; true'",
+		// the grandchild leaves the process group and keeps the output pipes open until it exits
+		"setsid sh -c 'sleep 10; true' & wait",
+	} {
+		t.Run(cmd, func(t *testing.T) {
+			start := time.Now()
+			require.ErrorIs(t, c.Exec(cmd, exec.Timeout(100*time.Millisecond)), ErrTimeout)
+			require.Less(t, time.Since(start), 5*time.Second)
+
+			start = time.Now()
+			waiter, err := c.ExecStreams(cmd, nil, io.Discard, io.Discard, exec.Timeout(100*time.Millisecond))
+			require.NoError(t, err)
+			require.ErrorIs(t, waiter.Wait(), ErrTimeout)
+			require.Less(t, time.Since(start), 5*time.Second)
+		})
+	}
+}
@@ -0,0 +1,33 @@
+//go:build !windows
+
+package rig
+
+import (
+	osexec "os/exec"
+	"syscall"
+)
+
+// shellArgs returns the command line for running cmd using bash
+func shellArgs(cmd string) []string {
+	return []string{"bash", "-c", "--", cmd}
+}
+
+// newLocalCommand returns a command for args that is started in a process group of its own, so
+// that killProcess also reaches the processes the command has started
+func newLocalCommand(args []string) *osexec.Cmd {
+	cmd := osexec.Command(args[0], args[1:]...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	return cmd
+}
+
+// killProcess kills the process group of the command
+func killProcess(cmd *osexec.Cmd) {
+	if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil {
+		_ = cmd.Process.Kill()
+	}
+}
+
+// defaultInteractiveShell is the shell started by ExecInteractive when no command is given
+func defaultInteractiveShell() string {
+	return "sh -l"
+}
@@ -0,0 +1,34 @@
+package rig
+
+import (
+	"fmt"
+	osexec "os/exec"
+	"strings"
+	"syscall"
+)
+
+// shellArgs returns the command line for running cmd using cmd.exe. With /s cmd.exe removes the
+// outer quotes and takes the rest as is.
+func shellArgs(cmd string) []string {
+	return []string{"cmd.exe", "/s", "/c", `"` + cmd + `"`}
+}
+
+// newLocalCommand returns a command for args. The command line is passed to the process as is,
+// the escaping os/exec would apply to the arguments is not understood by cmd.exe.
+func newLocalCommand(args []string) *osexec.Cmd {
+	cmd := osexec.Command(args[0])
+	cmd.SysProcAttr = &syscall.SysProcAttr{CmdLine: strings.Join(args, " ")}
+	return cmd
+}
+
+// killProcess kills the process tree of the command
+func killProcess(cmd *osexec.Cmd) {
+	if err := osexec.Command("taskkill", "/T", "/F", "/PID", fmt.Sprint(cmd.Process.Pid)).Run(); err != nil {
+		_ = cmd.Process.Kill()
+	}
+}
+
+// defaultInteractiveShell is the shell started by ExecInteractive when no command is given
+func defaultInteractiveShell() string {
+	return "cmd"
+}
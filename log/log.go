@@ -1,7 +1,15 @@
-// Package log provides a simple pluggable logging interface
+// Package log provides a simple pluggable logging interface.
+//
+// A logrus Logger or Entry implements Logger as is, a zap SugaredLogger can be used through Sugared
+// and a log/slog Logger through Slog. The logger can be set globally using Log or for a single
+// connection using the Log field of rig.Connection.
 package log
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/k0sproject/rig/pkg/redact"
+)
 
 // Logger interface should be implemented by the logging library you wish to use
 type Logger interface {
@@ -15,31 +23,109 @@ type Logger interface {
 // Log can be assigned a proper logger, such as logrus configured to your liking.
 var Log Logger
 
+// Global is a Logger that logs to the logger currently assigned to Log
+var Global Logger = global{}
+
+type global struct{}
+
+func (global) Tracef(t string, args ...interface{}) { Tracef(t, args...) }
+func (global) Debugf(t string, args ...interface{}) { Debugf(t, args...) }
+func (global) Infof(t string, args ...interface{})  { Infof(t, args...) }
+func (global) Warnf(t string, args ...interface{})  { Warnf(t, args...) }
+func (global) Errorf(t string, args ...interface{}) { Errorf(t, args...) }
+
 // Tracef logs a trace level log message
 func Tracef(t string, args ...interface{}) {
+	t, args = redacted(t, args)
 	Log.Debugf(t, args...)
 }
 
 // Debugf logs a debug level log message
 func Debugf(t string, args ...interface{}) {
+	t, args = redacted(t, args)
 	Log.Debugf(t, args...)
 }
 
 // Infof logs an info level log message
 func Infof(t string, args ...interface{}) {
+	t, args = redacted(t, args)
 	Log.Infof(t, args...)
 }
 
 // Errorf logs an error level log message
 func Errorf(t string, args ...interface{}) {
+	t, args = redacted(t, args)
 	Log.Errorf(t, args...)
 }
 
 // Warnf logs a warn level log message
 func Warnf(t string, args ...interface{}) {
+	t, args = redacted(t, args)
 	Log.Warnf(t, args...)
 }
 
+// redacted formats the message and masks the secrets registered in the redact package and in r. The
+// arguments are passed through as is when nothing has been registered.
+func redacted(t string, args []interface{}, r ...*redact.Redactor) (string, []interface{}) {
+	empty := redact.Empty()
+	for _, rr := range r {
+		empty = empty && rr.Empty()
+	}
+	if empty {
+		return t, args
+	}
+	s := redact.String(fmt.Sprintf(t, args...))
+	for _, rr := range r {
+		s = rr.String(s)
+	}
+	return "%s", []interface{}{s}
+}
+
+// Redacted returns a Logger that masks the secrets registered in the redact package in the messages
+// before passing them to l
+func Redacted(l Logger) Logger {
+	return RedactedWith(l, nil)
+}
+
+// RedactedWith returns a Logger that masks the secrets registered in the redact package and in r in
+// the messages before passing them to l
+func RedactedWith(l Logger, r *redact.Redactor) Logger {
+	if rl, ok := l.(redactedLogger); ok && rl.r == r {
+		return rl
+	}
+	return redactedLogger{l: l, r: r}
+}
+
+type redactedLogger struct {
+	l Logger
+	r *redact.Redactor
+}
+
+func (r redactedLogger) Tracef(t string, args ...interface{}) {
+	t, args = redacted(t, args, r.r)
+	r.l.Tracef(t, args...)
+}
+
+func (r redactedLogger) Debugf(t string, args ...interface{}) {
+	t, args = redacted(t, args, r.r)
+	r.l.Debugf(t, args...)
+}
+
+func (r redactedLogger) Infof(t string, args ...interface{}) {
+	t, args = redacted(t, args, r.r)
+	r.l.Infof(t, args...)
+}
+
+func (r redactedLogger) Warnf(t string, args ...interface{}) {
+	t, args = redacted(t, args, r.r)
+	r.l.Warnf(t, args...)
+}
+
+func (r redactedLogger) Errorf(t string, args ...interface{}) {
+	t, args = redacted(t, args, r.r)
+	r.l.Errorf(t, args...)
+}
+
 // StdLog is a simplistic logger for rig
 type StdLog struct {
 	Logger
@@ -0,0 +1,35 @@
+//go:build go1.21
+
+package log
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// LevelTrace is the slog level used for the trace messages
+const LevelTrace = slog.LevelDebug - 4
+
+// Slog returns a Logger that logs to a log/slog Logger
+func Slog(l *slog.Logger) Logger {
+	return slogger{l}
+}
+
+type slogger struct {
+	l *slog.Logger
+}
+
+func (s slogger) log(level slog.Level, t string, args ...interface{}) {
+	ctx := context.Background()
+	if !s.l.Enabled(ctx, level) {
+		return
+	}
+	s.l.Log(ctx, level, fmt.Sprintf(t, args...))
+}
+
+func (s slogger) Tracef(t string, args ...interface{}) { s.log(LevelTrace, t, args...) }
+func (s slogger) Debugf(t string, args ...interface{}) { s.log(slog.LevelDebug, t, args...) }
+func (s slogger) Infof(t string, args ...interface{})  { s.log(slog.LevelInfo, t, args...) }
+func (s slogger) Warnf(t string, args ...interface{})  { s.log(slog.LevelWarn, t, args...) }
+func (s slogger) Errorf(t string, args ...interface{}) { s.log(slog.LevelError, t, args...) }
@@ -0,0 +1,23 @@
+package log
+
+// SugaredLogger is a leveled logger without a trace level, such as zap's SugaredLogger
+type SugaredLogger interface {
+	Debugf(string, ...interface{})
+	Infof(string, ...interface{})
+	Warnf(string, ...interface{})
+	Errorf(string, ...interface{})
+}
+
+// Sugared returns a Logger that logs to a logger without a trace level, such as zap's
+// SugaredLogger. The trace messages are logged at the debug level.
+func Sugared(l SugaredLogger) Logger {
+	return sugared{l}
+}
+
+type sugared struct {
+	SugaredLogger
+}
+
+func (s sugared) Tracef(t string, args ...interface{}) {
+	s.Debugf(t, args...)
+}
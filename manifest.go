@@ -0,0 +1,72 @@
+package rig
+
+import (
+	"io/fs"
+	"sort"
+)
+
+// ManifestEntry describes a regular file in a Manifest
+type ManifestEntry struct {
+	Path   string      `json:"path"` // Path relative to the manifest root, slash separated
+	Size   int64       `json:"size"`
+	Mode   fs.FileMode `json:"mode"`
+	Sha256 string      `json:"sha256"`
+}
+
+// Manifest is a list of the regular files in a directory tree, sorted by path
+type Manifest []ManifestEntry
+
+// Get returns the entry for path and true if the path is included in the manifest
+func (m Manifest) Get(path string) (ManifestEntry, bool) {
+	idx := sort.Search(len(m), func(i int) bool { return m[i].Path >= path })
+	if idx < len(m) && m[idx].Path == path {
+		return m[idx], true
+	}
+	return ManifestEntry{}, false
+}
+
+// Diff compares the manifest to another manifest and returns the paths that only exist in the other
+// manifest (added), only exist in this manifest (removed) and the paths that exist in both but have
+// a different size, mode or checksum (changed).
+func (m Manifest) Diff(other Manifest) (added, removed, changed []string) {
+	for _, entry := range m {
+		otherEntry, ok := other.Get(entry.Path)
+		if !ok {
+			removed = append(removed, entry.Path)
+			continue
+		}
+		if otherEntry != entry {
+			changed = append(changed, entry.Path)
+		}
+	}
+	for _, entry := range other {
+		if _, ok := m.Get(entry.Path); !ok {
+			added = append(added, entry.Path)
+		}
+	}
+	return added, removed, changed
+}
+
+// manifestResponse is a manifest entry as returned by the fsys helper scripts
+type manifestResponse struct {
+	Path   string    `json:"path"`
+	Sha256 string    `json:"sha256"`
+	Stat   *FileInfo `json:"stat"`
+}
+
+func newManifest(entries []*manifestResponse) Manifest {
+	manifest := make(Manifest, 0, len(entries))
+	for _, entry := range entries {
+		if entry == nil || entry.Stat == nil {
+			continue
+		}
+		manifest = append(manifest, ManifestEntry{
+			Path:   entry.Path,
+			Size:   entry.Stat.Size(),
+			Mode:   entry.Stat.Mode(),
+			Sha256: entry.Sha256,
+		})
+	}
+	sort.Slice(manifest, func(i, j int) bool { return manifest[i].Path < manifest[j].Path })
+	return manifest
+}
@@ -0,0 +1,21 @@
+package rig
+
+import "time"
+
+// Metrics receives the operational metrics of connections, for example for exposing them to
+// Prometheus using the github.com/k0sproject/rig/pkg/metrics/prometheus module, which is kept
+// separate so that rig itself does not depend on the Prometheus client. Set it using the Metrics
+// field of Connection.
+// The same Metrics is usually shared by all of the connections, so it must be safe for concurrent use.
+type Metrics interface {
+	// ConnectDone is called after each connection attempt with the error it failed with
+	ConnectDone(protocol string, err error)
+	// ExecDone is called when a command has finished
+	ExecDone(protocol string, duration time.Duration, err error)
+	// UploadDone is called when a file upload has finished
+	UploadDone(protocol string, bytes int64, duration time.Duration, err error)
+	// SessionOpened is called when a connection has been established
+	SessionOpened(protocol string)
+	// SessionClosed is called when an established connection is closed
+	SessionClosed(protocol string)
+}
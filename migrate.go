@@ -0,0 +1,487 @@
+package rig
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Deprecation describes a deprecated configuration field found while migrating a configuration
+type Deprecation struct {
+	Path    string // Path to the field, such as "hosts[0].ssh.keypath"
+	Line    int    // Line number in the source document
+	Message string // Description of the change that was made
+}
+
+// String returns a human readable description of the deprecation
+func (d Deprecation) String() string {
+	return fmt.Sprintf("line %d: %s: %s", d.Line, d.Path, d.Message)
+}
+
+// fieldRenames maps field names used by older versions of rig and projects embedding it to the current ones
+var fieldRenames = map[string]map[string]string{
+	"connection": {
+		"SSH":   "ssh",
+		"WinRM": "winRM",
+		"winrm": "winRM",
+		"local": "localhost",
+	},
+	"ssh": {
+		"host":         "address",
+		"ip":           "address",
+		"username":     "user",
+		"keypath":      "keyPath",
+		"key_path":     "keyPath",
+		"identityFile": "keyPath",
+		"hostkey":      "hostKey",
+		"host_key":     "hostKey",
+	},
+	"winRM": {
+		"host":            "address",
+		"ip":              "address",
+		"username":        "user",
+		"https":           "useHTTPS",
+		"usehttps":        "useHTTPS",
+		"use_https":       "useHTTPS",
+		"ntlm":            "useNTLM",
+		"usentlm":         "useNTLM",
+		"use_ntlm":        "useNTLM",
+		"cacertpath":      "caCertPath",
+		"ca_cert_path":    "caCertPath",
+		"certpath":        "certPath",
+		"cert_path":       "certPath",
+		"keypath":         "keyPath",
+		"key_path":        "keyPath",
+		"tlsservername":   "tlsServerName",
+		"tls_server_name": "tlsServerName",
+	},
+}
+
+// deprecatedConnectionFields holds the connection fields decoded from their old names. Connection
+// can't decode them in an UnmarshalYAML of its own, because it is usually embedded into a host
+// struct that would then lose the rest of its fields. The values are moved into the current fields
+// once by SetDefaults. The keys are the ones in fieldRenames["connection"]. The keys that only differ
+// from the current ones by case are yaml only, json and mapstructure match them case-insensitively.
+type deprecatedConnectionFields struct {
+	// Deprecated: use SSH
+	DeprecatedSSH *SSH `yaml:"SSH,omitempty" json:"-" mapstructure:"-"`
+	// Deprecated: use WinRM
+	DeprecatedWinRM *WinRM `yaml:"WinRM,omitempty" json:"-" mapstructure:"-"`
+	// Deprecated: use WinRM
+	DeprecatedWinrm *WinRM `yaml:"winrm,omitempty" json:"-" mapstructure:"-"`
+	// Deprecated: use Localhost
+	DeprecatedLocal *Localhost `yaml:"local,omitempty" json:"local,omitempty" mapstructure:"local"`
+}
+
+// applyDeprecatedFields moves the values of the deprecated connection fields into the current ones
+// and logs a warning for each deprecated field found while decoding the configuration
+func (c *Connection) applyDeprecatedFields() {
+	var warnings deprecationWarnings
+	// cleared first, the connection is logged in the warnings
+	deprecated := c.deprecatedConnectionFields
+	c.deprecatedConnectionFields = deprecatedConnectionFields{}
+
+	apply := func(old, current string, applied bool) {
+		if applied {
+			warnings.warnf("field %q is deprecated, use %q instead", old, current)
+		} else {
+			warnings.warnf("ignoring deprecated field %q because %q is already set", old, current)
+		}
+	}
+	if deprecated.DeprecatedSSH != nil {
+		apply("SSH", "ssh", setIfNil(&c.SSH, deprecated.DeprecatedSSH))
+	}
+	if deprecated.DeprecatedWinRM != nil {
+		apply("WinRM", "winRM", setIfNil(&c.WinRM, deprecated.DeprecatedWinRM))
+	}
+	if deprecated.DeprecatedWinrm != nil {
+		apply("winrm", "winRM", setIfNil(&c.WinRM, deprecated.DeprecatedWinrm))
+	}
+	if deprecated.DeprecatedLocal != nil {
+		apply("local", "localhost", setIfNil(&c.Localhost, deprecated.DeprecatedLocal))
+	}
+
+	if c.SSH != nil {
+		warnings = append(warnings, c.SSH.takeDeprecations()...)
+	}
+	if c.WinRM != nil {
+		warnings = append(warnings, c.WinRM.deprecations.take()...)
+		if c.WinRM.Bastion != nil {
+			warnings = append(warnings, c.WinRM.Bastion.takeDeprecations()...)
+		}
+	}
+	if c.Localhost != nil {
+		warnings = append(warnings, c.Localhost.deprecations.take()...)
+	}
+
+	for _, warning := range warnings {
+		c.Logger().Warnf("%s: %s", c, warning)
+	}
+}
+
+// deprecationWarnings collects the warnings about the deprecated fields found by the decoders of the
+// client configurations, which don't know the logger of the connection yet. Connection logs them when
+// the client is set up.
+type deprecationWarnings []string
+
+func (w *deprecationWarnings) warnf(format string, args ...interface{}) {
+	*w = append(*w, fmt.Sprintf(format, args...))
+}
+
+// take returns the collected warnings and clears them
+func (w *deprecationWarnings) take() []string {
+	warnings := *w
+	*w = nil
+	return warnings
+}
+
+// takeDeprecations returns and clears the deprecation warnings of the configuration and the
+// configurations of its bastions
+func (c *SSH) takeDeprecations() []string {
+	warnings := c.deprecations.take()
+	if c.Bastion != nil {
+		warnings = append(warnings, c.Bastion.takeDeprecations()...)
+	}
+	return warnings
+}
+
+// setIfNil sets *field to value when it is nil and returns true if it did
+// firstSet returns the first of the values that is not nil
+func firstSet[T any](values ...*T) *T {
+	for _, value := range values {
+		if value != nil {
+			return value
+		}
+	}
+	return nil
+}
+
+func setIfNil[T any](field **T, value *T) bool {
+	if *field != nil {
+		return false
+	}
+	*field = value
+	return true
+}
+
+// sortedKeys returns the keys of a string map in a stable order
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// yamlFieldName returns the name of a struct field in yaml documents
+func yamlFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if name == "" {
+		return strings.ToLower(field.Name)
+	}
+	return name
+}
+
+// unmarshalRenamed decodes the values of deprecated fields into the current fields of the struct
+// pointed to by target, adding a warning to warnings for each deprecated field encountered
+func unmarshalRenamed(unmarshal func(interface{}) error, kind string, target interface{}, warnings *deprecationWarnings) error {
+	raw := make(map[string]*rawYAML)
+	if err := unmarshal(&raw); err != nil {
+		return nil //nolint:nilerr // not a mapping, the regular decoding has already reported the error
+	}
+	values := make(map[string]func(interface{}) error, len(raw))
+	for key, value := range raw {
+		values[key] = value.unmarshal
+	}
+	return decodeRenamed(values, kind, target, warnings)
+}
+
+// unmarshalRenamedJSON is unmarshalRenamed for JSON documents
+func unmarshalRenamedJSON(data []byte, kind string, target interface{}, warnings *deprecationWarnings) error {
+	raw := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil //nolint:nilerr // not an object, the regular decoding has already reported the error
+	}
+	values := make(map[string]func(interface{}) error, len(raw))
+	for key, value := range raw {
+		value := value
+		values[key] = func(v interface{}) error { return json.Unmarshal(value, v) }
+	}
+	return decodeRenamed(values, kind, target, warnings)
+}
+
+// decodeRenamed decodes the values of the deprecated keys in raw into the current fields of the
+// struct pointed to by target
+func decodeRenamed(raw map[string]func(interface{}) error, kind string, target interface{}, warnings *deprecationWarnings) error {
+	renames := fieldRenames[kind]
+	value := reflect.ValueOf(target).Elem()
+	fields := make(map[string]reflect.Value, value.NumField())
+	for i := 0; i < value.NumField(); i++ {
+		if value.Type().Field(i).IsExported() {
+			fields[yamlFieldName(value.Type().Field(i))] = value.Field(i)
+		}
+	}
+
+	seen := make(map[string]string)
+	for _, key := range sortedKeys(raw) {
+		if _, ok := renames[key]; !ok {
+			seen[key] = key
+		}
+	}
+
+	for _, old := range sortedKeys(raw) {
+		current, ok := renames[old]
+		if !ok {
+			continue
+		}
+		if prev, ok := seen[current]; ok {
+			warnings.warnf("%s: ignoring deprecated field %q because %q is already set", kind, old, prev)
+			continue
+		}
+		field, ok := fields[current]
+		if !ok {
+			continue
+		}
+		warnings.warnf("%s: field %q is deprecated, use %q instead", kind, old, current)
+		if err := raw[old](field.Addr().Interface()); err != nil {
+			return ErrValidationFailed.Wrapf("unmarshal %s.%s: %w", kind, old, err)
+		}
+		seen[current] = old
+	}
+
+	return nil
+}
+
+// UnmarshalYAML decodes the SSH configuration, accepting deprecated field names
+func (c *SSH) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type sshConfig SSH
+	if err := unmarshal((*sshConfig)(c)); err != nil {
+		return err //nolint:wrapcheck
+	}
+	if err := unmarshalRenamed(unmarshal, "ssh", c, &c.deprecations); err != nil {
+		return err
+	}
+	return c.expandEnv()
+}
+
+// UnmarshalYAML decodes the WinRM configuration, accepting deprecated field names
+func (c *WinRM) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type winrmConfig WinRM
+	if err := unmarshal((*winrmConfig)(c)); err != nil {
+		return err //nolint:wrapcheck
+	}
+	if err := unmarshalRenamed(unmarshal, "winRM", c, &c.deprecations); err != nil {
+		return err
+	}
+	return c.expandEnv()
+}
+
+// UnmarshalYAML decodes the Localhost configuration. The deprecated "localhost: true" form is accepted
+// in addition to the "localhost: { enabled: true }" mapping.
+func (c *Localhost) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var enabled bool
+	if err := unmarshal(&enabled); err == nil {
+		c.deprecations.warnf("localhost: boolean value is deprecated, use \"enabled: %t\" instead", enabled)
+		c.Enabled = enabled
+		return nil
+	}
+	type localhostConfig Localhost
+	return unmarshal((*localhostConfig)(c)) //nolint:wrapcheck
+}
+
+// UnmarshalJSON decodes the SSH configuration, accepting the same deprecated field names as
+// UnmarshalYAML
+func (c *SSH) UnmarshalJSON(data []byte) error {
+	type sshConfig SSH
+	if err := json.Unmarshal(data, (*sshConfig)(c)); err != nil {
+		return err //nolint:wrapcheck
+	}
+	if err := unmarshalRenamedJSON(data, "ssh", c, &c.deprecations); err != nil {
+		return err
+	}
+	return c.expandEnv()
+}
+
+// UnmarshalJSON decodes the WinRM configuration, accepting the same deprecated field names as
+// UnmarshalYAML
+func (c *WinRM) UnmarshalJSON(data []byte) error {
+	type winrmConfig WinRM
+	if err := json.Unmarshal(data, (*winrmConfig)(c)); err != nil {
+		return err //nolint:wrapcheck
+	}
+	if err := unmarshalRenamedJSON(data, "winRM", c, &c.deprecations); err != nil {
+		return err
+	}
+	return c.expandEnv()
+}
+
+// UnmarshalJSON decodes the Localhost configuration, accepting the deprecated boolean form like
+// UnmarshalYAML
+func (c *Localhost) UnmarshalJSON(data []byte) error {
+	var enabled bool
+	if err := json.Unmarshal(data, &enabled); err == nil {
+		c.deprecations.warnf("localhost: boolean value is deprecated, use \"enabled: %t\" instead", enabled)
+		c.Enabled = enabled
+		return nil
+	}
+	type localhostConfig Localhost
+	return json.Unmarshal(data, (*localhostConfig)(c)) //nolint:wrapcheck
+}
+
+// MigrateYAML finds connection configurations in a yaml document and upgrades deprecated field names
+// and layouts to their current form. The upgraded document is returned along with a list of the
+// deprecations that were found. Comments and the order of fields are preserved.
+func MigrateYAML(data []byte) ([]byte, []Deprecation, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, ErrValidationFailed.Wrapf("parse yaml: %w", err)
+	}
+
+	m := &migrator{}
+	m.walk(&doc, "")
+
+	if len(m.deprecations) == 0 {
+		return data, nil, nil
+	}
+
+	buf := bytes.NewBuffer(nil)
+	enc := yaml.NewEncoder(buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, nil, ErrValidationFailed.Wrapf("encode yaml: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, nil, ErrValidationFailed.Wrapf("encode yaml: %w", err)
+	}
+
+	return buf.Bytes(), m.deprecations, nil
+}
+
+type migrator struct {
+	deprecations []Deprecation
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// walk looks for mappings that look like connection configurations
+func (m *migrator) walk(node *yaml.Node, path string) {
+	switch node.Kind { //nolint:exhaustive
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			m.walk(child, path)
+		}
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			m.walk(child, path+"["+strconv.Itoa(i)+"]")
+		}
+	case yaml.MappingNode:
+		if isConnectionNode(node) {
+			m.migrateConnection(node, path)
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			m.walk(node.Content[i+1], joinPath(path, node.Content[i].Value))
+		}
+	}
+}
+
+// isConnectionNode returns true if the mapping has a key that identifies a connection protocol
+func isConnectionNode(node *yaml.Node) bool {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i].Value
+		if current, ok := fieldRenames["connection"][key]; ok && current != "localhost" {
+			return true
+		}
+		if key == "ssh" || key == "winRM" || key == "localhost" {
+			return true
+		}
+	}
+	return false
+}
+
+// rename renames the keys of a mapping according to the rename table for kind
+func (m *migrator) rename(node *yaml.Node, kind, path string) {
+	renames := fieldRenames[kind]
+	keys := make(map[string]struct{})
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if _, ok := renames[node.Content[i].Value]; !ok {
+			keys[node.Content[i].Value] = struct{}{}
+		}
+	}
+
+	content := make([]*yaml.Node, 0, len(node.Content))
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		current, ok := renames[key.Value]
+		if !ok {
+			content = append(content, key, value)
+			continue
+		}
+		if _, exists := keys[current]; exists {
+			m.deprecations = append(m.deprecations, Deprecation{Path: joinPath(path, key.Value), Line: key.Line, Message: fmt.Sprintf("removed deprecated field %q because %q is already set", key.Value, current)})
+			continue
+		}
+		m.deprecations = append(m.deprecations, Deprecation{Path: joinPath(path, key.Value), Line: key.Line, Message: fmt.Sprintf("field %q is deprecated, use %q instead", key.Value, current)})
+		keys[current] = struct{}{}
+		key.Value = current
+		content = append(content, key, value)
+	}
+	node.Content = content
+}
+
+func (m *migrator) migrateConnection(node *yaml.Node, path string) {
+	m.rename(node, "connection", path)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		switch key.Value {
+		case "ssh":
+			m.migrateSSH(value, joinPath(path, key.Value))
+		case "winRM":
+			m.rename(value, "winRM", joinPath(path, key.Value))
+			m.migrateBastion(value, joinPath(path, key.Value))
+		case "localhost":
+			if value.Kind == yaml.ScalarNode && value.Tag == "!!bool" {
+				m.deprecations = append(m.deprecations, Deprecation{Path: joinPath(path, key.Value), Line: key.Line, Message: fmt.Sprintf("boolean value is deprecated, use \"enabled: %s\" instead", value.Value)})
+				node.Content[i+1] = &yaml.Node{
+					Kind: yaml.MappingNode,
+					Tag:  "!!map",
+					Content: []*yaml.Node{
+						{Kind: yaml.ScalarNode, Tag: "!!str", Value: "enabled"},
+						value,
+					},
+				}
+			}
+		}
+	}
+}
+
+func (m *migrator) migrateSSH(node *yaml.Node, path string) {
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+	m.rename(node, "ssh", path)
+	m.migrateBastion(node, path)
+}
+
+func (m *migrator) migrateBastion(node *yaml.Node, path string) {
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == "bastion" {
+			m.migrateSSH(node.Content[i+1], joinPath(path, "bastion"))
+		}
+	}
+}
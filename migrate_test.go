@@ -0,0 +1,193 @@
+package rig
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/creasty/defaults"
+	"github.com/k0sproject/rig/log"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+const legacyConfig = `hosts:
+  - role: controller
+    ssh:
+      host: 10.0.0.1
+      username: admin
+      keypath: ~/.ssh/id_rsa
+      bastion:
+        ip: 10.0.0.254
+  - role: worker
+    winrm:
+      address: 10.0.0.2
+      ip: 10.0.0.3
+      https: true
+  - role: local
+    localhost: true
+`
+
+func TestMigrateYAML(t *testing.T) {
+	out, deprecations, err := MigrateYAML([]byte(legacyConfig))
+	require.NoError(t, err)
+	require.Len(t, deprecations, 8)
+	require.Equal(t, "hosts[0].ssh.host", deprecations[0].Path)
+	require.Equal(t, 4, deprecations[0].Line)
+	require.Equal(t, `hosts:
+  - role: controller
+    ssh:
+      address: 10.0.0.1
+      user: admin
+      keyPath: ~/.ssh/id_rsa
+      bastion:
+        address: 10.0.0.254
+  - role: worker
+    winRM:
+      address: 10.0.0.2
+      useHTTPS: true
+  - role: local
+    localhost:
+      enabled: true
+`, string(out))
+
+	out, deprecations, err = MigrateYAML(out)
+	require.NoError(t, err)
+	require.Empty(t, deprecations)
+	require.NotEmpty(t, out)
+}
+
+func TestUnmarshalDeprecatedFields(t *testing.T) {
+	var config struct {
+		Hosts []struct {
+			Connection `yaml:",inline"`
+		} `yaml:"hosts"`
+	}
+	require.NoError(t, yaml.Unmarshal([]byte(legacyConfig), &config))
+	require.Len(t, config.Hosts, 3)
+	require.Equal(t, "10.0.0.1", config.Hosts[0].SSH.Address)
+	require.Equal(t, "admin", config.Hosts[0].SSH.User)
+	require.Equal(t, "~/.ssh/id_rsa", *config.Hosts[0].SSH.KeyPath)
+	require.Equal(t, "10.0.0.254", config.Hosts[0].SSH.Bastion.Address)
+	require.True(t, config.Hosts[2].Localhost.Enabled)
+
+	// renamed connection level keys are taken into account by the getters but only applied by SetDefaults
+	require.Nil(t, config.Hosts[1].WinRM)
+	require.Equal(t, "WinRM", config.Hosts[1].Protocol())
+	require.Nil(t, config.Hosts[1].WinRM)
+	require.NotNil(t, config.Hosts[1].DeprecatedWinrm)
+	require.NoError(t, defaults.Set(&config.Hosts[1].Connection))
+	require.Nil(t, config.Hosts[1].DeprecatedWinrm)
+	require.Equal(t, "10.0.0.2", config.Hosts[1].WinRM.Address)
+	require.True(t, config.Hosts[1].WinRM.UseHTTPS)
+}
+
+func TestDeprecatedConnectionFields(t *testing.T) {
+	fieldType := reflect.TypeOf(deprecatedConnectionFields{})
+	var tags []string
+	for i := 0; i < fieldType.NumField(); i++ {
+		tags = append(tags, yamlFieldName(fieldType.Field(i)))
+	}
+	require.ElementsMatch(t, sortedKeys(fieldRenames["connection"]), tags)
+
+	var host struct {
+		Connection `yaml:",inline"`
+		Role       string `yaml:"role"`
+	}
+	require.NoError(t, yaml.Unmarshal([]byte("role: worker\nSSH:\n  address: 10.0.0.1\nlocal: true\n"), &host))
+	require.Equal(t, "worker", host.Role)
+	require.NoError(t, defaults.Set(&host.Connection))
+	require.Equal(t, "10.0.0.1", host.SSH.Address)
+	require.True(t, host.Localhost.Enabled)
+	require.Equal(t, "Local", host.Protocol(), "localhost is preferred like with the current field names")
+
+	var jsonHost struct {
+		Connection
+		Role string `json:"role"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(`{"role": "worker", "WinRM": {"address": "10.0.0.2"}, "winRM": {"address": "10.0.0.3"}}`), &jsonHost))
+	require.Equal(t, "worker", jsonHost.Role)
+	require.Equal(t, "10.0.0.3", jsonHost.Address(), "the current field wins")
+	require.Nil(t, jsonHost.DeprecatedWinRM)
+
+	var jsonConn Connection
+	require.NoError(t, json.Unmarshal([]byte(`{"SSH": {"address": "10.0.0.1"}, "local": true}`), &jsonConn))
+	require.Equal(t, "10.0.0.1", jsonConn.SSH.Address, "json matches the key case-insensitively")
+	require.Nil(t, jsonConn.DeprecatedSSH)
+	require.True(t, jsonConn.DeprecatedLocal.Enabled)
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	var hosts []struct {
+		Connection
+	}
+	data := []byte(`[
+		{"ssh": {"address": "10.0.0.1", "username": "admin", "keyPath": "~/.ssh/id_rsa", "bastion": {"ip": "10.0.0.254"}}},
+		{"winRM": {"address": "10.0.0.2", "use_https": true}},
+		{"localhost": true},
+		{"localhost": {"enabled": true}}
+	]`)
+	require.NoError(t, json.Unmarshal(data, &hosts))
+	require.Len(t, hosts, 4)
+	require.Equal(t, "10.0.0.1", hosts[0].SSH.Address)
+	require.Equal(t, "admin", hosts[0].SSH.User)
+	require.Equal(t, "~/.ssh/id_rsa", *hosts[0].SSH.KeyPath)
+	require.Equal(t, "10.0.0.254", hosts[0].SSH.Bastion.Address)
+	require.True(t, hosts[1].WinRM.UseHTTPS)
+	require.True(t, hosts[2].Localhost.Enabled)
+	require.True(t, hosts[3].Localhost.Enabled)
+
+	out, err := json.Marshal(hosts[1])
+	require.NoError(t, err)
+	require.Contains(t, string(out), `"winRM":{"address":"10.0.0.2"`)
+	require.NotContains(t, string(out), `"ssh"`)
+}
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("RIG_TEST_ADDRESS", "10.0.0.1")
+	t.Setenv("RIG_TEST_PASSWORD", "secret")
+	data := []byte("ssh:\n  address: ${RIG_TEST_ADDRESS}\n  keyPath: ~/.ssh/${RIG_TEST_MISSING}\n")
+
+	var c Connection
+	require.NoError(t, yaml.Unmarshal(data, &c))
+	require.Equal(t, "${RIG_TEST_ADDRESS}", c.SSH.Address, "expansion is opt-in")
+
+	ExpandEnv = true
+	defer func() { ExpandEnv = false }()
+
+	require.ErrorIs(t, yaml.Unmarshal(data, &c), ErrValidationFailed)
+
+	c = Connection{}
+	require.NoError(t, json.Unmarshal([]byte(`{"winRM": {"address": "${RIG_TEST_ADDRESS}", "password": "pa$$${RIG_TEST_PASSWORD}"}}`), &c))
+	require.Equal(t, "10.0.0.1", c.WinRM.Address)
+	require.Equal(t, "pa$$secret", c.WinRM.Password)
+}
+
+func TestDeprecationWarningsLogged(t *testing.T) {
+	var config struct {
+		Hosts []struct {
+			Connection `yaml:",inline"`
+		} `yaml:"hosts"`
+	}
+	require.NoError(t, yaml.Unmarshal([]byte(legacyConfig), &config))
+
+	loggers := make([]*captureLogger, len(config.Hosts))
+	for i := range config.Hosts {
+		loggers[i] = &captureLogger{}
+		config.Hosts[i].Log = log.Sugared(loggers[i])
+		require.NotEmpty(t, config.Hosts[i].Protocol())
+		require.Empty(t, loggers[i].messages, "getters don't log")
+		require.NoError(t, defaults.Set(&config.Hosts[i].Connection))
+		// logged once
+		config.Hosts[i].SetDefaults()
+	}
+	require.Equal(t, []string{
+		`[SSH] 10.0.0.1: ssh: field "host" is deprecated, use "address" instead`,
+		`[SSH] 10.0.0.1: ssh: field "keypath" is deprecated, use "keyPath" instead`,
+		`[SSH] 10.0.0.1: ssh: field "username" is deprecated, use "user" instead`,
+		`[SSH] 10.0.0.1: ssh: field "ip" is deprecated, use "address" instead`,
+	}, loggers[0].messages)
+	require.Contains(t, loggers[1].messages[0], `field "winrm" is deprecated, use "winRM" instead`)
+	require.Contains(t, loggers[1].messages, `[WinRM] 10.0.0.2: winRM: ignoring deprecated field "ip" because "address" is already set`)
+	require.Equal(t, []string{`[Local] 127.0.0.1: localhost: boolean value is deprecated, use "enabled: true" instead`}, loggers[2].messages)
+}
@@ -0,0 +1,117 @@
+package rig
+
+import (
+	"context"
+	"sync"
+)
+
+// ActiveOperations is a snapshot of the work in progress on a connection, see
+// Connection.ActiveOperations
+type ActiveOperations struct {
+	// Sessions is the number of commands running on the host, including the commands run by the
+	// file transfers and the commands started using ExecStreams whose Waiter has not returned yet
+	Sessions int
+	// Processes are the processes started using StartBackground that have not been seen to have
+	// exited using RemoteProcess.Poll. They keep running after the connection is closed.
+	Processes []*RemoteProcess
+}
+
+// operations tracks the sessions and background processes of a connection. The methods do nothing
+// on a nil operations, so commands run on a connection that has not been set up are not tracked.
+type operations struct {
+	mu        sync.Mutex
+	sessions  int
+	idle      chan struct{}
+	processes []*RemoteProcess
+}
+
+// sessionStarted counts a command that has been started on the host
+func (o *operations) sessionStarted() {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.sessions == 0 {
+		o.idle = make(chan struct{})
+	}
+	o.sessions++
+}
+
+// sessionDone counts a command that has finished
+func (o *operations) sessionDone() {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.sessions--
+	if o.sessions == 0 {
+		close(o.idle)
+	}
+}
+
+// processStarted adds a background process
+func (o *operations) processStarted(p *RemoteProcess) {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.processes = append(o.processes, p)
+}
+
+// processExited removes a background process
+func (o *operations) processExited(p *RemoteProcess) {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i, proc := range o.processes {
+		if proc == p {
+			o.processes = append(o.processes[:i:i], o.processes[i+1:]...)
+			return
+		}
+	}
+}
+
+// snapshot returns the current operations and a channel that is closed when there are no sessions
+// left, nil when there are none
+func (o *operations) snapshot() (ActiveOperations, <-chan struct{}) {
+	if o == nil {
+		return ActiveOperations{}, nil
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	active := ActiveOperations{Sessions: o.sessions, Processes: append([]*RemoteProcess(nil), o.processes...)}
+	if o.sessions == 0 {
+		return active, nil
+	}
+	return active, o.idle
+}
+
+// ActiveOperations returns the commands and background processes in progress on the connection, for
+// example to detect ExecStreams waiters that are never waited for or background processes that are
+// left running
+func (c *Connection) ActiveOperations() ActiveOperations {
+	active, _ := c.ops.snapshot()
+	return active
+}
+
+// WaitIdle blocks until no commands are running on the connection or the context is done, for
+// example to let the work in progress finish before calling Disconnect. The background processes
+// are not waited for.
+func (c *Connection) WaitIdle(ctx context.Context) error {
+	for {
+		_, idle := c.ops.snapshot()
+		if idle == nil {
+			return nil
+		}
+		select {
+		case <-idle:
+		case <-ctx.Done():
+			return ErrTimeout.Wrapf("%s: wait for running commands: %w", c, ctx.Err())
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package os
+
+import (
+	"crypto/sha1" //nolint:gosec // sha1 is what windows uses for certificate thumbprints
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/k0sproject/rig/errstring"
+)
+
+// ErrInvalidCertificate is returned when a certificate can't be decoded
+var ErrInvalidCertificate = errstring.New("invalid certificate")
+
+// certificateNameRe matches the names accepted by InstallCACertificate and RemoveCACertificate
+var certificateNameRe = regexp.MustCompile(`^[\w.-]+$`)
+
+// checkCertificateName returns an error if name can't be used as a CA certificate name. The name
+// ends up in a file path on linux, so it can't contain path separators or "..".
+func checkCertificateName(name string) error {
+	if !certificateNameRe.MatchString(name) || strings.Contains(name, "..") {
+		return ErrInvalidCertificate.Wrapf("invalid certificate name %q", name)
+	}
+	return nil
+}
+
+// caTrustStore describes where a distribution keeps locally added CA certificates
+// and the command that rebuilds the system trust bundle from them
+type caTrustStore struct {
+	dir    string
+	update string
+}
+
+// caTrustStores lists the known trust store layouts in the order they are probed
+var caTrustStores = []caTrustStore{
+	{dir: "/usr/local/share/ca-certificates", update: "update-ca-certificates"},        // debian, ubuntu, alpine
+	{dir: "/etc/pki/ca-trust/source/anchors", update: "update-ca-trust extract"},       // rhel, centos, fedora
+	{dir: "/etc/pki/trust/anchors", update: "update-ca-certificates"},                  // sles, opensuse
+	{dir: "/etc/ca-certificates/trust-source/anchors", update: "trust extract-compat"}, // arch
+}
+
+// parseCertificatePEM decodes the first certificate from a PEM encoded string
+func parseCertificatePEM(data string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, ErrInvalidCertificate.Wrapf("no PEM encoded certificate found")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, ErrInvalidCertificate.Wrap(err)
+	}
+	return cert, nil
+}
+
+// CertificateThumbprint returns the uppercase hex SHA-1 fingerprint of a PEM encoded certificate,
+// which is the format windows and macOS use to identify certificates in their stores
+func CertificateThumbprint(data string) (string, error) {
+	cert, err := parseCertificatePEM(data)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToUpper(fmt.Sprintf("%x", sha1.Sum(cert.Raw))), nil //nolint:gosec
+}
@@ -0,0 +1,68 @@
+package os
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/k0sproject/rig/exec"
+	"github.com/stretchr/testify/require"
+)
+
+// mockHost records the commands it is asked to run and succeeds on all of them
+type mockHost struct {
+	commands []string
+}
+
+func (h *mockHost) Upload(_, _ string, _ ...exec.Option) error { return nil }
+func (h *mockHost) Exec(cmd string, _ ...exec.Option) error {
+	h.commands = append(h.commands, cmd)
+	return nil
+}
+
+func (h *mockHost) ExecOutput(cmd string, _ ...exec.Option) (string, error) {
+	h.commands = append(h.commands, cmd)
+	return "", nil
+}
+
+func (h *mockHost) Execf(s string, params ...interface{}) error {
+	return h.Exec(fmt.Sprintf(s, withoutOptions(params)...))
+}
+
+func (h *mockHost) ExecOutputf(s string, params ...interface{}) (string, error) {
+	return h.ExecOutput(fmt.Sprintf(s, withoutOptions(params)...))
+}
+
+// withoutOptions drops the exec options from the Execf parameters
+func withoutOptions(params []interface{}) []interface{} {
+	var args []interface{}
+	for _, p := range params {
+		if _, ok := p.(exec.Option); !ok {
+			args = append(args, p)
+		}
+	}
+	return args
+}
+
+func (h *mockHost) String() string                  { return "mock" }
+func (h *mockHost) Sudo(cmd string) (string, error) { return cmd, nil }
+
+func TestCACertificateName(t *testing.T) {
+	for _, name := range []string{"", "..", "../../etc/cron.d/evil", "a/b", `a\b`, "a b", "a;b", "x..y"} {
+		t.Run(name, func(t *testing.T) {
+			h := &mockHost{}
+			require.ErrorIs(t, Linux{}.InstallCACertificate(h, name, "cert"), ErrInvalidCertificate)
+			require.ErrorIs(t, Linux{}.RemoveCACertificate(h, name), ErrInvalidCertificate)
+			require.ErrorIs(t, Windows{}.InstallCACertificate(h, name, "cert"), ErrInvalidCertificate)
+			require.ErrorIs(t, Windows{}.RemoveCACertificate(h, name), ErrInvalidCertificate)
+			require.Empty(t, h.commands)
+		})
+	}
+
+	h := &mockHost{}
+	require.NoError(t, Linux{}.RemoveCACertificate(h, "my-ca_1.0"))
+	require.Contains(t, h.commands, "rm -f -- /usr/local/share/ca-certificates/my-ca_1.0.crt 2> /dev/null")
+
+	h = &mockHost{}
+	require.NoError(t, Windows{}.RemoveCACertificate(h, "my-ca_1.0"))
+	require.Len(t, h.commands, 1)
+}
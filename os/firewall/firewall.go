@@ -0,0 +1,154 @@
+// Package firewall provides an abstraction over the host firewalls for opening and closing ports
+package firewall
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alessio/shellescape"
+	"github.com/k0sproject/rig/errstring"
+	"github.com/k0sproject/rig/exec"
+	ps "github.com/k0sproject/rig/powershell"
+)
+
+// Protocols for OpenPort and ClosePort
+const (
+	TCP = "tcp"
+	UDP = "udp"
+)
+
+var (
+	// ErrNotFound is returned when no supported firewall is found on the host
+	ErrNotFound = errstring.New("firewall not found")
+	// ErrInvalidProtocol is returned when the protocol is not tcp or udp
+	ErrInvalidProtocol = errstring.New("invalid protocol")
+)
+
+// Host interface for firewalls
+type Host interface {
+	Exec(string, ...exec.Option) error
+	Sudo(string) (string, error)
+	IsWindows() bool
+}
+
+// Firewall opens and closes ports on a host
+type Firewall interface {
+	// Name returns the name of the firewall, such as "firewalld"
+	Name() string
+	// OpenPort allows incoming traffic to a port. Opening a port that is already open is not an error.
+	OpenPort(h Host, port int, protocol string) error
+	// ClosePort removes the rule added by OpenPort. Closing a port that is not open is not an error.
+	ClosePort(h Host, port int, protocol string) error
+}
+
+// firewall is a firewall driven by command templates, where %[1]d is replaced with the port, %[2]s
+// with the protocol and %[3]s with the protocol in upper case. The commands on linux are run with
+// elevated privileges.
+type firewall struct {
+	name    string
+	check   string
+	open    string
+	close   string
+	windows bool
+}
+
+var linuxFirewalls = []*firewall{
+	{
+		name:  "firewalld",
+		check: "firewall-cmd --state",
+		open:  "firewall-cmd --permanent --add-port=%[1]d/%[2]s && firewall-cmd --add-port=%[1]d/%[2]s",
+		close: "firewall-cmd --permanent --remove-port=%[1]d/%[2]s && firewall-cmd --remove-port=%[1]d/%[2]s",
+	},
+	{
+		name:  "ufw",
+		check: `ufw status | grep -q "Status: active"`,
+		open:  "ufw allow %[1]d/%[2]s",
+		close: "ufw delete allow %[1]d/%[2]s",
+	},
+	{
+		// the rules are added into the input chain of the inet filter table and are not persisted
+		name:  "nftables",
+		check: "nft list chain inet filter input",
+		open:  `nft list chain inet filter input | grep -q "%[2]s dport %[1]d accept" || nft insert rule inet filter input %[2]s dport %[1]d accept`,
+		close: `for h in $(nft -a list chain inet filter input | grep "%[2]s dport %[1]d accept" | sed "s/.*# handle //"); do nft delete rule inet filter input handle "$h" || exit 1; done`,
+	},
+	{
+		// the rules are not persisted
+		name:  "iptables",
+		check: "iptables -n -L INPUT",
+		open:  "iptables -C INPUT -p %[2]s --dport %[1]d -j ACCEPT 2> /dev/null || iptables -I INPUT -p %[2]s --dport %[1]d -j ACCEPT",
+		close: "while iptables -D INPUT -p %[2]s --dport %[1]d -j ACCEPT 2> /dev/null; do :; done",
+	},
+}
+
+var windowsFirewall = &firewall{
+	name:    "windows",
+	check:   "Get-NetFirewallProfile | Out-Null",
+	open:    "if (-not (Get-NetFirewallRule -Name 'rig-%[2]s-%[1]d' -ErrorAction SilentlyContinue)) { New-NetFirewallRule -Name 'rig-%[2]s-%[1]d' -DisplayName 'rig %[3]s %[1]d' -Direction Inbound -Protocol %[3]s -LocalPort %[1]d -Action Allow | Out-Null }",
+	close:   "Remove-NetFirewallRule -Name 'rig-%[2]s-%[1]d' -ErrorAction SilentlyContinue",
+	windows: true,
+}
+
+// Detect returns the firewall found on the host. On linux the first one found of an active firewalld
+// or ufw, nftables with an inet filter table and iptables is returned and on windows the Windows
+// Firewall.
+func Detect(h Host) (Firewall, error) {
+	firewalls := linuxFirewalls
+	if h.IsWindows() {
+		firewalls = []*firewall{windowsFirewall}
+	}
+	for _, f := range firewalls {
+		if f.exec(h, f.check, exec.HideOutput()) == nil {
+			return f, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Name returns the name of the firewall
+func (f *firewall) Name() string {
+	return f.name
+}
+
+func (f *firewall) String() string {
+	return f.name
+}
+
+func (f *firewall) exec(h Host, cmd string, opts ...exec.Option) error {
+	if f.windows {
+		return h.Exec(ps.Cmd(cmd), opts...)
+	}
+	return h.Exec("sh -c "+shellescape.Quote(cmd), append(opts, exec.Sudo(h))...)
+}
+
+func (f *firewall) command(template string, port int, protocol string) (string, error) {
+	protocol = strings.ToLower(protocol)
+	if protocol != TCP && protocol != UDP {
+		return "", ErrInvalidProtocol.Wrapf("%q", protocol)
+	}
+	return fmt.Sprintf(template, port, protocol, strings.ToUpper(protocol)), nil
+}
+
+// OpenPort allows incoming traffic to a port
+func (f *firewall) OpenPort(h Host, port int, protocol string) error {
+	cmd, err := f.command(f.open, port, protocol)
+	if err != nil {
+		return err
+	}
+	if err := f.exec(h, cmd); err != nil {
+		return exec.ErrRemote.Wrapf("failed to open port %d/%s using %s: %w", port, protocol, f.name, err)
+	}
+	return nil
+}
+
+// ClosePort removes the rule added by OpenPort
+func (f *firewall) ClosePort(h Host, port int, protocol string) error {
+	cmd, err := f.command(f.close, port, protocol)
+	if err != nil {
+		return err
+	}
+	if err := f.exec(h, cmd); err != nil {
+		return exec.ErrRemote.Wrapf("failed to close port %d/%s using %s: %w", port, protocol, f.name, err)
+	}
+	return nil
+}
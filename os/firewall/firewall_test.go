@@ -0,0 +1,59 @@
+package firewall
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/k0sproject/rig/exec"
+	"github.com/stretchr/testify/require"
+)
+
+type mockHost struct {
+	windows  bool
+	commands []string
+	fail     func(cmd string) bool
+}
+
+func (h *mockHost) Exec(cmd string, opts ...exec.Option) error {
+	o := exec.Build(opts...)
+	if o.Sudo {
+		cmd = "sudo " + cmd
+	}
+	h.commands = append(h.commands, cmd)
+	if h.fail != nil && h.fail(cmd) {
+		return fmt.Errorf("failed")
+	}
+	return nil
+}
+
+func (h *mockHost) Sudo(cmd string) (string, error) { return cmd, nil }
+func (h *mockHost) IsWindows() bool                 { return h.windows }
+
+func TestDetect(t *testing.T) {
+	h := &mockHost{fail: func(cmd string) bool { return !strings.Contains(cmd, "iptables") }}
+	fw, err := Detect(h)
+	require.NoError(t, err)
+	require.Equal(t, "iptables", fw.Name())
+
+	h = &mockHost{fail: func(string) bool { return true }}
+	_, err = Detect(h)
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestFirewall(t *testing.T) {
+	h := &mockHost{}
+	fw := linuxFirewalls[1]
+	require.NoError(t, fw.OpenPort(h, 6443, TCP))
+	require.NoError(t, fw.ClosePort(h, 8472, "UDP"))
+	require.Equal(t, []string{
+		"sudo sh -c 'ufw allow 6443/tcp'",
+		"sudo sh -c 'ufw delete allow 8472/udp'",
+	}, h.commands)
+	require.ErrorIs(t, fw.OpenPort(h, 22, "icmp"), ErrInvalidProtocol)
+
+	h = &mockHost{windows: true}
+	require.NoError(t, windowsFirewall.OpenPort(h, 10250, TCP))
+	require.Len(t, h.commands, 1)
+	require.NotContains(t, h.commands[0], "sudo")
+}
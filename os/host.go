@@ -2,6 +2,7 @@ package os
 
 import (
 	"github.com/k0sproject/rig/exec"
+	"github.com/k0sproject/rig/log"
 )
 
 // Host is an interface to a host object that has the functions needed by the various OS support packages
@@ -14,3 +15,12 @@ type Host interface {
 	String() string
 	Sudo(string) (string, error)
 }
+
+// hostLogger returns the logger of the host when it has one, such as the logger of a rig.Connection,
+// and the global logger otherwise
+func hostLogger(h Host) log.Logger {
+	if l, ok := h.(interface{ Logger() log.Logger }); ok {
+		return l.Logger()
+	}
+	return log.Global
+}
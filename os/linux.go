@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"fmt"
 	"io/fs"
+	"path"
 	"strconv"
 	"strings"
 	"time"
@@ -450,3 +451,60 @@ func (c Linux) Touch(h Host, path string, ts time.Time, opts ...exec.Option) err
 	}
 	return nil
 }
+
+// caTrustStore returns the CA certificate trust store layout used on the host
+func (c Linux) caTrustStore(h Host) (*caTrustStore, error) {
+	for _, store := range caTrustStores {
+		cmd := strings.Fields(store.update)[0]
+		if h.Execf(`test -d %s && command -v %s > /dev/null 2>&1`, store.dir, cmd, exec.Sudo(h)) == nil {
+			return &store, nil
+		}
+	}
+	return nil, exec.ErrRemote.Wrapf("failed to detect a supported ca certificate trust store")
+}
+
+// InstallCACertificate adds a PEM encoded CA certificate to the host's trust store under the given name
+// and rebuilds the system trust bundle
+func (c Linux) InstallCACertificate(h Host, name, cert string) error {
+	if err := checkCertificateName(name); err != nil {
+		return err
+	}
+	if _, err := parseCertificatePEM(cert); err != nil {
+		return err
+	}
+	store, err := c.caTrustStore(h)
+	if err != nil {
+		return err
+	}
+	if err := c.WriteFile(h, path.Join(store.dir, name+".crt"), cert, "0644"); err != nil {
+		return exec.ErrRemote.Wrapf("failed to write ca certificate %s: %w", name, err)
+	}
+	if err := h.Exec(store.update, exec.Sudo(h)); err != nil {
+		return exec.ErrRemote.Wrapf("failed to update ca trust store: %w", err)
+	}
+	return nil
+}
+
+// RemoveCACertificate removes a CA certificate previously added with InstallCACertificate and rebuilds the
+// system trust bundle
+func (c Linux) RemoveCACertificate(h Host, name string) error {
+	if err := checkCertificateName(name); err != nil {
+		return err
+	}
+	store, err := c.caTrustStore(h)
+	if err != nil {
+		return err
+	}
+	if err := c.DeleteFile(h, path.Join(store.dir, name+".crt")); err != nil {
+		return err
+	}
+	if err := h.Exec(store.update, exec.Sudo(h)); err != nil {
+		return exec.ErrRemote.Wrapf("failed to update ca trust store: %w", err)
+	}
+	return nil
+}
+
+// CACertificateTrusted returns true if the PEM encoded certificate verifies against the host's system trust store
+func (c Linux) CACertificateTrusted(h Host, cert string) bool {
+	return h.Exec("openssl verify > /dev/null 2>&1", exec.Stdin(cert)) == nil
+}
@@ -133,3 +133,38 @@ func init() {
 		},
 	)
 }
+
+// InstallCACertificate adds a PEM encoded CA certificate to the system keychain as a trusted root. The name is
+// only used for the temporary file, macOS identifies keychain certificates by their subject and fingerprint.
+func (c Darwin) InstallCACertificate(h os.Host, name, cert string) error {
+	if _, err := os.CertificateThumbprint(cert); err != nil {
+		return err
+	}
+	tempFile, err := h.ExecOutputf("mktemp -t %s", shellescape.Quote(name))
+	if err != nil {
+		return exec.ErrRemote.Wrapf("failed to create temporary file: %w", err)
+	}
+	defer func() { _ = c.DeleteFile(h, tempFile) }()
+
+	if err := h.Execf("cat > %s", shellescape.Quote(tempFile), exec.Stdin(cert)); err != nil {
+		return exec.ErrRemote.Wrapf("failed to write temporary file: %w", err)
+	}
+	if err := h.Execf("security add-trusted-cert -d -r trustRoot -k /Library/Keychains/System.keychain %s", shellescape.Quote(tempFile), exec.Sudo(h)); err != nil {
+		return exec.ErrRemote.Wrapf("failed to add ca certificate %s to system keychain: %w", name, err)
+	}
+	return nil
+}
+
+// RemoveCACertificate is not supported on darwin because certificates can't be looked up by name from the keychain
+func (c Darwin) RemoveCACertificate(_ os.Host, name string) error {
+	return exec.ErrRemote.Wrapf("removing ca certificate %s: removing certificates by name is not supported on darwin", name)
+}
+
+// CACertificateTrusted returns true if the PEM encoded certificate is found in the system keychain
+func (c Darwin) CACertificateTrusted(h os.Host, cert string) bool {
+	thumbprint, err := os.CertificateThumbprint(cert)
+	if err != nil {
+		return false
+	}
+	return h.Execf("security find-certificate -a -Z /Library/Keychains/System.keychain | grep -q %s", thumbprint) == nil
+}
@@ -0,0 +1,269 @@
+// Package pkgman provides an abstraction over the package managers of the supported operating systems
+package pkgman
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/alessio/shellescape"
+	"github.com/k0sproject/rig/errstring"
+	"github.com/k0sproject/rig/exec"
+)
+
+var (
+	// ErrNotFound is returned when no supported package manager is found on the host
+	ErrNotFound = errstring.New("package manager not found")
+	// ErrInvalidName is returned when a package name contains characters that are not allowed
+	ErrInvalidName = errstring.New("invalid package name")
+
+	// windowsPackageRe matches the package names that can be passed to cmd.exe unquoted
+	windowsPackageRe = regexp.MustCompile(`^[\w.+-]+$`)
+)
+
+// Host interface for package managers
+type Host interface {
+	Exec(string, ...exec.Option) error
+	Sudo(string) (string, error)
+	IsWindows() bool
+}
+
+// PackageManager installs and removes packages on a host
+type PackageManager interface {
+	// Name returns the name of the package manager, such as "apt"
+	Name() string
+	// Install installs packages
+	Install(h Host, packages ...string) error
+	// Remove removes packages
+	Remove(h Host, packages ...string) error
+	// Update refreshes the package index, so that the latest versions of the packages get installed
+	Update(h Host) error
+	// IsInstalled returns true if a package is installed
+	IsInstalled(h Host, pkg string) (bool, error)
+}
+
+// manager is a package manager driven by command templates, where %s is replaced with the quoted
+// package names. Linux package managers are run with elevated privileges.
+type manager struct {
+	name        string
+	check       string
+	install     string
+	remove      string
+	update      string
+	isInstalled string
+	windows     bool
+	// perPackage runs the install and remove commands once for each package
+	perPackage bool
+	env        map[string]string
+}
+
+var linuxManagers = []*manager{
+	{
+		name:        "apt",
+		check:       "command -v apt-get",
+		install:     "apt-get install -y -q %s",
+		remove:      "apt-get remove -y -q %s",
+		update:      "apt-get update -q",
+		isInstalled: `dpkg-query -W -f='${Status}' %s 2> /dev/null | grep -q "install ok installed"`,
+		env:         map[string]string{"DEBIAN_FRONTEND": "noninteractive"},
+	},
+	{
+		name:        "dnf",
+		check:       "command -v dnf",
+		install:     "dnf install -y %s",
+		remove:      "dnf remove -y %s",
+		update:      "dnf makecache -y",
+		isInstalled: "rpm -q %s",
+	},
+	{
+		name:        "yum",
+		check:       "command -v yum",
+		install:     "yum install -y %s",
+		remove:      "yum remove -y %s",
+		update:      "yum makecache -y",
+		isInstalled: "rpm -q %s",
+	},
+	{
+		name:        "zypper",
+		check:       "command -v zypper",
+		install:     "zypper -n install -y %s",
+		remove:      "zypper -n remove -y %s",
+		update:      "zypper -n refresh",
+		isInstalled: "rpm -q %s",
+	},
+	{
+		name:        "apk",
+		check:       "command -v apk",
+		install:     "apk add %s",
+		remove:      "apk del %s",
+		update:      "apk update",
+		isInstalled: "apk info -e %s",
+	},
+	{
+		name:        "pacman",
+		check:       "command -v pacman",
+		install:     "pacman -S --noconfirm --noprogressbar --needed %s",
+		remove:      "pacman -R --noconfirm --noprogressbar %s",
+		update:      "pacman -Sy --noconfirm --noprogressbar",
+		isInstalled: "pacman -Q %s",
+	},
+}
+
+var windowsManagers = []*manager{
+	{
+		name:    "choco",
+		check:   "where.exe choco",
+		install: "choco install -y --no-progress %s",
+		remove:  "choco uninstall -y %s",
+		// choco always uses the latest package index
+		isInstalled: `if exist "%%ChocolateyInstall%%\lib\%s" (exit /b 0) else (exit /b 1)`,
+		windows:     true,
+	},
+	{
+		name:        "winget",
+		check:       "where.exe winget",
+		install:     "winget install --exact --id %s --silent --accept-package-agreements --accept-source-agreements --disable-interactivity",
+		remove:      "winget uninstall --exact --id %s --silent --disable-interactivity",
+		update:      "winget source update --disable-interactivity",
+		isInstalled: "winget list --exact --id %s --accept-source-agreements --disable-interactivity",
+		windows:     true,
+		perPackage:  true,
+	},
+}
+
+// Detect returns the package manager found on the host. On linux the first one found of apt, dnf,
+// yum, zypper, apk and pacman is returned and on windows choco or winget.
+func Detect(h Host) (PackageManager, error) {
+	managers := linuxManagers
+	if h.IsWindows() {
+		managers = windowsManagers
+	}
+	for _, m := range managers {
+		if h.Exec(m.check, exec.HideOutput()) == nil {
+			return m, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// DetectScript returns a script that prints the name of the package manager Detect would find, or
+// nothing when there is none, for detecting it as a part of a larger script. The script is for sh
+// or, when windows is true, PowerShell.
+func DetectScript(windows bool) string {
+	var sb strings.Builder
+	if windows {
+		sb.WriteString("$pm = ''")
+		for _, m := range windowsManagers {
+			fmt.Fprintf(&sb, "; if (-not $pm) { $null = %s 2>&1; if ($LASTEXITCODE -eq 0) { $pm = '%s' } }", m.check, m.name)
+		}
+		sb.WriteString("; $pm")
+		return sb.String()
+	}
+	for i, m := range linuxManagers {
+		if i > 0 {
+			sb.WriteString("el")
+		}
+		fmt.Fprintf(&sb, "if %s > /dev/null 2>&1; then echo %s; ", m.check, m.name)
+	}
+	sb.WriteString("fi")
+	return sb.String()
+}
+
+// Name returns the name of the package manager
+func (m *manager) Name() string {
+	return m.name
+}
+
+func (m *manager) String() string {
+	return m.name
+}
+
+func (m *manager) quote(pkg string) (string, error) {
+	if !m.windows {
+		return shellescape.Quote(pkg), nil
+	}
+	if !windowsPackageRe.MatchString(pkg) {
+		return "", ErrInvalidName.Wrapf("%q", pkg)
+	}
+	return pkg, nil
+}
+
+func (m *manager) exec(h Host, cmd string) error {
+	opts := []exec.Option{exec.Env(m.env)}
+	if !m.windows {
+		opts = append(opts, exec.Sudo(h))
+	}
+	return h.Exec(cmd, opts...)
+}
+
+// run runs the command template for the packages, once for each package when the package manager
+// does not take multiple packages at once
+func (m *manager) run(h Host, template string, packages []string) error {
+	quoted := make([]string, len(packages))
+	for i, pkg := range packages {
+		q, err := m.quote(pkg)
+		if err != nil {
+			return err
+		}
+		quoted[i] = q
+	}
+	if !m.perPackage {
+		return m.exec(h, fmt.Sprintf(template, strings.Join(quoted, " ")))
+	}
+	for i, pkg := range quoted {
+		if err := m.exec(h, fmt.Sprintf(template, pkg)); err != nil {
+			return fmt.Errorf("%s: %w", packages[i], err)
+		}
+	}
+	return nil
+}
+
+// Install installs packages
+func (m *manager) Install(h Host, packages ...string) error {
+	if len(packages) == 0 {
+		return nil
+	}
+	if err := m.run(h, m.install, packages); err != nil {
+		return exec.ErrRemote.Wrapf("failed to install packages using %s: %w", m.name, err)
+	}
+	return nil
+}
+
+// Remove removes packages
+func (m *manager) Remove(h Host, packages ...string) error {
+	if len(packages) == 0 {
+		return nil
+	}
+	if err := m.run(h, m.remove, packages); err != nil {
+		return exec.ErrRemote.Wrapf("failed to remove packages using %s: %w", m.name, err)
+	}
+	return nil
+}
+
+// Update refreshes the package index
+func (m *manager) Update(h Host) error {
+	if m.update == "" {
+		return nil
+	}
+	if err := m.exec(h, m.update); err != nil {
+		return exec.ErrRemote.Wrapf("failed to update the package index using %s: %w", m.name, err)
+	}
+	return nil
+}
+
+// IsInstalled returns true if a package is installed. An error is only returned when the package
+// manager can't be run.
+func (m *manager) IsInstalled(h Host, pkg string) (bool, error) {
+	quoted, err := m.quote(pkg)
+	if err != nil {
+		return false, err
+	}
+	if h.Exec(fmt.Sprintf(m.isInstalled, quoted), exec.HideOutput()) == nil {
+		return true, nil
+	}
+	// tell a missing package from a broken package manager
+	if err := h.Exec(m.check, exec.HideOutput()); err != nil {
+		return false, exec.ErrRemote.Wrapf("%s is not available: %w", m.name, err)
+	}
+	return false, nil
+}
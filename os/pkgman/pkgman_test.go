@@ -0,0 +1,97 @@
+package pkgman
+
+import (
+	"fmt"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/k0sproject/rig/exec"
+	"github.com/stretchr/testify/require"
+)
+
+type mockHost struct {
+	windows  bool
+	commands []string
+	fail     func(cmd string) bool
+}
+
+func (h *mockHost) Exec(cmd string, opts ...exec.Option) error {
+	o := exec.Build(opts...)
+	if o.Sudo {
+		cmd = "sudo " + cmd
+	}
+	for k, v := range o.Env {
+		cmd = k + "=" + v + " " + cmd
+	}
+	h.commands = append(h.commands, cmd)
+	if h.fail != nil && h.fail(cmd) {
+		return fmt.Errorf("failed")
+	}
+	return nil
+}
+
+func (h *mockHost) Sudo(cmd string) (string, error) { return cmd, nil }
+func (h *mockHost) IsWindows() bool                 { return h.windows }
+
+func TestDetect(t *testing.T) {
+	h := &mockHost{fail: func(cmd string) bool { return cmd != "command -v apk" && strings.HasPrefix(cmd, "command -v") }}
+	pm, err := Detect(h)
+	require.NoError(t, err)
+	require.Equal(t, "apk", pm.Name())
+
+	h = &mockHost{fail: func(string) bool { return true }}
+	_, err = Detect(h)
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestDetectScript(t *testing.T) {
+	windows := DetectScript(true)
+	for _, m := range windowsManagers {
+		require.Contains(t, windows, m.check)
+		require.Contains(t, windows, "'"+m.name+"'")
+	}
+
+	if runtime.GOOS == "windows" {
+		t.Skip("the sh script can't be run on windows")
+	}
+	dir := t.TempDir()
+	for _, name := range []string{"apk", "pacman"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"), 0o755))
+	}
+	run := func() string {
+		cmd := osexec.Command("/bin/sh", "-c", DetectScript(false))
+		cmd.Env = []string{"PATH=" + dir}
+		out, err := cmd.Output()
+		require.NoError(t, err)
+		return string(out)
+	}
+	require.Equal(t, "apk\n", run(), "the first one found in the order of Detect is printed")
+	for _, name := range []string{"apk", "pacman"} {
+		require.NoError(t, os.Remove(filepath.Join(dir, name)))
+	}
+	require.Empty(t, run())
+}
+
+func TestManager(t *testing.T) {
+	h := &mockHost{}
+	pm := linuxManagers[0]
+	require.NoError(t, pm.Install(h, "curl", "ca-certificates"))
+	require.NoError(t, pm.Update(h))
+	require.Equal(t, []string{
+		"DEBIAN_FRONTEND=noninteractive sudo apt-get install -y -q curl ca-certificates",
+		"DEBIAN_FRONTEND=noninteractive sudo apt-get update -q",
+	}, h.commands)
+
+	h = &mockHost{windows: true, fail: func(cmd string) bool { return strings.HasPrefix(cmd, "winget list") }}
+	pm = windowsManagers[1]
+	require.NoError(t, pm.Install(h, "Git.Git", "Microsoft.PowerShell"))
+	require.Len(t, h.commands, 2)
+	installed, err := pm.IsInstalled(h, "Git.Git")
+	require.NoError(t, err)
+	require.False(t, installed)
+	require.ErrorIs(t, pm.Install(h, "git & calc"), ErrInvalidName)
+}
@@ -9,7 +9,7 @@ import (
 	"time"
 
 	"github.com/k0sproject/rig/exec"
-	"github.com/k0sproject/rig/log"
+	"github.com/k0sproject/rig/pkg/shellfmt"
 	ps "github.com/k0sproject/rig/powershell"
 )
 
@@ -46,7 +46,7 @@ func (c Windows) InstallPackage(h Host, s ...string) error {
 
 // InstallFile on windows is a regular file move operation
 func (c Windows) InstallFile(h Host, src, dst, _ string) error {
-	if err := h.Execf("move /y %s %s", ps.DoubleQuote(src), ps.DoubleQuote(dst), exec.Sudo(h)); err != nil {
+	if err := h.Execf("move /y %s %s", shellfmt.CmdArg(src), shellfmt.CmdArg(dst), exec.Sudo(h)); err != nil {
 		return exec.ErrRemote.Wrapf("failed to move %s to %s: %w", src, dst, err)
 	}
 	return nil
@@ -122,7 +122,7 @@ func (c Windows) WriteFile(h Host, path string, data string, permissions string)
 		return exec.ErrRemote.Wrapf("failed to write to temporary file: %w", err)
 	}
 
-	err = h.Exec(fmt.Sprintf(`powershell -Command "Move-Item -Force -Path %s -Destination %s"`, ps.SingleQuote(tempFile), ps.SingleQuote(path)))
+	err = h.Exec(ps.Cmd(fmt.Sprintf(`Move-Item -Force -LiteralPath %s -Destination %s`, ps.SingleQuote(tempFile), ps.SingleQuote(path))))
 	if err != nil {
 		return exec.ErrRemote.Wrapf("failed to move temporary file to %s: %w", path, err)
 	}
@@ -132,7 +132,7 @@ func (c Windows) WriteFile(h Host, path string, data string, permissions string)
 
 // ReadFile reads a files contents from the host.
 func (c Windows) ReadFile(h Host, path string) (string, error) {
-	out, err := h.ExecOutput(fmt.Sprintf(`type %s`, ps.DoubleQuote(path)), exec.HideOutput())
+	out, err := h.ExecOutput(fmt.Sprintf(`type %s`, shellfmt.CmdArg(path)), exec.HideOutput())
 	if err != nil {
 		return "", exec.ErrRemote.Wrapf("failed to read file %s: %w", path, err)
 	}
@@ -141,7 +141,7 @@ func (c Windows) ReadFile(h Host, path string) (string, error) {
 
 // DeleteFile deletes a file from the host.
 func (c Windows) DeleteFile(h Host, path string) error {
-	if err := h.Exec(fmt.Sprintf(`del /f %s`, ps.DoubleQuote(path))); err != nil {
+	if err := h.Exec(fmt.Sprintf(`del /f %s`, shellfmt.CmdArg(path))); err != nil {
 		return exec.ErrRemote.Wrapf("failed to delete file %s: %w", path, err)
 	}
 	return nil
@@ -149,7 +149,7 @@ func (c Windows) DeleteFile(h Host, path string) error {
 
 func (c Windows) deleteTempFile(h Host, path string) {
 	if err := c.DeleteFile(h, path); err != nil {
-		log.Debugf("failed to delete temporary file %s: %v", path, err)
+		hostLogger(h).Debugf("%s: failed to delete temporary file %s: %v", h, path, err)
 	}
 }
 
@@ -161,7 +161,7 @@ func (c Windows) FileExist(h Host, path string) bool {
 // UpdateEnvironment updates the hosts's environment variables
 func (c Windows) UpdateEnvironment(h Host, env map[string]string) error {
 	for k, v := range env {
-		err := h.Exec(fmt.Sprintf(`setx %s %s`, ps.DoubleQuote(k), ps.DoubleQuote(v)))
+		err := h.Exec(fmt.Sprintf(`setx %s %s`, shellfmt.CmdArg(k), shellfmt.CmdArg(v)))
 		if err != nil {
 			return exec.ErrRemote.Wrapf("failed to set environment variable %s: %w", k, err)
 		}
@@ -177,11 +177,11 @@ func (c Windows) UpdateServiceEnvironment(_ Host, _ string, _ map[string]string)
 // CleanupEnvironment removes environment variable configuration
 func (c Windows) CleanupEnvironment(h Host, env map[string]string) error {
 	for k := range env {
-		err := h.Exec(fmt.Sprintf(`powershell "[Environment]::SetEnvironmentVariable(%s, $null, 'User')"`, ps.SingleQuote(k)))
+		err := h.Exec(ps.Cmd(fmt.Sprintf(`[Environment]::SetEnvironmentVariable(%s, $null, 'User')`, ps.SingleQuote(k))))
 		if err != nil {
 			return exec.ErrRemote.Wrapf("failed to remove user environment variable %s: %w", k, err)
 		}
-		err = h.Exec(fmt.Sprintf(`powershell "[Environment]::SetEnvironmentVariable(%s, $null, 'Machine')"`, ps.SingleQuote(k)))
+		err = h.Exec(ps.Cmd(fmt.Sprintf(`[Environment]::SetEnvironmentVariable(%s, $null, 'Machine')`, ps.SingleQuote(k))))
 		if err != nil {
 			return exec.ErrRemote.Wrapf("failed to remove machine environment variable %s: %w", k, err)
 		}
@@ -266,7 +266,7 @@ func (c Windows) ServiceIsRunning(h Host, s string) bool {
 // MkDir creates a directory (including intermediate directories)
 func (c Windows) MkDir(h Host, s string, opts ...exec.Option) error {
 	// windows mkdir is "-p" by default
-	if err := h.Exec(fmt.Sprintf(`mkdir %s`, ps.DoubleQuote(s)), opts...); err != nil {
+	if err := h.Exec(fmt.Sprintf(`mkdir %s`, shellfmt.CmdArg(s)), opts...); err != nil {
 		return exec.ErrRemote.Wrapf("failed to create directory %s: %w", s, err)
 	}
 	return nil
@@ -281,7 +281,7 @@ func (c Windows) Chmod(h Host, s, perm string, opts ...exec.Option) error {
 func (c Windows) Stat(h Host, path string, opts ...exec.Option) (*FileInfo, error) {
 	info := &FileInfo{FName: path, FMode: fs.FileMode(0)}
 
-	out, err := h.ExecOutput(ps.Cmd(fmt.Sprintf("[System.Math]::Truncate((Get-Date -Date ((Get-Item %s).LastWriteTime.ToUniversalTime()) -UFormat %%s))", ps.DoubleQuote(path))), opts...)
+	out, err := h.ExecOutput(ps.Cmd(fmt.Sprintf("[System.Math]::Truncate((Get-Date -Date ((Get-Item -LiteralPath %s).LastWriteTime.ToUniversalTime()) -UFormat %%s))", ps.SingleQuote(path))), opts...)
 	if err != nil {
 		return nil, exec.ErrRemote.Wrapf("failed to get file %s modtime: %w", path, err)
 	}
@@ -291,7 +291,7 @@ func (c Windows) Stat(h Host, path string, opts ...exec.Option) (*FileInfo, erro
 	}
 	info.FModTime = time.Unix(ts, 0)
 
-	out, err = h.ExecOutput(ps.Cmd(fmt.Sprintf("(Get-Item %s).Length", ps.DoubleQuote(path))), opts...)
+	out, err = h.ExecOutput(ps.Cmd(fmt.Sprintf("(Get-Item -LiteralPath %s).Length", ps.SingleQuote(path))), opts...)
 	if err != nil {
 		return nil, exec.ErrRemote.Wrapf("failed to get file %s size: %w", path, err)
 	}
@@ -301,7 +301,7 @@ func (c Windows) Stat(h Host, path string, opts ...exec.Option) (*FileInfo, erro
 	}
 	info.FSize = size
 
-	out, err = h.ExecOutput(ps.Cmd(fmt.Sprintf("(Get-Item %s).GetType().Name", ps.DoubleQuote(path))), opts...)
+	out, err = h.ExecOutput(ps.Cmd(fmt.Sprintf("(Get-Item -LiteralPath %s).GetType().Name", ps.SingleQuote(path))), opts...)
 	if err != nil {
 		return nil, exec.ErrRemote.Wrapf("failed to get file %s type: %w", path, err)
 	}
@@ -313,12 +313,12 @@ func (c Windows) Stat(h Host, path string, opts ...exec.Option) (*FileInfo, erro
 // Touch updates a file's last modified time or creates a new empty file
 func (c Windows) Touch(h Host, path string, ts time.Time, opts ...exec.Option) error {
 	if !c.FileExist(h, path) {
-		if err := h.Exec(ps.Cmd(fmt.Sprintf("Set-Content -Path %s -value $null", ps.DoubleQuote(path))), opts...); err != nil {
+		if err := h.Exec(ps.Cmd(fmt.Sprintf("Set-Content -LiteralPath %s -value $null", ps.SingleQuote(path))), opts...); err != nil {
 			return exec.ErrRemote.Wrapf("failed to create file %s: %w", path, err)
 		}
 	}
 
-	err := h.Exec(ps.Cmd(fmt.Sprintf("(Get-Item %s).LastWriteTime = (Get-Date %s)", ps.DoubleQuote(path), ps.DoubleQuote(ts.Format(time.RFC3339)))), opts...)
+	err := h.Exec(ps.Cmd(fmt.Sprintf("(Get-Item -LiteralPath %s).LastWriteTime = (Get-Date %s)", ps.SingleQuote(path), ps.SingleQuote(ts.Format(time.RFC3339)))), opts...)
 	if err != nil {
 		return exec.ErrRemote.Wrapf("failed to update file %s timestamp: %w", path, err)
 	}
@@ -355,3 +355,53 @@ func (c Windows) LineIntoFile(h Host, path, matcher, newLine string) error {
 
 	return c.WriteFile(h, path, writer.String(), "0644")
 }
+
+// InstallCACertificate imports a PEM encoded CA certificate into the local machine's trusted root store and
+// tags it with the given name as the certificate's friendly name
+func (c Windows) InstallCACertificate(h Host, name, cert string) error {
+	if err := checkCertificateName(name); err != nil {
+		return err
+	}
+	thumbprint, err := CertificateThumbprint(cert)
+	if err != nil {
+		return err
+	}
+
+	tempFile, err := h.ExecOutput("powershell -Command \"New-TemporaryFile | Write-Host\"")
+	if err != nil {
+		return exec.ErrRemote.Wrapf("failed to create temporary file: %w", err)
+	}
+	defer c.deleteTempFile(h, tempFile)
+
+	err = h.Exec(fmt.Sprintf(`powershell -Command "$Input | Out-File -Encoding ascii -FilePath %s"`, ps.SingleQuote(tempFile)), exec.Stdin(cert))
+	if err != nil {
+		return exec.ErrRemote.Wrapf("failed to write certificate to temporary file: %w", err)
+	}
+
+	err = h.Exec(ps.Cmd(fmt.Sprintf(`Import-Certificate -FilePath %s -CertStoreLocation Cert:\LocalMachine\Root | Out-Null; (Get-Item Cert:\LocalMachine\Root\%s).FriendlyName = %s`, ps.SingleQuote(tempFile), thumbprint, ps.SingleQuote(name))))
+	if err != nil {
+		return exec.ErrRemote.Wrapf("failed to import ca certificate %s: %w", name, err)
+	}
+	return nil
+}
+
+// RemoveCACertificate removes CA certificates with the given friendly name from the local machine's trusted root store
+func (c Windows) RemoveCACertificate(h Host, name string) error {
+	if err := checkCertificateName(name); err != nil {
+		return err
+	}
+	err := h.Exec(ps.Cmd(fmt.Sprintf(`Get-ChildItem Cert:\LocalMachine\Root | Where-Object { $_.FriendlyName -eq %s } | Remove-Item`, ps.SingleQuote(name))))
+	if err != nil {
+		return exec.ErrRemote.Wrapf("failed to remove ca certificate %s: %w", name, err)
+	}
+	return nil
+}
+
+// CACertificateTrusted returns true if the PEM encoded certificate is in the local machine's trusted root store
+func (c Windows) CACertificateTrusted(h Host, cert string) bool {
+	thumbprint, err := CertificateThumbprint(cert)
+	if err != nil {
+		return false
+	}
+	return h.Exec(ps.Cmd(fmt.Sprintf(`if (!(Test-Path Cert:\LocalMachine\Root\%s)) { exit 1 }`, thumbprint))) == nil
+}
@@ -6,6 +6,16 @@ type OSVersion struct {
 	IDLike  string
 	Name    string
 	Version string
+
+	// Arch is the machine architecture as reported by the host, such as "x86_64" or "AMD64"
+	Arch string
+	// KernelVersion is the kernel release, such as "6.1.0-18-amd64", or the build version on windows
+	KernelVersion string
+	// InitSystem is the service manager of the host: "systemd", "openrc", "upstart", "sysvinit",
+	// "launchd" or "windows"
+	InitSystem string
+	// PackageManager is the name of the package manager found on the host, see pkgman.Detect
+	PackageManager string
 }
 
 // String returns a human readable representation of OSVersion
@@ -0,0 +1,187 @@
+package rig
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/alessio/shellescape"
+	"github.com/k0sproject/rig/exec"
+)
+
+const (
+	// parallelChunkAlign is the alignment of chunk offsets, dd seeks in blocks of this size
+	parallelChunkAlign = 1 << 20
+	// minParallelChunkSize is the smallest chunk size worth its own session
+	minParallelChunkSize = 8 << 20
+	// maxWindowsWriteSize limits the size of a single write command sent to rigrcp
+	maxWindowsWriteSize = 256 << 20
+)
+
+type chunk struct {
+	offset int64
+	length int64
+}
+
+// splitChunks splits size bytes into at most n chunks with offsets aligned to align bytes
+func splitChunks(size int64, n int, align int64) []chunk {
+	if maxChunks := int((size + minParallelChunkSize - 1) / minParallelChunkSize); n > maxChunks {
+		n = maxChunks
+	}
+	if n < 1 {
+		n = 1
+	}
+	per := ((size+int64(n)-1)/int64(n) + align - 1) / align * align
+	var chunks []chunk
+	for offset := int64(0); offset < size; offset += per {
+		length := per
+		if offset+length > size {
+			length = size - offset
+		}
+		chunks = append(chunks, chunk{offset: offset, length: length})
+	}
+	return chunks
+}
+
+// lockedWriter serializes writes to w
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p) //nolint:wrapcheck
+}
+
+// uploadParallel uploads a file in chunks over concurrent sessions and verifies the checksum of
+// the result
+func (c *Connection) uploadParallel(src, dst string, opts ...exec.Option) error {
+	o := exec.Build(opts...)
+
+	local, err := os.Open(src)
+	if err != nil {
+		return ErrInvalidPath.Wrap(err)
+	}
+	defer local.Close()
+
+	stat, err := local.Stat()
+	if err != nil {
+		return ErrInvalidPath.Wrapf("stat local file %s: %w", src, err)
+	}
+
+	chunks := splitChunks(stat.Size(), o.Parallel, parallelChunkAlign)
+	c.loggerFor(opts).Debugf("%s: uploading %s in %d parallel chunks", c, dst, len(chunks))
+
+	if err := c.createEmpty(dst, stat.Mode().Perm(), opts...); err != nil {
+		return ErrUploadFailed.Wrap(err)
+	}
+
+	progress := &lockedWriter{w: exec.ProgressWriter(o.Progress, stat.Size())}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(chunks))
+	for i, ch := range chunks {
+		wg.Add(1)
+		go func(i int, ch chunk) {
+			defer wg.Done()
+			section := io.TeeReader(io.NewSectionReader(local, ch.offset, ch.length), progress)
+			if c.IsWindows() {
+				errs[i] = c.uploadChunkWindows(section, dst, ch, opts...)
+			} else {
+				errs[i] = c.uploadChunkUnix(section, dst, ch, opts...)
+			}
+		}(i, ch)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return ErrUploadFailed.Wrapf("chunk %d at offset %d: %w", i, chunks[i].offset, err)
+		}
+	}
+
+	shasum, err := newChecksum(opts...)
+	if err != nil {
+		return ErrUploadFailed.Wrap(err)
+	}
+	if shasum != nil {
+		if _, err := io.Copy(shasum, io.NewSectionReader(local, 0, stat.Size())); err != nil {
+			return ErrOS.Wrapf("calculate checksum: %w", err)
+		}
+	}
+	if err := c.verifyChecksum(dst, shasum, opts...); err != nil {
+		return ErrUploadFailed.Wrap(err)
+	}
+
+	return nil
+}
+
+// createEmpty creates or truncates a remote file
+func (c *Connection) createEmpty(path string, perm os.FileMode, opts ...exec.Option) error {
+	if c.IsWindows() {
+		f, err := c.fsysFor(opts...).OpenFile(path, ModeCreate, int(perm))
+		if err != nil {
+			return ErrCommandFailed.Wrapf("create %s: %w", path, err)
+		}
+		return f.Close() //nolint:wrapcheck
+	}
+
+	quoted := shellescape.Quote(path)
+	if err := c.Exec(fmt.Sprintf("sh -c %s", shellescape.Quote(fmt.Sprintf(": > %s && chmod %04o %s", quoted, perm, quoted))), opts...); err != nil {
+		return ErrCommandFailed.Wrapf("create %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *Connection) uploadChunkUnix(src io.Reader, dst string, ch chunk, opts ...exec.Option) error {
+	cmd := fmt.Sprintf("dd of=%s bs=%d seek=%d conv=notrunc", shellescape.Quote(dst), parallelChunkAlign, ch.offset/parallelChunkAlign)
+	errbuf := bytes.NewBuffer(nil)
+	waiter, err := c.ExecStreams(cmd, io.NopCloser(src), io.Discard, errbuf, opts...)
+	if err != nil {
+		return ErrCommandFailed.Wrapf("start dd: %w", err)
+	}
+	if err := waiter.Wait(); err != nil {
+		return ErrCommandFailed.Wrapf("dd: %w (%s)", err, strings.TrimSpace(errbuf.String()))
+	}
+	return nil
+}
+
+func (c *Connection) uploadChunkWindows(src io.Reader, dst string, ch chunk, opts ...exec.Option) error {
+	// each chunk gets a rigrcp process of its own
+	fsys := newWindowsFsys(c, opts...)
+	defer fsys.rcp.close()
+
+	f, err := fsys.OpenFile(dst, ModeReadWrite, 0)
+	if err != nil {
+		return err
+	}
+
+	err = writeChunk(f, src, ch)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// writeChunk seeks to the chunk offset and copies the chunk from src into f
+func writeChunk(f File, src io.Reader, ch chunk) error {
+	if _, err := f.Seek(ch.offset, io.SeekStart); err != nil {
+		return err //nolint:wrapcheck
+	}
+	for remaining := ch.length; remaining > 0; {
+		n := remaining
+		if n > maxWindowsWriteSize {
+			n = maxWindowsWriteSize
+		}
+		if _, err := f.CopyFromN(src, n, nil); err != nil {
+			return err //nolint:wrapcheck
+		}
+		remaining -= n
+	}
+	return nil
+}
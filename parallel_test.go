@@ -0,0 +1,23 @@
+package rig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitChunks(t *testing.T) {
+	const mb = 1 << 20
+	chunks := splitChunks(100*mb+1, 4, mb)
+	require.Len(t, chunks, 4)
+	var total int64
+	for i, ch := range chunks {
+		require.Zero(t, ch.offset%mb, "chunk %d is not aligned", i)
+		require.Equal(t, total, ch.offset)
+		total += ch.length
+	}
+	require.Equal(t, int64(100*mb+1), total)
+
+	require.Len(t, splitChunks(20*mb, 16, mb), 3, "chunks are not made smaller than the minimum size")
+	require.Len(t, splitChunks(mb, 4, mb), 1)
+}
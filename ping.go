@@ -0,0 +1,93 @@
+package rig
+
+import (
+	"context"
+	"io"
+)
+
+// pinger is implemented by the clients that have a cheaper way of checking that the connection
+// works than running a command
+type pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Ping checks that the connection still works by sending an SSH keepalive request, running a no-op
+// command over WinRM or running "true" using the other clients. Unlike IsConnected, which only
+// tells if Connect has succeeded, Ping talks to the host. When the check fails or the context is
+// done before it finishes, the connection is closed and an error matching ErrNotConnected is
+// returned.
+func (c *Connection) Ping(ctx context.Context) error {
+	if err := c.checkConnected(); err != nil {
+		return err
+	}
+	var err error
+	if p, ok := c.client.(pinger); ok {
+		err = p.Ping(ctx)
+	} else {
+		err = c.pingExec(ctx)
+	}
+	if err != nil {
+		c.Logger().Debugf("%s: ping failed: %v", c, err)
+		_ = c.Disconnect()
+		return ErrNotConnected.Wrapf("ping: %w", err)
+	}
+	return nil
+}
+
+// pingExec runs a no-op command, giving up when the context is done
+func (c *Connection) pingExec(ctx context.Context) error {
+	cmd := "true"
+	if c.IsWindows() {
+		cmd = "exit 0"
+	}
+	return waitContext(ctx, func() error {
+		return c.client.Exec(cmd)
+	})
+}
+
+// waitContext calls fn in a goroutine and returns its error or the error of the context when it is
+// done first. The goroutine is left running in the latter case.
+func waitContext(ctx context.Context, fn func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err() //nolint:wrapcheck
+	}
+}
+
+// Ping sends a keepalive request over the SSH connection
+func (c *SSH) Ping(ctx context.Context) error {
+	client := c.client
+	if client == nil {
+		return ErrNotConnected
+	}
+	return waitContext(ctx, func() error {
+		// the server replies with a failure to the unknown request, any reply means it's alive
+		if _, _, err := client.SendRequest("keepalive@openssh.com", true, nil); err != nil {
+			return ErrNotConnected.Wrapf("keepalive: %w", err)
+		}
+		return nil
+	})
+}
+
+// Ping runs a no-op command over WinRM. The WinRM client does not support the WS-Management
+// Identify request.
+func (c *WinRM) Ping(ctx context.Context) error {
+	if c.client == nil {
+		return ErrNotConnected
+	}
+	if _, err := c.client.RunWithContext(ctx, "exit 0", io.Discard, io.Discard); err != nil {
+		return ErrNotConnected.Wrapf("winrm: %w", err)
+	}
+	return nil
+}
+
+// Ping returns the error of the context, the local host is always reachable
+func (c *Localhost) Ping(ctx context.Context) error {
+	return ctx.Err() //nolint:wrapcheck
+}
@@ -0,0 +1,116 @@
+// Package asciicast writes terminal sessions in the asciicast v2 format of asciinema, so that they
+// can be replayed using "asciinema play" or the asciinema web player
+package asciicast
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/k0sproject/rig/pkg/clock"
+)
+
+// Header is the first line of an asciicast file
+type Header struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp,omitempty"`
+	Command   string            `json:"command,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// Writer writes the data written to it as the output events of an asciicast file, timed from the
+// creation of the Writer. It is safe for concurrent use.
+type Writer struct {
+	w     io.Writer
+	start time.Time
+
+	mu sync.Mutex
+	// pending is the start of a multi-byte character split between writes, the event data must be
+	// valid UTF-8
+	pending []byte
+}
+
+// NewWriter writes the header into w and returns a Writer for the events. The version is always 2
+// and the timestamp is set to the current time when it is zero.
+func NewWriter(w io.Writer, header Header) (*Writer, error) {
+	start := clock.Default.Now()
+	header.Version = 2
+	if header.Timestamp == 0 {
+		header.Timestamp = start.Unix()
+	}
+	line, err := json.Marshal(header)
+	if err != nil {
+		return nil, fmt.Errorf("encode asciicast header: %w", err)
+	}
+	if _, err := w.Write(append(line, '\n')); err != nil {
+		return nil, fmt.Errorf("write asciicast header: %w", err)
+	}
+	return &Writer{w: w, start: start}, nil
+}
+
+// Write writes p as an output event
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	data := append(w.pending, p...)
+	w.pending = nil
+	if n := incompleteSuffix(data); n > 0 {
+		w.pending = append([]byte(nil), data[len(data)-n:]...)
+		data = data[:len(data)-n]
+	}
+	if len(data) == 0 {
+		return len(p), nil
+	}
+	if err := w.event(data); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close writes out a character that was left incomplete by the last write. It does not close the
+// underlying writer.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.pending) == 0 {
+		return nil
+	}
+	data := w.pending
+	w.pending = nil
+	return w.event(data)
+}
+
+// event writes an output event line, invalid UTF-8 is replaced by the JSON encoder
+func (w *Writer) event(data []byte) error {
+	elapsed := clock.Default.Since(w.start).Seconds()
+	line, err := json.Marshal([]any{elapsed, "o", string(data)})
+	if err != nil {
+		return fmt.Errorf("encode asciicast event: %w", err)
+	}
+	if _, err := w.w.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("write asciicast event: %w", err)
+	}
+	return nil
+}
+
+// incompleteSuffix returns the length of a multi-byte character at the end of b that is not
+// complete yet
+func incompleteSuffix(b []byte) int {
+	for i := 1; i < utf8.UTFMax && i <= len(b); i++ {
+		c := b[len(b)-i]
+		if !utf8.RuneStart(c) {
+			continue
+		}
+		if !utf8.FullRune(b[len(b)-i:]) {
+			return i
+		}
+		return 0
+	}
+	return 0
+}
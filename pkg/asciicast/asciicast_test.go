@@ -0,0 +1,36 @@
+package asciicast
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/k0sproject/rig/pkg/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriter(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	clock.Default = fake
+	defer func() { clock.Default = clock.Real{} }()
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, Header{Width: 80, Height: 24, Command: "bash"})
+	require.NoError(t, err)
+
+	fake.Advance(1500 * time.Millisecond)
+	_, err = w.Write([]byte("hello\r\n\xe2\x82"))
+	require.NoError(t, err)
+	fake.Advance(500 * time.Millisecond)
+	_, err = w.Write([]byte("\xac"))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("\xe2"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	require.Equal(t, `{"version":2,"width":80,"height":24,"timestamp":1700000000,"command":"bash"}
+[1.5,"o","hello\r\n"]
+[2,"o","€"]
+[2,"o","�"]
+`, buf.String())
+}
@@ -0,0 +1,65 @@
+package clock
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Backoff calculates exponentially growing delays between retry attempts
+type Backoff struct {
+	// Initial is the delay before the first retry
+	Initial time.Duration
+	// Max is the upper limit for the delay, zero means no limit
+	Max time.Duration
+	// Multiplier is the factor the delay grows by for each attempt, values below 1 are treated as 1
+	Multiplier float64
+	// Jitter is the fraction of the delay that is randomized to avoid retrying in lockstep, from 0 to 1.
+	// Values above 1 are treated as 1.
+	Jitter float64
+
+	// Clock is used for waiting, clock.Default when nil
+	Clock Clock
+	// Rand is used for jitter, clock.DefaultRand when nil
+	Rand Rand
+}
+
+// Delay returns the delay before the retry attempt number n, where the first retry is n=1
+func (b *Backoff) Delay(n int) time.Duration {
+	delay := float64(b.Initial)
+	if n > 1 && b.Multiplier > 1 {
+		for i := 1; i < n; i++ {
+			delay *= b.Multiplier
+			if b.Max > 0 && delay >= float64(b.Max) {
+				break
+			}
+		}
+	}
+	if b.Max > 0 && delay > float64(b.Max) {
+		delay = float64(b.Max)
+	}
+	// leaves room for the jitter, which adds at most the delay itself
+	if delay > math.MaxInt64/2 {
+		delay = math.MaxInt64 / 2
+	}
+
+	if jitter := math.Min(b.Jitter, 1); jitter > 0 && delay > 0 {
+		r := b.Rand
+		if r == nil {
+			r = DefaultRand
+		}
+		spread := delay * jitter
+		delay = delay - spread + r.Float64()*2*spread
+	}
+	// float64 can't represent math.MaxInt64 exactly, the conversion of anything above it overflows
+	if delay >= math.MaxInt64 {
+		return time.Duration(math.MaxInt64)
+	}
+
+	return time.Duration(delay)
+}
+
+// Wait sleeps for the delay of the retry attempt number n or until the context is done
+func (b *Backoff) Wait(ctx context.Context, n int) error {
+	return Sleep(ctx, b.Clock, b.Delay(n))
+}
@@ -0,0 +1,69 @@
+package clock
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	b := &Backoff{Initial: time.Second, Max: 10 * time.Second, Multiplier: 2}
+	require.Equal(t, time.Second, b.Delay(1))
+	require.Equal(t, 2*time.Second, b.Delay(2))
+	require.Equal(t, 8*time.Second, b.Delay(4))
+	require.Equal(t, 10*time.Second, b.Delay(5))
+	require.Equal(t, 10*time.Second, b.Delay(100))
+
+	b.Jitter = 0.5
+	b.Rand = NewRand(1)
+	for i := 0; i < 100; i++ {
+		d := b.Delay(1)
+		require.GreaterOrEqual(t, d, 500*time.Millisecond)
+		require.LessOrEqual(t, d, 1500*time.Millisecond)
+	}
+	require.Equal(t, NewRand(42).Int63n(1000), NewRand(42).Int63n(1000), "seeded sources are deterministic")
+}
+
+func TestBackoffDelayLimits(t *testing.T) {
+	for _, b := range []*Backoff{
+		{Initial: time.Duration(math.MaxInt64), Jitter: 1},
+		{Initial: time.Second, Max: time.Duration(math.MaxInt64), Multiplier: 10, Jitter: 1},
+		{Initial: time.Hour, Multiplier: 1000, Jitter: 5},
+	} {
+		b.Rand = NewRand(1)
+		for i := 0; i < 100; i++ {
+			require.NotPanics(t, func() {
+				require.Positive(t, b.Delay(50))
+			})
+		}
+	}
+
+	b := &Backoff{Initial: time.Second, Jitter: 3, Rand: NewRand(1)}
+	for i := 0; i < 100; i++ {
+		require.LessOrEqual(t, b.Delay(1), 2*time.Second, "the jitter is at most the delay itself")
+	}
+}
+
+func TestFake(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := NewFake(start)
+	b := &Backoff{Initial: time.Second, Multiplier: 2, Clock: fake}
+
+	done := make(chan error)
+	go func() { done <- b.Wait(context.Background(), 2) }()
+	fake.BlockUntil(1)
+	fake.Advance(time.Second)
+	require.Equal(t, 1, fake.Waiters())
+	select {
+	case <-done:
+		t.Fatal("backoff returned before the delay elapsed")
+	default:
+	}
+	fake.Advance(time.Second)
+	require.NoError(t, <-done)
+	require.Equal(t, 0, fake.Waiters())
+	require.Equal(t, 2*time.Second, fake.Since(start))
+}
@@ -0,0 +1,90 @@
+// Package clock provides replaceable sources of time and randomness for the retry, backoff and timeout
+// logic in rig, so that the behavior can be tested deterministically without real waiting.
+package clock
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Clock is a source of time
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+	// Since returns the time elapsed since t
+	Since(t time.Time) time.Duration
+	// Sleep pauses the current goroutine for at least the duration d
+	Sleep(d time.Duration)
+	// After waits for the duration to elapse and then sends the current time on the returned channel
+	After(d time.Duration) <-chan time.Time
+}
+
+// Rand is a source of randomness
+type Rand interface {
+	// Int63n returns a non-negative pseudo-random number in [0,n). It panics if n <= 0.
+	Int63n(n int64) int64
+	// Float64 returns a pseudo-random number in [0.0,1.0)
+	Float64() float64
+}
+
+var (
+	// Default is the clock used by rig when no other clock has been set. It can be replaced in tests.
+	Default Clock = Real{}
+
+	// DefaultRand is the source of randomness used by rig when no other source has been set. It can be
+	// replaced in tests.
+	DefaultRand Rand = NewRand(time.Now().UnixNano())
+)
+
+// Real is a Clock that uses the time package
+type Real struct{}
+
+// Now returns the current time
+func (Real) Now() time.Time { return time.Now() }
+
+// Since returns the time elapsed since t
+func (Real) Since(t time.Time) time.Duration { return time.Since(t) }
+
+// Sleep pauses the current goroutine for at least the duration d
+func (Real) Sleep(d time.Duration) { time.Sleep(d) }
+
+// After waits for the duration to elapse and then sends the current time on the returned channel
+func (Real) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+type lockedRand struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+// NewRand returns a concurrency safe Rand seeded with seed. Use a fixed seed for deterministic results.
+func NewRand(seed int64) Rand {
+	return &lockedRand{r: rand.New(rand.NewSource(seed))} //nolint:gosec // not used for security
+}
+
+func (l *lockedRand) Int63n(n int64) int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Int63n(n)
+}
+
+func (l *lockedRand) Float64() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Float64()
+}
+
+// Sleep pauses for the duration d using the clock or until the context is done, whichever happens first.
+// It returns the context's error if the context was done before the duration elapsed.
+func Sleep(ctx context.Context, c Clock, d time.Duration) error {
+	if c == nil {
+		c = Default
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err() //nolint:wrapcheck
+	case <-c.After(d):
+		return nil
+	}
+}
@@ -0,0 +1,110 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Fake is a Clock for tests that only moves when told to using Advance or Set. Assign it to Default
+// to control the retry, backoff, polling and timeout behavior of rig:
+//
+//	fake := clock.NewFake(time.Now())
+//	clock.Default = fake
+//	defer func() { clock.Default = clock.Real{} }()
+//	go conn.Exec("false", exec.Retries(3, nil))
+//	fake.BlockUntil(1)
+//	fake.Advance(time.Second)
+type Fake struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	until time.Time
+	ch    chan time.Time
+}
+
+// NewFake returns a Fake clock set to start
+func NewFake(start time.Time) *Fake {
+	f := &Fake{now: start}
+	f.cond = sync.NewCond(&f.mu)
+	return f
+}
+
+// Now returns the current time of the clock
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Since returns the time elapsed since t according to the clock
+func (f *Fake) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+// Sleep blocks until the clock has been advanced by at least d
+func (f *Fake) Sleep(d time.Duration) {
+	<-f.After(d)
+}
+
+// After returns a channel that receives the time of the clock once it has been advanced by at least d
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- f.now
+		return ch
+	}
+	f.waiters = append(f.waiters, fakeWaiter{until: f.now.Add(d), ch: ch})
+	f.cond.Broadcast()
+	return ch
+}
+
+// Advance moves the clock forward by d and wakes up the waiters whose time has come
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.set(f.now.Add(d))
+}
+
+// Set sets the clock to t and wakes up the waiters whose time has come
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.set(t)
+}
+
+func (f *Fake) set(t time.Time) {
+	f.now = t
+	remaining := f.waiters[:0]
+	for _, w := range f.waiters {
+		if w.until.After(t) {
+			remaining = append(remaining, w)
+			continue
+		}
+		w.ch <- t
+	}
+	f.waiters = remaining
+	f.cond.Broadcast()
+}
+
+// Waiters returns the number of Sleep and After calls waiting for the clock to advance
+func (f *Fake) Waiters() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.waiters)
+}
+
+// BlockUntil blocks until at least n Sleep or After calls are waiting for the clock to advance, so
+// that the clock is not advanced before the code under test has started waiting
+func (f *Fake) BlockUntil(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for len(f.waiters) < n {
+		f.cond.Wait()
+	}
+}
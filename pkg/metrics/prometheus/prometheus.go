@@ -0,0 +1,95 @@
+// Package prometheus provides a rig.Metrics implementation that exposes the metrics of rig
+// connections to Prometheus
+package prometheus
+
+import (
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics implements rig.Metrics using Prometheus collectors. The metrics are labeled with the
+// connection protocol and, where applicable, the result "success" or "failure".
+type Metrics struct {
+	connects       *prom.CounterVec
+	connectErrors  *prom.CounterVec
+	execDuration   *prom.HistogramVec
+	uploadDuration *prom.HistogramVec
+	uploadBytes    *prom.CounterVec
+	sessions       *prom.GaugeVec
+}
+
+// New returns a new Metrics with its collectors registered into reg, such as
+// prometheus.DefaultRegisterer
+func New(reg prom.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		connects: prom.NewCounterVec(prom.CounterOpts{
+			Name: "rig_connects_total",
+			Help: "Number of connection attempts.",
+		}, []string{"protocol"}),
+		connectErrors: prom.NewCounterVec(prom.CounterOpts{
+			Name: "rig_connect_failures_total",
+			Help: "Number of failed connection attempts.",
+		}, []string{"protocol"}),
+		execDuration: prom.NewHistogramVec(prom.HistogramOpts{
+			Name:    "rig_exec_duration_seconds",
+			Help:    "Duration of the commands run on the hosts.",
+			Buckets: prom.ExponentialBuckets(0.01, 4, 9),
+		}, []string{"protocol", "result"}),
+		uploadDuration: prom.NewHistogramVec(prom.HistogramOpts{
+			Name:    "rig_upload_duration_seconds",
+			Help:    "Duration of the file uploads to the hosts.",
+			Buckets: prom.ExponentialBuckets(0.01, 4, 9),
+		}, []string{"protocol", "result"}),
+		uploadBytes: prom.NewCounterVec(prom.CounterOpts{
+			Name: "rig_upload_bytes_total",
+			Help: "Number of bytes uploaded to the hosts.",
+		}, []string{"protocol"}),
+		sessions: prom.NewGaugeVec(prom.GaugeOpts{
+			Name: "rig_open_sessions",
+			Help: "Number of open connections.",
+		}, []string{"protocol"}),
+	}
+	for _, c := range []prom.Collector{m.connects, m.connectErrors, m.execDuration, m.uploadDuration, m.uploadBytes, m.sessions} {
+		if err := reg.Register(c); err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+	}
+	return m, nil
+}
+
+func result(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
+
+// ConnectDone counts a connection attempt
+func (m *Metrics) ConnectDone(protocol string, err error) {
+	m.connects.WithLabelValues(protocol).Inc()
+	if err != nil {
+		m.connectErrors.WithLabelValues(protocol).Inc()
+	}
+}
+
+// ExecDone observes the duration of a command
+func (m *Metrics) ExecDone(protocol string, duration time.Duration, err error) {
+	m.execDuration.WithLabelValues(protocol, result(err)).Observe(duration.Seconds())
+}
+
+// UploadDone observes the duration and counts the bytes of an upload
+func (m *Metrics) UploadDone(protocol string, bytes int64, duration time.Duration, err error) {
+	m.uploadDuration.WithLabelValues(protocol, result(err)).Observe(duration.Seconds())
+	m.uploadBytes.WithLabelValues(protocol).Add(float64(bytes))
+}
+
+// SessionOpened increments the open sessions gauge
+func (m *Metrics) SessionOpened(protocol string) {
+	m.sessions.WithLabelValues(protocol).Inc()
+}
+
+// SessionClosed decrements the open sessions gauge
+func (m *Metrics) SessionClosed(protocol string) {
+	m.sessions.WithLabelValues(protocol).Dec()
+}
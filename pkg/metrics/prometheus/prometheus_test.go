@@ -0,0 +1,34 @@
+package prometheus
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/k0sproject/rig"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+var _ rig.Metrics = (*Metrics)(nil)
+
+func TestMetrics(t *testing.T) {
+	reg := prom.NewRegistry()
+	m, err := New(reg)
+	require.NoError(t, err)
+
+	m.ConnectDone("SSH", nil)
+	m.ConnectDone("SSH", errors.New("refused"))
+	m.SessionOpened("SSH")
+	m.ExecDone("SSH", time.Second, nil)
+	m.UploadDone("SSH", 1024, time.Second, nil)
+
+	require.Equal(t, 2.0, testutil.ToFloat64(m.connects.WithLabelValues("SSH")))
+	require.Equal(t, 1.0, testutil.ToFloat64(m.connectErrors.WithLabelValues("SSH")))
+	require.Equal(t, 1.0, testutil.ToFloat64(m.sessions.WithLabelValues("SSH")))
+	require.Equal(t, 1024.0, testutil.ToFloat64(m.uploadBytes.WithLabelValues("SSH")))
+
+	_, err = New(reg)
+	require.Error(t, err)
+}
@@ -0,0 +1,147 @@
+// Package redact masks secrets in the log output, command echoes and error strings produced by rig.
+// The package level functions use a global registry, a Redactor can be used to scope the secrets, for
+// example to a connection.
+package redact
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Mask is what the secrets are replaced with
+const Mask = "[REDACTED]"
+
+// MinLength is the length below which values are ignored. Masking every occurrence of a very short
+// value would mangle unrelated text, such as the numbers in the output.
+const MinLength = 4
+
+// Default is the global registry used by the package level functions
+var Default = &Redactor{}
+
+// Redactor is a set of secret values and patterns to mask. The zero value is ready to use, a nil
+// Redactor masks nothing.
+type Redactor struct {
+	mu       sync.RWMutex
+	values   []string
+	patterns []*regexp.Regexp
+}
+
+// Value registers a secret value to be masked. Values shorter than MinLength are ignored.
+func (r *Redactor) Value(secret string) {
+	if len(secret) < MinLength {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, v := range r.values {
+		if v == secret {
+			return
+		}
+	}
+	r.values = append(r.values, secret)
+	// replace the longest values first so that a secret containing another one is masked whole
+	for i := len(r.values) - 1; i > 0 && len(r.values[i]) > len(r.values[i-1]); i-- {
+		r.values[i], r.values[i-1] = r.values[i-1], r.values[i]
+	}
+}
+
+// RemoveValue removes a value registered using Value, for example when the secret has been rotated
+func (r *Redactor) RemoveValue(secret string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, v := range r.values {
+		if v == secret {
+			r.values = append(r.values[:i], r.values[i+1:]...)
+			return
+		}
+	}
+}
+
+// Pattern registers a regular expression whose matches are masked
+func (r *Redactor) Pattern(re *regexp.Regexp) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.patterns = append(r.patterns, re)
+}
+
+// RemovePattern removes a regular expression registered using Pattern
+func (r *Redactor) RemovePattern(re *regexp.Regexp) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, p := range r.patterns {
+		if p == re {
+			r.patterns = append(r.patterns[:i], r.patterns[i+1:]...)
+			return
+		}
+	}
+}
+
+// Reset removes all of the registered values and patterns
+func (r *Redactor) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.values = nil
+	r.patterns = nil
+}
+
+// Empty returns true when there is nothing to redact
+func (r *Redactor) Empty() bool {
+	if r == nil {
+		return true
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.values) == 0 && len(r.patterns) == 0
+}
+
+// String masks the registered values and patterns in s
+func (r *Redactor) String(s string) string {
+	if r == nil {
+		return s
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, v := range r.values {
+		s = strings.ReplaceAll(s, v, Mask)
+	}
+	for _, re := range r.patterns {
+		s = re.ReplaceAllString(s, Mask)
+	}
+	return s
+}
+
+// Value registers a secret value to be masked globally. Values shorter than MinLength are ignored.
+func Value(secret string) {
+	Default.Value(secret)
+}
+
+// RemoveValue removes a value registered using Value
+func RemoveValue(secret string) {
+	Default.RemoveValue(secret)
+}
+
+// Pattern registers a regular expression whose matches are masked globally
+func Pattern(re *regexp.Regexp) {
+	Default.Pattern(re)
+}
+
+// RemovePattern removes a regular expression registered using Pattern
+func RemovePattern(re *regexp.Regexp) {
+	Default.RemovePattern(re)
+}
+
+// Reset removes all of the globally registered values and patterns
+func Reset() {
+	Default.Reset()
+}
+
+// Empty returns true when nothing has been registered globally
+func Empty() bool {
+	return Default.Empty()
+}
+
+// String masks the globally registered values and patterns in s
+func String(s string) string {
+	return Default.String(s)
+}
@@ -0,0 +1,41 @@
+package redact
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestString(t *testing.T) {
+	defer Reset()
+	require.True(t, Empty())
+	Value("hunter2")
+	Value("hunter2hunter2")
+	Value("")
+	Pattern(regexp.MustCompile(`token=\S+`))
+	require.False(t, Empty())
+	require.Equal(t, "pw [REDACTED] [REDACTED] [REDACTED]", String("pw hunter2hunter2 hunter2 token=abc"))
+
+	RemoveValue("hunter2hunter2")
+	require.Equal(t, "pw [REDACTED][REDACTED]", String("pw hunter2hunter2"))
+}
+
+func TestRedactor(t *testing.T) {
+	var r Redactor
+	r.Value("abc")
+	require.True(t, r.Empty(), "short values are ignored")
+	r.Value("s3cret")
+	re := regexp.MustCompile(`key=\w+`)
+	r.Pattern(re)
+	require.Equal(t, "abc [REDACTED] [REDACTED]", r.String("abc s3cret key=foo"))
+	require.Equal(t, "s3cret", String("s3cret"), "values are not registered globally")
+
+	r.RemoveValue("s3cret")
+	r.RemovePattern(re)
+	require.True(t, r.Empty())
+
+	var nilRedactor *Redactor
+	require.True(t, nilRedactor.Empty())
+	require.Equal(t, "s3cret", nilRedactor.String("s3cret"))
+}
@@ -0,0 +1,89 @@
+// Package shellfmt quotes strings for the command lines and scripts run on remote hosts.
+//
+// Pick the function by what parses the string on the host, not by the host's operating system:
+//
+//   - Posix for arguments on a unix host, parsed by sh, bash or any other POSIX shell
+//   - WindowsArg for arguments of programs on a windows host, parsed by CommandLineToArgvW
+//   - PowerShell for string literals in PowerShell scripts
+//   - Cmd for text in cmd.exe commands outside of double quotes, such as the value in set FOO=bar
+//   - CmdArg for arguments of programs and builtins in commands that are run through cmd.exe
+//
+// Quote and Join pick Posix or WindowsArg for arguments depending on the host.
+package shellfmt
+
+import (
+	"strings"
+
+	"github.com/alessio/shellescape"
+	ps "github.com/k0sproject/rig/powershell"
+)
+
+// Posix quotes s for use as a single argument in a POSIX shell command. Strings that consist only of
+// characters that are never special to the shell are returned as is, anything else is wrapped in
+// single quotes. Nothing is expanded inside single quotes, the single quotes in s are written as '"'"'.
+// The result can't represent a NUL byte.
+func Posix(s string) string {
+	return shellescape.Quote(s)
+}
+
+// WindowsArg quotes s for use as a single argument on a windows command line following the rules of
+// CommandLineToArgvW, which is how most programs parse their arguments. The string is always wrapped
+// in double quotes, the double quotes in s and the backslashes preceding them are escaped using
+// backslashes. Windows command lines are text, invalid UTF-8 in s is replaced with U+FFFD. This does
+// not make the string safe for cmd.exe, which does not know about the backslash escapes, see Cmd.
+func WindowsArg(s string) string {
+	return ps.DoubleQuote(s)
+}
+
+// PowerShell quotes s as a PowerShell verbatim string literal. The string is wrapped in single quotes
+// and the single quotes in s, including the typographic ones PowerShell also accepts, are doubled.
+// Nothing is expanded inside the literal.
+func PowerShell(s string) string {
+	return ps.SingleQuote(s)
+}
+
+// cmdEscaper escapes the characters that are special to cmd.exe outside of double quotes
+var cmdEscaper = strings.NewReplacer(
+	"^", "^^",
+	"&", "^&",
+	"|", "^|",
+	"<", "^<",
+	">", "^>",
+	"(", "^(",
+	")", "^)",
+	"%", "^%",
+	"!", "^!",
+	`"`, `^"`,
+)
+
+// Cmd escapes the characters that are special to cmd.exe using carets so that s is taken literally
+// when it appears outside of double quotes in a cmd.exe command. Spaces are not escaped, so s is not
+// made into a single argument, and line breaks can't be represented at all.
+func Cmd(s string) string {
+	return cmdEscaper.Replace(s)
+}
+
+// CmdArg quotes s for use as a single argument in a command that is run through cmd.exe, such as the
+// commands run over SSH on a windows host. The argument is quoted using WindowsArg and the result is
+// escaped using Cmd so that cmd.exe passes it on to the program or builtin as is.
+func CmdArg(s string) string {
+	return Cmd(WindowsArg(s))
+}
+
+// Quote quotes s as a single command argument for a windows host using WindowsArg or for a unix
+// host using Posix
+func Quote(s string, windows bool) string {
+	if windows {
+		return WindowsArg(s)
+	}
+	return Posix(s)
+}
+
+// Join quotes each of the arguments using Quote and joins them with spaces into a command line
+func Join(args []string, windows bool) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = Quote(arg, windows)
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,185 @@
+package shellfmt
+
+import (
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/require"
+)
+
+var seeds = []string{"", "plain", "with space", "it's", "it’s", `"double"`, `trailing\`, `back\"slash`, `a\\b`, "$(id)", "`id`", "a;b|c&d", "100%", "^caret", "new\nline", "-n", "*", "~root", "!", "ä"}
+
+// FuzzPosix verifies that the quoted strings come out intact from a real shell
+func FuzzPosix(f *testing.F) {
+	if runtime.GOOS == "windows" {
+		f.Skip("requires a posix shell")
+	}
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		f.Skip("requires a posix shell")
+	}
+	for _, s := range seeds {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		if strings.ContainsRune(s, 0) {
+			t.Skip("arguments can't contain NUL")
+		}
+		out, err := exec.Command(sh, "-c", "printf '%s' "+Posix(s)).Output()
+		require.NoError(t, err)
+		require.Equal(t, s, string(out))
+	})
+}
+
+// parseWindowsArgs splits a command line like CommandLineToArgvW does for the arguments after the
+// program name
+func parseWindowsArgs(cmdline string) []string {
+	var (
+		args    []string
+		current strings.Builder
+		inQuote bool
+		hasArg  bool
+	)
+	for i := 0; i < len(cmdline); i++ {
+		c := cmdline[i]
+		switch {
+		case c == '\\':
+			n := 0
+			for i < len(cmdline) && cmdline[i] == '\\' {
+				n++
+				i++
+			}
+			if i < len(cmdline) && cmdline[i] == '"' {
+				current.WriteString(strings.Repeat(`\`, n/2))
+				if n%2 == 1 {
+					current.WriteByte('"')
+				} else {
+					inQuote = !inQuote
+				}
+			} else {
+				current.WriteString(strings.Repeat(`\`, n))
+				i--
+			}
+			hasArg = true
+		case c == '"':
+			if inQuote && i+1 < len(cmdline) && cmdline[i+1] == '"' {
+				current.WriteByte('"')
+				i++
+			} else {
+				inQuote = !inQuote
+			}
+			hasArg = true
+		case (c == ' ' || c == '\t') && !inQuote:
+			if hasArg {
+				args = append(args, current.String())
+				current.Reset()
+				hasArg = false
+			}
+		default:
+			current.WriteByte(c)
+			hasArg = true
+		}
+	}
+	if hasArg {
+		args = append(args, current.String())
+	}
+	return args
+}
+
+func FuzzWindowsArg(f *testing.F) {
+	for _, s := range seeds {
+		f.Add(s, "second")
+	}
+	f.Fuzz(func(t *testing.T, a, b string) {
+		if !utf8.ValidString(a) || !utf8.ValidString(b) || strings.ContainsRune(a+b, 0) {
+			t.Skip("windows command lines are NUL terminated UTF-16 text")
+		}
+		require.Equal(t, []string{a, b}, parseWindowsArgs(Join([]string{a, b}, true)))
+	})
+}
+
+// parsePowerShellLiteral returns the value of a PowerShell verbatim string literal and the rest of
+// the input after it
+func parsePowerShellLiteral(s string) (string, string, bool) {
+	r, size := utf8.DecodeRuneInString(s)
+	if !isPowerShellQuote(r) {
+		return "", s, false
+	}
+	s = s[size:]
+	var value strings.Builder
+	for len(s) > 0 {
+		r, size := utf8.DecodeRuneInString(s)
+		s = s[size:]
+		if !isPowerShellQuote(r) {
+			value.WriteRune(r)
+			continue
+		}
+		next, nextSize := utf8.DecodeRuneInString(s)
+		if len(s) > 0 && isPowerShellQuote(next) {
+			value.WriteRune(next)
+			s = s[nextSize:]
+			continue
+		}
+		return value.String(), s, true
+	}
+	return "", "", false
+}
+
+func isPowerShellQuote(r rune) bool {
+	switch r {
+	case '\'', '\u2018', '\u2019', '\u201a', '\u201b':
+		return true
+	}
+	return false
+}
+
+func FuzzPowerShell(f *testing.F) {
+	for _, s := range seeds {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		if !utf8.ValidString(s) {
+			t.Skip("powershell scripts are text")
+		}
+		value, rest, ok := parsePowerShellLiteral(PowerShell(s) + "; rest")
+		require.True(t, ok)
+		require.Equal(t, s, value)
+		require.Equal(t, "; rest", rest)
+	})
+}
+
+func FuzzCmd(f *testing.F) {
+	for _, s := range seeds {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		escaped := Cmd(s)
+		var unescaped strings.Builder
+		for i := 0; i < len(escaped); i++ {
+			c := escaped[i]
+			if strings.IndexByte(`&|<>()%!"`, c) >= 0 {
+				t.Fatalf("unescaped special character %q in %q", c, escaped)
+			}
+			if c == '^' {
+				i++
+				require.Less(t, i, len(escaped), "dangling caret in %q", escaped)
+				c = escaped[i]
+			}
+			unescaped.WriteByte(c)
+		}
+		require.Equal(t, s, unescaped.String())
+	})
+}
+
+func TestQuote(t *testing.T) {
+	require.Equal(t, "plain", Quote("plain", false))
+	require.Equal(t, `'it'"'"'s'`, Quote("it's", false))
+	require.Equal(t, `"C:\Program Files\\"`, Quote(`C:\Program Files\`, true))
+	require.Equal(t, `'C:\Program Files\' "a\"b"`, Posix(`C:\Program Files\`)+" "+WindowsArg(`a"b`))
+	require.Equal(t, "'it''s'", PowerShell("it's"))
+	require.Equal(t, "100^%^&^&", Cmd("100%&&"))
+	require.Equal(t, `^"a\^" ^& calc ^%PATH^%^"`, CmdArg(`a" & calc %PATH%`))
+}
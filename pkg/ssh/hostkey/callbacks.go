@@ -21,6 +21,10 @@ var (
 	// ErrHostKeyMismatch is returned when the host key does not match the host key or a key in known_hosts file
 	ErrHostKeyMismatch = errstring.New("host key mismatch")
 
+	// ErrHostKeyRejected is returned when the key of a host that is not in the known_hosts file was
+	// not accepted by the ConfirmFunc
+	ErrHostKeyRejected = errstring.New("host key rejected")
+
 	// ErrCheckHostKey is returned when the callback could not be created
 	ErrCheckHostKey = errstring.New("check hostkey")
 
@@ -50,8 +54,19 @@ var KnownHostsPathFromEnv = func() (string, bool) {
 	return os.LookupEnv("SSH_KNOWN_HOSTS")
 }
 
-// KnownHostsFileCallback returns a HostKeyCallback that uses a known hosts file to verify host keys
+// ConfirmFunc is called with the host and the SHA256 fingerprint of its key when the host is not in
+// the known_hosts file. The key is added to the file when it returns true.
+type ConfirmFunc func(host, fingerprint string) bool
+
+// KnownHostsFileCallback returns a HostKeyCallback that uses a known hosts file to verify host keys.
+// The keys of the hosts that are not in the file are added to it.
 func KnownHostsFileCallback(path string, permissive bool) (ssh.HostKeyCallback, error) {
+	return KnownHostsFileConfirmCallback(path, permissive, nil)
+}
+
+// KnownHostsFileConfirmCallback is like KnownHostsFileCallback but asks confirm before adding the
+// key of a host that is not in the file. Without a confirm function the key is added as is.
+func KnownHostsFileConfirmCallback(path string, permissive bool, confirm ConfirmFunc) (ssh.HostKeyCallback, error) {
 	if path == "/dev/null" {
 		return InsecureIgnoreHostKeyCallback, nil
 	}
@@ -68,17 +83,17 @@ func KnownHostsFileCallback(path string, permissive bool) (ssh.HostKeyCallback,
 		return nil, ErrCheckHostKey.Wrapf("knownhosts callback: %w", err)
 	}
 
-	return wrapCallback(hkc, path, permissive), nil
+	return wrapCallback(hkc, path, permissive, confirm), nil
 }
 
 // extends a knownhosts callback to not return an error when the key
 // is not found in the known_hosts file but instead adds it to the file as new
-// entry
-func wrapCallback(hkc ssh.HostKeyCallback, path string, permissive bool) ssh.HostKeyCallback {
+// entry, after asking confirm when it is set
+func wrapCallback(hkc ssh.HostKeyCallback, path string, permissive bool, confirm ConfirmFunc) ssh.HostKeyCallback {
 	return ssh.HostKeyCallback(func(hostname string, remote net.Addr, key ssh.PublicKey) error {
 		mu.Lock()
-		defer mu.Unlock()
 		err := hkc(hostname, remote, key)
+		mu.Unlock()
 		if err == nil {
 			return nil
 		}
@@ -94,6 +109,13 @@ func wrapCallback(hkc ssh.HostKeyCallback, path string, permissive bool) ssh.Hos
 			return ErrHostKeyMismatch.Wrap(err)
 		}
 
+		// the lock is not held while asking, the confirmation may take a while
+		if confirm != nil && !confirm(hostname, ssh.FingerprintSHA256(key)) {
+			return ErrHostKeyRejected.Wrapf("%s", hostname)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
 		dbFile, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
 		if err != nil {
 			return ErrCheckHostKey.Wrapf("failed to open ssh known_hosts file %s for writing: %w", path, err)
@@ -0,0 +1,282 @@
+// Package sshtest provides an in-memory SSH server for testing code that connects to hosts over SSH
+// without a real host, in the spirit of net/http/httptest.
+package sshtest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+
+	gliderssh "github.com/gliderlabs/ssh"
+	"github.com/k0sproject/rig/errstring"
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrServer is returned when the server can't be started
+var ErrServer = errstring.New("sshtest server")
+
+// Request is a command received by the server
+type Request struct {
+	// User is the name of the authenticated user
+	User string
+	// Command is the command as it was sent by the client, empty for an interactive shell
+	Command string
+	// Env holds the environment variables set by the client as KEY=value
+	Env []string
+	// PTY is true when the client requested a pseudo terminal and Term is its terminal type
+	PTY  bool
+	Term string
+
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Handler handles a command and returns its exit status
+type Handler func(req *Request) int
+
+// NotFoundHandler is the default handler for the commands that have no handler, it exits with 127
+func NotFoundHandler(req *Request) int {
+	fmt.Fprintf(req.Stderr, "sh: %s: command not found\n", req.Command)
+	return 127
+}
+
+// Output returns a handler that writes stdout and exits with the exit status
+func Output(stdout string, exitStatus int) Handler {
+	return func(req *Request) int {
+		_, _ = io.WriteString(req.Stdout, stdout)
+		return exitStatus
+	}
+}
+
+// Option is a functional option for NewServer
+type Option func(*Server)
+
+// WithHostKey sets the host key of the server, by default a new ed25519 key is generated
+func WithHostKey(key ssh.Signer) Option {
+	return func(s *Server) {
+		s.hostKey = key
+	}
+}
+
+// WithPasswordAuth makes the server accept the password logins for which fn returns true. Without
+// any of the auth options all clients are accepted.
+func WithPasswordAuth(fn func(user, password string) bool) Option {
+	return func(s *Server) {
+		s.srv.PasswordHandler = func(ctx gliderssh.Context, password string) bool {
+			return fn(ctx.User(), password)
+		}
+	}
+}
+
+// WithPublicKeyAuth makes the server accept the public key logins, including the ones using keys
+// from an ssh agent, for which fn returns true. Without any of the auth options all clients are
+// accepted.
+func WithPublicKeyAuth(fn func(user string, key ssh.PublicKey) bool) Option {
+	return func(s *Server) {
+		s.srv.PublicKeyHandler = func(ctx gliderssh.Context, key gliderssh.PublicKey) bool {
+			return fn(ctx.User(), key)
+		}
+	}
+}
+
+// WithAuthorizedKeys makes the server accept the public key logins using any of the keys
+func WithAuthorizedKeys(keys ...ssh.PublicKey) Option {
+	return WithPublicKeyAuth(func(_ string, key ssh.PublicKey) bool {
+		for _, k := range keys {
+			if gliderssh.KeysEqual(k, key) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// WithHandler sets the handler for the command, the command has to match exactly
+func WithHandler(cmd string, handler Handler) Option {
+	return func(s *Server) {
+		s.handlers[cmd] = handler
+	}
+}
+
+// WithDefaultHandler sets the handler for the commands that don't have their own handler, by default
+// NotFoundHandler
+func WithDefaultHandler(handler Handler) Option {
+	return func(s *Server) {
+		s.defaultHandler = handler
+	}
+}
+
+// Server is an SSH server listening on a random port on the loopback interface
+type Server struct {
+	// Addr is the host:port the server is listening on
+	Addr string
+
+	srv            *gliderssh.Server
+	hostKey        ssh.Signer
+	handlers       map[string]Handler
+	defaultHandler Handler
+
+	mu       sync.Mutex
+	requests []Request
+	done     chan struct{}
+}
+
+// NewServer starts a new server, it must be stopped using Close
+func NewServer(opts ...Option) (*Server, error) {
+	s := &Server{
+		srv:            &gliderssh.Server{},
+		handlers:       make(map[string]Handler),
+		defaultHandler: NotFoundHandler,
+		done:           make(chan struct{}),
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	if s.hostKey == nil {
+		key, err := GenerateKey()
+		if err != nil {
+			return nil, err
+		}
+		s.hostKey = key
+	}
+	s.srv.AddHostKey(s.hostKey)
+	s.srv.Handler = s.handle
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, ErrServer.Wrapf("listen: %w", err)
+	}
+	s.Addr = listener.Addr().String()
+	go func() {
+		defer close(s.done)
+		_ = s.srv.Serve(listener)
+	}()
+	return s, nil
+}
+
+// Host returns the address the server is listening on without the port
+func (s *Server) Host() string {
+	host, _, _ := net.SplitHostPort(s.Addr)
+	return host
+}
+
+// Port returns the port the server is listening on
+func (s *Server) Port() int {
+	_, port, _ := net.SplitHostPort(s.Addr)
+	p, _ := strconv.Atoi(port)
+	return p
+}
+
+// HostKey returns the public host key of the server
+func (s *Server) HostKey() ssh.PublicKey {
+	return s.hostKey.PublicKey()
+}
+
+// HostKeyString returns the public host key in the "type base64" format used in the rig SSH
+// HostKey field
+func (s *Server) HostKeyString() string {
+	k := s.HostKey()
+	return k.Type() + " " + base64.StdEncoding.EncodeToString(k.Marshal())
+}
+
+// KnownHostsLine returns a line for a known_hosts file that trusts the server
+func (s *Server) KnownHostsLine() string {
+	return fmt.Sprintf("[%s]:%d %s", s.Host(), s.Port(), s.HostKeyString())
+}
+
+// Requests returns the commands received so far
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// Commands returns the command strings received so far
+func (s *Server) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cmds := make([]string, len(s.requests))
+	for i, r := range s.requests {
+		cmds[i] = r.Command
+	}
+	return cmds
+}
+
+// Close stops the server and closes the client connections
+func (s *Server) Close() error {
+	err := s.srv.Close()
+	<-s.done
+	if err != nil && !errors.Is(err, gliderssh.ErrServerClosed) {
+		return ErrServer.Wrapf("close: %w", err)
+	}
+	return nil
+}
+
+func (s *Server) handle(session gliderssh.Session) {
+	req := Request{
+		User:    session.User(),
+		Command: session.RawCommand(),
+		Env:     session.Environ(),
+		Stdin:   session,
+		Stdout:  session,
+		Stderr:  session.Stderr(),
+	}
+	if pty, _, ok := session.Pty(); ok {
+		req.PTY = true
+		req.Term = pty.Term
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	handler, ok := s.handlers[req.Command]
+	s.mu.Unlock()
+	if !ok {
+		handler = s.defaultHandler
+	}
+
+	_ = session.Exit(handler(&req))
+}
+
+// GenerateKey returns a new ed25519 key for use as a host key or a client key
+func GenerateKey() (ssh.Signer, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, ErrServer.Wrapf("generate key: %w", err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		return nil, ErrServer.Wrapf("generate key: %w", err)
+	}
+	return signer, nil
+}
+
+// GenerateKeyFile writes a new unencrypted ed25519 private key to path for use as a client key file
+// and returns its signer
+func GenerateKeyFile(path string) (ssh.Signer, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, ErrServer.Wrapf("generate key: %w", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, ErrServer.Wrapf("marshal key: %w", err)
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		return nil, ErrServer.Wrapf("write key: %w", err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		return nil, ErrServer.Wrapf("generate key: %w", err)
+	}
+	return signer, nil
+}
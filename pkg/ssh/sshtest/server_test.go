@@ -0,0 +1,107 @@
+package sshtest_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/k0sproject/rig"
+	"github.com/k0sproject/rig/exec"
+	"github.com/k0sproject/rig/pkg/ssh/hostkey"
+	"github.com/k0sproject/rig/pkg/ssh/sshtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "id_ed25519")
+	key, err := sshtest.GenerateKeyFile(keyPath)
+	require.NoError(t, err)
+
+	server, err := sshtest.NewServer(
+		sshtest.WithAuthorizedKeys(key.PublicKey()),
+		sshtest.WithHandler("hostname", sshtest.Output("testhost\n", 0)),
+		sshtest.WithHandler("cat", func(req *sshtest.Request) int {
+			data, _ := io.ReadAll(req.Stdin)
+			_, _ = req.Stdout.Write(bytes.ToUpper(data))
+			return 0
+		}),
+	)
+	require.NoError(t, err)
+	defer server.Close()
+
+	client := &rig.SSH{
+		Address: server.Host(),
+		Port:    server.Port(),
+		User:    "test",
+		KeyPath: &keyPath,
+		HostKey: server.HostKeyString(),
+	}
+	require.NoError(t, client.Connect())
+	defer client.Disconnect()
+
+	var out string
+	require.NoError(t, client.Exec("hostname", exec.Output(&out)))
+	require.Equal(t, "testhost\n", out)
+
+	out = ""
+	require.NoError(t, client.Exec("cat", exec.Stdin("hello"), exec.Output(&out)))
+	require.Equal(t, "HELLO\n", out)
+
+	err = client.Exec("missing")
+	code, ok := exec.ExitCode(err)
+	require.True(t, ok, "no exit code in %v", err)
+	require.Equal(t, 127, code)
+
+	require.Equal(t, []string{"hostname", "cat", "missing"}, server.Commands())
+	require.Equal(t, "test", server.Requests()[0].User)
+}
+
+func TestServerHostKeyMismatch(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "id_ed25519")
+	_, err := sshtest.GenerateKeyFile(keyPath)
+	require.NoError(t, err)
+	other, err := sshtest.GenerateKey()
+	require.NoError(t, err)
+
+	server, err := sshtest.NewServer()
+	require.NoError(t, err)
+	defer server.Close()
+
+	client := &rig.SSH{
+		Address: server.Host(),
+		Port:    server.Port(),
+		User:    "test",
+		KeyPath: &keyPath,
+		HostKey: other.PublicKey().Type() + " " + base64.StdEncoding.EncodeToString(other.PublicKey().Marshal()),
+	}
+	err = client.Connect()
+	require.ErrorContains(t, err, hostkey.ErrHostKeyMismatch.Error())
+	require.Empty(t, server.Commands())
+}
+
+func TestPing(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "id_ed25519")
+	key, err := sshtest.GenerateKeyFile(keyPath)
+	require.NoError(t, err)
+	server, err := sshtest.NewServer(sshtest.WithAuthorizedKeys(key.PublicKey()))
+	require.NoError(t, err)
+	defer server.Close()
+
+	client := &rig.SSH{Address: server.Host(), Port: server.Port(), User: "test", KeyPath: &keyPath, HostKey: server.HostKeyString()}
+	require.NoError(t, client.Connect())
+	defer client.Disconnect()
+	require.NoError(t, client.Ping(context.Background()))
+	require.NoError(t, client.Disconnect())
+	require.NoError(t, client.Disconnect())
+	require.False(t, client.IsConnected())
+	require.NoError(t, client.Connect())
+
+	require.NoError(t, server.Close())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.ErrorIs(t, client.Ping(ctx), rig.ErrNotConnected)
+}
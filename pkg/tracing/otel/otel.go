@@ -0,0 +1,72 @@
+// Package otel provides a rig.Tracer implementation that records the spans of rig connections
+// using OpenTelemetry
+package otel
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/k0sproject/rig"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation name of the tracer used for the spans
+const tracerName = "github.com/k0sproject/rig"
+
+// Tracer implements rig.Tracer using an OpenTelemetry tracer provider
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// New returns a new Tracer that creates the spans using tp, such as otel.GetTracerProvider()
+func New(tp trace.TracerProvider) *Tracer {
+	return &Tracer{tracer: tp.Tracer(tracerName)}
+}
+
+// Start starts a client span as a child of the span in ctx
+func (t *Tracer) Start(ctx context.Context, name string, attrs ...rig.TraceAttribute) (context.Context, rig.Span) {
+	ctx, span := t.tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attributes(attrs)...),
+	)
+	return ctx, &otelSpan{span: span}
+}
+
+func attributes(attrs []rig.TraceAttribute) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, 0, len(attrs))
+	for _, attr := range attrs {
+		switch v := attr.Value.(type) {
+		case string:
+			kvs = append(kvs, attribute.String(attr.Key, v))
+		case int64:
+			kvs = append(kvs, attribute.Int64(attr.Key, v))
+		case int:
+			kvs = append(kvs, attribute.Int(attr.Key, v))
+		case bool:
+			kvs = append(kvs, attribute.Bool(attr.Key, v))
+		default:
+			kvs = append(kvs, attribute.String(attr.Key, fmt.Sprint(v)))
+		}
+	}
+	return kvs
+}
+
+type otelSpan struct {
+	span trace.Span
+}
+
+// SetAttributes adds attributes to the span
+func (s *otelSpan) SetAttributes(attrs ...rig.TraceAttribute) {
+	s.span.SetAttributes(attributes(attrs)...)
+}
+
+// End records err as the status of the span when it is not nil and ends the span
+func (s *otelSpan) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
@@ -0,0 +1,72 @@
+package otel
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/k0sproject/rig"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var _ rig.Tracer = (*Tracer)(nil)
+
+type recordedSpan struct {
+	trace.Span
+	name   string
+	parent string
+	attrs  []attribute.KeyValue
+	status codes.Code
+	ended  bool
+}
+
+func (s *recordedSpan) SetAttributes(kv ...attribute.KeyValue)  { s.attrs = append(s.attrs, kv...) }
+func (s *recordedSpan) RecordError(error, ...trace.EventOption) {}
+func (s *recordedSpan) SetStatus(code codes.Code, _ string)     { s.status = code }
+func (s *recordedSpan) End(...trace.SpanEndOption)              { s.ended = true }
+
+type spanKey struct{}
+
+// recordingProvider records the started spans and the names of their parents
+type recordingProvider struct {
+	trace.TracerProvider
+	spans []*recordedSpan
+}
+
+func (p *recordingProvider) Tracer(string, ...trace.TracerOption) trace.Tracer {
+	return p
+}
+
+func (p *recordingProvider) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	cfg := trace.NewSpanStartConfig(opts...)
+	span := &recordedSpan{name: name, attrs: cfg.Attributes()}
+	if parent, ok := ctx.Value(spanKey{}).(*recordedSpan); ok {
+		span.parent = parent.name
+	}
+	p.spans = append(p.spans, span)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+func TestTracer(t *testing.T) {
+	tp := &recordingProvider{}
+	tracer := New(tp)
+
+	ctx, parent := tracer.Start(context.Background(), "rig.Upload", rig.TraceAttribute{Key: "rig.transfer.source", Value: "src"})
+	_, child := tracer.Start(ctx, "rig.Exec")
+	child.SetAttributes(rig.TraceAttribute{Key: "rig.exec.exit_code", Value: int64(1)})
+	child.End(errors.New("exit code 1"))
+	parent.End(nil)
+
+	require.Len(t, tp.spans, 2)
+	require.Equal(t, []attribute.KeyValue{attribute.String("rig.transfer.source", "src")}, tp.spans[0].attrs)
+	require.Equal(t, codes.Unset, tp.spans[0].status)
+	require.True(t, tp.spans[0].ended)
+
+	require.Equal(t, "rig.Upload", tp.spans[1].parent)
+	require.Equal(t, []attribute.KeyValue{attribute.Int64("rig.exec.exit_code", 1)}, tp.spans[1].attrs)
+	require.Equal(t, codes.Error, tp.spans[1].status)
+	require.True(t, tp.spans[1].ended)
+}
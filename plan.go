@@ -0,0 +1,117 @@
+package rig
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/k0sproject/rig/exec"
+	"github.com/k0sproject/rig/pkg/clock"
+)
+
+// Plan is an ordered list of steps that are run on a connection one after another. When a step
+// fails, the rollbacks of the steps that were completed before it are run in the reverse order,
+// so that an installer can leave the host the way it was found.
+//
+//	var plan rig.Plan
+//	plan.Upload("k0s", "/usr/local/bin/k0s", exec.Sudo(h)).
+//	  RollbackExec("rm -f /usr/local/bin/k0s", exec.Sudo(h))
+//	plan.Exec("k0s install controller", exec.Sudo(h)).
+//	  RollbackExec("k0s reset", exec.Sudo(h))
+//	plan.Exec("k0s start", exec.Sudo(h))
+//	results, err := plan.Run(h)
+//
+// A Plan can be run on any number of connections, also concurrently.
+type Plan struct {
+	steps []*PlanStep
+}
+
+// PlanStep is a step of a Plan
+type PlanStep struct {
+	// Name describes the step in the results and the log messages
+	Name string
+
+	run      func(*Connection) error
+	rollback func(*Connection) error
+}
+
+// StepResult is the outcome of a single step of a Plan
+type StepResult struct {
+	Name     string
+	Err      error
+	Duration time.Duration
+	// RolledBack is true when the rollback of the step was run, RollbackErr is the error it failed with
+	RolledBack  bool
+	RollbackErr error
+}
+
+// StepResults are the results of the steps of a Plan that were run, in the order they were run
+type StepResults []StepResult
+
+// Step adds a step that calls fn
+func (p *Plan) Step(name string, fn func(c *Connection) error) *PlanStep {
+	step := &PlanStep{Name: name, run: fn}
+	p.steps = append(p.steps, step)
+	return step
+}
+
+// Exec adds a step that runs the command
+func (p *Plan) Exec(cmd string, opts ...exec.Option) *PlanStep {
+	return p.Step("exec "+exec.Build(opts...).Redact(cmd), func(c *Connection) error {
+		return c.Exec(cmd, opts...)
+	})
+}
+
+// Upload adds a step that uploads the local file src to dst
+func (p *Plan) Upload(src, dst string, opts ...exec.Option) *PlanStep {
+	return p.Step(fmt.Sprintf("upload %s to %s", src, dst), func(c *Connection) error {
+		return c.Upload(src, dst, opts...)
+	})
+}
+
+// Rollback sets the function that undoes the step when a later step fails
+func (s *PlanStep) Rollback(fn func(c *Connection) error) *PlanStep {
+	s.rollback = fn
+	return s
+}
+
+// RollbackExec sets a command that undoes the step when a later step fails
+func (s *PlanStep) RollbackExec(cmd string, opts ...exec.Option) *PlanStep {
+	return s.Rollback(func(c *Connection) error {
+		return c.Exec(cmd, opts...)
+	})
+}
+
+// Run runs the steps on the connection until one of them fails. The rollbacks of the completed
+// steps are then run in the reverse order and the error of the failed step is returned. A failing
+// rollback does not stop the rest of them from being run, the errors are in the results.
+func (p *Plan) Run(c *Connection) (StepResults, error) {
+	results := make(StepResults, 0, len(p.steps))
+	for i, step := range p.steps {
+		c.Logger().Debugf("%s: running step %d/%d: %s", c, i+1, len(p.steps), step.Name)
+		start := clock.Default.Now()
+		err := step.run(c)
+		results = append(results, StepResult{Name: step.Name, Err: err, Duration: clock.Default.Since(start)})
+		if err != nil {
+			c.Logger().Errorf("%s: step %q failed: %v", c, step.Name, err)
+			p.rollback(c, results, i)
+			return results, fmt.Errorf("step %q: %w", step.Name, err)
+		}
+	}
+	return results, nil
+}
+
+// rollback runs the rollbacks of the steps before the failed one in the reverse order
+func (p *Plan) rollback(c *Connection, results StepResults, failed int) {
+	for i := failed - 1; i >= 0; i-- {
+		step := p.steps[i]
+		if step.rollback == nil {
+			continue
+		}
+		c.Logger().Infof("%s: rolling back step %q", c, step.Name)
+		results[i].RolledBack = true
+		if err := step.rollback(c); err != nil {
+			c.Logger().Warnf("%s: rollback of step %q failed: %v", c, step.Name, err)
+			results[i].RollbackErr = err
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package rig
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlan(t *testing.T) {
+	mc := &mockClient{}
+	c := &Connection{client: mc}
+	errFailed := errors.New("failed")
+
+	var plan Plan
+	plan.Exec("install a").RollbackExec("remove a")
+	plan.Exec("install b")
+	plan.Step("configure", func(*Connection) error { return nil }).Rollback(func(*Connection) error { return errFailed })
+	plan.Step("start", func(*Connection) error { return errFailed }).RollbackExec("stop")
+	plan.Exec("never")
+
+	results, err := plan.Run(c)
+	require.ErrorIs(t, err, errFailed)
+	require.Equal(t, []string{"install a", "install b", "remove a"}, mc.commands)
+	require.Len(t, results, 4)
+	require.Equal(t, "exec install a", results[0].Name)
+	require.True(t, results[0].RolledBack)
+	require.NoError(t, results[0].RollbackErr)
+	require.False(t, results[1].RolledBack)
+	require.True(t, results[2].RolledBack)
+	require.ErrorIs(t, results[2].RollbackErr, errFailed)
+	require.False(t, results[3].RolledBack)
+	require.ErrorIs(t, results[3].Err, errFailed)
+
+	mc.commands = nil
+	plan = Plan{}
+	plan.Exec("install a").RollbackExec("remove a")
+	results, err = plan.Run(c)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, []string{"install a"}, mc.commands)
+}
@@ -5,8 +5,10 @@ import (
 	"bytes"
 	"compress/gzip"
 	"encoding/base64"
+	"encoding/binary"
 	"fmt"
 	"strings"
+	"unicode/utf16"
 )
 
 // PipeHasEnded string is used during the base64+sha265 upload process
@@ -51,14 +53,14 @@ func EncodeCmd(psCmd string) string {
 	if !strings.Contains(psCmd, "begin {") {
 		psCmd = "$ProgressPreference='SilentlyContinue'; " + psCmd
 	}
-	// 2 byte chars to make PowerShell happy
-	wideCmd := ""
-	for _, b := range []byte(psCmd) {
-		wideCmd += string(b) + "\x00"
+	// PowerShell expects the command to be UTF-16LE encoded
+	wide := utf16.Encode([]rune(psCmd))
+	input := make([]byte, len(wide)*2)
+	for i, c := range wide {
+		binary.LittleEndian.PutUint16(input[i*2:], c)
 	}
 
 	// Base64 encode the command
-	input := []uint8(wideCmd)
 	return base64.StdEncoding.EncodeToString(input)
 }
 
@@ -70,35 +72,54 @@ func Cmd(psCmd string) string {
 	return fmt.Sprintf("powershell.exe -NonInteractive -ExecutionPolicy Unrestricted -NoProfile -EncodedCommand %s", encodedCmd)
 }
 
-// SingleQuote quotes and escapes a string in a format that is accepted by powershell scriptlets
-// from jbrekelmans/go-winrm/util.go PowerShellSingleQuotedStringLiteral
+// isSingleQuote returns true for the characters PowerShell treats as single quotes
+func isSingleQuote(r rune) bool {
+	switch r {
+	case '\'', '\u2018', '\u2019', '\u201a', '\u201b':
+		return true
+	}
+	return false
+}
+
+// SingleQuote quotes a string as a PowerShell verbatim string literal. No expansion or escape
+// sequences are processed inside single quotes, the only special characters are the quotes
+// themselves, which are escaped by doubling them.
 func SingleQuote(v string) string {
 	var buf strings.Builder
 	_, _ = buf.WriteRune('\'')
-	for _, rune := range v {
-		switch rune {
-		case '\n', '\r', '\t', '\v', '\f', '\a', '\b', '\'', '`', '\x00':
-			_, _ = buf.WriteString(fmt.Sprintf("`%c", rune))
-		default:
-			_, _ = buf.WriteRune(rune)
+	for _, r := range v {
+		if isSingleQuote(r) {
+			_, _ = buf.WriteRune(r)
 		}
+		_, _ = buf.WriteRune(r)
 	}
 	_, _ = buf.WriteRune('\'')
 	return buf.String()
 }
 
-// DoubleQuote escapes a string in a way that can be used as a windows file path
+// DoubleQuote quotes a string for use as a single argument on a windows command line. The escaping
+// follows the rules of CommandLineToArgvW. The result is not safe for cmd.exe, which does not know
+// about the backslash escapes. Use SingleQuote for strings in PowerShell scripts.
 func DoubleQuote(v string) string {
 	var buf strings.Builder
 	_, _ = buf.WriteRune('"')
-	for _, rune := range v {
-		switch rune {
+	backslashes := 0
+	for _, r := range v {
+		switch r {
+		case '\\':
+			backslashes++
+			continue
 		case '"':
-			_, _ = buf.WriteString("`\"")
+			// backslashes preceding a quote need to be escaped as well
+			_, _ = buf.WriteString(strings.Repeat("\\", backslashes*2+1))
 		default:
-			_, _ = buf.WriteRune(rune)
+			_, _ = buf.WriteString(strings.Repeat("\\", backslashes))
 		}
+		backslashes = 0
+		_, _ = buf.WriteRune(r)
 	}
+	// trailing backslashes would escape the closing quote
+	_, _ = buf.WriteString(strings.Repeat("\\", backslashes*2))
 	_, _ = buf.WriteRune('"')
 	return buf.String()
 }
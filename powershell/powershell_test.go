@@ -0,0 +1,148 @@
+package powershell
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"os/exec"
+	"strings"
+	"testing"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/require"
+)
+
+var quoteSeeds = []string{
+	"",
+	"plain",
+	"with space",
+	"it's",
+	"`backtick`",
+	"$env:PATH",
+	"$(Remove-Item -Recurse C:\\)",
+	"'; Remove-Item -Recurse C:\\; '",
+	"\u2018smart\u2019 \u201cquotes\u201d",
+	"C:\\Program Files\\",
+	"tab\tnew\nline",
+	"\"double\"",
+	"back\\\\\"slash",
+}
+
+// unquoteSingle reverses SingleQuote according to the PowerShell verbatim string rules
+func unquoteSingle(t *testing.T, quoted string) string {
+	t.Helper()
+	runes := []rune(quoted)
+	require.GreaterOrEqual(t, len(runes), 2)
+	require.Equal(t, '\'', runes[0])
+	require.Equal(t, '\'', runes[len(runes)-1])
+	var buf strings.Builder
+	inner := runes[1 : len(runes)-1]
+	for i := 0; i < len(inner); i++ {
+		if isSingleQuote(inner[i]) {
+			require.True(t, i+1 < len(inner) && isSingleQuote(inner[i+1]), "unescaped quote would terminate the string in %q", quoted)
+			i++
+		}
+		buf.WriteRune(inner[i])
+	}
+	return buf.String()
+}
+
+// splitArgs parses a command line according to the CommandLineToArgvW rules
+func splitArgs(cmdline string) []string {
+	var args []string
+	var arg strings.Builder
+	inQuotes, hasArg := false, false
+	runes := []rune(cmdline)
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; {
+		case r == '\\':
+			n := 0
+			for i < len(runes) && runes[i] == '\\' {
+				n++
+				i++
+			}
+			if i < len(runes) && runes[i] == '"' {
+				arg.WriteString(strings.Repeat("\\", n/2))
+				if n%2 == 1 {
+					arg.WriteRune('"')
+				} else {
+					inQuotes = !inQuotes
+				}
+			} else {
+				arg.WriteString(strings.Repeat("\\", n))
+				i--
+			}
+			hasArg = true
+		case r == '"':
+			inQuotes = !inQuotes
+			hasArg = true
+		case (r == ' ' || r == '\t') && !inQuotes:
+			if hasArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				hasArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			hasArg = true
+		}
+	}
+	if hasArg {
+		args = append(args, arg.String())
+	}
+	return args
+}
+
+func FuzzSingleQuote(f *testing.F) {
+	for _, s := range quoteSeeds {
+		f.Add(s)
+	}
+	pwsh, _ := exec.LookPath("pwsh")
+	f.Fuzz(func(t *testing.T, s string) {
+		if !utf8.ValidString(s) || strings.ContainsRune(s, 0) {
+			t.Skip()
+		}
+		quoted := SingleQuote(s)
+		require.Equal(t, s, unquoteSingle(t, quoted))
+
+		if pwsh == "" {
+			return
+		}
+		out, err := exec.Command(pwsh, "-NoProfile", "-NonInteractive", "-EncodedCommand", EncodeCmd("[Console]::Out.Write("+quoted+")")).Output()
+		require.NoError(t, err)
+		require.Equal(t, s, string(out))
+	})
+}
+
+func FuzzDoubleQuote(f *testing.F) {
+	for _, s := range quoteSeeds {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		if !utf8.ValidString(s) || strings.ContainsRune(s, 0) {
+			t.Skip()
+		}
+		require.Equal(t, []string{s}, splitArgs(DoubleQuote(s)))
+		require.Equal(t, []string{"cmd", s, "x"}, splitArgs("cmd "+DoubleQuote(s)+" x"))
+	})
+}
+
+func FuzzEncodeCmd(f *testing.F) {
+	for _, s := range quoteSeeds {
+		f.Add(s)
+	}
+	f.Add("Write-Host 'ä€😀'")
+	f.Fuzz(func(t *testing.T, s string) {
+		if !utf8.ValidString(s) {
+			t.Skip()
+		}
+		data, err := base64.StdEncoding.DecodeString(EncodeCmd(s))
+		require.NoError(t, err)
+		require.Zero(t, len(data)%2)
+		wide := make([]uint16, len(data)/2)
+		for i := range wide {
+			wide[i] = binary.LittleEndian.Uint16(data[i*2:])
+		}
+		require.Equal(t, "$ProgressPreference='SilentlyContinue'; "+s, string(utf16.Decode(wide)))
+	})
+}
@@ -0,0 +1,81 @@
+package rig
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// prefixWriteMu serializes the writes of all the PrefixWriters so that the lines written from
+// concurrent commands into the same destination don't get mixed up
+var prefixWriteMu sync.Mutex
+
+// PrefixWriter writes the lines written to it into one or more writers, prefixing each of them. A
+// line is only written when it is complete or the writer is closed, in a single Write call per
+// destination, so the output of commands running on many hosts at the same time stays readable.
+type PrefixWriter struct {
+	prefix string
+	w      []io.Writer
+	mu     sync.Mutex
+	buf    []byte
+}
+
+// NewPrefixWriter returns a PrefixWriter that writes the lines prefixed with prefix to all of w
+func NewPrefixWriter(prefix string, w ...io.Writer) *PrefixWriter {
+	return &PrefixWriter{prefix: prefix, w: w}
+}
+
+// HostOutputWriters returns the writers for the stdout and stderr of commands run on the host, for
+// use with exec.StdoutWriter and exec.StderrWriter. The lines are prefixed with the host and the
+// stream name, such as "[ssh] 10.0.0.1:22 stdout: ". Close the writers when the command has
+// finished to write out a last line that does not end in a line break.
+func HostOutputWriters(c *Connection, w ...io.Writer) (stdout, stderr *PrefixWriter) {
+	host := c.String()
+	return NewPrefixWriter(host+" stdout: ", w...), NewPrefixWriter(host+" stderr: ", w...)
+}
+
+// Write buffers p and writes out the completed lines
+func (p *PrefixWriter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.buf = append(p.buf, b...)
+	for {
+		idx := bytes.IndexByte(p.buf, '\n')
+		if idx == -1 {
+			break
+		}
+		if err := p.writeLine(p.buf[:idx+1]); err != nil {
+			return len(b), err
+		}
+		p.buf = p.buf[idx+1:]
+	}
+	return len(b), nil
+}
+
+// Close writes out the last line when it does not end in a line break
+func (p *PrefixWriter) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.buf) == 0 {
+		return nil
+	}
+	line := append(p.buf, '\n')
+	p.buf = nil
+	return p.writeLine(line)
+}
+
+// writeLine writes the prefixed line to all of the writers
+func (p *PrefixWriter) writeLine(line []byte) error {
+	out := make([]byte, 0, len(p.prefix)+len(line))
+	out = append(out, p.prefix...)
+	out = append(out, line...)
+
+	prefixWriteMu.Lock()
+	defer prefixWriteMu.Unlock()
+	for _, w := range p.w {
+		if _, err := w.Write(out); err != nil {
+			return err //nolint:wrapcheck
+		}
+	}
+	return nil
+}
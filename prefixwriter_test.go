@@ -0,0 +1,44 @@
+package rig
+
+import (
+	"bytes"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	var a, b bytes.Buffer
+	w := NewPrefixWriter("host: ", &a, &b)
+	_, err := w.Write([]byte("one\ntw"))
+	require.NoError(t, err)
+	require.Equal(t, "host: one\n", a.String())
+	_, err = w.Write([]byte("o\nthree"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.Equal(t, "host: one\nhost: two\nhost: three\n", a.String())
+	require.Equal(t, a.String(), b.String())
+}
+
+func TestHostGroupOutput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a posix shell")
+	}
+	var hosts []*Connection
+	for i := 0; i < 2; i++ {
+		c := &Connection{Localhost: &Localhost{Enabled: true}}
+		require.NoError(t, c.Connect())
+		hosts = append(hosts, c)
+	}
+	var out bytes.Buffer
+	results := (&HostGroup{Hosts: hosts, Output: &out}).ExecOutput("echo hello; echo oops >&2")
+	require.NoError(t, results.Err())
+	require.Equal(t, "hello", results[0].Output)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.ElementsMatch(t, []string{
+		"[local] localhost stdout: hello", "[local] localhost stdout: hello",
+		"[local] localhost stderr: oops", "[local] localhost stderr: oops",
+	}, lines)
+}
@@ -0,0 +1,80 @@
+package rig
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/alessio/shellescape"
+	"github.com/k0sproject/rig/exec"
+	ps "github.com/k0sproject/rig/powershell"
+)
+
+// defaultProbeTimeout is how long ProbeFromHost waits for the connection when no exec.Timeout is given
+const defaultProbeTimeout = 5 * time.Second
+
+// ProbeTCP checks that a TCP connection can be opened from the local host to the port of addr
+// within the timeout, for example to verify that the SSH port of a host is reachable before
+// connecting. The connection is closed right away. An error matching ErrCantConnect is returned
+// when the port can't be reached.
+func ProbeTCP(addr string, port int, timeout time.Duration) error {
+	if err := validatePort(port); err != nil {
+		return err
+	}
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(addr, strconv.Itoa(port)), timeout)
+	if err != nil {
+		return ErrCantConnect.Wrapf("probe %s: %w", net.JoinHostPort(addr, strconv.Itoa(port)), err)
+	}
+	_ = conn.Close()
+	return nil
+}
+
+// ProbeFromHost checks that a TCP connection can be opened from the host to the port of
+// targetAddr, for example to verify that the hosts of a cluster can reach each other. Nothing is
+// sent over the connection. The connection attempt is given the duration of exec.Timeout, five
+// seconds by default.
+//
+// On unix hosts nc is used when available and the bash /dev/tcp device otherwise, on windows the
+// probe is made using PowerShell. An error matching ErrCantConnect is returned when the port can't
+// be reached and ErrNotSupported when the host has no means of probing it.
+func (c *Connection) ProbeFromHost(targetAddr string, port int, opts ...exec.Option) error {
+	if err := validatePort(port); err != nil {
+		return err
+	}
+	timeout := exec.Build(opts...).Timeout
+	if timeout <= 0 {
+		timeout = defaultProbeTimeout
+	}
+	target := net.JoinHostPort(targetAddr, strconv.Itoa(port))
+
+	var cmd string
+	if c.IsWindows() {
+		cmd = ps.Cmd(fmt.Sprintf(`$c = New-Object Net.Sockets.TcpClient; try { if (-not $c.ConnectAsync(%s, %d).Wait(%d)) { exit 1 } } catch { exit 1 } finally { $c.Close() }`, ps.SingleQuote(targetAddr), port, timeout.Milliseconds()))
+	} else {
+		secs := strconv.Itoa(int(math.Ceil(timeout.Seconds())))
+		host := shellescape.Quote(targetAddr)
+		// exit code 127 tells that neither of the methods is available
+		cmd = "sh -c " + shellescape.Quote(fmt.Sprintf(`if command -v nc > /dev/null 2>&1; then nc -z -w %[1]s %[2]s %[3]d; elif command -v bash > /dev/null 2>&1 && command -v timeout > /dev/null 2>&1; then timeout %[1]s bash -c 'exec 3<> "/dev/tcp/$0/$1"' %[2]s %[3]d; else exit 127; fi`, secs, host, port))
+	}
+
+	// leave the command some time to report the failure before it is terminated
+	opts = append(opts[:len(opts):len(opts)], exec.Timeout(timeout+defaultProbeTimeout))
+	err := c.Exec(cmd, opts...)
+	if err == nil {
+		return nil
+	}
+	if code, ok := exec.ExitCode(err); ok && code == 127 && !c.IsWindows() {
+		return ErrNotSupported.Wrapf("%s: probe %s: neither nc nor bash and timeout found", c, target)
+	}
+	return ErrCantConnect.Wrapf("%s: probe %s: %w", c, target, err)
+}
+
+// validatePort returns an error when port is not a valid TCP port number
+func validatePort(port int) error {
+	if port < 1 || port > 65535 {
+		return ErrValidationFailed.Wrapf("invalid port %d", port)
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package rig
+
+import (
+	"net"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/creasty/defaults"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProbe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := listener.Addr().(*net.TCPAddr).Port
+	require.NoError(t, listener.Close())
+
+	require.ErrorIs(t, ProbeTCP("127.0.0.1", port, time.Second), ErrCantConnect)
+	require.ErrorIs(t, ProbeTCP("127.0.0.1", 0, time.Second), ErrValidationFailed)
+
+	listener, err = net.Listen("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer listener.Close()
+	require.NoError(t, ProbeTCP("127.0.0.1", port, time.Second))
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	h := Host{Connection: Connection{Localhost: &Localhost{Enabled: true}}}
+	require.NoError(t, defaults.Set(&h))
+	require.NoError(t, h.Connect())
+	require.NoError(t, h.ProbeFromHost("127.0.0.1", port))
+	require.NoError(t, listener.Close())
+	require.ErrorIs(t, h.ProbeFromHost("127.0.0.1", port), ErrCantConnect)
+}
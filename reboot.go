@@ -0,0 +1,121 @@
+package rig
+
+import (
+	"context"
+	"time"
+
+	"github.com/k0sproject/rig/exec"
+	"github.com/k0sproject/rig/pkg/clock"
+	ps "github.com/k0sproject/rig/powershell"
+)
+
+// DefaultRebootPollInterval is the default time between the reconnection attempts after a reboot
+const DefaultRebootPollInterval = 5 * time.Second
+
+// RebootOption is a functional option for Connection.Reboot
+type RebootOption func(*rebootOptions)
+
+type rebootOptions struct {
+	command  string
+	interval time.Duration
+}
+
+// RebootCommand overrides the command used for rebooting the host. The command is run in the
+// background with elevated privileges.
+func RebootCommand(cmd string) RebootOption {
+	return func(o *rebootOptions) {
+		o.command = cmd
+	}
+}
+
+// RebootPollInterval sets the time between the reconnection attempts, DefaultRebootPollInterval by default
+func RebootPollInterval(d time.Duration) RebootOption {
+	return func(o *rebootOptions) {
+		o.interval = d
+	}
+}
+
+// bootIDCommand prints a value that changes on every boot
+const bootIDCommand = "cat /proc/sys/kernel/random/boot_id 2> /dev/null || sysctl -n kern.boottime"
+
+var bootIDCommandWindows = ps.Cmd("(Get-CimInstance Win32_OperatingSystem).LastBootUpTime.ToString('o')")
+
+// bootID returns a value that identifies the current boot of the host or an empty string when it
+// can't be determined
+func (c *Connection) bootID() string {
+	cmd := bootIDCommand
+	if c.IsWindows() {
+		cmd = bootIDCommandWindows
+	}
+	id, err := c.ExecOutput(cmd, exec.HideOutput())
+	if err != nil {
+		c.Logger().Debugf("%s: failed to get boot id: %v", c, err)
+		return ""
+	}
+	return id
+}
+
+// Reboot reboots the host and waits until it can be connected to again. The connection is closed
+// when the reboot command has been issued and reopened once the host is back. A changed boot id, or
+// the boot time on hosts without one, is used to make sure the host has actually rebooted. Returns an
+// error and leaves the connection closed when the host has not come back before the context is done.
+func (c *Connection) Reboot(ctx context.Context, opts ...RebootOption) error {
+	if err := c.checkConnected(); err != nil {
+		return err
+	}
+	o := &rebootOptions{interval: DefaultRebootPollInterval}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	before := c.bootID()
+	if err := c.issueReboot(o.command); err != nil {
+		return err
+	}
+	c.Logger().Infof("%s: rebooting", c)
+	// the connection is expected to be gone already
+	_ = c.Disconnect()
+	// the remote file helpers are bound to the old connection
+	c.fsys = nil
+	c.sudofsys = nil
+
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-ctx.Done():
+			return ErrCantConnect.Wrapf("host did not come back after reboot: %w", ctx.Err())
+		case <-clock.Default.After(o.interval):
+		}
+		if err := c.Connect(); err != nil {
+			c.Logger().Debugf("%s: waiting for the host to come back after reboot (attempt %d): %v", c, attempt, err)
+			continue
+		}
+		if after := c.bootID(); before != "" && after == before {
+			c.Logger().Debugf("%s: host has not rebooted yet", c)
+			_ = c.Disconnect()
+			continue
+		}
+		c.Logger().Infof("%s: host is back after reboot", c)
+		return nil
+	}
+}
+
+// issueReboot starts the reboot in the background so that the command returns before the
+// connection is cut
+func (c *Connection) issueReboot(cmd string) error {
+	if c.IsWindows() {
+		if cmd == "" {
+			cmd = "shutdown /r /t 2"
+		}
+		if err := c.Exec(cmd, exec.Sudo(c)); err != nil {
+			return ErrCommandFailed.Wrapf("reboot: %w", err)
+		}
+		return nil
+	}
+	if cmd == "" {
+		cmd = "shutdown -r now || reboot"
+	}
+	if _, err := c.StartBackground("sleep 1; "+cmd, exec.Sudo(c)); err != nil {
+		return ErrCommandFailed.Wrapf("reboot: %w", err)
+	}
+	return nil
+}
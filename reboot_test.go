@@ -0,0 +1,73 @@
+package rig
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// rebootClient returns a scriptClient for a host that reports the boot ids in order, repeating the
+// last one
+func rebootClient(bootIDs ...string) *scriptClient {
+	return &scriptClient{respond: func(cmd string) (string, string, error) {
+		switch {
+		case cmd == bootIDCommand:
+			id := bootIDs[0]
+			if len(bootIDs) > 1 {
+				bootIDs = bootIDs[1:]
+			}
+			return id + "\n", "", nil
+		case strings.Contains(cmd, "nohup"):
+			return "1234 /tmp/tmp.abc123\n", "", nil
+		}
+		return "", "", nil
+	}}
+}
+
+func TestReboot(t *testing.T) {
+	// the first reconnect still finds the host running the old boot
+	client := rebootClient("boot-1", "boot-1", "boot-2")
+	c := newScriptConnection(t, client)
+	client.connectErrs = []error{errors.New("connection refused"), errors.New("connection refused")}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, c.Reboot(ctx, RebootPollInterval(time.Millisecond)))
+	require.True(t, c.IsConnected())
+	require.Empty(t, client.connectErrs)
+	require.Equal(t, 3, client.connects, "connected initially, to the old boot and to the new boot")
+
+	var rebootCmd string
+	for _, cmd := range client.commands {
+		if strings.Contains(cmd, "nohup") {
+			rebootCmd = cmd
+		}
+	}
+	require.Contains(t, rebootCmd, "shutdown -r now || reboot")
+
+	client = rebootClient("boot-1", "boot-2")
+	c = newScriptConnection(t, client)
+	require.NoError(t, c.Reboot(ctx, RebootPollInterval(time.Millisecond), RebootCommand("systemctl kexec")))
+	require.Equal(t, 2, client.connects)
+	require.Contains(t, strings.Join(client.commands, "\n"), "systemctl kexec")
+}
+
+func TestRebootTimeout(t *testing.T) {
+	client := rebootClient("boot-1")
+	c := newScriptConnection(t, client)
+	client.connectErrs = make([]error, 1000)
+	for i := range client.connectErrs {
+		client.connectErrs[i] = errors.New("connection refused")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := c.Reboot(ctx, RebootPollInterval(time.Millisecond))
+	require.ErrorIs(t, err, ErrCantConnect)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.False(t, c.IsConnected())
+}
@@ -0,0 +1,89 @@
+package rig
+
+import (
+	"regexp"
+
+	"github.com/k0sproject/rig/pkg/redact"
+)
+
+// RedactValue registers a secret that is masked in every log line, command echo and error string
+// produced by rig. Values shorter than redact.MinLength are ignored. The secrets rig learns on its own,
+// such as the WinRM password, the su root password and SSH key passphrases, are registered only for
+// the connection that uses them, see Connection.RedactValue.
+func RedactValue(secret string) {
+	redact.Value(secret)
+}
+
+// RemoveRedactValue removes a secret registered using RedactValue
+func RemoveRedactValue(secret string) {
+	redact.RemoveValue(secret)
+}
+
+// RedactPattern registers a regular expression whose matches are masked in every log line, command
+// echo and error string produced by rig
+func RedactPattern(re *regexp.Regexp) {
+	redact.Pattern(re)
+}
+
+// RemoveRedactPattern removes a regular expression registered using RedactPattern
+func RemoveRedactPattern(re *regexp.Regexp) {
+	redact.RemovePattern(re)
+}
+
+// RedactValue registers a secret that is masked in the log lines, command echoes and errors of the
+// connection. Values shorter than redact.MinLength are ignored.
+func (c *Connection) RedactValue(secret string) {
+	c.secrets().Value(secret)
+}
+
+// RemoveRedactValue removes a secret registered for the connection using RedactValue
+func (c *Connection) RemoveRedactValue(secret string) {
+	c.secrets().RemoveValue(secret)
+}
+
+// secrets returns the redactor of the connection, creating it when needed
+func (c *Connection) secrets() *redact.Redactor {
+	if c.redactor == nil {
+		c.redactor = &redact.Redactor{}
+	}
+	return c.redactor
+}
+
+// redactorSetter is implemented by the clients that learn secrets on their own, such as passwords
+// from a credential source
+type redactorSetter interface {
+	setRedactor(r *redact.Redactor)
+}
+
+// setClientRedactor creates the redactor of the connection and passes it to the client
+func (c *Connection) setClientRedactor() {
+	r := c.secrets()
+	if rs, ok := c.client.(redactorSetter); ok {
+		rs.setRedactor(r)
+	}
+}
+
+// secretsOrDefault returns r or the global redactor when r is nil, for the clients that are used
+// without a connection
+func secretsOrDefault(r *redact.Redactor) *redact.Redactor {
+	if r == nil {
+		return redact.Default
+	}
+	return r
+}
+
+// setRedactor sets the redactor for the key passphrases of the connection and its bastion
+func (c *SSH) setRedactor(r *redact.Redactor) {
+	c.redactor = r
+	if c.Bastion != nil {
+		c.Bastion.setRedactor(r)
+	}
+}
+
+// setRedactor sets the redactor for the password of the connection and its bastion
+func (c *WinRM) setRedactor(r *redact.Redactor) {
+	c.redactor = r
+	if c.Bastion != nil {
+		c.Bastion.setRedactor(r)
+	}
+}
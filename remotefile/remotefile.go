@@ -0,0 +1,209 @@
+// Package remotefile provides idempotent editing helpers for configuration files on remote hosts
+package remotefile
+
+import (
+	"errors"
+	"io/fs"
+	"regexp"
+	"strings"
+
+	"github.com/k0sproject/rig"
+)
+
+// Option is a functional option for the file editing functions
+type Option func(*options)
+
+type options struct {
+	backupSuffix string
+	perm         fs.FileMode
+	atomic       bool
+}
+
+// Backup makes the editing functions save a copy of the original file with the suffix appended to the
+// file name, such as ".bak", before changing it
+func Backup(suffix string) Option {
+	return func(o *options) {
+		o.backupSuffix = suffix
+	}
+}
+
+// Perm sets the permissions used when a file that does not exist is created. The default is 0644.
+func Perm(perm fs.FileMode) Option {
+	return func(o *options) {
+		o.perm = perm
+	}
+}
+
+// Atomic makes the editing functions replace the file atomically by writing the new content into a
+// temporary file and renaming it over the original, see rig.FS.WriteFileAtomic. The renamed file is
+// owned by the user performing the edit.
+func Atomic() Option {
+	return func(o *options) {
+		o.atomic = true
+	}
+}
+
+func buildOptions(opts ...Option) *options {
+	o := &options{perm: 0o644}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// EnsureLine makes sure the file contains line. If there are lines matching the regular expression
+// match, the last one of them is replaced with line and the others are removed, so that no stale
+// duplicates are left behind. Otherwise line is appended to the file unless it is already present.
+// The file is created if it does not exist. Returns true if the file was changed.
+func EnsureLine(fsys rig.FS, name, match, line string, opts ...Option) (bool, error) {
+	re, err := compile(match)
+	if err != nil {
+		return false, err
+	}
+	return edit(fsys, name, true, func(lines []string) []string {
+		return ensureLine(lines, re, line)
+	}, opts...)
+}
+
+// RemoveLines removes all the lines matching the regular expression match from the file. Returns
+// true if the file was changed. A file that does not exist is left alone.
+func RemoveLines(fsys rig.FS, name, match string, opts ...Option) (bool, error) {
+	re, err := compile(match)
+	if err != nil {
+		return false, err
+	}
+	return edit(fsys, name, false, func(lines []string) []string {
+		return removeLines(lines, re)
+	}, opts...)
+}
+
+func compile(match string) (*regexp.Regexp, error) {
+	if match == "" {
+		return nil, nil //nolint:nilnil // no pattern
+	}
+	re, err := regexp.Compile(match)
+	if err != nil {
+		return nil, rig.ErrValidationFailed.Wrapf("invalid pattern %q: %w", match, err)
+	}
+	return re, nil
+}
+
+// edit reads the file, applies fn to its lines and writes the result back if it changed
+func edit(fsys rig.FS, name string, create bool, fn func([]string) []string, opts ...Option) (bool, error) {
+	o := buildOptions(opts...)
+
+	perm := o.perm
+	var content []byte
+	info, err := fsys.Stat(name)
+	exists := err == nil
+	switch {
+	case exists:
+		perm = info.Mode().Perm()
+		content, err = fsys.ReadFile(name)
+		if err != nil {
+			return false, err //nolint:wrapcheck
+		}
+	case errors.Is(err, fs.ErrNotExist) && create:
+	case errors.Is(err, fs.ErrNotExist):
+		return false, nil
+	default:
+		return false, err //nolint:wrapcheck
+	}
+
+	lines, eol := splitLines(string(content))
+	edited := fn(lines)
+	if exists && equalLines(lines, edited) {
+		return false, nil
+	}
+	updated := joinLines(edited, eol)
+
+	if o.backupSuffix != "" && exists {
+		if err := fsys.WriteFile(name+o.backupSuffix, content, perm); err != nil {
+			return false, err //nolint:wrapcheck
+		}
+	}
+
+	if o.atomic {
+		err = fsys.WriteFileAtomic(name, []byte(updated), perm)
+	} else {
+		err = fsys.WriteFile(name, []byte(updated), perm)
+	}
+	if err != nil {
+		return false, err //nolint:wrapcheck
+	}
+	return true, nil
+}
+
+// splitLines splits content into lines and returns them along with the line ending used
+func splitLines(content string) ([]string, string) {
+	eol := "\n"
+	if strings.Contains(content, "\r\n") {
+		eol = "\r\n"
+	}
+	if content == "" {
+		return nil, eol
+	}
+	return strings.Split(strings.TrimSuffix(content, eol), eol), eol
+}
+
+// joinLines joins lines into file content that ends with a line ending
+func joinLines(lines []string, eol string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, eol) + eol
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func ensureLine(lines []string, re *regexp.Regexp, line string) []string {
+	last := -1
+	if re != nil {
+		for i, l := range lines {
+			if re.MatchString(l) {
+				last = i
+			}
+		}
+	}
+	if last >= 0 {
+		result := make([]string, 0, len(lines))
+		for i, l := range lines {
+			switch {
+			case i == last:
+				result = append(result, line)
+			case !re.MatchString(l):
+				result = append(result, l)
+			}
+		}
+		return result
+	}
+	for _, l := range lines {
+		if l == line {
+			return lines
+		}
+	}
+	return append(lines, line)
+}
+
+func removeLines(lines []string, re *regexp.Regexp) []string {
+	if re == nil {
+		return lines
+	}
+	result := make([]string, 0, len(lines))
+	for _, l := range lines {
+		if !re.MatchString(l) {
+			result = append(result, l)
+		}
+	}
+	return result
+}
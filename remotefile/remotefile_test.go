@@ -0,0 +1,49 @@
+package remotefile
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitJoinLines(t *testing.T) {
+	lines, eol := splitLines("a\r\nb\r\n")
+	require.Equal(t, []string{"a", "b"}, lines)
+	require.Equal(t, "\r\n", eol)
+	require.Equal(t, "a\r\nb\r\n", joinLines(lines, eol))
+
+	lines, eol = splitLines("a\nb")
+	require.Equal(t, []string{"a", "b"}, lines)
+	require.Equal(t, "a\nb\n", joinLines(lines, eol))
+
+	lines, _ = splitLines("")
+	require.Empty(t, lines)
+}
+
+func TestEnsureLine(t *testing.T) {
+	re := regexp.MustCompile(`^#?PermitRootLogin\s`)
+	lines := []string{"Port 22", "#PermitRootLogin yes", "PermitRootLogin yes", "UsePAM yes"}
+
+	require.Equal(t, []string{"Port 22", "PermitRootLogin no", "UsePAM yes"}, ensureLine(lines, re, "PermitRootLogin no"))
+	require.Equal(t, []string{"Port 22", "#PermitRootLogin yes", "PermitRootLogin yes", "UsePAM yes"}, lines, "input was modified")
+	require.Equal(t, append(lines, "X11Forwarding no"), ensureLine(lines, regexp.MustCompile(`^X11Forwarding`), "X11Forwarding no"))
+	require.Equal(t, lines, ensureLine(lines, nil, "UsePAM yes"))
+	require.Equal(t, []string{"new"}, ensureLine(nil, nil, "new"))
+}
+
+func TestEnsureLineMultipleMatches(t *testing.T) {
+	re := regexp.MustCompile(`^MaxSessions\s`)
+	lines := []string{"MaxSessions 5", "Port 22", "MaxSessions 10", "UsePAM yes", "MaxSessions 20"}
+	require.Equal(t, []string{"Port 22", "UsePAM yes", "MaxSessions 30"}, ensureLine(lines, re, "MaxSessions 30"))
+
+	// already in place, the stale duplicates are still removed
+	lines = []string{"MaxSessions 30", "Port 22", "MaxSessions 30"}
+	require.Equal(t, []string{"Port 22", "MaxSessions 30"}, ensureLine(lines, re, "MaxSessions 30"))
+}
+
+func TestRemoveLines(t *testing.T) {
+	lines := []string{"keep", "# drop", "keep too", "# drop too"}
+	require.Equal(t, []string{"keep", "keep too"}, removeLines(lines, regexp.MustCompile(`^#`)))
+	require.Equal(t, lines, removeLines(lines, nil))
+}
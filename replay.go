@@ -0,0 +1,390 @@
+package rig
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/k0sproject/rig/exec"
+	"github.com/k0sproject/rig/log"
+)
+
+// Interaction is a command and its response captured by RecordingClient
+type Interaction struct {
+	Command string `json:"command"`
+	Stdout  []byte `json:"stdout,omitempty"`
+	Stderr  []byte `json:"stderr,omitempty"`
+	// ExitCode is the exit code of the command, -1 when the command failed without one
+	ExitCode int `json:"exitCode"`
+	// Error is the error the command failed with
+	Error string `json:"error,omitempty"`
+	// Interactive is true for the commands run using ExecInteractive, their output is not captured
+	Interactive bool `json:"interactive,omitempty"`
+}
+
+// recordingHeader is the first line of a recording and describes the recorded host
+type recordingHeader struct {
+	Protocol  string `json:"protocol"`
+	Address   string `json:"address"`
+	IPAddress string `json:"ipAddress"`
+	Windows   bool   `json:"windows"`
+}
+
+// RecordingClient wraps a Client and writes the commands run through it and their responses to a
+// writer as JSON lines, to be served back by a ReplayClient. Use it through the Custom field of a
+// Connection:
+//
+//	f, _ := os.Create("session.jsonl")
+//	h.Connection = rig.Connection{Custom: &rig.ClientConfig{Name: "record", Client: rig.NewRecordingClient(&rig.SSH{...}, f)}}
+//
+// The output of the commands is captured in full, including the data streamed to files, so
+// recording large file transfers is not practical.
+type RecordingClient struct {
+	client Client
+
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewRecordingClient returns a RecordingClient that records the session of client into w
+func NewRecordingClient(client Client, w io.Writer) *RecordingClient {
+	return &RecordingClient{client: client, enc: json.NewEncoder(w)}
+}
+
+func (c *RecordingClient) write(v interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_ = c.enc.Encode(v)
+}
+
+func (c *RecordingClient) record(cmd string, stdout, stderr *bytes.Buffer, err error) {
+	i := Interaction{Command: cmd}
+	if stdout != nil {
+		i.Stdout = stdout.Bytes()
+	}
+	if stderr != nil {
+		i.Stderr = stderr.Bytes()
+	}
+	if err != nil {
+		i.Error = err.Error()
+		i.ExitCode = -1
+		if code, ok := exec.ExitCode(err); ok {
+			i.ExitCode = code
+		}
+	}
+	c.write(i)
+}
+
+// Connect connects the wrapped client and records the details of the host
+func (c *RecordingClient) Connect() error {
+	if err := c.client.Connect(); err != nil {
+		return err //nolint:wrapcheck
+	}
+	c.write(recordingHeader{
+		Protocol:  c.client.Protocol(),
+		Address:   c.client.String(),
+		IPAddress: c.client.IPAddress(),
+		Windows:   c.client.IsWindows(),
+	})
+	return nil
+}
+
+// Disconnect disconnects the wrapped client
+func (c *RecordingClient) Disconnect() error { return c.client.Disconnect() } //nolint:wrapcheck
+
+// IsWindows returns true if the host is running windows
+func (c *RecordingClient) IsWindows() bool { return c.client.IsWindows() }
+
+// String returns the address of the wrapped client
+func (c *RecordingClient) String() string { return c.client.String() }
+
+// Protocol returns the protocol of the wrapped client
+func (c *RecordingClient) Protocol() string { return c.client.Protocol() }
+
+// IPAddress returns the ip address of the wrapped client
+func (c *RecordingClient) IPAddress() string { return c.client.IPAddress() }
+
+// IsConnected returns true if the wrapped client is connected
+func (c *RecordingClient) IsConnected() bool { return c.client.IsConnected() }
+
+// SetLogger passes the logger to the wrapped client
+func (c *RecordingClient) SetLogger(l log.Logger) {
+	if ls, ok := c.client.(loggerSetter); ok {
+		ls.SetLogger(l)
+	}
+}
+
+// Exec runs the command using the wrapped client and records its output
+func (c *RecordingClient) Exec(cmd string, opts ...exec.Option) error {
+	var (
+		mu             sync.Mutex
+		stdout, stderr bytes.Buffer
+	)
+	execOpts := exec.Build(opts...)
+	// the output is captured from wherever the client sends it
+	opts = opts[:len(opts):len(opts)]
+	if execOpts.Writer != nil {
+		opts = append(opts, exec.Writer(io.MultiWriter(execOpts.Writer, &stdout)))
+	}
+	if execOpts.ErrWriter != nil {
+		opts = append(opts, exec.StderrWriter(io.MultiWriter(execOpts.ErrWriter, &stderr)))
+	}
+	lineFunc := execOpts.OutputLineFunc
+	opts = append(opts, exec.OnOutputLine(func(line string, isStderr bool) {
+		if lineFunc != nil {
+			lineFunc(line, isStderr)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if isStderr {
+			stderr.WriteString(line + "\n")
+		} else {
+			stdout.WriteString(line + "\n")
+		}
+	}))
+	err := c.client.Exec(cmd, opts...)
+	c.record(cmd, &stdout, &stderr, err)
+	return err //nolint:wrapcheck
+}
+
+// ExecStreams runs the command using the wrapped client and records its output when it finishes
+func (c *RecordingClient) ExecStreams(cmd string, stdin io.ReadCloser, stdout, stderr io.Writer, opts ...exec.Option) (Waiter, error) {
+	var outBuf, errBuf bytes.Buffer
+	if stdout != nil {
+		stdout = io.MultiWriter(stdout, &outBuf)
+	}
+	if stderr != nil {
+		stderr = io.MultiWriter(stderr, &errBuf)
+	}
+	waiter, err := c.client.ExecStreams(cmd, stdin, stdout, stderr, opts...)
+	if err != nil {
+		c.record(cmd, nil, nil, err)
+		return nil, err //nolint:wrapcheck
+	}
+	return &auditWaiter{Waiter: waiter, done: func(err error) { c.record(cmd, &outBuf, &errBuf, err) }}, nil
+}
+
+// ExecInteractive runs the command using the wrapped client, only the result is recorded
+func (c *RecordingClient) ExecInteractive(cmd string) error {
+	return c.recordInteractive(cmd, c.client.ExecInteractive(cmd))
+}
+
+// ExecInteractiveWithOutput runs the command using the wrapped client when it supports copying the
+// output, only the result is recorded
+func (c *RecordingClient) ExecInteractiveWithOutput(cmd string, output io.Writer) error {
+	r, ok := c.client.(interactiveRecorder)
+	if !ok {
+		return ErrNotSupported.Wrapf("%s: recording interactive sessions", c.client.Protocol())
+	}
+	return c.recordInteractive(cmd, r.ExecInteractiveWithOutput(cmd, output))
+}
+
+// recordInteractive records the result of an interactive command
+func (c *RecordingClient) recordInteractive(cmd string, err error) error {
+	i := Interaction{Command: cmd, Interactive: true}
+	if err != nil {
+		i.Error = err.Error()
+		i.ExitCode = -1
+		if code, ok := exec.ExitCode(err); ok {
+			i.ExitCode = code
+		}
+	}
+	c.write(i)
+	return err //nolint:wrapcheck
+}
+
+// ReplayClient is a Client that serves the responses captured by a RecordingClient. Each recorded
+// command is served once, in the recorded order when the same command was run more than once.
+// Running a command that was not recorded returns an error matching ErrNotFound.
+type ReplayClient struct {
+	header    recordingHeader
+	connected bool
+
+	mu           sync.Mutex
+	interactions []*Interaction
+}
+
+// NewReplayClient returns a ReplayClient serving the recording read from r
+func NewReplayClient(r io.Reader) (*ReplayClient, error) {
+	c := &ReplayClient{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		data := scanner.Bytes()
+		if len(bytes.TrimSpace(data)) == 0 {
+			continue
+		}
+		if c.header.Protocol == "" {
+			if err := json.Unmarshal(data, &c.header); err != nil {
+				return nil, ErrValidationFailed.Wrapf("decode recording line %d: %w", line, err)
+			}
+			continue
+		}
+		var i Interaction
+		if err := json.Unmarshal(data, &i); err != nil {
+			return nil, ErrValidationFailed.Wrapf("decode recording line %d: %w", line, err)
+		}
+		c.interactions = append(c.interactions, &i)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, ErrValidationFailed.Wrapf("read recording: %w", err)
+	}
+	if c.header.Protocol == "" {
+		return nil, ErrValidationFailed.Wrapf("recording does not have a header")
+	}
+	return c, nil
+}
+
+// Remaining returns the recorded commands that have not been run
+func (c *ReplayClient) Remaining() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cmds := make([]string, 0, len(c.interactions))
+	for _, i := range c.interactions {
+		cmds = append(cmds, i.Command)
+	}
+	return cmds
+}
+
+// next returns and removes the first recorded interaction for the command
+func (c *ReplayClient) next(cmd string, interactive bool) (*Interaction, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for idx, i := range c.interactions {
+		if i.Command == cmd && i.Interactive == interactive {
+			c.interactions = append(c.interactions[:idx], c.interactions[idx+1:]...)
+			return i, nil
+		}
+	}
+	return nil, ErrNotFound.Wrapf("command `%s` was not recorded", cmd)
+}
+
+// replayExitError is the error of a replayed command that exited with a non-zero exit code
+type replayExitError struct {
+	code int
+	msg  string
+}
+
+func (e *replayExitError) Error() string { return e.msg }
+func (e *replayExitError) ExitCode() int { return e.code }
+
+// err returns the recorded error of the interaction
+func (i *Interaction) err() error {
+	if i.Error == "" {
+		return nil
+	}
+	if i.ExitCode >= 0 {
+		return &replayExitError{code: i.ExitCode, msg: i.Error}
+	}
+	return ErrCommandFailed.Wrap(errors.New(i.Error)) //nolint:goerr113
+}
+
+// Connect marks the client connected
+func (c *ReplayClient) Connect() error {
+	c.connected = true
+	return nil
+}
+
+// Disconnect marks the client disconnected
+func (c *ReplayClient) Disconnect() error {
+	c.connected = false
+	return nil
+}
+
+// IsWindows returns true if the recorded host was running windows
+func (c *ReplayClient) IsWindows() bool { return c.header.Windows }
+
+// String returns the address of the recorded host
+func (c *ReplayClient) String() string { return c.header.Address }
+
+// Protocol returns the protocol of the recorded host
+func (c *ReplayClient) Protocol() string { return c.header.Protocol }
+
+// IPAddress returns the ip address of the recorded host
+func (c *ReplayClient) IPAddress() string { return c.header.IPAddress }
+
+// IsConnected returns true if the client is connected
+func (c *ReplayClient) IsConnected() bool { return c.connected }
+
+// Exec serves the recorded output of the command
+func (c *ReplayClient) Exec(cmd string, opts ...exec.Option) error {
+	execOpts := exec.Build(opts...)
+	execOpts.LogCmd(c.String(), cmd)
+	i, err := c.next(cmd, false)
+	if err != nil {
+		return err
+	}
+	if execOpts.Writer != nil {
+		if _, err := execOpts.Writer.Write(i.Stdout); err != nil {
+			return fmt.Errorf("write stdout: %w", err)
+		}
+	} else {
+		for _, line := range splitLines(i.Stdout) {
+			execOpts.AddOutput(c.String(), line+"\n", "")
+		}
+	}
+	if execOpts.ErrWriter != nil {
+		if _, err := execOpts.ErrWriter.Write(i.Stderr); err != nil {
+			return fmt.Errorf("write stderr: %w", err)
+		}
+	} else {
+		for _, line := range splitLines(i.Stderr) {
+			execOpts.AddOutput(c.String(), "", line+"\n")
+		}
+	}
+	execOpts.FlushOutput()
+	return i.err()
+}
+
+// ExecStreams writes the recorded output of the command to the writers
+func (c *ReplayClient) ExecStreams(cmd string, stdin io.ReadCloser, stdout, stderr io.Writer, opts ...exec.Option) (Waiter, error) {
+	exec.Build(opts...).LogCmd(c.String(), cmd)
+	i, err := c.next(cmd, false)
+	if err != nil {
+		return nil, err
+	}
+	if stdin != nil {
+		_, _ = io.Copy(io.Discard, stdin)
+		_ = stdin.Close()
+	}
+	if stdout != nil {
+		_, _ = stdout.Write(i.Stdout)
+	}
+	if stderr != nil {
+		_, _ = stderr.Write(i.Stderr)
+	}
+	return replayWaiter{err: i.err()}, nil
+}
+
+// ExecInteractive returns the recorded result of the command
+func (c *ReplayClient) ExecInteractive(cmd string) error {
+	i, err := c.next(cmd, true)
+	if err != nil {
+		return err
+	}
+	return i.err()
+}
+
+// ExecInteractiveWithOutput returns the recorded result of the command, no output was recorded
+func (c *ReplayClient) ExecInteractiveWithOutput(cmd string, _ io.Writer) error {
+	return c.ExecInteractive(cmd)
+}
+
+type replayWaiter struct {
+	err error
+}
+
+func (w replayWaiter) Wait() error { return w.err }
+
+// splitLines splits the output into lines without the line breaks
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
@@ -0,0 +1,53 @@
+package rig
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/creasty/defaults"
+	"github.com/k0sproject/rig/exec"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordReplay(t *testing.T) {
+	var recording bytes.Buffer
+	h := Host{
+		Connection: Connection{
+			Custom: &ClientConfig{Name: "record", Client: NewRecordingClient(&Localhost{Enabled: true}, &recording)},
+		},
+	}
+	require.NoError(t, defaults.Set(&h))
+	require.NoError(t, h.Connect())
+	out, err := h.ExecOutput("echo hello; echo world")
+	require.NoError(t, err)
+	require.Equal(t, "hello\nworld", out)
+	err = h.Exec("echo oops >&2; exit 3")
+	require.Error(t, err)
+	h.Disconnect()
+
+	replay, err := NewReplayClient(&recording)
+	require.NoError(t, err)
+	require.Contains(t, replay.Remaining(), "echo hello; echo world")
+	h = Host{
+		Connection: Connection{
+			Custom: &ClientConfig{Name: "replay", Client: replay},
+		},
+	}
+	require.NoError(t, defaults.Set(&h))
+	require.NoError(t, h.Connect())
+	require.Equal(t, "Local", h.Protocol())
+
+	out, err = h.ExecOutput("echo hello; echo world")
+	require.NoError(t, err)
+	require.Equal(t, "hello\nworld", out)
+
+	var stderr string
+	err = h.Exec("echo oops >&2; exit 3", exec.Output(&stderr), exec.OutputStderr())
+	code, ok := exec.ExitCode(err)
+	require.True(t, ok)
+	require.Equal(t, 3, code)
+	require.Equal(t, "oops\n", stderr)
+
+	require.ErrorIs(t, h.Exec("echo hello; echo world"), ErrNotFound)
+	require.Empty(t, replay.Remaining())
+}
@@ -7,29 +7,61 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/k0sproject/rig/errstring"
-	"github.com/k0sproject/rig/log"
+	"github.com/k0sproject/rig/exec"
+	"github.com/k0sproject/rig/os/pkgman"
 	ps "github.com/k0sproject/rig/powershell"
 )
 
 type resolveFunc func(*Connection) (OSVersion, error)
 
+// OSVersionProbe detects the operating system of a host. It returns false when the host is not
+// something the probe knows about, so that the next probe can be tried.
+type OSVersionProbe func(Connection) (OSVersion, bool)
+
 var (
 	// Resolvers exposes an array of resolve functions where you can add your own if you need to detect some OS rig doesn't already know about
 	// (consider making a PR)
 	Resolvers = []resolveFunc{resolveLinux, resolveDarwin, resolveWindows}
 
 	errAbort = errstring.New("base os detected, version resolving failed")
+
+	osVersionProbes   []OSVersionProbe
+	osVersionProbesMu sync.RWMutex
 )
 
+// RegisterOSVersionProbe adds a probe for detecting operating systems rig doesn't know about, such as
+// niche or embedded distributions. Probes registered later are tried before the earlier ones and all
+// of them are tried before the built-in Resolvers.
+func RegisterOSVersionProbe(probe OSVersionProbe) {
+	osVersionProbesMu.Lock()
+	defer osVersionProbesMu.Unlock()
+	osVersionProbes = append([]OSVersionProbe{probe}, osVersionProbes...)
+}
+
+func registeredOSVersionProbes() []OSVersionProbe {
+	osVersionProbesMu.RLock()
+	defer osVersionProbesMu.RUnlock()
+	probes := make([]OSVersionProbe, len(osVersionProbes))
+	copy(probes, osVersionProbes)
+	return probes
+}
+
 type windowsVersion struct {
 	Caption string
 	Version string
 }
 
-// GetOSVersion runs through the Resolvers and tries to figure out the OS version information
+// GetOSVersion runs through the probes registered with RegisterOSVersionProbe and the Resolvers and
+// tries to figure out the OS version information
 func GetOSVersion(conn *Connection) (OSVersion, error) {
+	for _, probe := range registeredOSVersionProbes() {
+		if os, ok := probe(*conn); ok {
+			return os, nil
+		}
+	}
 	for _, r := range Resolvers {
 		os, err := r(conn)
 		if err == nil {
@@ -38,17 +70,17 @@ func GetOSVersion(conn *Connection) (OSVersion, error) {
 		if errors.Is(err, errAbort) {
 			return OSVersion{}, ErrNotSupported.Wrap(err)
 		}
-		log.Tracef("resolver failed: %v", err)
+		conn.Logger().Tracef("resolver failed: %v", err)
 	}
 	return OSVersion{}, ErrNotSupported.Wrapf("unable to determine host os")
 }
 
 func resolveLinux(conn *Connection) (OSVersion, error) {
-	if err := conn.Exec("uname | grep -q Linux"); err != nil {
+	if err := conn.Exec("uname | grep -q Linux", exec.Internal()); err != nil {
 		return OSVersion{}, ErrCommandFailed.Wrapf("not a linux host: %w", err)
 	}
 
-	output, err := conn.ExecOutput("cat /etc/os-release || cat /usr/lib/os-release")
+	output, err := conn.ExecOutput("cat /etc/os-release || cat /usr/lib/os-release", exec.Internal())
 	if err != nil {
 		// at this point it is known that this is a linux host, so any error from here on should signal the resolver to not try the next
 		return OSVersion{}, errAbort.Wrapf("unable to read os-release file: %w", err)
@@ -67,7 +99,7 @@ func resolveWindows(conn *Connection) (OSVersion, error) {
 	}
 
 	script := ps.Cmd("Get-CimInstance -ClassName Win32_OperatingSystem | Select-Object Caption, Version | ConvertTo-Json")
-	output, err := conn.ExecOutput(script)
+	output, err := conn.ExecOutput(script, exec.Internal())
 	if err != nil {
 		return OSVersion{}, errAbort.Wrapf("unable to get windows version: %w", err)
 	}
@@ -84,18 +116,18 @@ func resolveWindows(conn *Connection) (OSVersion, error) {
 }
 
 func resolveDarwin(conn *Connection) (OSVersion, error) {
-	if err := conn.Exec("uname | grep -q Darwin"); err != nil {
+	if err := conn.Exec("uname | grep -q Darwin", exec.Internal()); err != nil {
 		return OSVersion{}, ErrCommandFailed.Wrapf("not a darwin host: %w", err)
 	}
 
 	// at this point it is known that this is a windows host, so any error from here on should signal the resolver to not try the next
-	version, err := conn.ExecOutput("sw_vers -productVersion")
+	version, err := conn.ExecOutput("sw_vers -productVersion", exec.Internal())
 	if err != nil {
 		return OSVersion{}, errAbort.Wrapf("unable to determine darwin version: %w", err)
 	}
 
 	var name string
-	if n, err := conn.ExecOutput(`grep "SOFTWARE LICENSE AGREEMENT FOR " "/System/Library/CoreServices/Setup Assistant.app/Contents/Resources/en.lproj/OSXSoftwareLicense.rtf" | sed -E "s/^.*SOFTWARE LICENSE AGREEMENT FOR (.+)\\\/\1/"`); err == nil {
+	if n, err := conn.ExecOutput(`grep "SOFTWARE LICENSE AGREEMENT FOR " "/System/Library/CoreServices/Setup Assistant.app/Contents/Resources/en.lproj/OSXSoftwareLicense.rtf" | sed -E "s/^.*SOFTWARE LICENSE AGREEMENT FOR (.+)\\\/\1/"`, exec.Internal()); err == nil {
 		name = fmt.Sprintf("%s %s", n, version)
 	}
 
@@ -109,6 +141,43 @@ func resolveDarwin(conn *Connection) (OSVersion, error) {
 	return os, nil
 }
 
+// hostDetailsScript prints the architecture, kernel version, init system and package manager, one per line
+var hostDetailsScript = `uname -m; uname -r
+if [ -d /run/systemd/system ]; then echo systemd
+elif command -v openrc-init > /dev/null 2>&1 || grep ::sysinit: /etc/inittab 2> /dev/null | grep -q openrc; then echo openrc
+elif [ -e /sbin/upstart-udev-bridge ]; then echo upstart
+elif [ "$(uname)" = Darwin ]; then echo launchd
+elif [ -d /etc/init.d ]; then echo sysvinit
+else echo; fi
+` + pkgman.DetectScript(false)
+
+var hostDetailsScriptWindows = ps.Cmd(`$env:PROCESSOR_ARCHITECTURE; [Environment]::OSVersion.Version.ToString(); 'windows'; ` + pkgman.DetectScript(true))
+
+// resolveHostDetails fills in the architecture, kernel version, init system and package manager
+// fields of the version that are not already set
+func resolveHostDetails(conn *Connection, version *OSVersion) error {
+	script := hostDetailsScript
+	if conn.IsWindows() {
+		script = hostDetailsScriptWindows
+	}
+	output, err := conn.ExecOutput(script, exec.HideOutput(), exec.Internal())
+	if err != nil {
+		return ErrCommandFailed.Wrapf("unable to resolve host details: %w", err)
+	}
+	parseHostDetails(output, version)
+	return nil
+}
+
+func parseHostDetails(output string, version *OSVersion) {
+	lines := strings.Split(strings.ReplaceAll(output, "\r\n", "\n"), "\n")
+	fields := []*string{&version.Arch, &version.KernelVersion, &version.InitSystem, &version.PackageManager}
+	for i, field := range fields {
+		if *field == "" && i < len(lines) {
+			*field = strings.TrimSpace(lines[i])
+		}
+	}
+}
+
 func unquote(s string) string {
 	if u, err := strconv.Unquote(s); err == nil {
 		return u
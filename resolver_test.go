@@ -0,0 +1,71 @@
+package rig
+
+import (
+	"fmt"
+	osexec "os/exec"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/creasty/defaults"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHostDetails(t *testing.T) {
+	var version OSVersion
+	parseHostDetails("AMD64\r\n10.0.20348\r\nwindows\r\nchoco", &version)
+	require.Equal(t, OSVersion{Arch: "AMD64", KernelVersion: "10.0.20348", InitSystem: "windows", PackageManager: "choco"}, version)
+
+	version = OSVersion{Arch: "aarch64"}
+	parseHostDetails("x86_64\n6.1.0\n", &version)
+	require.Equal(t, OSVersion{Arch: "aarch64", KernelVersion: "6.1.0"}, version, "the fields that are set are kept")
+}
+
+// detailsClient answers the os release and host details commands of a linux host
+func detailsClient(details string, detailsErr error) *scriptClient {
+	return &scriptClient{respond: func(cmd string) (string, string, error) {
+		switch {
+		case cmd == "uname | grep -q Linux":
+			return "", "", nil
+		case strings.Contains(cmd, "/etc/os-release"):
+			return "ID=debian\nVERSION_ID=\"12\"\n", "", nil
+		case cmd == hostDetailsScript:
+			return details, "", detailsErr
+		default:
+			return "", "", fmt.Errorf("failed")
+		}
+	}}
+}
+
+func TestHostDetails(t *testing.T) {
+	c := &Connection{Custom: &ClientConfig{Name: "script", Client: detailsClient("x86_64\n6.1.0-18-amd64\nsystemd\napt\n", nil)}}
+	require.NoError(t, c.Connect())
+	require.Equal(t, "debian", c.OSVersion.ID)
+	require.Equal(t, "x86_64", c.OSVersion.Arch)
+	require.Equal(t, "6.1.0-18-amd64", c.OSVersion.KernelVersion)
+	require.Equal(t, "systemd", c.OSVersion.InitSystem)
+	require.Equal(t, "apt", c.OSVersion.PackageManager)
+
+	c = &Connection{Custom: &ClientConfig{Name: "script", Client: detailsClient("", fmt.Errorf("failed"))}}
+	require.NoError(t, c.Connect(), "failing to get the details does not fail the connection")
+	require.Equal(t, "debian", c.OSVersion.ID)
+	require.Empty(t, c.OSVersion.Arch)
+}
+
+func TestHostDetailsLocalhost(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("compares against uname on linux")
+	}
+	c := &Connection{Localhost: &Localhost{Enabled: true}}
+	require.NoError(t, defaults.Set(c))
+	require.NoError(t, c.Connect())
+	t.Cleanup(func() { _ = c.Disconnect() })
+
+	arch, err := osexec.Command("uname", "-m").Output()
+	require.NoError(t, err)
+	kernel, err := osexec.Command("uname", "-r").Output()
+	require.NoError(t, err)
+	require.Equal(t, strings.TrimSpace(string(arch)), c.OSVersion.Arch)
+	require.Equal(t, strings.TrimSpace(string(kernel)), c.OSVersion.KernelVersion)
+	require.Contains(t, []string{"systemd", "openrc", "upstart", "sysvinit", ""}, c.OSVersion.InitSystem)
+}
@@ -0,0 +1,41 @@
+// Package rigfs provides an io/fs.FS adapter for accessing the filesystem of a host through a rig.Connection,
+// so that libraries operating on fs.FS can be used transparently on remote hosts.
+package rigfs
+
+import (
+	"io/fs"
+
+	"github.com/k0sproject/rig"
+)
+
+// Check interfaces
+var (
+	_ fs.FS         = &FS{}
+	_ fs.StatFS     = &FS{}
+	_ fs.ReadDirFS  = &FS{}
+	_ fs.ReadFileFS = &FS{}
+	_ fs.GlobFS     = &FS{}
+	_ fs.SubFS      = &FS{}
+	_ WriteFileFS   = &FS{}
+)
+
+// WriteFileFS is the interface implemented by a file system that supports writing whole files
+type WriteFileFS interface {
+	fs.FS
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+}
+
+// FS is an fs.FS implementation rooted at a directory on a remote host. Paths given to the methods
+// must be valid fs.FS paths: unrooted, slash-separated and relative to the root. It is the same
+// filesystem that rig.FS.Sub returns.
+type FS = rig.DirFS
+
+// New returns an FS for the filesystem of the connection's host, rooted at root
+func New(conn *rig.Connection, root string) *FS {
+	return rig.NewDirFS(conn.Fsys(), root)
+}
+
+// NewSudo is like New but the files are accessed with elevated privileges
+func NewSudo(conn *rig.Connection, root string) *FS {
+	return rig.NewDirFS(conn.SudoFsys(), root)
+}
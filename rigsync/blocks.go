@@ -0,0 +1,56 @@
+package rigsync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+
+	"github.com/k0sproject/rig"
+)
+
+type byteRange struct {
+	offset int64
+	length int64
+}
+
+// blockSums returns the hex encoded sha256 checksums of the consecutive blocks read from r
+func blockSums(r io.Reader, blockSize int64) ([]string, error) {
+	var sums []string
+	buf := make([]byte, blockSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			sum := sha256.Sum256(buf[:n])
+			sums = append(sums, hex.EncodeToString(sum[:]))
+		}
+		switch {
+		case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+			return sums, nil
+		case err != nil:
+			return nil, rig.ErrOS.Wrapf("read block %d: %w", len(sums), err)
+		}
+	}
+}
+
+// diffBlocks returns the byte ranges of a file of size bytes where the local block checksums differ
+// from the remote ones, merging adjacent blocks
+func diffBlocks(local, remote []string, blockSize, size int64) []byteRange {
+	var ranges []byteRange
+	for i, sum := range local {
+		if i < len(remote) && remote[i] == sum {
+			continue
+		}
+		offset := int64(i) * blockSize
+		length := blockSize
+		if offset+length > size {
+			length = size - offset
+		}
+		if last := len(ranges) - 1; last >= 0 && ranges[last].offset+ranges[last].length == offset {
+			ranges[last].length += length
+			continue
+		}
+		ranges = append(ranges, byteRange{offset: offset, length: length})
+	}
+	return ranges
+}
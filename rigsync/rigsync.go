@@ -0,0 +1,296 @@
+// Package rigsync provides rsync style synchronization of local directory trees to remote hosts. Only
+// the files that differ from the remote copies are transferred.
+package rigsync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/k0sproject/rig"
+	"github.com/k0sproject/rig/exec"
+	"github.com/k0sproject/rig/log"
+)
+
+// Option is a functional option for Upload
+type Option func(*options)
+
+type options struct {
+	checksum  bool
+	delete    bool
+	dryRun    bool
+	exclude   []string
+	deltaSize int64
+	execOpts  []exec.Option
+}
+
+// Checksum makes Upload compare the checksums of the files instead of their sizes and modification
+// times. This is slower but detects changes that did not touch the modification time.
+func Checksum() Option {
+	return func(o *options) {
+		o.checksum = true
+	}
+}
+
+// Delete makes Upload remove the remote files and directories that do not exist in the local tree
+func Delete() Option {
+	return func(o *options) {
+		o.delete = true
+	}
+}
+
+// DryRun makes Upload only report the changes it would make
+func DryRun() Option {
+	return func(o *options) {
+		o.dryRun = true
+	}
+}
+
+// Exclude skips the files and directories with a name or a relative slash separated path matching
+// any of the path.Match patterns. Excluded remote files are not deleted.
+func Exclude(patterns ...string) Option {
+	return func(o *options) {
+		o.exclude = append(o.exclude, patterns...)
+	}
+}
+
+// Delta makes Upload update changed files of at least minSize bytes in place by comparing the
+// checksums of fixed size blocks of the local and the remote file and only sending the blocks that
+// differ. This greatly reduces the amount of data sent for large files with small changes, such as
+// disk images and appended log files.
+func Delta(minSize int64) Option {
+	return func(o *options) {
+		o.deltaSize = minSize
+	}
+}
+
+// ExecOptions sets the exec options used for the remote operations, such as exec.Sudo
+func ExecOptions(opts ...exec.Option) Option {
+	return func(o *options) {
+		o.execOpts = append(o.execOpts, opts...)
+	}
+}
+
+func buildOptions(opts ...Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Summary describes the changes made by Upload. The paths are relative to the synchronized
+// directories and slash separated.
+type Summary struct {
+	Created   []string
+	Updated   []string
+	Deleted   []string
+	Unchanged int
+	BytesSent int64
+}
+
+// Changed returns true if any files were created, updated or deleted
+func (s *Summary) Changed() bool {
+	return len(s.Created) > 0 || len(s.Updated) > 0 || len(s.Deleted) > 0
+}
+
+// String returns a short description of the changes
+func (s *Summary) String() string {
+	return fmt.Sprintf("%d created, %d updated, %d deleted, %d unchanged, %d bytes sent", len(s.Created), len(s.Updated), len(s.Deleted), s.Unchanged, s.BytesSent)
+}
+
+// entry is a file or a directory in a tree
+type entry struct {
+	info fs.FileInfo
+	sum  string
+}
+
+// Upload synchronizes the contents of the local directory src into the remote directory dst, which is
+// created if it doesn't exist. Regular files that are missing or differ from the local ones are
+// uploaded and get the mode and the modification time of the local file. Other kinds of files, such
+// as symlinks, are skipped.
+func Upload(conn *rig.Connection, src, dst string, opts ...Option) (*Summary, error) {
+	o := buildOptions(opts...)
+	fsys := conn.Fsys()
+	if exec.Build(o.execOpts...).Sudo {
+		fsys = conn.SudoFsys()
+	}
+	dst = strings.TrimSuffix(strings.ReplaceAll(dst, `\`, "/"), "/")
+
+	local, err := localTree(src, o, conn.Logger())
+	if err != nil {
+		return nil, err
+	}
+	remote, err := remoteTree(fsys, dst, o)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &syncer{conn: conn, fsys: fsys, src: src, dst: dst, opts: o, summary: &Summary{}}
+	if err := s.upload(local, remote); err != nil {
+		return s.summary, err
+	}
+	if o.delete {
+		if err := s.deleteExtra(local, remote); err != nil {
+			return s.summary, err
+		}
+	}
+	conn.Logger().Debugf("%s: sync %s to %s: %s", conn, src, dst, s.summary)
+
+	return s.summary, nil
+}
+
+// excluded returns true if the relative path or its base name match any of the exclude patterns
+func (o *options) excluded(rel string) bool {
+	for _, pattern := range o.exclude {
+		if ok, _ := path.Match(pattern, rel); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, path.Base(rel)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// localTree returns the files and directories under root keyed by their relative slash separated paths,
+// logging the skipped files to logger
+func localTree(root string, o *options, logger log.Logger) (map[string]*entry, error) {
+	tree := make(map[string]*entry)
+	err := filepath.WalkDir(root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, name)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		if rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if o.excluded(rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() && !d.Type().IsRegular() {
+			logger.Debugf("sync: skipping %s: not a regular file", name)
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		tree[rel] = &entry{info: info}
+		return nil
+	})
+	if err != nil {
+		return nil, rig.ErrInvalidPath.Wrapf("walk local directory %s: %w", root, err)
+	}
+	if o.checksum {
+		for rel, e := range tree {
+			if e.info.IsDir() {
+				continue
+			}
+			if e.sum, err = localSum(filepath.Join(root, filepath.FromSlash(rel))); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return tree, nil
+}
+
+// remoteTree returns the files and directories under root on the remote host. An empty tree is
+// returned if root does not exist.
+func remoteTree(fsys rig.FS, root string, o *options) (map[string]*entry, error) {
+	tree := make(map[string]*entry)
+	err := fsys.WalkDir(root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(name, root), "/")
+		if rel == "" {
+			if !d.IsDir() {
+				return rig.ErrInvalidPath.Wrapf("%s is not a directory", root)
+			}
+			return nil
+		}
+		if o.excluded(rel) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		tree[rel] = &entry{info: info}
+		return nil
+	})
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return tree, nil
+	case err != nil:
+		return nil, rig.ErrCommandFailed.Wrapf("walk remote directory %s: %w", root, err)
+	}
+
+	if o.checksum {
+		manifest, err := fsys.Manifest(root)
+		if err != nil {
+			return nil, rig.ErrCommandFailed.Wrapf("get remote checksums: %w", err)
+		}
+		for _, m := range manifest {
+			if e, ok := tree[m.Path]; ok {
+				e.sum = m.Sha256
+			}
+		}
+	}
+	return tree, nil
+}
+
+// localSum returns the hex encoded sha256 checksum of a local file
+func localSum(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", rig.ErrInvalidPath.Wrap(err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", rig.ErrOS.Wrapf("calculate checksum of %s: %w", name, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// equal returns true if the remote file does not need to be updated
+func (o *options) equal(local, remote *entry) bool {
+	if remote.info.IsDir() || !remote.info.Mode().IsRegular() || local.info.Size() != remote.info.Size() {
+		return false
+	}
+	if o.checksum {
+		return local.sum == remote.sum
+	}
+	return local.info.ModTime().Truncate(time.Second).Equal(remote.info.ModTime().Truncate(time.Second))
+}
+
+// sortedPaths returns the keys of the tree in lexical order, which puts directories before their contents
+func sortedPaths(tree map[string]*entry) []string {
+	paths := make([]string, 0, len(tree))
+	for rel := range tree {
+		paths = append(paths, rel)
+	}
+	sort.Strings(paths)
+	return paths
+}
@@ -0,0 +1,38 @@
+package rigsync
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffBlocks(t *testing.T) {
+	remote, err := blockSums(bytes.NewReader([]byte("aaaabbbbccccdd")), 4)
+	require.NoError(t, err)
+	require.Len(t, remote, 4)
+
+	data := []byte("aaaaBBBBCCCCdd12345")
+	local, err := blockSums(bytes.NewReader(data), 4)
+	require.NoError(t, err)
+	require.Len(t, local, 5)
+	ranges := diffBlocks(local, remote, 4, int64(len(data)))
+	require.Equal(t, []byteRange{{offset: 4, length: 15}}, ranges, "adjacent blocks are merged")
+
+	data = []byte("aaaaBBBBccccdd")
+	local, err = blockSums(bytes.NewReader(data), 4)
+	require.NoError(t, err)
+	ranges = diffBlocks(local, remote, 4, int64(len(data)))
+	require.Equal(t, []byteRange{{offset: 4, length: 4}}, ranges)
+
+	require.Empty(t, diffBlocks(remote, remote, 4, 14))
+}
+
+func TestExcluded(t *testing.T) {
+	o := buildOptions(Exclude("*.tmp", "cache/*"))
+	require.True(t, o.excluded("foo.tmp"))
+	require.True(t, o.excluded("a/b/foo.tmp"))
+	require.True(t, o.excluded("cache/data"))
+	require.False(t, o.excluded("a/cache/data"))
+	require.False(t, o.excluded("foo.txt"))
+}
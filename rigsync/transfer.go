@@ -0,0 +1,235 @@
+package rigsync
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/alessio/shellescape"
+	"github.com/k0sproject/rig"
+	"github.com/k0sproject/rig/exec"
+	ps "github.com/k0sproject/rig/powershell"
+)
+
+// defaultBlockSize is the size of the blocks compared in delta transfers
+const defaultBlockSize = 1 << 20
+
+type syncer struct {
+	conn    *rig.Connection
+	fsys    rig.FS
+	src     string
+	dst     string
+	opts    *options
+	summary *Summary
+}
+
+func (s *syncer) localPath(rel string) string {
+	return filepath.Join(s.src, filepath.FromSlash(rel))
+}
+
+func (s *syncer) remotePath(rel string) string {
+	return path.Join(s.dst, rel)
+}
+
+// upload creates the missing directories and transfers the files that differ
+func (s *syncer) upload(local, remote map[string]*entry) error {
+	if !s.opts.dryRun {
+		if err := s.fsys.MkdirAll(s.dst, 0o755); err != nil {
+			return rig.ErrUploadFailed.Wrap(err)
+		}
+	}
+	for _, rel := range sortedPaths(local) {
+		l := local[rel]
+		r, exists := remote[rel]
+		if l.info.IsDir() {
+			if err := s.mkdir(rel, l, r); err != nil {
+				return err
+			}
+			continue
+		}
+		switch {
+		case !exists:
+			s.summary.Created = append(s.summary.Created, rel)
+		case s.opts.equal(l, r):
+			s.summary.Unchanged++
+			continue
+		default:
+			s.summary.Updated = append(s.summary.Updated, rel)
+		}
+		if s.opts.dryRun {
+			s.summary.BytesSent += l.info.Size()
+			continue
+		}
+		if err := s.uploadFile(rel, l, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mkdir creates a directory that is missing from the remote tree, replacing a file in its place
+func (s *syncer) mkdir(rel string, local, remote *entry) error {
+	if remote != nil && remote.info.IsDir() {
+		return nil
+	}
+	s.summary.Created = append(s.summary.Created, rel+"/")
+	if s.opts.dryRun {
+		return nil
+	}
+	if remote != nil {
+		if err := s.fsys.Remove(s.remotePath(rel)); err != nil {
+			return rig.ErrUploadFailed.Wrap(err)
+		}
+	}
+	if err := s.fsys.MkdirAll(s.remotePath(rel), local.info.Mode().Perm()); err != nil {
+		return rig.ErrUploadFailed.Wrap(err)
+	}
+	return nil
+}
+
+// uploadFile transfers a file using a delta transfer when possible and a full upload otherwise
+func (s *syncer) uploadFile(rel string, local, remote *entry) error {
+	dst := s.remotePath(rel)
+	if remote != nil && remote.info.IsDir() {
+		if err := s.fsys.RemoveAll(dst); err != nil {
+			return rig.ErrUploadFailed.Wrap(err)
+		}
+		remote = nil
+	}
+
+	if s.opts.deltaSize > 0 && remote != nil && local.info.Size() >= s.opts.deltaSize && local.info.Size() >= remote.info.Size() {
+		sent, err := s.uploadDelta(rel, local, remote)
+		if err == nil {
+			s.summary.BytesSent += sent
+			return s.setAttributes(dst, local)
+		}
+		s.conn.Logger().Debugf("%s: delta transfer of %s failed, uploading the whole file: %v", s.conn, dst, err)
+	}
+
+	if err := s.conn.Upload(s.localPath(rel), dst, append(s.opts.execOpts, exec.PreserveTimes())...); err != nil {
+		return err //nolint:wrapcheck
+	}
+	s.summary.BytesSent += local.info.Size()
+	return nil
+}
+
+// setAttributes applies the mode and modification time of the local file to the remote file
+func (s *syncer) setAttributes(dst string, local *entry) error {
+	if err := s.fsys.Chmod(dst, local.info.Mode().Perm()); err != nil {
+		return rig.ErrUploadFailed.Wrap(err)
+	}
+	if err := s.fsys.Chtimes(dst, local.info.ModTime(), local.info.ModTime()); err != nil {
+		return rig.ErrUploadFailed.Wrap(err)
+	}
+	return nil
+}
+
+// uploadDelta compares the block checksums of the local and the remote file and writes the blocks
+// that differ into the remote file. Returns the number of bytes sent.
+func (s *syncer) uploadDelta(rel string, local, remote *entry) (int64, error) {
+	dst := s.remotePath(rel)
+	remoteSums, err := remoteBlockSums(s.conn, dst, defaultBlockSize, s.opts.execOpts...)
+	if err != nil {
+		return 0, err
+	}
+
+	f, err := os.Open(s.localPath(rel))
+	if err != nil {
+		return 0, rig.ErrInvalidPath.Wrap(err)
+	}
+	defer f.Close()
+
+	localSums, err := blockSums(f, defaultBlockSize)
+	if err != nil {
+		return 0, err
+	}
+	ranges := diffBlocks(localSums, remoteSums, defaultBlockSize, local.info.Size())
+	s.conn.Logger().Debugf("%s: delta transfer of %s: %d of %d blocks differ", s.conn, dst, len(ranges), len(localSums))
+
+	var sent int64
+	for _, r := range ranges {
+		if err := s.writeRange(f, dst, r); err != nil {
+			return sent, err
+		}
+		sent += r.length
+	}
+
+	sum, err := localSum(s.localPath(rel))
+	if err != nil {
+		return sent, err
+	}
+	remoteSum, err := s.fsys.Sha256(dst)
+	if err != nil {
+		return sent, rig.ErrCommandFailed.Wrapf("get checksum of %s: %w", dst, err)
+	}
+	if sum != remoteSum {
+		return sent, rig.ErrChecksumMismatch.Wrapf("%s: local %s, remote %s", dst, sum, remoteSum)
+	}
+	return sent, nil
+}
+
+// writeRange writes a byte range of the local file into the same position of the remote file
+func (s *syncer) writeRange(local io.ReaderAt, dst string, r byteRange) error {
+	remote, err := s.fsys.OpenFile(dst, rig.ModeReadWrite, 0)
+	if err != nil {
+		return rig.ErrInvalidPath.Wrapf("open remote file for writing: %w", err)
+	}
+	defer remote.Close()
+	if _, err := remote.Seek(r.offset, io.SeekStart); err != nil {
+		return rig.ErrUploadFailed.Wrapf("seek %s: %w", dst, err)
+	}
+	if _, err := remote.CopyFromN(io.NewSectionReader(local, r.offset, r.length), r.length, nil); err != nil {
+		return rig.ErrUploadFailed.Wrapf("write %s at offset %d: %w", dst, r.offset, err)
+	}
+	return remote.Close() //nolint:wrapcheck
+}
+
+// deleteExtra removes the remote files and directories that do not exist in the local tree
+func (s *syncer) deleteExtra(local, remote map[string]*entry) error {
+	var removed string
+	for _, rel := range sortedPaths(remote) {
+		if _, ok := local[rel]; ok {
+			continue
+		}
+		// the contents of removed directories go with them
+		if removed != "" && strings.HasPrefix(rel, removed+"/") {
+			continue
+		}
+		if l, ok := local[path.Dir(rel)]; path.Dir(rel) != "." && ok && !l.info.IsDir() {
+			// the parent directory was replaced with a file
+			continue
+		}
+		name := rel
+		if remote[rel].info.IsDir() {
+			name += "/"
+			removed = rel
+		}
+		s.summary.Deleted = append(s.summary.Deleted, name)
+		if s.opts.dryRun {
+			continue
+		}
+		if err := s.fsys.RemoveAll(s.remotePath(rel)); err != nil {
+			return rig.ErrCommandFailed.Wrap(err)
+		}
+	}
+	return nil
+}
+
+// remoteBlockSums returns the hex encoded sha256 checksums of the consecutive blocks of a remote file
+func remoteBlockSums(conn *rig.Connection, name string, blockSize int64, opts ...exec.Option) ([]string, error) {
+	var cmd string
+	if conn.IsWindows() {
+		cmd = ps.Cmd(fmt.Sprintf(`$f = [IO.File]::OpenRead(%s); $h = [Security.Cryptography.SHA256]::Create(); $b = New-Object byte[] %d; while (($n = $f.Read($b, 0, $b.Length)) -gt 0) { [BitConverter]::ToString($h.ComputeHash($b, 0, $n)).Replace('-', '').ToLower() }; $f.Close()`, ps.SingleQuote(name), blockSize))
+	} else {
+		script := fmt.Sprintf(`f=%s; n=$(( ($(wc -c < "$f") + %[2]d - 1) / %[2]d )); i=0; while [ "$i" -lt "$n" ]; do dd if="$f" bs=%[2]d skip="$i" count=1 2>/dev/null | sha256sum | cut -d" " -f1; i=$((i+1)); done`, shellescape.Quote(name), blockSize)
+		cmd = "sh -c " + shellescape.Quote(script)
+	}
+	out, err := conn.ExecOutput(cmd, opts...)
+	if err != nil {
+		return nil, rig.ErrCommandFailed.Wrapf("get block checksums of %s: %w", name, err)
+	}
+	return strings.Fields(out), nil
+}
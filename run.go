@@ -0,0 +1,88 @@
+package rig
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/k0sproject/rig/exec"
+	"github.com/k0sproject/rig/pkg/clock"
+)
+
+// Result is the outcome of a command run using Connection.Run
+type Result struct {
+	// Command is the redacted command as it was sent to the host, after applying the shell, the
+	// environment, the working directory and the privilege elevation from the exec options
+	Command string
+	// Stdout is the standard output of the command. On hosts where a PTY is used, such as linux over
+	// SSH, the output of stderr is received here as well.
+	Stdout string
+	// Stderr is the standard error output of the command
+	Stderr string
+	// ExitCode is the exit code of the command or -1 if the command failed without one, for example
+	// when the connection was lost
+	ExitCode int
+	// Duration is the time it took to run the command
+	Duration time.Duration
+}
+
+// Run runs a command on the host and returns the outputs, the exit code and the duration of the
+// command. When the command fails, the result is returned along with the error. Only the result of the
+// last attempt is returned when using exec.Retries.
+func (c Connection) Run(cmd string, opts ...exec.Option) (*Result, error) {
+	if err := c.checkConnected(); err != nil {
+		return nil, err
+	}
+
+	var (
+		mu             sync.Mutex
+		stdout, stderr strings.Builder
+	)
+	lineFunc := exec.Build(opts...).OutputLineFunc
+	opts = append(opts[:len(opts):len(opts)], exec.OnOutputLine(func(line string, isStderr bool) {
+		if lineFunc != nil {
+			lineFunc(line, isStderr)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if isStderr {
+			stderr.WriteString(line + "\n")
+		} else {
+			stdout.WriteString(line + "\n")
+		}
+	}))
+
+	opts = withCorrelationID(opts)
+	var res *Result
+	err := c.withRetries(opts, func() error {
+		stdout.Reset()
+		stderr.Reset()
+		rendered, runOpts, err := c.command(cmd, opts)
+		if err != nil {
+			return err
+		}
+		execOpts := exec.Build(runOpts...)
+		if rendered, err = execOpts.Command(rendered); err != nil {
+			return ErrCommandFailed.Wrapf("build command: %w", err)
+		}
+
+		res = &Result{Command: execOpts.Redact(rendered)}
+		runOpts, span := c.startExecSpan(rendered, withoutSudo(runOpts))
+		start := clock.Default.Now()
+		err = c.client.Exec(rendered, runOpts...)
+		res.Duration = clock.Default.Since(start)
+		c.execDone(rendered, runOpts, start, span, err)
+		res.Stdout = strings.TrimSpace(stdout.String())
+		res.Stderr = strings.TrimSpace(stderr.String())
+		if err != nil {
+			res.ExitCode = -1
+			if code, ok := exec.ExitCode(err); ok {
+				res.ExitCode = code
+			}
+			return ErrCommandFailed.Wrapf("client exec: %w", err)
+		}
+		return nil
+	})
+
+	return res, c.correlateError(opts, err)
+}
@@ -0,0 +1,50 @@
+package rig
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/k0sproject/rig/exec"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	client := &scriptClient{respond: func(cmd string) (string, string, error) {
+		switch cmd {
+		case "make":
+			return "building\ndone\n", "warning: deprecated\n", nil
+		case "make test":
+			return "FAIL\n", "1 test failed\n", &exitError{code: 2}
+		case "make deploy --token s3cret":
+			return "", "", errors.New("connection lost")
+		}
+		return "", "", nil
+	}}
+	c := newScriptConnection(t, client)
+
+	var lines []string
+	res, err := c.Run("make", exec.OnOutputLine(func(line string, _ bool) { lines = append(lines, line) }))
+	require.NoError(t, err)
+	require.Equal(t, "make", res.Command)
+	require.Equal(t, "building\ndone", res.Stdout)
+	require.Equal(t, "warning: deprecated", res.Stderr)
+	require.Zero(t, res.ExitCode)
+	require.ElementsMatch(t, []string{"building", "done", "warning: deprecated"}, lines, "the lines are passed on to the function of the caller")
+
+	res, err = c.Run("make test")
+	require.ErrorIs(t, err, ErrCommandFailed)
+	require.NotNil(t, res, "the result is returned along with the error")
+	require.Equal(t, 2, res.ExitCode)
+	require.Equal(t, "FAIL", res.Stdout)
+	require.Equal(t, "1 test failed", res.Stderr)
+
+	res, err = c.Run("make deploy --token s3cret", exec.RedactString("s3cret"))
+	require.ErrorIs(t, err, ErrCommandFailed)
+	require.Equal(t, -1, res.ExitCode, "no exit code when the command failed without one")
+	require.Equal(t, "make deploy --token [REDACTED]", res.Command)
+
+	require.NoError(t, c.Disconnect())
+	res, err = c.Run("make")
+	require.ErrorIs(t, err, ErrNotConnected)
+	require.Nil(t, res)
+}
@@ -0,0 +1,210 @@
+package rig
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/alessio/shellescape"
+	"github.com/k0sproject/rig/exec"
+	"github.com/k0sproject/rig/log"
+)
+
+// scp protocol response codes
+const (
+	scpOK      = 0
+	scpWarning = 1
+	scpError   = 2
+)
+
+// UploadSCP copies a file from a local path src to the remote host path dst using the scp protocol.
+// It only requires the scp binary to be present on the remote host, which makes it usable on minimal
+// servers and network appliances that lack the tools the regular file transfers depend on. Upload
+// falls back to this automatically when needed, see TransferStrategy.
+func (c *Connection) UploadSCP(src, dst string, opts ...exec.Option) error {
+	if err := c.checkConnected(); err != nil {
+		return err
+	}
+
+	local, err := os.Open(src)
+	if err != nil {
+		return ErrInvalidPath.Wrap(err)
+	}
+	defer local.Close()
+
+	stat, err := local.Stat()
+	if err != nil {
+		return ErrInvalidPath.Wrapf("stat local file %s: %w", src, err)
+	}
+	if stat.IsDir() {
+		return ErrInvalidPath.Wrapf("%s is a directory", src)
+	}
+
+	if err := c.scp("scp -t -- "+shellescape.Quote(dst), func(w io.Writer, r *bufio.Reader) error {
+		src := io.TeeReader(local, exec.ProgressWriter(exec.Build(opts...).Progress, stat.Size()))
+		return scpSend(w, r, src, stat.Mode().Perm(), stat.Size(), path.Base(dst))
+	}, opts...); err != nil {
+		return ErrUploadFailed.Wrap(err)
+	}
+
+	return nil
+}
+
+// DownloadSCP copies a file from the remote host path src to the local path dst using the scp protocol.
+// See UploadSCP.
+func (c *Connection) DownloadSCP(src, dst string, opts ...exec.Option) error {
+	if err := c.checkConnected(); err != nil {
+		return err
+	}
+
+	if err := c.scp("scp -f -- "+shellescape.Quote(src), func(w io.Writer, r *bufio.Reader) error {
+		return scpReceive(w, r, dst, exec.Build(opts...).Progress, c.Logger())
+	}, opts...); err != nil {
+		return ErrDownloadFailed.Wrap(err)
+	}
+
+	return nil
+}
+
+// scp runs an scp command on the remote host and lets fn speak the protocol over its stdin and stdout
+func (c *Connection) scp(cmd string, fn func(w io.Writer, r *bufio.Reader) error, opts ...exec.Option) error {
+	stdinR, stdinW := io.Pipe()
+	stdoutR, stdoutW := io.Pipe()
+	errbuf := bytes.NewBuffer(nil)
+
+	waiter, err := c.ExecStreams(cmd, stdinR, stdoutW, errbuf, opts...)
+	if err != nil {
+		return ErrCommandFailed.Wrapf("start scp: %w", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		err := waiter.Wait()
+		// unblock the protocol handler if the remote process exits prematurely
+		_ = stdoutW.Close()
+		_ = stdinR.Close()
+		done <- err
+	}()
+
+	protoErr := fn(stdinW, bufio.NewReader(stdoutR))
+	_ = stdinW.Close()
+	_, _ = io.Copy(io.Discard, stdoutR)
+
+	waitErr := <-done
+	if protoErr != nil {
+		return protoErr
+	}
+	if waitErr != nil {
+		return ErrCommandFailed.Wrapf("scp: %w (%s)", waitErr, strings.TrimSpace(errbuf.String()))
+	}
+
+	return nil
+}
+
+// scpAck reads a response from the remote scp process
+func scpAck(r *bufio.Reader) error {
+	code, err := r.ReadByte()
+	if err != nil {
+		return ErrCommandFailed.Wrapf("read response: %w", err)
+	}
+	switch code {
+	case scpOK:
+		return nil
+	case scpWarning, scpError:
+		msg, _ := r.ReadString('\n')
+		return ErrCommandFailed.Wrapf("remote: %s", strings.TrimSpace(msg))
+	default:
+		return ErrCommandFailed.Wrapf("unexpected response code %d", code)
+	}
+}
+
+// scpSend performs the source side of an scp file transfer
+func scpSend(w io.Writer, r *bufio.Reader, src io.Reader, perm os.FileMode, size int64, name string) error {
+	if err := scpAck(r); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "C%04o %d %s\n", perm, size, name); err != nil {
+		return ErrCommandFailed.Wrapf("send file header: %w", err)
+	}
+	if err := scpAck(r); err != nil {
+		return err
+	}
+	if _, err := io.CopyN(w, src, size); err != nil {
+		return ErrCommandFailed.Wrapf("send file content: %w", err)
+	}
+	if _, err := w.Write([]byte{scpOK}); err != nil {
+		return ErrCommandFailed.Wrapf("send end of file: %w", err)
+	}
+	return scpAck(r)
+}
+
+// scpHeader parses a "C<mode> <size> <name>" file header
+func scpHeader(line string) (os.FileMode, int64, error) {
+	fields := strings.SplitN(strings.TrimSuffix(line, "\n"), " ", 3)
+	if len(fields) != 3 || !strings.HasPrefix(fields[0], "C") {
+		return 0, 0, ErrCommandFailed.Wrapf("invalid file header %q", line)
+	}
+	mode, err := strconv.ParseUint(fields[0][1:], 8, 32)
+	if err != nil {
+		return 0, 0, ErrCommandFailed.Wrapf("invalid file mode in header %q: %w", line, err)
+	}
+	size, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || size < 0 {
+		return 0, 0, ErrCommandFailed.Wrapf("invalid file size in header %q", line)
+	}
+	return os.FileMode(mode).Perm(), size, nil
+}
+
+// scpReceive performs the sink side of an scp file transfer
+func scpReceive(w io.Writer, r *bufio.Reader, dst string, progress exec.ProgressFunc, logger log.Logger) error {
+	if _, err := w.Write([]byte{scpOK}); err != nil {
+		return ErrCommandFailed.Wrapf("send ready: %w", err)
+	}
+
+	code, err := r.Peek(1)
+	if err != nil {
+		return ErrCommandFailed.Wrapf("read file header: %w", err)
+	}
+	if code[0] == scpWarning || code[0] == scpError {
+		return scpAck(r)
+	}
+
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return ErrCommandFailed.Wrapf("read file header: %w", err)
+	}
+	perm, size, err := scpHeader(line)
+	if err != nil {
+		return err
+	}
+	logger.Tracef("scp: receiving %d bytes into %s", size, dst)
+
+	if _, err := w.Write([]byte{scpOK}); err != nil {
+		return ErrCommandFailed.Wrapf("send header ack: %w", err)
+	}
+
+	local, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return ErrInvalidPath.Wrapf("open local file for writing: %w", err)
+	}
+	defer local.Close()
+	if _, err := io.CopyN(io.MultiWriter(local, exec.ProgressWriter(progress, size)), r, size); err != nil {
+		return ErrCommandFailed.Wrapf("receive file content: %w", err)
+	}
+	if err := local.Close(); err != nil {
+		return ErrOS.Wrapf("close local file: %w", err)
+	}
+
+	if err := scpAck(r); err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte{scpOK}); err != nil {
+		return ErrCommandFailed.Wrapf("send end of file ack: %w", err)
+	}
+	return nil
+}
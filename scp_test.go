@@ -0,0 +1,47 @@
+package rig
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/k0sproject/rig/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSCPHeader(t *testing.T) {
+	perm, size, err := scpHeader("C0644 1234 file name.txt\n")
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o644), perm)
+	require.Equal(t, int64(1234), size)
+
+	_, _, err = scpHeader("D0755 0 dir\n")
+	require.Error(t, err)
+	_, _, err = scpHeader("C0644 -1 file\n")
+	require.Error(t, err)
+}
+
+func TestSCPSend(t *testing.T) {
+	out := bytes.NewBuffer(nil)
+	acks := bufio.NewReader(strings.NewReader("\x00\x00\x00"))
+	require.NoError(t, scpSend(out, acks, strings.NewReader("hello"), 0o600, 5, "test.txt"))
+	require.Equal(t, "C0600 5 test.txt\nhello\x00", out.String())
+
+	acks = bufio.NewReader(strings.NewReader("\x00\x02scp: permission denied\n"))
+	err := scpSend(bytes.NewBuffer(nil), acks, strings.NewReader("hello"), 0o600, 5, "test.txt")
+	require.ErrorContains(t, err, "permission denied")
+}
+
+func TestSCPReceive(t *testing.T) {
+	dst := filepath.Join(t.TempDir(), "test.txt")
+	out := bytes.NewBuffer(nil)
+	in := bufio.NewReader(strings.NewReader("C0640 5 test.txt\nhello\x00"))
+	require.NoError(t, scpReceive(out, in, dst, nil, log.Global))
+	require.Equal(t, "\x00\x00\x00", out.String())
+	data, err := os.ReadFile(dst)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(data))
+}
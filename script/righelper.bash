@@ -16,22 +16,61 @@ abs() (
   fi
 )
 
+# like abs but does not resolve the last path component, for inspecting symlinks
+labs() (
+  local dir="${1%/*}"
+  if [ "$dir" = "$1" ]; then
+    echo "$(pwd)/$1"
+    return
+  fi
+  cd "${dir:-/}" || return 1
+  echo "$(pwd)/${1##*/}"
+)
+
+jsonescape() {
+  local s="$1" i o c u
+  s="${s//\\/\\\\}"
+  s="${s//\"/\\\"}"
+  s="${s//$'\n'/\\n}"
+  s="${s//$'\r'/\\r}"
+  s="${s//$'\t'/\\t}"
+  # the rest of the control characters are not allowed in json strings as is
+  if [[ "$s" == *[[:cntrl:]]* ]]; then
+    for ((i = 1; i < 32; i++)); do
+      printf -v o '%03o' "$i"
+      printf -v c "\\$o"
+      printf -v u '\\u%04x' "$i"
+      s="${s//"$c"/$u}"
+    done
+  fi
+  echo -n "$s"
+}
+
+# statjson path [embed] [nofollow]
 statjson() {
   local path="$1"
   local embed
   if [ "$2" = "true" ]; then
     embed=1
   fi
+  local follow="-L"
+  local is_link=false
+  if [ "$3" = "true" ]; then
+    follow=""
+    if [ -L "$path" ]; then
+      is_link=true
+    fi
+  fi
 
   if [ "$path" = "" ]; then
     throw "empty path"
   fi
   if stat --help 2>&1 | grep -q -- --format; then
     # GNU stat
-    file_info=$(stat --format="0%a %s %Y" "$path" 2> /dev/null)
+    file_info=$(stat $follow --format="0%a %s %Y" "$path" 2> /dev/null)
   else
     # BSD stat
-    file_info=$(stat -f "%Mp%Lp %z %m" "$path" 2> /dev/null)
+    file_info=$(stat $follow -f "%Mp%Lp %z %m" "$path" 2> /dev/null)
   fi
   read -r unix_mode size mod_time <<EOF
 $file_info
@@ -39,15 +78,17 @@ EOF
 
   unix_mode=$(printf "%d" "$unix_mode")
 
-  if [ -d "$path" ]; then
+  if [ -d "$path" ] && [ "$is_link" = false ]; then
     is_dir=true
   else
     is_dir=false
   fi
+  local name
+  name=$(jsonescape "$path")
   if [ "$embed" == "" ]; then
-    echo -n "{\"stat\":{\"size\":$size,\"unixMode\":$unix_mode,\"modTime\":$mod_time,\"isDir\":$is_dir,\"name\":\"$path\"}}"
+    echo -n "{\"stat\":{\"size\":$size,\"unixMode\":$unix_mode,\"modTime\":$mod_time,\"isDir\":$is_dir,\"isLink\":$is_link,\"name\":\"$name\"}}"
   else
-    echo -n "{\"size\":$size,\"unixMode\":$unix_mode,\"modTime\":$mod_time,\"isDir\":$is_dir,\"name\":\"$path\"}"
+    echo -n "{\"size\":$size,\"unixMode\":$unix_mode,\"modTime\":$mod_time,\"isDir\":$is_dir,\"isLink\":$is_link,\"name\":\"$name\"}"
   fi
 }
 
@@ -72,11 +113,17 @@ main() {
       fi
       statjson "$path"
       ;;
+    "lstat")
+      if [ ! -e "$2" ] && [ ! -L "$2" ]; then
+        throw "file not found"
+      fi
+      statjson "$(labs "$2")" "" true
+      ;;
     "sum")
       if [ ! -f "$path" ]; then
         throw "file not found"
       fi
-      sum=$(sha256sum -b "$path" | awk '{print $1}')
+      sum=$(sha256sum -b < "$path" | awk '{print $1}')
       if [ -z "$sum" ]; then
         throw "failed to calculate checksum"
       fi
@@ -94,7 +141,69 @@ main() {
         else
           echo -n ","
         fi
+        statjson "$file" true true
+      done
+      echo -n "]}"
+      ;;
+    "walk")
+      if [ ! -d "$path" ]; then
+        throw "directory not found"
+      fi
+      local depth="$3"
+      echo -n "{\"dir\":["
+      first=true
+      while IFS= read -r -d '' file; do
+        if [ "$first" = true ]; then
+          first=false
+        else
+          echo -n ","
+        fi
+        statjson "$file" true true
+      done < <(find "$path" -mindepth 1 ${depth:+-maxdepth "$depth"} -print0)
+      echo -n "]}"
+      ;;
+    "manifest")
+      if [ ! -d "$path" ]; then
+        throw "directory not found"
+      fi
+      echo -n "{\"manifest\":["
+      first=true
+      while IFS= read -r -d '' file; do
+        sum=$(sha256sum -b < "$file" | awk '{print $1}')
+        if [ -z "$sum" ]; then
+          continue
+        fi
+        if [ "$first" = true ]; then
+          first=false
+        else
+          echo -n ","
+        fi
+        echo -n "{\"path\":\"$(jsonescape "${file#"$path"/}")\",\"sha256\":\"$sum\",\"stat\":"
         statjson "$file" true
+        echo -n "}"
+      done < <(find "$path" -type f -print0)
+      echo -n "]}"
+      ;;
+    "rm")
+      echo -n "{\"rm\":["
+      first=true
+      for file in "${@:2}"; do
+        if [ "$first" = true ]; then
+          first=false
+        else
+          echo -n ","
+        fi
+        if [ -d "$file" ] && [ ! -L "$file" ]; then
+          rmcmd=rmdir
+        else
+          rmcmd="rm -f"
+        fi
+        if out=$($rmcmd -- "$file" 2>&1); then
+          out=""
+        elif [ -z "$out" ]; then
+          out="failed to remove"
+        fi
+        echo -n "{\"path\":\"$(jsonescape "$file")\",\"error\":\"$(jsonescape "${out//$'\n'/ }")\"}"
       done
       echo -n "]}"
       ;;
@@ -113,4 +222,4 @@ main() {
       ;;
   esac
 }
-main $@
+main "$@"
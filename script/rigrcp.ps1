@@ -1,10 +1,12 @@
 begin {
   class Stat {
-    [int]$size
+    [long]$size
     [int]$mode
     [int]$unixMode
     [int]$modTime
     [bool]$isDir
+    [bool]$isLink
+    [string]$linkType
     [string]$name
     Stat([System.IO.FileSystemInfo]$fi) {
       if ($fi.Exists -eq $false) {
@@ -12,9 +14,11 @@ begin {
       }
       $this.isDir = ($fi.Attributes -band [System.IO.FileAttributes]::Directory)
       $this.modTime = [int](Get-Date ($fi.LastWriteTimeUtc).ToUniversalTime() -UFormat %s)
-      $this.size = [int]$fi.Length
+      $this.size = [long]$fi.Length
       $this.unixMode = [int]$fi.UnixFileMode
       $this.mode = [int]$fi.Attributes
+      $this.linkType = [string]$fi.LinkType
+      $this.isLink = ($this.linkType -eq "SymbolicLink" -or $this.linkType -eq "Junction")
       $this.name = $fi.FullName
     }
   }
@@ -35,6 +39,33 @@ begin {
     return (New-Object System.IO.FileInfo($Path))
   }
 
+  # returns the FileInfo or DirectoryInfo of the final target when fi is a symbolic link or a junction
+  function Resolve-Link($fi) {
+    $hops = 0
+    while ($fi.LinkType -eq "SymbolicLink" -or $fi.LinkType -eq "Junction") {
+      $hops++
+      if ($hops -gt 40) {
+        throw "too many levels of symbolic links"
+      }
+      $target = @($fi.Target)[0]
+      if (![System.IO.Path]::IsPathRooted($target)) {
+        $target = Join-Path (Split-Path -Parent $fi.FullName) $target
+      }
+      $fi = Get-FSInfo $target
+    }
+    return $fi
+  }
+
+  # parses the JSON encoded arguments of a command, used by commands that take more than a single path
+  function Read-Args($parts) {
+    return ($parts[1..($parts.Length-1)] -join " ") | ConvertFrom-Json
+  }
+
+  # returns the absolute path for the given path, relative paths are resolved against the current location
+  function Get-FullPath($path) {
+    return $ExecutionContext.SessionState.Path.GetUnresolvedProviderPathFromPSPath($path)
+  }
+
   # throws when a file isn't open
   function Check-Open($f) {
     if ($f -eq $null) {
@@ -42,12 +73,48 @@ begin {
     }
   }
 
-  # converts an object to json, writes it to the stream, and sends a zero byte to mark the end
+  # writes a frame to the stream: the length of the payload in bytes and a newline followed by the payload
+  function Write-Frame($stream, [byte[]]$bytes) {
+    $header = [System.Text.Encoding]::ASCII.GetBytes([string]$bytes.Length + "`n")
+    $stream.Write($header, 0, $header.Length)
+    $stream.Write($bytes, 0, $bytes.Length)
+  }
+
+  # converts an object to json and writes it to the stream as a frame
   function Write-JSON($stream, $obj) {
     $json = ConvertTo-Json -InputObject $obj -Depth 10 -Compress
-    $bytes = [System.Text.Encoding]::UTF8.GetBytes($json)
-    $stream.Write($bytes, 0, $bytes.Length)
-    $stream.WriteByte(0)
+    Write-Frame $stream ([System.Text.Encoding]::UTF8.GetBytes($json))
+  }
+
+  # writes an empty frame to acknowledge a command that has no response
+  function Write-Ack($stream) {
+    Write-Frame $stream ([byte[]]@())
+  }
+
+  # reads a frame from the stream and returns the payload as a string, or $null when the stream has ended
+  function Read-Frame($stream) {
+    $header = New-Object System.Text.StringBuilder
+    while ($true) {
+      $b = $stream.ReadByte()
+      if ($b -eq -1) {
+        return $null
+      }
+      if ($b -eq 10) {
+        break
+      }
+      [void]$header.Append([char]$b)
+    }
+    $length = [int]$header.ToString()
+    $bytes = New-Object byte[] $length
+    $read = 0
+    while ($read -lt $length) {
+      $n = $stream.Read($bytes, $read, $length - $read)
+      if ($n -eq 0) {
+        return $null
+      }
+      $read += $n
+    }
+    return [System.Text.Encoding]::UTF8.GetString($bytes)
   }
 
 	$bufferSize = 32768
@@ -70,7 +137,6 @@ public static extern IntPtr GetStdHandle(int nStdHandle);
   $Kernel32 = Add-Type -MemberDefinition $MethodDefinitions -Name 'Kernel32' -Namespace 'Win32' -PassThru
   $stdinHandle = $Kernel32::GetStdHandle(-10)
   $stdin = New-Object System.IO.FileStream $stdinHandle, ([System.IO.FileAccess]::Read), ([System.IO.FileShare]::Read), 16384, $false
-  $stdinStream = New-Object System.IO.StreamReader $stdin
 
   # get a raw stdout handle
   [Console]::OutputEncoding = [System.Text.Encoding]::ASCII
@@ -78,16 +144,20 @@ public static extern IntPtr GetStdHandle(int nStdHandle);
 
   $buf = New-Object byte[] $bufferSize
 
-  while(!$stdinStream.EndOfStream) {
+  # each command is a frame that holds the command name and its arguments separated by spaces
+  while ($true) {
+    $command = Read-Frame $stdin
+    if ($command -eq $null) {
+      break
+    }
     try {
-      $command = $stdinStream.ReadLine()
       $parts = $command -split " "
 
       switch ($parts[0]) {
         'stat' {
           $path = $parts[1..($parts.Length-1)] -join " "
           try {
-            $fi = Get-FSInfo $path
+            $fi = Resolve-Link (Get-FSInfo $path)
           } catch {
             Write-JSON $stdout @{"error" = "get-fsinfo: $($_.Exception.Message)"}
             continue
@@ -98,6 +168,13 @@ public static extern IntPtr GetStdHandle(int nStdHandle);
           }
           Write-JSON $stdout $output
         }
+        # command "lstat" = like stat, but describes a symbolic link or a junction itself instead of its target
+        # arguments: {"path": string}
+        'lstat' {
+          $a = Read-Args $parts
+          $item = Get-Item -LiteralPath (Get-FullPath $a.path) -Force
+          Write-JSON $stdout @{ stat = (New-Object Stat $item) }
+        }
         'sum' {
           $path = $parts[1..($parts.Length-1)] -join " "
           $fi = Get-FSInfo $path
@@ -134,6 +211,199 @@ public static extern IntPtr GetStdHandle(int nStdHandle);
           }
           Write-JSON $stdout $output
         }
+        # command "walk" = list all files and directories under a directory recursively
+        # first parameter is the maximum depth, 0 for unlimited
+        # last parameter is the path
+        'walk' {
+          $depth = [int]$parts[1]
+          $path = $parts[2..($parts.Length-1)] -join " "
+          $di = Get-FSInfo $path
+          if (!$di.Exists -or $di.GetType().Name -ne "DirectoryInfo") {
+            throw "directory not found"
+          }
+          $params = @{
+            LiteralPath = $di.FullName
+            Recurse = $true
+            Force = $true
+          }
+          if ($depth -gt 0) {
+            $params.Depth = $depth - 1
+          }
+          $infos = @()
+          Get-ChildItem @params | ForEach-Object {
+            $infos += New-Object Stat $_
+          }
+          $output = @{
+            dir = $infos
+          }
+          Write-JSON $stdout $output
+        }
+        # command "find" = list the paths under a directory that match all of the given filters
+        # type is "f" for files, "d" for directories or "l" for symbolic links, name is matched
+        # using -like, the times are in minutes and the sizes in bytes, zero values are ignored
+        # arguments: {"path": string, "depth": int, "type": string, "name": string,
+        #             "modifiedWithin": long, "modifiedBefore": long, "minSize": long, "maxSize": long}
+        'find' {
+          $a = Read-Args $parts
+          $params = @{
+            LiteralPath = (Get-FullPath $a.path)
+            Recurse = $true
+            Force = $true
+          }
+          if ($a.depth -gt 0) {
+            $params.Depth = $a.depth - 1
+          }
+          switch ($a.type) {
+            'f' { $params.File = $true }
+            'd' { $params.Directory = $true }
+          }
+          $now = [DateTime]::UtcNow
+          $paths = @()
+          Get-ChildItem @params | Where-Object {
+            (-not $a.name -or $_.Name -like $a.name) -and
+            ($a.type -ne 'l' -or ($_.Attributes -band [System.IO.FileAttributes]::ReparsePoint)) -and
+            ($a.modifiedWithin -le 0 -or $_.LastWriteTimeUtc -gt $now.AddMinutes(-$a.modifiedWithin)) -and
+            ($a.modifiedBefore -le 0 -or $_.LastWriteTimeUtc -lt $now.AddMinutes(-$a.modifiedBefore)) -and
+            ($a.minSize -le 0 -or (-not $_.PSIsContainer -and $_.Length -ge $a.minSize)) -and
+            ($a.maxSize -le 0 -or (-not $_.PSIsContainer -and $_.Length -le $a.maxSize))
+          } | ForEach-Object {
+            $paths += $_.FullName
+          }
+          Write-JSON $stdout @{ paths = $paths }
+        }
+        # command "mkdir" = create a directory and any missing parents
+        # arguments: {"path": string}
+        'mkdir' {
+          $a = Read-Args $parts
+          [void][System.IO.Directory]::CreateDirectory((Get-FullPath $a.path))
+          Write-JSON $stdout @{}
+        }
+        # command "rm" = remove a file or an empty directory, or a whole tree when recursive is set
+        # a recursive remove of a path that does not exist succeeds
+        # arguments: {"path": string, "recursive": bool}
+        'rm' {
+          $a = Read-Args $parts
+          $path = Get-FullPath $a.path
+          if (Test-Path -LiteralPath $path) {
+            if ($a.recursive) {
+              Remove-Item -LiteralPath $path -Recurse -Force
+            } elseif (Test-Path -LiteralPath $path -PathType Container) {
+              [System.IO.Directory]::Delete($path)
+            } else {
+              Remove-Item -LiteralPath $path -Force
+            }
+          } elseif (-not $a.recursive) {
+            throw "file not found"
+          }
+          Write-JSON $stdout @{}
+        }
+        # command "rmmany" = remove files or empty directories, continuing after failures
+        # a path that does not exist is not an error
+        # arguments: {"paths": [string]}
+        'rmmany' {
+          $a = Read-Args $parts
+          $results = @()
+          foreach ($p in @($a.paths)) {
+            try {
+              $path = Get-FullPath $p
+              if (Test-Path -LiteralPath $path) {
+                Remove-Item -LiteralPath $path -Force
+              }
+              $results += @{ path = $p; error = "" }
+            } catch {
+              $results += @{ path = $p; error = $_.Exception.Message }
+            }
+          }
+          Write-JSON $stdout @{ rm = $results }
+        }
+        # command "mv" = rename a file or a directory, replacing an existing file
+        # arguments: {"old": string, "new": string}
+        'mv' {
+          $a = Read-Args $parts
+          Move-Item -LiteralPath (Get-FullPath $a.old) -Destination (Get-FullPath $a.new) -Force
+          Write-JSON $stdout @{}
+        }
+        # command "chmod" = set or clear the read-only attribute
+        # arguments: {"path": string, "readonly": bool}
+        'chmod' {
+          $a = Read-Args $parts
+          Set-ItemProperty -LiteralPath (Get-FullPath $a.path) -Name IsReadOnly -Value ([bool]$a.readonly)
+          Write-JSON $stdout @{}
+        }
+        # command "chown" = change the owner of a file or a directory
+        # arguments: {"path": string, "owner": string}
+        'chown' {
+          $a = Read-Args $parts
+          $path = Get-FullPath $a.path
+          $acl = Get-Acl -LiteralPath $path
+          $acl.SetOwner((New-Object System.Security.Principal.NTAccount($a.owner)))
+          Set-Acl -LiteralPath $path -AclObject $acl
+          Write-JSON $stdout @{}
+        }
+        # command "chtimes" = set the access and modification times, given as windows file times
+        # arguments: {"path": string, "atime": long, "mtime": long}
+        'chtimes' {
+          $a = Read-Args $parts
+          $item = Get-Item -LiteralPath (Get-FullPath $a.path) -Force
+          $item.LastAccessTimeUtc = [DateTime]::FromFileTimeUtc([long]$a.atime)
+          $item.LastWriteTimeUtc = [DateTime]::FromFileTimeUtc([long]$a.mtime)
+          Write-JSON $stdout @{}
+        }
+        # command "symlink" = create a symbolic link new pointing to old
+        # arguments: {"old": string, "new": string}
+        'symlink' {
+          $a = Read-Args $parts
+          [void](New-Item -ItemType SymbolicLink -Path (Get-FullPath $a.new) -Target $a.old)
+          Write-JSON $stdout @{}
+        }
+        # command "readlink" = return the target of a symbolic link
+        # arguments: {"path": string}
+        'readlink' {
+          $a = Read-Args $parts
+          $target = (Get-Item -LiteralPath (Get-FullPath $a.path) -Force).Target
+          if (-not $target) {
+            throw "not a symbolic link"
+          }
+          Write-JSON $stdout @{ path = [string]$target }
+        }
+        # command "mktemp" = create a file or a directory with a random name
+        # the default temporary directory is used when dir is empty
+        # arguments: {"dir": string, "prefix": string, "suffix": string, "directory": bool}
+        'mktemp' {
+          $a = Read-Args $parts
+          $dir = $a.dir
+          if (-not $dir) {
+            $dir = [System.IO.Path]::GetTempPath()
+          }
+          $path = [System.IO.Path]::Combine((Get-FullPath $dir), $a.prefix + [System.IO.Path]::GetRandomFileName().Replace(".", "") + $a.suffix)
+          if ($a.directory) {
+            [void][System.IO.Directory]::CreateDirectory($path)
+          } else {
+            [System.IO.File]::Open($path, [System.IO.FileMode]::CreateNew).Dispose()
+          }
+          Write-JSON $stdout @{ path = $path }
+        }
+        # command "manifest" = list all files under a directory with their checksums
+        'manifest' {
+          $path = $parts[1..($parts.Length-1)] -join " "
+          $di = Get-FSInfo $path
+          if (!$di.Exists -or $di.GetType().Name -ne "DirectoryInfo") {
+            throw "directory not found"
+          }
+          $root = $di.FullName.TrimEnd("\") + "\"
+          $entries = @()
+          Get-ChildItem -LiteralPath $di.FullName -Recurse -File -Force | ForEach-Object {
+            $entries += @{
+              path = $_.FullName.Substring($root.Length).Replace("\", "/")
+              sha256 = (Get-FileHash -LiteralPath $_.FullName -Algorithm SHA256).Hash.ToLower()
+              stat = New-Object Stat $_
+            }
+          }
+          $output = @{
+            manifest = $entries
+          }
+          Write-JSON $stdout $output
+        }
         # command "o" = open a file
         # second parameter is the mode (ro = readonly, c = create/truncate, a = create/append, rw = read/write)
         # last parameter is the path
@@ -152,15 +422,17 @@ public static extern IntPtr GetStdHandle(int nStdHandle);
           $path = $fi.FullName
 
           $fmode = $null
+          $faccess = $null
           switch ($mode) {
             'ro' {
               $fmode = [System.IO.FileMode]::Open
             }
             'w' {
-              $fmode = [System.IO.FileMode]::CreateNew
+              $fmode = [System.IO.FileMode]::OpenOrCreate
+              $faccess = [System.IO.FileAccess]::Write
             }
             'rw' {
-              $fmode = [System.IO.FileMode]::ReadWrite
+              $fmode = [System.IO.FileMode]::OpenOrCreate
             }
             'c' {
               if ($fi.Exists) {
@@ -177,7 +449,14 @@ public static extern IntPtr GetStdHandle(int nStdHandle);
             }
           }
 
-          $file = New-Object System.IO.FileStream($path, $fmode)
+          if ($mode -eq 'rw') {
+            # allow other writers so that a file can be written in parallel from multiple sessions
+            $file = New-Object System.IO.FileStream($path, $fmode, [System.IO.FileAccess]::ReadWrite, [System.IO.FileShare]::ReadWrite)
+          } elseif ($faccess -ne $null) {
+            $file = New-Object System.IO.FileStream($path, $fmode, $faccess)
+          } else {
+            $file = New-Object System.IO.FileStream($path, $fmode)
+          }
           $position = $file.Position
           $eof = ($file.Length -eq $position)
 
@@ -194,7 +473,7 @@ public static extern IntPtr GetStdHandle(int nStdHandle);
         # the second parameter is the origin (0 = start, 1 = current, 2 = end)
         'seek' {
           Check-Open $file
-          $pos = [int]$parts[1]
+          $pos = [long]$parts[1]
           $whence = [int]$parts[2]
           switch ($whence) {
             0 { $position = $pos }
@@ -223,7 +502,7 @@ public static extern IntPtr GetStdHandle(int nStdHandle);
             throw "eof"
           }
 
-          $count = [int]$parts[1]
+          $count = [long]$parts[1]
           if ($count -eq 0) {
             throw "zero count"
           }
@@ -280,17 +559,20 @@ public static extern IntPtr GetStdHandle(int nStdHandle);
             throw "file not open for writing"
           }
 
-          $count = [int]$parts[1]
+          $count = [long]$parts[1]
           if ($count -eq 0) {
             throw "zero count"
           }
-          $stdout.WriteByte(0)
+          Write-Ack $stdout
 
           $bytesRead = 0
           $totalBytesRead = 0
           while ($totalBytesRead -lt $count) {
             $bytesToRead = [Math]::Min($bufferSize, $count - $totalBytesRead)
             $bytesRead = $stdin.Read($buf, 0, $bytesToRead)
+            if ($bytesRead -eq 0) {
+              throw "unexpected end of input"
+            }
             $file.Write($buf, 0, $bytesRead)
             $position = $file.Position
             $totalBytesRead += $bytesRead
@@ -305,7 +587,7 @@ public static extern IntPtr GetStdHandle(int nStdHandle);
           $file = $null
           $eof = $false
           $position = 0
-          $stdout.WriteByte(0)
+          Write-Ack $stdout
         }
         'q' {
           throw "quit"
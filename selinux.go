@@ -0,0 +1,68 @@
+package rig
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/alessio/shellescape"
+	"github.com/k0sproject/rig/exec"
+)
+
+// SELinux modes
+const (
+	SELinuxEnforcing  = "enforcing"
+	SELinuxPermissive = "permissive"
+	SELinuxDisabled   = "disabled"
+)
+
+// selinuxModeScript prints the SELinux mode or nothing when SELinux is not available
+const selinuxModeScript = `if command -v getenforce > /dev/null 2>&1; then getenforce; elif [ -r /sys/fs/selinux/enforce ]; then if [ "$(cat /sys/fs/selinux/enforce)" = 1 ]; then echo enforcing; else echo permissive; fi; fi`
+
+// selinuxNameRe matches the names of SELinux booleans and types
+var selinuxNameRe = regexp.MustCompile(`^\w+$`)
+
+// SELinuxMode returns the SELinux mode of the host, SELinuxEnforcing, SELinuxPermissive or
+// SELinuxDisabled, or an empty string when the host has no SELinux support
+func (c *Connection) SELinuxMode() (string, error) {
+	if c.IsWindows() {
+		return "", nil
+	}
+	out, err := c.ExecOutput("sh -c "+shellescape.Quote(selinuxModeScript), exec.HideOutput())
+	if err != nil {
+		return "", ErrCommandFailed.Wrapf("get selinux mode: %w", err)
+	}
+	return strings.ToLower(out), nil
+}
+
+// SetSELinuxBoolean persistently sets a SELinux boolean, such as "container_manage_cgroup"
+func (c *Connection) SetSELinuxBoolean(name string, value bool) error {
+	if err := c.checkLinuxName("selinux boolean", name, selinuxNameRe); err != nil {
+		return err
+	}
+	state := "off"
+	if value {
+		state = "on"
+	}
+	if err := c.Exec(fmt.Sprintf("setsebool -P %s %s", name, state), exec.Sudo(c)); err != nil {
+		return ErrCommandFailed.Wrapf("set selinux boolean %s: %w", name, err)
+	}
+	return nil
+}
+
+// SetSELinuxLabel persistently sets the SELinux type of a path and everything under it, such as
+// "container_file_t", and relabels the existing files
+func (c *Connection) SetSELinuxLabel(path, fileType string) error {
+	if err := c.checkLinuxName("selinux type", fileType, selinuxNameRe); err != nil {
+		return err
+	}
+	spec := shellescape.Quote(path + "(/.*)?")
+	script := fmt.Sprintf(
+		"{ semanage fcontext -a -t %[1]s %[2]s || semanage fcontext -m -t %[1]s %[2]s; } && restorecon -R %[3]s",
+		fileType, spec, shellescape.Quote(path),
+	)
+	if err := c.Exec("sh -c "+shellescape.Quote(script), exec.Sudo(c)); err != nil {
+		return ErrCommandFailed.Wrapf("set selinux label of %s: %w", path, err)
+	}
+	return nil
+}
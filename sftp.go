@@ -0,0 +1,501 @@
+package rig
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/k0sproject/rig/exec"
+)
+
+// sftp protocol version 3 packet types, flags and status codes
+const (
+	sftpInit    = 1
+	sftpVersion = 2
+	sftpOpen    = 3
+	sftpClose   = 4
+	sftpRead    = 5
+	sftpWrite   = 6
+	sftpFstat   = 8
+	sftpStatus  = 101
+	sftpHandle  = 102
+	sftpData    = 103
+	sftpAttrs   = 105
+
+	sftpOpenRead  = 0x01
+	sftpOpenWrite = 0x02
+	sftpOpenCreat = 0x08
+	sftpOpenTrunc = 0x10
+
+	sftpAttrSize        = 0x01
+	sftpAttrUIDGID      = 0x02
+	sftpAttrPermissions = 0x04
+
+	sftpStatusOK           = 0
+	sftpStatusEOF          = 1
+	sftpStatusNoSuchFile   = 2
+	sftpStatusPermDenied   = 3
+	sftpProtocolVersion    = 3
+	sftpChunkSize          = 32 * 1024
+	sftpMaxPacketSize      = 256 * 1024
+	sftpMaxPendingRequests = 16
+)
+
+// subsystemOpener is implemented by the clients that can start SSH subsystems
+type subsystemOpener interface {
+	openSubsystem(name string) (io.WriteCloser, io.Reader, io.Closer, error)
+}
+
+// sftpTransfer transfers files using the sftp subsystem of an ssh server. It works on any host
+// running an ssh server with sftp enabled, including windows hosts running OpenSSH, but it can't
+// elevate privileges.
+type sftpTransfer struct{}
+
+func (t *sftpTransfer) Name() string {
+	return TransferSFTP
+}
+
+func (t *sftpTransfer) Probe(c *Connection) error {
+	client, err := c.sftp()
+	if err != nil {
+		return err
+	}
+	return client.Close()
+}
+
+func (t *sftpTransfer) Upload(c *Connection, src, dst string, opts ...exec.Option) error {
+	if exec.Build(opts...).Sudo {
+		return ErrUploadFailed.Wrapf("sftp: %w", ErrNotSupported.Wrapf("sftp can't elevate privileges"))
+	}
+
+	local, err := os.Open(src)
+	if err != nil {
+		return ErrInvalidPath.Wrap(err)
+	}
+	defer local.Close()
+
+	stat, err := local.Stat()
+	if err != nil {
+		return ErrInvalidPath.Wrapf("stat local file %s: %w", src, err)
+	}
+	if stat.IsDir() {
+		return ErrInvalidPath.Wrapf("%s is a directory", src)
+	}
+
+	shasum, err := newChecksum(opts...)
+	if err != nil {
+		return ErrUploadFailed.Wrap(err)
+	}
+
+	client, err := c.sftp()
+	if err != nil {
+		return ErrUploadFailed.Wrap(err)
+	}
+	defer client.Close()
+
+	progress := exec.ProgressWriter(exec.Build(opts...).Progress, stat.Size())
+	if err := client.upload(io.TeeReader(local, io.MultiWriter(hashWriter(shasum), progress)), dst, stat.Mode().Perm()); err != nil {
+		return ErrUploadFailed.Wrap(err)
+	}
+
+	if err := c.verifyChecksum(dst, shasum, opts...); err != nil {
+		return ErrUploadFailed.Wrap(err)
+	}
+
+	return nil
+}
+
+func (t *sftpTransfer) Download(c *Connection, src, dst string, opts ...exec.Option) error {
+	if exec.Build(opts...).Sudo {
+		return ErrDownloadFailed.Wrapf("sftp: %w", ErrNotSupported.Wrapf("sftp can't elevate privileges"))
+	}
+
+	shasum, err := newChecksum(opts...)
+	if err != nil {
+		return ErrDownloadFailed.Wrap(err)
+	}
+
+	client, err := c.sftp()
+	if err != nil {
+		return ErrDownloadFailed.Wrap(err)
+	}
+	defer client.Close()
+
+	if err := client.download(src, dst, hashWriter(shasum), exec.Build(opts...).Progress); err != nil {
+		return ErrDownloadFailed.Wrap(err)
+	}
+
+	if err := c.verifyChecksum(src, shasum, opts...); err != nil {
+		return ErrDownloadFailed.Wrap(err)
+	}
+
+	return nil
+}
+
+// sftp starts an sftp session on the connection
+func (c *Connection) sftp() (*sftpClient, error) {
+	opener, ok := c.client.(subsystemOpener)
+	if !ok {
+		return nil, ErrNotSupported.Wrapf("sftp requires an ssh connection")
+	}
+	w, r, closer, err := opener.openSubsystem("sftp")
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	client := &sftpClient{w: w, r: bufio.NewReader(r), closer: closer}
+	if err := client.init(); err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// sftpPacket builds the payload of an sftp packet
+type sftpPacket []byte
+
+func (p sftpPacket) uint32(v uint32) sftpPacket {
+	return binary.BigEndian.AppendUint32(p, v)
+}
+
+func (p sftpPacket) uint64(v uint64) sftpPacket {
+	return binary.BigEndian.AppendUint64(p, v)
+}
+
+func (p sftpPacket) bytes(b []byte) sftpPacket {
+	return append(p.uint32(uint32(len(b))), b...)
+}
+
+func (p sftpPacket) string(s string) sftpPacket {
+	return append(p.uint32(uint32(len(s))), s...)
+}
+
+// sftpReader decodes the payload of an sftp packet. The first decoding error is kept in err and
+// the reads after it return zero values.
+type sftpReader struct {
+	b   []byte
+	err error
+}
+
+func (r *sftpReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.b) < n {
+		r.err = ErrCommandFailed.Wrapf("sftp: short packet")
+		return nil
+	}
+	b := r.b[:n]
+	r.b = r.b[n:]
+	return b
+}
+
+func (r *sftpReader) uint32() uint32 {
+	if b := r.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *sftpReader) uint64() uint64 {
+	if b := r.next(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (r *sftpReader) bytes() []byte {
+	return r.next(int(r.uint32()))
+}
+
+// sftpClient speaks the sftp protocol version 3 over the stdin and stdout of an sftp subsystem
+type sftpClient struct {
+	w      io.Writer
+	r      *bufio.Reader
+	closer io.Closer
+	id     uint32
+}
+
+// Close ends the sftp session
+func (s *sftpClient) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+	if err := s.closer.Close(); err != nil && !errors.Is(err, io.EOF) {
+		return ErrCommandFailed.Wrapf("close sftp session: %w", err)
+	}
+	return nil
+}
+
+func (s *sftpClient) writePacket(typ byte, payload sftpPacket) error {
+	packet := make(sftpPacket, 0, 5+len(payload)).uint32(uint32(len(payload) + 1))
+	packet = append(packet, typ)
+	if _, err := s.w.Write(append(packet, payload...)); err != nil {
+		return ErrCommandFailed.Wrapf("sftp: send: %w", err)
+	}
+	return nil
+}
+
+func (s *sftpClient) readPacket() (byte, *sftpReader, error) {
+	var length uint32
+	if err := binary.Read(s.r, binary.BigEndian, &length); err != nil {
+		return 0, nil, ErrCommandFailed.Wrapf("sftp: receive: %w", err)
+	}
+	if length == 0 || length > sftpMaxPacketSize {
+		return 0, nil, ErrCommandFailed.Wrapf("sftp: invalid packet length %d", length)
+	}
+	packet := make([]byte, length)
+	if _, err := io.ReadFull(s.r, packet); err != nil {
+		return 0, nil, ErrCommandFailed.Wrapf("sftp: receive: %w", err)
+	}
+	return packet[0], &sftpReader{b: packet[1:]}, nil
+}
+
+// send sends a request and returns its id
+func (s *sftpClient) send(typ byte, payload sftpPacket) (uint32, error) {
+	s.id++
+	return s.id, s.writePacket(typ, append(make(sftpPacket, 0, 4+len(payload)).uint32(s.id), payload...))
+}
+
+// receive reads a response and returns its type and id
+func (s *sftpClient) receive() (byte, uint32, *sftpReader, error) {
+	typ, r, err := s.readPacket()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	id := r.uint32()
+	return typ, id, r, r.err
+}
+
+// request sends a request and waits for its response
+func (s *sftpClient) request(typ byte, payload sftpPacket) (byte, *sftpReader, error) {
+	id, err := s.send(typ, payload)
+	if err != nil {
+		return 0, nil, err
+	}
+	respType, respID, r, err := s.receive()
+	if err != nil {
+		return 0, nil, err
+	}
+	if respID != id {
+		return 0, nil, ErrCommandFailed.Wrapf("sftp: unexpected response id %d, expected %d", respID, id)
+	}
+	return respType, r, nil
+}
+
+// sftpStatusError returns the error for a status response, nil for success and io.EOF for the end of file
+func sftpStatusError(r *sftpReader) error {
+	code := r.uint32()
+	msg := string(r.bytes())
+	if r.err != nil {
+		return r.err
+	}
+	switch code {
+	case sftpStatusOK:
+		return nil
+	case sftpStatusEOF:
+		return io.EOF
+	case sftpStatusNoSuchFile:
+		return ErrCommandFailed.Wrapf("sftp: %s: %w", msg, fs.ErrNotExist)
+	case sftpStatusPermDenied:
+		return ErrCommandFailed.Wrapf("sftp: %s: %w", msg, fs.ErrPermission)
+	default:
+		return ErrCommandFailed.Wrapf("sftp: %s (status %d)", msg, code)
+	}
+}
+
+// sftpUnexpected returns the error for a response of the wrong type
+func sftpUnexpected(typ byte, r *sftpReader) error {
+	if typ == sftpStatus {
+		if err := sftpStatusError(r); err != nil {
+			return err
+		}
+	}
+	return ErrCommandFailed.Wrapf("sftp: unexpected response type %d", typ)
+}
+
+func (s *sftpClient) init() error {
+	if err := s.writePacket(sftpInit, sftpPacket{}.uint32(sftpProtocolVersion)); err != nil {
+		return err
+	}
+	typ, r, err := s.readPacket()
+	if err != nil {
+		return err
+	}
+	if typ != sftpVersion {
+		return ErrCommandFailed.Wrapf("sftp: unexpected response type %d to init", typ)
+	}
+	if version := r.uint32(); r.err == nil && version < sftpProtocolVersion {
+		return ErrNotSupported.Wrapf("sftp protocol version %d", version)
+	}
+	return r.err
+}
+
+// open opens a remote file and returns its handle. The permissions are applied when a file is created.
+func (s *sftpClient) open(path string, flags uint32, perm fs.FileMode) (string, error) {
+	payload := sftpPacket{}.string(path).uint32(flags)
+	if perm == 0 {
+		payload = payload.uint32(0)
+	} else {
+		payload = payload.uint32(sftpAttrPermissions).uint32(uint32(perm.Perm()))
+	}
+	typ, r, err := s.request(sftpOpen, payload)
+	if err != nil {
+		return "", err
+	}
+	if typ != sftpHandle {
+		return "", fmt.Errorf("open %s: %w", path, sftpUnexpected(typ, r))
+	}
+	handle := string(r.bytes())
+	return handle, r.err
+}
+
+func (s *sftpClient) close(handle string) error {
+	typ, r, err := s.request(sftpClose, sftpPacket{}.string(handle))
+	if err != nil {
+		return err
+	}
+	if typ != sftpStatus {
+		return sftpUnexpected(typ, r)
+	}
+	return sftpStatusError(r)
+}
+
+// fstat returns the size and permissions of an open file
+func (s *sftpClient) fstat(handle string) (int64, fs.FileMode, error) {
+	typ, r, err := s.request(sftpFstat, sftpPacket{}.string(handle))
+	if err != nil {
+		return 0, 0, err
+	}
+	if typ != sftpAttrs {
+		return 0, 0, sftpUnexpected(typ, r)
+	}
+	var size int64
+	var perm fs.FileMode
+	flags := r.uint32()
+	if flags&sftpAttrSize != 0 {
+		size = int64(r.uint64())
+	}
+	if flags&sftpAttrUIDGID != 0 {
+		r.uint32()
+		r.uint32()
+	}
+	if flags&sftpAttrPermissions != 0 {
+		perm = fs.FileMode(r.uint32()).Perm()
+	}
+	return size, perm, r.err
+}
+
+// upload writes the contents of src into the remote file dst. Several write requests are kept in
+// flight at once to avoid waiting for a round trip after each chunk.
+func (s *sftpClient) upload(src io.Reader, dst string, perm fs.FileMode) error {
+	handle, err := s.open(dst, sftpOpenWrite|sftpOpenCreat|sftpOpenTrunc, perm)
+	if err != nil {
+		return err
+	}
+
+	pending := make(map[uint32]struct{})
+	var offset uint64
+	var readErr, writeErr error
+	buf := make([]byte, sftpChunkSize)
+	for writeErr == nil && (readErr == nil || len(pending) > 0) {
+		if readErr == nil && len(pending) < sftpMaxPendingRequests {
+			n, err := src.Read(buf)
+			if n > 0 {
+				id, err := s.send(sftpWrite, sftpPacket{}.string(handle).uint64(offset).bytes(buf[:n]))
+				if err != nil {
+					writeErr = err
+					break
+				}
+				pending[id] = struct{}{}
+				offset += uint64(n)
+			}
+			if err != nil {
+				readErr = err
+			}
+			continue
+		}
+		typ, id, r, err := s.receive()
+		if err != nil {
+			writeErr = err
+			break
+		}
+		if _, ok := pending[id]; !ok {
+			writeErr = ErrCommandFailed.Wrapf("sftp: unexpected response id %d", id)
+			break
+		}
+		delete(pending, id)
+		if typ != sftpStatus {
+			writeErr = sftpUnexpected(typ, r)
+		} else {
+			writeErr = sftpStatusError(r)
+		}
+	}
+
+	closeErr := s.close(handle)
+	switch {
+	case writeErr != nil:
+		return fmt.Errorf("write %s: %w", dst, writeErr)
+	case readErr != nil && !errors.Is(readErr, io.EOF):
+		return ErrInvalidPath.Wrapf("read local file: %w", readErr)
+	case closeErr != nil:
+		return fmt.Errorf("close %s: %w", dst, closeErr)
+	}
+	return nil
+}
+
+// download copies the remote file src into the local file dst and w. The local file gets the
+// permissions of the remote file.
+func (s *sftpClient) download(src, dst string, w io.Writer, progress exec.ProgressFunc) error {
+	handle, err := s.open(src, sftpOpenRead, 0)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = s.close(handle) }()
+
+	size, perm, err := s.fstat(handle)
+	if err != nil {
+		return fmt.Errorf("stat %s: %w", src, err)
+	}
+	if perm == 0 {
+		perm = 0o644
+	}
+
+	local, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return ErrInvalidPath.Wrapf("open local file for writing: %w", err)
+	}
+	defer local.Close()
+
+	out := io.MultiWriter(local, w, exec.ProgressWriter(progress, size))
+	var offset uint64
+	for {
+		typ, r, err := s.request(sftpRead, sftpPacket{}.string(handle).uint64(offset).uint32(sftpChunkSize))
+		if err != nil {
+			return err
+		}
+		if typ != sftpData {
+			err := sftpUnexpected(typ, r)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return fmt.Errorf("read %s: %w", src, err)
+		}
+		data := r.bytes()
+		if r.err != nil {
+			return r.err
+		}
+		if _, err := out.Write(data); err != nil {
+			return ErrInvalidPath.Wrapf("write local file: %w", err)
+		}
+		offset += uint64(len(data))
+	}
+
+	if err := local.Close(); err != nil {
+		return ErrOS.Wrapf("close local file: %w", err)
+	}
+	return nil
+}
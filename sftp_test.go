@@ -0,0 +1,177 @@
+package rig
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// sftpTestServer serves the subset of the sftp protocol used by sftpClient from the local filesystem
+func sftpTestServer(r io.Reader, w io.Writer) {
+	responses := make(chan sftpPacket, 64)
+	go func() {
+		for p := range responses {
+			_, _ = w.Write(p)
+		}
+	}()
+	defer close(responses)
+
+	respond := func(typ byte, id uint32, payload sftpPacket) {
+		p := sftpPacket{}.uint32(uint32(len(payload) + 5))
+		p = append(p, typ)
+		responses <- append(p.uint32(id), payload...)
+	}
+	status := func(id uint32, err error) {
+		code := uint32(sftpStatusOK)
+		switch {
+		case errors.Is(err, io.EOF):
+			code = sftpStatusEOF
+		case errors.Is(err, fs.ErrNotExist):
+			code = sftpStatusNoSuchFile
+		case err != nil:
+			code = 4 // SSH_FX_FAILURE
+		}
+		msg := ""
+		if err != nil {
+			msg = err.Error()
+		}
+		respond(sftpStatus, id, sftpPacket{}.uint32(code).string(msg).string(""))
+	}
+
+	files := make(map[string]*os.File)
+	br := bufio.NewReader(r)
+	for {
+		var length uint32
+		if binary.Read(br, binary.BigEndian, &length) != nil {
+			return
+		}
+		packet := make([]byte, length)
+		if _, err := io.ReadFull(br, packet); err != nil {
+			return
+		}
+		req := &sftpReader{b: packet[1:]}
+		if packet[0] == sftpInit {
+			p := sftpPacket{}.uint32(5)
+			responses <- append(append(p, sftpVersion), sftpPacket{}.uint32(sftpProtocolVersion)...)
+			continue
+		}
+		id := req.uint32()
+		switch packet[0] {
+		case sftpOpen:
+			path := string(req.bytes())
+			pflags := req.uint32()
+			perm := fs.FileMode(0)
+			if req.uint32()&sftpAttrPermissions != 0 {
+				perm = fs.FileMode(req.uint32())
+			}
+			flags := os.O_RDONLY
+			if pflags&sftpOpenWrite != 0 {
+				flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+			}
+			f, err := os.OpenFile(path, flags, perm)
+			if err != nil {
+				status(id, err)
+				continue
+			}
+			handle := strconv.Itoa(len(files))
+			files[handle] = f
+			respond(sftpHandle, id, sftpPacket{}.string(handle))
+		case sftpWrite:
+			f := files[string(req.bytes())]
+			offset := req.uint64()
+			_, err := f.WriteAt(req.bytes(), int64(offset))
+			status(id, err)
+		case sftpRead:
+			f := files[string(req.bytes())]
+			offset := req.uint64()
+			buf := make([]byte, req.uint32())
+			n, err := f.ReadAt(buf, int64(offset))
+			if n == 0 {
+				status(id, err)
+				continue
+			}
+			respond(sftpData, id, sftpPacket{}.bytes(buf[:n]))
+		case sftpFstat:
+			stat, err := files[string(req.bytes())].Stat()
+			if err != nil {
+				status(id, err)
+				continue
+			}
+			respond(sftpAttrs, id, sftpPacket{}.uint32(sftpAttrSize|sftpAttrPermissions).uint64(uint64(stat.Size())).uint32(uint32(stat.Mode().Perm())))
+		case sftpClose:
+			handle := string(req.bytes())
+			status(id, files[handle].Close())
+			delete(files, handle)
+		default:
+			status(id, errors.New("unsupported"))
+		}
+	}
+}
+
+func newTestSFTPClient(t *testing.T) *sftpClient {
+	t.Helper()
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+	go sftpTestServer(serverR, serverW)
+	client := &sftpClient{w: clientW, r: bufio.NewReader(clientR), closer: clientW}
+	t.Cleanup(func() { _ = client.Close() })
+	require.NoError(t, client.init())
+	return client
+}
+
+func TestSFTPClient(t *testing.T) {
+	client := newTestSFTPClient(t)
+	dir := t.TempDir()
+
+	// larger than the chunks that can be in flight at once
+	data := make([]byte, sftpChunkSize*sftpMaxPendingRequests*2+123)
+	_, err := rand.Read(data)
+	require.NoError(t, err)
+
+	remote := filepath.Join(dir, "remote")
+	f, err := os.CreateTemp(dir, "local")
+	require.NoError(t, err)
+	_, err = f.Write(data)
+	require.NoError(t, err)
+	_, err = f.Seek(0, io.SeekStart)
+	require.NoError(t, err)
+	require.NoError(t, client.upload(f, remote, 0o640))
+	require.NoError(t, f.Close())
+
+	content, err := os.ReadFile(remote)
+	require.NoError(t, err)
+	require.Equal(t, data, content)
+
+	local := filepath.Join(dir, "downloaded")
+	var progress []int64
+	require.NoError(t, client.download(remote, local, io.Discard, func(current, _ int64) { progress = append(progress, current) }))
+	content, err = os.ReadFile(local)
+	require.NoError(t, err)
+	require.Equal(t, data, content)
+	require.Equal(t, int64(len(data)), progress[len(progress)-1])
+	for _, path := range []string{remote, local} {
+		stat, err := os.Stat(path)
+		require.NoError(t, err)
+		// the umask may remove some of the permissions but it can't add any
+		require.Zero(t, stat.Mode().Perm()&^0o640, path)
+	}
+
+	err = client.download(filepath.Join(dir, "nonexistent"), local, io.Discard, nil)
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	require.ErrorIs(t, err, ErrCommandFailed)
+}
+
+func TestSFTPTransferRequiresSSH(t *testing.T) {
+	mc := mockClient{}
+	c := Connection{client: &mc}
+	require.ErrorIs(t, (&sftpTransfer{}).Probe(&c), ErrNotSupported)
+}
@@ -0,0 +1,113 @@
+package rig
+
+import (
+	"bytes"
+	"io"
+	"os"
+
+	"github.com/k0sproject/rig/exec"
+)
+
+// sparseBlockSize is the granularity of zero block detection for sparse uploads
+const sparseBlockSize = 64 << 10
+
+// dataExtents reads size bytes from r in blocks of blockSize and returns the extents that contain
+// data, merging adjacent data blocks. Everything read is also written to w for checksumming.
+func dataExtents(r io.ReaderAt, size, blockSize int64, w io.Writer) ([]chunk, error) {
+	var extents []chunk
+	buf := make([]byte, blockSize)
+	zero := make([]byte, blockSize)
+	for offset := int64(0); offset < size; offset += blockSize {
+		n := blockSize
+		if offset+n > size {
+			n = size - offset
+		}
+		if _, err := r.ReadAt(buf[:n], offset); err != nil && err != io.EOF {
+			return nil, ErrOS.Wrapf("read at offset %d: %w", offset, err)
+		}
+		if _, err := w.Write(buf[:n]); err != nil {
+			return nil, ErrOS.Wrapf("calculate checksum: %w", err)
+		}
+		if bytes.Equal(buf[:n], zero[:n]) {
+			continue
+		}
+		if last := len(extents) - 1; last >= 0 && extents[last].offset+extents[last].length == offset {
+			extents[last].length += n
+			continue
+		}
+		extents = append(extents, chunk{offset: offset, length: n})
+	}
+	return extents, nil
+}
+
+// uploadSparse uploads only the blocks of a file that contain data and recreates the zero blocks on
+// the remote host as holes
+func (c *Connection) uploadSparse(src, dst string, opts ...exec.Option) error {
+	local, err := os.Open(src)
+	if err != nil {
+		return ErrInvalidPath.Wrap(err)
+	}
+	defer local.Close()
+
+	stat, err := local.Stat()
+	if err != nil {
+		return ErrInvalidPath.Wrapf("stat local file %s: %w", src, err)
+	}
+
+	shasum, err := newChecksum(opts...)
+	if err != nil {
+		return ErrUploadFailed.Wrap(err)
+	}
+
+	extents, err := dataExtents(local, stat.Size(), sparseBlockSize, hashWriter(shasum))
+	if err != nil {
+		return ErrUploadFailed.Wrap(err)
+	}
+	var dataSize int64
+	for _, ext := range extents {
+		dataSize += ext.length
+	}
+	c.loggerFor(opts).Debugf("%s: uploading %d bytes of data in %d extents to %s, skipping %d zero bytes", c, dataSize, len(extents), dst, stat.Size()-dataSize)
+
+	if err := c.createEmpty(dst, stat.Mode().Perm(), opts...); err != nil {
+		return ErrUploadFailed.Wrap(err)
+	}
+
+	if err := c.writeExtents(local, dst, stat.Size(), extents, exec.ProgressWriter(exec.Build(opts...).Progress, dataSize), opts...); err != nil {
+		return ErrUploadFailed.Wrap(err)
+	}
+
+	if err := c.verifyChecksum(dst, shasum, opts...); err != nil {
+		return ErrUploadFailed.Wrap(err)
+	}
+
+	return nil
+}
+
+// writeExtents copies the extents of local into the same positions of the remote file dst. When the
+// file ends with a hole, a single zero byte is written at the end to give the file its full size.
+func (c *Connection) writeExtents(local io.ReaderAt, dst string, size int64, extents []chunk, progress io.Writer, opts ...exec.Option) error {
+	remote, err := c.fsysFor(opts...).OpenFile(dst, ModeReadWrite, 0)
+	if err != nil {
+		return ErrInvalidPath.Wrapf("open remote file for writing: %w", err)
+	}
+	defer remote.Close()
+
+	for _, ext := range extents {
+		section := io.TeeReader(io.NewSectionReader(local, ext.offset, ext.length), progress)
+		if err := writeChunk(remote, section, ext); err != nil {
+			return ErrCommandFailed.Wrapf("write extent at offset %d: %w", ext.offset, err)
+		}
+	}
+
+	if last := len(extents) - 1; size > 0 && (last < 0 || extents[last].offset+extents[last].length < size) {
+		if _, err := remote.Seek(size-1, io.SeekStart); err != nil {
+			return ErrCommandFailed.Wrapf("seek to end of file: %w", err)
+		}
+		if _, err := remote.Write([]byte{0}); err != nil {
+			return ErrCommandFailed.Wrapf("write end of file: %w", err)
+		}
+	}
+
+	return remote.Close() //nolint:wrapcheck
+}
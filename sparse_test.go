@@ -0,0 +1,27 @@
+package rig
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataExtents(t *testing.T) {
+	data := make([]byte, 10*16+5)
+	data[20] = 1 // block 1
+	data[40] = 1 // block 2, merged with block 1
+	data[100] = 1
+	data[163] = 1 // the partial last block
+
+	sum := bytes.NewBuffer(nil)
+	extents, err := dataExtents(bytes.NewReader(data), int64(len(data)), 16, sum)
+	require.NoError(t, err)
+	require.Equal(t, []chunk{{offset: 16, length: 32}, {offset: 96, length: 16}, {offset: 160, length: 5}}, extents)
+	require.Equal(t, data, sum.Bytes(), "all of the data including the zero blocks is passed on for checksumming")
+
+	extents, err = dataExtents(bytes.NewReader(make([]byte, 64)), 64, 16, io.Discard)
+	require.NoError(t, err)
+	require.Empty(t, extents)
+}
@@ -15,9 +15,9 @@ import (
 	"github.com/acarl005/stripansi"
 	"github.com/creasty/defaults"
 	"github.com/google/shlex"
-	"github.com/k0sproject/rig/errstring"
 	"github.com/k0sproject/rig/exec"
 	"github.com/k0sproject/rig/log"
+	"github.com/k0sproject/rig/pkg/redact"
 	"github.com/k0sproject/rig/pkg/ssh/hostkey"
 	"github.com/kevinburke/ssh_config"
 	ssh "golang.org/x/crypto/ssh"
@@ -26,22 +26,54 @@ import (
 
 // SSH describes an SSH connection
 type SSH struct {
-	Address          string           `yaml:"address" validate:"required,hostname|ip"`
-	User             string           `yaml:"user" validate:"required" default:"root"`
-	Port             int              `yaml:"port" default:"22" validate:"gt=0,lte=65535"`
-	KeyPath          *string          `yaml:"keyPath" validate:"omitempty"`
-	HostKey          string           `yaml:"hostKey,omitempty"`
-	Bastion          *SSH             `yaml:"bastion,omitempty"`
-	PasswordCallback PasswordCallback `yaml:"-"`
+	Address          string           `yaml:"address" json:"address" mapstructure:"address" validate:"required_without=Alias,omitempty,hostname|ip"`
+	User             string           `yaml:"user" json:"user" mapstructure:"user" validate:"required"`
+	Port             int              `yaml:"port" json:"port" mapstructure:"port" validate:"gt=0,lte=65535"`
+	KeyPath          *string          `yaml:"keyPath" json:"keyPath" mapstructure:"keyPath" validate:"omitempty"`
+	HostKey          string           `yaml:"hostKey,omitempty" json:"hostKey,omitempty" mapstructure:"hostKey"`
+	Bastion          *SSH             `yaml:"bastion,omitempty" json:"bastion,omitempty" mapstructure:"bastion"`
+	PasswordCallback PasswordCallback `yaml:"-" json:"-" mapstructure:"-"`
 	name             string
 
+	// KnownHostsPath is the known_hosts file used for verifying the host key and for storing the
+	// keys of new hosts. It takes precedence over SSH_KNOWN_HOSTS and the UserKnownHostsFile and
+	// StrictHostKeyChecking settings of the ssh config, to keep the host keys apart from the
+	// known_hosts of the user. It is not used when HostKey is set. The bastions taken from the
+	// ProxyJump of an Alias use the same file.
+	KnownHostsPath string `yaml:"knownHostsPath,omitempty" json:"knownHostsPath,omitempty" mapstructure:"knownHostsPath"`
+
+	// HostKeyConfirmCallback is called with the host and the SHA256 fingerprint of its key when the
+	// host is not in the known_hosts file, the key is trusted and added to the file only when it
+	// returns true. Without it the keys of new hosts are trusted as is. A bastion that does not have
+	// one of its own uses the callback of the host it is the bastion of. See PromptHostKeyConfirm.
+	HostKeyConfirmCallback func(host, fingerprint string) bool `yaml:"-" json:"-" mapstructure:"-"`
+
+	// Alias is a Host entry in the ssh config to take the address, user, port, identity files and
+	// ProxyJump bastions from. Address is not needed when it is set.
+	Alias string `yaml:"alias,omitempty" json:"alias,omitempty" mapstructure:"alias"`
+
 	isWindows bool
 	knowOs    bool
-	once      sync.Once
+	// once guards SetDefaults. It is a pointer so that copying an SSH struct doesn't copy a lock and
+	// so that Reset can start over with a fresh one.
+	once *sync.Once
+	// keyPathDefaulted is true when KeyPath was set by SetDefaults instead of the configuration
+	keyPathDefaulted bool
 
 	client *ssh.Client
 
 	keyPaths []string
+
+	// credentials is the source of the key passphrases, set by Connection
+	credentials CredentialSource
+	// redactor is where the key passphrases are registered for redaction, set by Connection
+	redactor *redact.Redactor
+	// parentHostKeyConfirm is the HostKeyConfirmCallback of the host this is the bastion of
+	parentHostKeyConfirm func(host, fingerprint string) bool
+	// deprecations are the warnings about deprecated fields found while decoding, logged by Connection
+	deprecations deprecationWarnings
+
+	log log.Logger
 }
 
 // PasswordCallback is a function that is called when a passphrase is needed to decrypt a private key
@@ -49,13 +81,10 @@ type PasswordCallback func() (secret string, err error)
 
 var (
 	authMethodCache   = sync.Map{}
-	defaultKeypaths   = []string{"~/.ssh/id_rsa", "~/.ssh/identity", "~/.ssh/id_dsa"}
 	dummyhostKeyPaths []string
 	globalOnce        sync.Once
+	onceMu            sync.Mutex
 	knownHostsMU      sync.Mutex
-
-	// ErrChecksumMismatch is returned when the checksum of an uploaded file does not match expectation
-	ErrChecksumMismatch = errstring.New("checksum mismatch")
 )
 
 const hopefullyNonexistentHost = "thisH0stDoe5not3xist"
@@ -113,17 +142,17 @@ func expandAndValidatePath(path string) (string, error) {
 }
 
 func (c *SSH) keypathsFromConfig() []string {
-	log.Tracef("%s: trying to get a keyfile path from ssh config", c)
+	c.logger().Tracef("%s: trying to get a keyfile path from ssh config", c)
 	if idf := c.getConfigAll("IdentityFile"); len(idf) > 0 {
-		log.Tracef("%s: detected %d identity file paths from ssh config: %v", c, len(idf), idf)
+		c.logger().Tracef("%s: detected %d identity file paths from ssh config: %v", c, len(idf), idf)
 		return idf
 	}
-	log.Tracef("%s: no identity file paths found in ssh config", c)
+	c.logger().Tracef("%s: no identity file paths found in ssh config", c)
 	return []string{}
 }
 
 func (c *SSH) initGlobalDefaults() {
-	log.Tracef("discovering global default keypaths")
+	c.logger().Tracef("discovering global default keypaths")
 	dummyHostIdentityFiles := SSHConfigGetAll(hopefullyNonexistentHost, "IdentityFile")
 	for _, keyPath := range dummyHostIdentityFiles {
 		if expanded, err := expandAndValidatePath(keyPath); err != nil {
@@ -148,10 +177,31 @@ func findUniq(a, b []string) (string, bool) {
 	return "", false
 }
 
-// SetDefaults sets various default values
+// defaultsOnce returns the sync.Once guarding SetDefaults, allocating it on first use
+func (c *SSH) defaultsOnce() *sync.Once {
+	onceMu.Lock()
+	defer onceMu.Unlock()
+	if c.once == nil {
+		c.once = &sync.Once{}
+	}
+	return c.once
+}
+
+// SetDefaults sets various default values, see SetDefaultSSHUser, SetDefaultSSHPort and
+// SetDefaultSSHKeyPaths
 func (c *SSH) SetDefaults() {
 	globalOnce.Do(c.initGlobalDefaults)
-	c.once.Do(func() {
+	c.defaultsOnce().Do(func() {
+		c.applyAlias()
+
+		user, port, keyPaths := sshDefaults()
+		if c.User == "" {
+			c.User = user
+		}
+		if c.Port == 0 {
+			c.Port = port
+		}
+
 		if c.KeyPath != nil && *c.KeyPath != "" {
 			if expanded, err := expandAndValidatePath(*c.KeyPath); err == nil {
 				c.keyPaths = append(c.keyPaths, expanded)
@@ -165,16 +215,16 @@ func (c *SSH) SetDefaults() {
 		paths := c.keypathsFromConfig()
 		if len(paths) == 0 {
 			// no paths found in ssh config either, use defaults
-			paths = append(paths, defaultKeypaths...)
+			paths = append(paths, keyPaths...)
 		}
 
 		for _, p := range paths {
 			expanded, err := expandAndValidatePath(p)
 			if err != nil {
-				log.Tracef("%s: %s: %v", c, p, err)
+				c.logger().Tracef("%s: %s: %v", c, p, err)
 				continue
 			}
-			log.Debugf("%s: using identity file %s", c, expanded)
+			c.logger().Debugf("%s: using identity file %s", c, expanded)
 			c.keyPaths = append(c.keyPaths, expanded)
 		}
 
@@ -182,10 +232,71 @@ func (c *SSH) SetDefaults() {
 		// errors are handled differently when a keypath is explicitly set vs when it's defaulted
 		if uniq, found := findUniq(c.keyPaths, dummyhostKeyPaths); found {
 			c.KeyPath = &uniq
+			c.keyPathDefaulted = true
 		}
 	})
 }
 
+// Reset closes the connection and clears the state derived from the configuration, such as the
+// discovered identity files and the detected operating system. Use it to make SetDefaults and
+// Connect start over after the configuration has been changed.
+func (c *SSH) Reset() {
+	if c.client != nil {
+		_ = c.client.Close()
+	}
+	c.clearState()
+
+	if c.Bastion != nil {
+		c.Bastion.Reset()
+	}
+}
+
+// Clone returns a copy of the configuration that does not share the connection or the state derived
+// from the configuration with c. Unlike with Reset, the connection of c is left open.
+func (c *SSH) Clone() *SSH {
+	clone := *c
+	clone.clearState()
+	if c.Bastion != nil {
+		clone.Bastion = c.Bastion.Clone()
+	}
+	return &clone
+}
+
+// clearState forgets the connection and the state set up by SetDefaults and Connect without closing
+// anything
+func (c *SSH) clearState() {
+	c.client = nil
+
+	onceMu.Lock()
+	c.once = nil
+	onceMu.Unlock()
+
+	if c.keyPathDefaulted {
+		c.KeyPath = nil
+		c.keyPathDefaulted = false
+	}
+	c.keyPaths = nil
+	c.isWindows = false
+	c.knowOs = false
+	c.name = ""
+}
+
+// SetLogger sets the logger for the messages about the connection, the global logger is used when
+// none is set. Called by Connection when its Log is set.
+func (c *SSH) SetLogger(l log.Logger) {
+	c.log = l
+	if c.Bastion != nil {
+		c.Bastion.SetLogger(l)
+	}
+}
+
+func (c *SSH) logger() log.Logger {
+	if c.log != nil {
+		return c.log
+	}
+	return log.Global
+}
+
 // Protocol returns the protocol name, "SSH"
 func (c *SSH) Protocol() string {
 	return "SSH"
@@ -200,8 +311,11 @@ func (c *SSH) IPAddress() string {
 // you can override it with your own implementation for testing purposes
 var SSHConfigGetAll = ssh_config.GetAll
 
-// try with port, if no results, try without
+// try with port, if no results, try without. The alias is used as is when set.
 func (c *SSH) getConfigAll(key string) []string {
+	if c.Alias != "" {
+		return SSHConfigGetAll(c.Alias, key)
+	}
 	dst := net.JoinHostPort(c.Address, strconv.Itoa(c.Port))
 	if val := SSHConfigGetAll(dst, key); len(val) > 0 {
 		return val
@@ -223,30 +337,43 @@ func (c *SSH) IsConnected() bool {
 	return c.client != nil
 }
 
-// Disconnect closes the SSH connection
-func (c *SSH) Disconnect() {
-	c.client.Close()
+// Disconnect closes the SSH connection and the connection to the bastion host it was made through.
+// It is safe to call Disconnect when not connected and more than once.
+func (c *SSH) Disconnect() error {
+	var err error
+	if c.client != nil {
+		if closeErr := c.client.Close(); closeErr != nil && !errors.Is(closeErr, net.ErrClosed) && !errors.Is(closeErr, io.EOF) {
+			err = fmt.Errorf("close ssh connection: %w", closeErr)
+		}
+		c.client = nil
+	}
+	if c.Bastion != nil {
+		if bastionErr := c.Bastion.Disconnect(); err == nil && bastionErr != nil {
+			err = fmt.Errorf("bastion: %w", bastionErr)
+		}
+	}
+	return err
 }
 
 // IsWindows is true when the host is running windows
 func (c *SSH) IsWindows() bool {
 	if !c.knowOs && c.client != nil {
-		log.Debugf("%s: checking if host is windows", c)
+		c.logger().Debugf("%s: checking if host is windows", c)
 		if strings.Contains(string(c.client.ServerVersion()), "Windows") {
 			c.isWindows = true
 			c.knowOs = true
 			return true
 		}
 		c.isWindows = c.Exec("cmd.exe /c exit 0") == nil
-		log.Debugf("%s: host is windows: %t", c, c.isWindows)
+		c.logger().Debugf("%s: host is windows: %t", c, c.isWindows)
 		c.knowOs = true
 	}
 
 	return c.isWindows
 }
 
-func knownhostsCallback(path string, permissive bool) (ssh.HostKeyCallback, error) {
-	cb, err := hostkey.KnownHostsFileCallback(path, permissive)
+func knownhostsCallback(path string, permissive bool, confirm hostkey.ConfirmFunc) (ssh.HostKeyCallback, error) {
+	cb, err := hostkey.KnownHostsFileConfirmCallback(path, permissive, confirm)
 	if err != nil {
 		return nil, ErrCantConnect.Wrapf("create host key validator: %w", err)
 	}
@@ -255,17 +382,26 @@ func knownhostsCallback(path string, permissive bool) (ssh.HostKeyCallback, erro
 
 func (c *SSH) hostkeyCallback() (ssh.HostKeyCallback, error) {
 	if c.HostKey != "" {
-		log.Debugf("%s: using host key from config", c)
+		c.logger().Debugf("%s: using host key from config", c)
 		return hostkey.StaticKeyCallback(c.HostKey), nil
 	}
 
 	knownHostsMU.Lock()
 	defer knownHostsMU.Unlock()
 
+	if c.KnownHostsPath != "" {
+		path, err := expandPath(c.KnownHostsPath)
+		if err != nil {
+			return nil, err
+		}
+		c.logger().Tracef("%s: using known_hosts file from config: %s", c, path)
+		return knownhostsCallback(path, false, c.hostKeyConfirm())
+	}
+
 	var permissive bool
 	strict := c.getConfigAll("StrictHostkeyChecking")
 	if len(strict) > 0 && strict[0] == "no" {
-		log.Debugf("%s: StrictHostkeyChecking is set to 'no'", c)
+		c.logger().Debugf("%s: StrictHostkeyChecking is set to 'no'", c)
 		permissive = true
 	}
 
@@ -273,8 +409,8 @@ func (c *SSH) hostkeyCallback() (ssh.HostKeyCallback, error) {
 		if path == "" {
 			return hostkey.InsecureIgnoreHostKeyCallback, nil
 		}
-		log.Tracef("%s: using known_hosts file from SSH_KNOWN_HOSTS: %s", c, path)
-		return knownhostsCallback(path, permissive)
+		c.logger().Tracef("%s: using known_hosts file from SSH_KNOWN_HOSTS: %s", c, path)
+		return knownhostsCallback(path, permissive, c.hostKeyConfirm())
 	}
 
 	var khPath string
@@ -294,17 +430,17 @@ func (c *SSH) hostkeyCallback() (ssh.HostKeyCallback, error) {
 	}
 
 	if khPath != "" {
-		log.Tracef("%s: using known_hosts file from ssh config %s", c, khPath)
-		return knownhostsCallback(khPath, permissive)
+		c.logger().Tracef("%s: using known_hosts file from ssh config %s", c, khPath)
+		return knownhostsCallback(khPath, permissive, c.hostKeyConfirm())
 	}
 
-	log.Tracef("%s: using default known_hosts file %s", c, hostkey.DefaultKnownHostsPath)
+	c.logger().Tracef("%s: using default known_hosts file %s", c, hostkey.DefaultKnownHostsPath)
 	defaultPath, err := expandPath(hostkey.DefaultKnownHostsPath)
 	if err != nil {
 		return nil, err
 	}
 
-	return knownhostsCallback(defaultPath, permissive)
+	return knownhostsCallback(defaultPath, permissive, c.hostKeyConfirm())
 }
 
 func (c *SSH) clientConfig() (*ssh.ClientConfig, error) {
@@ -319,13 +455,13 @@ func (c *SSH) clientConfig() (*ssh.ClientConfig, error) {
 	config.HostKeyCallback = hkc
 
 	var signers []ssh.Signer
-	agent, err := agentClient()
+	agent, err := agentClient(c.logger())
 	if err != nil {
-		log.Tracef("%s: failed to get ssh agent client: %v", c, err)
+		c.logger().Tracef("%s: failed to get ssh agent client: %v", c, err)
 	} else {
 		signers, err = agent.Signers()
 		if err != nil {
-			log.Debugf("%s: failed to list signers from ssh agent: %v", c, err)
+			c.logger().Debugf("%s: failed to list signers from ssh agent: %v", c, err)
 		}
 	}
 
@@ -333,18 +469,18 @@ func (c *SSH) clientConfig() (*ssh.ClientConfig, error) {
 		if am, ok := authMethodCache.Load(keyPath); ok {
 			switch authM := am.(type) {
 			case ssh.AuthMethod:
-				log.Tracef("%s: using cached auth method for %s", c, keyPath)
+				c.logger().Tracef("%s: using cached auth method for %s", c, keyPath)
 				config.Auth = append(config.Auth, authM)
 			case error:
-				log.Tracef("%s: already discarded key %s: %v", c, keyPath, authM)
+				c.logger().Tracef("%s: already discarded key %s: %v", c, keyPath, authM)
 			default:
-				log.Tracef("%s: unexpected type %T for cached auth method for %s", c, am, keyPath)
+				c.logger().Tracef("%s: unexpected type %T for cached auth method for %s", c, am, keyPath)
 			}
 			continue
 		}
 		privateKeyAuth, err := c.pkeySigner(signers, keyPath)
 		if err != nil {
-			log.Debugf("%s: failed to obtain a signer for identity %s: %v", c, keyPath, err)
+			c.logger().Debugf("%s: failed to obtain a signer for identity %s: %v", c, keyPath, err)
 			// store the error so this key won't be loaded again
 			authMethodCache.Store(keyPath, err)
 		} else {
@@ -357,13 +493,19 @@ func (c *SSH) clientConfig() (*ssh.ClientConfig, error) {
 		if len(signers) == 0 {
 			return nil, ErrCantConnect.Wrapf("no usable authentication method found")
 		}
-		log.Debugf("%s: using all keys (%d) from ssh agent because a keypath was not explicitly given", c, len(signers))
+		c.logger().Debugf("%s: using all keys (%d) from ssh agent because a keypath was not explicitly given", c, len(signers))
 		config.Auth = append(config.Auth, ssh.PublicKeys(signers...))
 	}
 
 	return config, nil
 }
 
+// isSSHAuthError returns true if the ssh handshake failed because none of the authentication methods
+// were accepted. The ssh package does not have a distinct error type for it.
+func isSSHAuthError(err error) bool {
+	return strings.Contains(err.Error(), "unable to authenticate")
+}
+
 // Connect opens the SSH connection
 func (c *SSH) Connect() error {
 	if err := defaults.Set(c); err != nil {
@@ -377,11 +519,23 @@ func (c *SSH) Connect() error {
 
 	dst := net.JoinHostPort(c.Address, strconv.Itoa(c.Port))
 
+	// the ssh package does not wrap the error of the host key callback, it is kept here to be able
+	// to match it
+	var hostKeyErr error
+	hkc := config.HostKeyCallback
+	config.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		hostKeyErr = hkc(hostname, remote, key)
+		return hostKeyErr
+	}
+
 	if c.Bastion == nil {
 		clientDirect, err := ssh.Dial("tcp", dst, config)
 		if err != nil {
-			if errors.Is(err, hostkey.ErrHostKeyMismatch) {
-				return ErrCantConnect.Wrap(err)
+			if hostKeyErr != nil {
+				return ErrCantConnect.Wrapf("ssh dial: %w", hostKeyErr)
+			}
+			if isSSHAuthError(err) {
+				return ErrAuthFailed.Wrap(err)
 			}
 			return fmt.Errorf("ssh dial: %w", err)
 		}
@@ -389,20 +543,26 @@ func (c *SSH) Connect() error {
 		return nil
 	}
 
+	c.Bastion.parentHostKeyConfirm = c.hostKeyConfirm()
 	if err := c.Bastion.Connect(); err != nil {
-		if errors.Is(err, hostkey.ErrHostKeyMismatch) {
+		if errors.Is(err, hostkey.ErrHostKeyMismatch) || errors.Is(err, hostkey.ErrHostKeyRejected) {
 			return ErrCantConnect.Wrapf("bastion connect: %w", err)
 		}
 		return err
 	}
 	bconn, err := c.Bastion.client.Dial("tcp", dst)
 	if err != nil {
+		_ = c.Bastion.Disconnect()
 		return fmt.Errorf("bastion dial: %w", err)
 	}
 	client, chans, reqs, err := ssh.NewClientConn(bconn, dst, config)
 	if err != nil {
-		if errors.Is(err, hostkey.ErrHostKeyMismatch) {
-			return ErrCantConnect.Wrapf("bastion client connect: %w", err)
+		_ = c.Bastion.Disconnect()
+		if hostKeyErr != nil {
+			return ErrCantConnect.Wrapf("bastion client connect: %w", hostKeyErr)
+		}
+		if isSSHAuthError(err) {
+			return ErrAuthFailed.Wrapf("bastion client connect: %w", err)
 		}
 		return fmt.Errorf("bastion client connect: %w", err)
 	}
@@ -418,7 +578,7 @@ func (c *SSH) pubkeySigner(signers []ssh.Signer, key ssh.PublicKey) (ssh.AuthMet
 
 	for _, s := range signers {
 		if bytes.Equal(key.Marshal(), s.PublicKey().Marshal()) {
-			log.Debugf("%s: signer for public key available in ssh agent", c)
+			c.logger().Debugf("%s: signer for public key available in ssh agent", c)
 			return ssh.PublicKeys(s), nil
 		}
 	}
@@ -427,7 +587,7 @@ func (c *SSH) pubkeySigner(signers []ssh.Signer, key ssh.PublicKey) (ssh.AuthMet
 }
 
 func (c *SSH) pkeySigner(signers []ssh.Signer, path string) (ssh.AuthMethod, error) {
-	log.Tracef("%s: checking identity file %s", c, path)
+	c.logger().Tracef("%s: checking identity file %s", c, path)
 	key, err := os.ReadFile(path)
 	if err != nil {
 		return nil, ErrCantConnect.Wrapf("read identity file: %w", err)
@@ -435,19 +595,19 @@ func (c *SSH) pkeySigner(signers []ssh.Signer, path string) (ssh.AuthMethod, err
 
 	pubKey, _, _, _, err := ssh.ParseAuthorizedKey(key)
 	if err == nil {
-		log.Debugf("%s: file %s is a public key", c, path)
+		c.logger().Debugf("%s: file %s is a public key", c, path)
 		return c.pubkeySigner(signers, pubKey)
 	}
 
 	signer, err := ssh.ParsePrivateKey(key)
 	if err == nil {
-		log.Debugf("%s: using an unencrypted private key from %s", c, path)
+		c.logger().Debugf("%s: using an unencrypted private key from %s", c, path)
 		return ssh.PublicKeys(signer), nil
 	}
 
 	var ppErr *ssh.PassphraseMissingError
 	if errors.As(err, &ppErr) { //nolint:nestif
-		log.Debugf("%s: key %s is encrypted", c, path)
+		c.logger().Debugf("%s: key %s is encrypted", c, path)
 
 		if len(signers) > 0 {
 			if signer, err := c.pkeySigner(signers, path+".pub"); err == nil {
@@ -455,12 +615,11 @@ func (c *SSH) pkeySigner(signers []ssh.Signer, path string) (ssh.AuthMethod, err
 			}
 		}
 
-		if c.PasswordCallback != nil {
-			log.Tracef("%s: asking for a password to decrypt %s", c, path)
-			pass, err := c.PasswordCallback()
-			if err != nil {
-				return nil, ErrCantConnect.Wrapf("password provider failed")
-			}
+		pass, ok, err := c.keyPassphrase(path)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
 			signer, err := ssh.ParsePrivateKeyWithPassphrase(key, []byte(pass))
 			if err != nil {
 				return nil, ErrCantConnect.Wrapf("protected key decoding failed: %w", err)
@@ -472,11 +631,55 @@ func (c *SSH) pkeySigner(signers []ssh.Signer, path string) (ssh.AuthMethod, err
 	return nil, ErrCantConnect.Wrapf("can't parse keyfile %s: %w", path, err)
 }
 
+// keyPassphrase returns the passphrase for an encrypted key from PasswordCallback or the credential
+// source. It returns false when neither has it.
+func (c *SSH) keyPassphrase(path string) (string, bool, error) {
+	if c.PasswordCallback == nil {
+		return lookupCredential(secretsOrDefault(c.redactor), c.credentials, CredentialKeyPassphrase, c.Address)
+	}
+	c.logger().Tracef("%s: asking for a password to decrypt %s", c, path)
+	pass, err := c.PasswordCallback()
+	if err != nil {
+		return "", false, ErrCantConnect.Wrapf("password provider failed")
+	}
+	secretsOrDefault(c.redactor).Value(pass)
+	return pass, true, nil
+}
+
 const (
 	ptyWidth  = 80
 	ptyHeight = 40
 )
 
+// openSubsystem starts an SSH subsystem such as "sftp" and returns its stdin and stdout. Closing the
+// returned closer ends the subsystem.
+func (c *SSH) openSubsystem(name string) (io.WriteCloser, io.Reader, io.Closer, error) {
+	if c.client == nil {
+		return nil, nil, nil, ErrNotConnected
+	}
+
+	session, err := c.client.NewSession()
+	if err != nil {
+		return nil, nil, nil, ErrCantConnect.Wrapf("session: %w", err)
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		_ = session.Close()
+		return nil, nil, nil, ErrCommandFailed.Wrapf("stdin pipe: %w", err)
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		_ = session.Close()
+		return nil, nil, nil, ErrCommandFailed.Wrapf("stdout pipe: %w", err)
+	}
+	if err := session.RequestSubsystem(name); err != nil {
+		_ = session.Close()
+		return nil, nil, nil, ErrNotSupported.Wrapf("subsystem %s: %w", name, err)
+	}
+
+	return stdin, stdout, session, nil
+}
+
 // ExecStreams executes a command on the remote host and uses the passed in streams for stdin, stdout and stderr. It returns a Waiter with a .Wait() function that
 // blocks until the command finishes and returns an error if the exit code is not zero.
 func (c *SSH) ExecStreams(cmd string, stdin io.ReadCloser, stdout, stderr io.Writer, opts ...exec.Option) (Waiter, error) {
@@ -503,7 +706,7 @@ func (c *SSH) ExecStreams(cmd string, stdin io.ReadCloser, stdout, stderr io.Wri
 		return nil, ErrCantConnect.Wrapf("start: %w", err)
 	}
 
-	return session, nil
+	return withTimeout(session, execOpts.Timeout, func() { killSession(session) }), nil
 }
 
 // Exec executes a command on the host
@@ -520,7 +723,7 @@ func (c *SSH) Exec(cmd string, opts ...exec.Option) error { //nolint:funlen,cycl
 		return fmt.Errorf("build command: %w", err)
 	}
 
-	if len(execOpts.Stdin) == 0 && c.knowOs && !c.isWindows {
+	if execOpts.StdinSource() == nil && c.knowOs && !c.isWindows {
 		// Only request a PTY when there's no STDIN data, because
 		// then you would need to send a CTRL-D after input to signal
 		// the end of text
@@ -540,16 +743,23 @@ func (c *SSH) Exec(cmd string, opts ...exec.Option) error { //nolint:funlen,cycl
 	if err := session.Start(cmd); err != nil {
 		return fmt.Errorf("ssh session start: %w", err)
 	}
+	timedOut := startTimeout(execOpts.Timeout, func() { killSession(session) })
 
-	if len(execOpts.Stdin) > 0 {
+	var wg sync.WaitGroup
+
+	// stdin is written while the output is being read, a large input could otherwise block forever
+	var stdinErr error
+	if src := execOpts.StdinSource(); src != nil {
 		execOpts.LogStdin(c.String())
-		if _, err := io.WriteString(stdin, execOpts.Stdin); err != nil {
-			return fmt.Errorf("write stdin: %w", err)
-		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer stdin.Close()
+			_, stdinErr = io.Copy(stdin, src)
+		}()
+	} else {
+		stdin.Close()
 	}
-	stdin.Close()
-
-	var wg sync.WaitGroup
 
 	wg.Add(1)
 	go func() {
@@ -578,6 +788,14 @@ func (c *SSH) Exec(cmd string, opts ...exec.Option) error { //nolint:funlen,cycl
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
+		if execOpts.ErrWriter != nil {
+			n, err := io.Copy(execOpts.ErrWriter, stderr)
+			gotErrors = n > 0
+			if err != nil {
+				execOpts.LogErrorf("%s: failed to stream stderr: %v", c, err)
+			}
+			return
+		}
 		outputScanner := bufio.NewScanner(stderr)
 
 		for outputScanner.Scan() {
@@ -593,10 +811,17 @@ func (c *SSH) Exec(cmd string, opts ...exec.Option) error { //nolint:funlen,cycl
 
 	err = session.Wait()
 	wg.Wait()
+	execOpts.FlushOutput()
 
+	if timedOut() {
+		return ErrTimeout.Wrapf("command did not finish in %s", execOpts.Timeout)
+	}
 	if err != nil {
 		return fmt.Errorf("ssh session wait: %w", err)
 	}
+	if stdinErr != nil {
+		return fmt.Errorf("write stdin: %w", stdinErr)
+	}
 
 	if c.knowOs && c.isWindows && (!execOpts.AllowWinStderr && gotErrors) {
 		return ErrCommandFailed.Wrapf("data in stderr")
@@ -605,8 +830,21 @@ func (c *SSH) Exec(cmd string, opts ...exec.Option) error { //nolint:funlen,cycl
 	return nil
 }
 
+// killSession asks the remote end to kill the command and closes the session. Many ssh servers ignore
+// signals, closing the session makes them hang up on the command.
+func killSession(session *ssh.Session) {
+	_ = session.Signal(ssh.SIGKILL)
+	_ = session.Close()
+}
+
 // ExecInteractive executes a command on the host and copies stdin/stdout/stderr from local host
 func (c *SSH) ExecInteractive(cmd string) error {
+	return c.ExecInteractiveWithOutput(cmd, nil)
+}
+
+// ExecInteractiveWithOutput is like ExecInteractive but also copies the output of the session into
+// output when it is not nil
+func (c *SSH) ExecInteractiveWithOutput(cmd string, output io.Writer) error {
 	session, err := c.client.NewSession()
 	if err != nil {
 		return fmt.Errorf("ssh new session: %w", err)
@@ -615,6 +853,10 @@ func (c *SSH) ExecInteractive(cmd string) error {
 
 	session.Stdout = os.Stdout
 	session.Stderr = os.Stderr
+	if output != nil {
+		session.Stdout = io.MultiWriter(os.Stdout, output)
+		session.Stderr = io.MultiWriter(os.Stderr, output)
+	}
 
 	fd := int(os.Stdin.Fd())
 	old, err := term.MakeRaw(fd)
@@ -6,6 +6,7 @@ import (
 	"github.com/Microsoft/go-winio"
 	"github.com/davidmz/go-pageant"
 	"github.com/k0sproject/rig/errstring"
+	"github.com/k0sproject/rig/log"
 	"golang.org/x/crypto/ssh/agent"
 )
 
@@ -16,10 +17,12 @@ const (
 // ErrSSHAgent is returned when connection to SSH agent fails
 var ErrSSHAgent = errstring.New("connect win ssh agent")
 
-func agentClient() (agent.Agent, error) {
+func agentClient(logger log.Logger) (agent.Agent, error) {
 	if pageant.Available() {
+		logger.Debugf("using pageant")
 		return pageant.New(), nil
 	}
+	logger.Debugf("using %s", openSshAgentPipe)
 	sock, err := winio.DialPipe(openSshAgentPipe, nil)
 	if err != nil {
 		return nil, ErrSSHAgent.Wrapf("can't connect to ssh agent: %w", err)
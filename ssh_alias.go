@@ -0,0 +1,73 @@
+package rig
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/creasty/defaults"
+)
+
+// configValue returns the first value for the key in the ssh config of the host
+func (c *SSH) configValue(key string) string {
+	if values := c.getConfigAll(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// applyAlias fills in the connection parameters from the ssh config entry of Alias. The HostName
+// of the entry is used as the address, or the alias itself when there is none. The user and the port
+// of the entry are used when not set and ProxyJump sets up the chain of bastion hosts, unless
+// Bastion is already set.
+func (c *SSH) applyAlias() {
+	if c.Alias == "" {
+		return
+	}
+	c.name = ""
+	if c.Address == "" {
+		c.Address = c.Alias
+		if hostname := c.configValue("HostName"); hostname != "" {
+			c.Address = hostname
+		}
+	}
+	if user := c.configValue("User"); user != "" && c.User == "" {
+		c.User = user
+	}
+	if port, err := strconv.Atoi(c.configValue("Port")); err == nil && port > 0 && c.Port == 0 {
+		c.Port = port
+	}
+	if c.Bastion == nil {
+		c.Bastion = c.proxyJumpBastion(c.configValue("ProxyJump"))
+	}
+	c.logger().Debugf("%s: using ssh config alias %s", c, c.Alias)
+}
+
+// proxyJumpBastion returns the bastion chain for a ProxyJump value such as "user@jump1:2222,jump2".
+// The hosts are connected to in order, so the last one is the bastion of the target host. Each hop
+// is looked up from the ssh config as an alias.
+func (c *SSH) proxyJumpBastion(proxyJump string) *SSH {
+	if proxyJump == "" || strings.EqualFold(proxyJump, "none") {
+		return nil
+	}
+	var bastion *SSH
+	for _, hop := range strings.Split(proxyJump, ",") {
+		hop = strings.TrimSpace(strings.TrimPrefix(hop, "ssh://"))
+		if hop == "" {
+			continue
+		}
+		jump := &SSH{Bastion: bastion, KnownHostsPath: c.KnownHostsPath, log: c.log}
+		if user, host, ok := strings.Cut(hop, "@"); ok {
+			jump.User = user
+			hop = host
+		}
+		if host, port, err := net.SplitHostPort(hop); err == nil {
+			hop = host
+			jump.Port, _ = strconv.Atoi(port)
+		}
+		jump.Alias = hop
+		_ = defaults.Set(jump)
+		bastion = jump
+	}
+	return bastion
+}
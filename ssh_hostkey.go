@@ -0,0 +1,38 @@
+package rig
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/k0sproject/rig/pkg/ssh/hostkey"
+	"golang.org/x/term"
+)
+
+// hostKeyConfirm returns the function that confirms the keys of new hosts, nil when they are trusted
+// as is
+func (c *SSH) hostKeyConfirm() hostkey.ConfirmFunc {
+	if c.HostKeyConfirmCallback != nil {
+		return c.HostKeyConfirmCallback
+	}
+	return c.parentHostKeyConfirm
+}
+
+// PromptHostKeyConfirm asks on the terminal whether to trust the key of a new host, like OpenSSH
+// does, for use as SSH.HostKeyConfirmCallback. The key is trusted when the answer is "yes" or the
+// fingerprint. It is rejected when stdin is not a terminal.
+func PromptHostKeyConfirm(host, fingerprint string) bool {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return false
+	}
+	promptMu.Lock()
+	defer promptMu.Unlock()
+	fmt.Fprintf(os.Stderr, "The authenticity of host '%s' can't be established.\nKey fingerprint is %s.\nAre you sure you want to continue connecting (yes/no/[fingerprint])? ", host, fingerprint)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	answer = strings.TrimSpace(answer)
+	return strings.EqualFold(answer, "yes") || answer == fingerprint
+}
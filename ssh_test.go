@@ -0,0 +1,164 @@
+package rig
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/creasty/defaults"
+	"github.com/k0sproject/rig/pkg/ssh/hostkey"
+	"github.com/k0sproject/rig/pkg/ssh/sshtest"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSSHReset(t *testing.T) {
+	dir := t.TempDir()
+	key1 := filepath.Join(dir, "key1")
+	key2 := filepath.Join(dir, "key2")
+	require.NoError(t, os.WriteFile(key1, []byte("key"), 0o600))
+	require.NoError(t, os.WriteFile(key2, []byte("key"), 0o600))
+
+	c := &SSH{Address: "127.0.0.1", Port: 22, KeyPath: &key1}
+	c.SetDefaults()
+	require.Equal(t, []string{key1}, c.keyPaths)
+
+	c.KeyPath = &key2
+	c.SetDefaults()
+	require.Equal(t, []string{key1}, c.keyPaths, "defaults are only set once")
+
+	c.Reset()
+	c.SetDefaults()
+	require.Equal(t, []string{key2}, c.keyPaths)
+
+	require.Contains(t, c.String(), "127.0.0.1")
+	c.Address = "127.0.0.2"
+	require.Contains(t, c.String(), "127.0.0.1")
+	c.Reset()
+	require.Contains(t, c.String(), "127.0.0.2")
+}
+
+func TestSSHAlias(t *testing.T) {
+	config := map[string]map[string]string{
+		"mybox":  {"HostName": "10.0.0.1", "User": "admin", "Port": "2222", "ProxyJump": "jump"},
+		"jump":   {"HostName": "10.0.0.254", "ProxyJump": "ops@outer:2200"},
+		"direct": {},
+	}
+	getAll := SSHConfigGetAll
+	SSHConfigGetAll = func(alias, key string) []string {
+		if v, ok := config[alias][key]; ok {
+			return []string{v}
+		}
+		return nil
+	}
+	defer func() { SSHConfigGetAll = getAll }()
+
+	key := "/nonexistent"
+	c := &SSH{Alias: "mybox", KeyPath: &key}
+	require.NoError(t, defaults.Set(c))
+	require.Equal(t, "10.0.0.1", c.Address)
+	require.Equal(t, "admin", c.User)
+	require.Equal(t, 2222, c.Port)
+	require.NotNil(t, c.Bastion)
+	require.Equal(t, "10.0.0.254", c.Bastion.Address)
+	require.Equal(t, "root", c.Bastion.User)
+	require.Equal(t, 22, c.Bastion.Port)
+	require.NotNil(t, c.Bastion.Bastion, "the jump host has a proxyjump of its own")
+	require.Equal(t, "outer", c.Bastion.Bastion.Address)
+	require.Equal(t, "ops", c.Bastion.Bastion.User)
+	require.Equal(t, 2200, c.Bastion.Bastion.Port)
+
+	c = &SSH{Alias: "direct", User: "explicit", KeyPath: &key}
+	require.NoError(t, defaults.Set(c))
+	require.Equal(t, "direct", c.Address)
+	require.Equal(t, "explicit", c.User)
+	require.Nil(t, c.Bastion)
+}
+
+func TestSSHDisconnectNotConnected(t *testing.T) {
+	c := &SSH{Address: "10.0.0.1", Bastion: &SSH{Address: "10.0.0.2"}}
+	require.NoError(t, c.Disconnect())
+	require.NoError(t, c.Disconnect())
+	require.NoError(t, (&Connection{SSH: c}).Disconnect())
+}
+
+func TestSSHKnownHostsPath(t *testing.T) {
+	server, err := sshtest.NewServer()
+	require.NoError(t, err)
+	defer server.Close()
+
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "id_ed25519")
+	_, err = sshtest.GenerateKeyFile(keyPath)
+	require.NoError(t, err)
+	envPath := filepath.Join(dir, "env_known_hosts")
+	t.Setenv("SSH_KNOWN_HOSTS", envPath)
+
+	knownHosts := filepath.Join(dir, "known_hosts")
+	c := &SSH{Address: server.Host(), Port: server.Port(), User: "test", KeyPath: &keyPath, KnownHostsPath: knownHosts}
+	require.NoError(t, c.Connect())
+	require.NoError(t, c.Disconnect())
+
+	content, err := os.ReadFile(knownHosts)
+	require.NoError(t, err)
+	require.Contains(t, string(content), server.HostKeyString())
+	require.NoFileExists(t, envPath)
+}
+
+func TestSSHHostKeyConfirm(t *testing.T) {
+	server, err := sshtest.NewServer()
+	require.NoError(t, err)
+	defer server.Close()
+
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "id_ed25519")
+	_, err = sshtest.GenerateKeyFile(keyPath)
+	require.NoError(t, err)
+	knownHosts := filepath.Join(dir, "known_hosts")
+
+	var confirmed []string
+	accept := false
+	c := &SSH{Address: server.Host(), Port: server.Port(), User: "test", KeyPath: &keyPath, KnownHostsPath: knownHosts}
+	c.HostKeyConfirmCallback = func(host, fingerprint string) bool {
+		confirmed = append(confirmed, host+" "+fingerprint)
+		return accept
+	}
+	err = c.Connect()
+	require.ErrorIs(t, err, ErrCantConnect)
+	require.ErrorIs(t, err, hostkey.ErrHostKeyRejected)
+	content, err := os.ReadFile(knownHosts)
+	require.NoError(t, err)
+	require.Empty(t, content)
+
+	accept = true
+	require.NoError(t, c.Connect())
+	require.NoError(t, c.Disconnect())
+	expected := server.Addr + " " + ssh.FingerprintSHA256(server.HostKey())
+	require.Equal(t, []string{expected, expected}, confirmed)
+
+	// the host is known now
+	require.NoError(t, c.Connect())
+	require.NoError(t, c.Disconnect())
+	require.Len(t, confirmed, 2)
+}
+
+func TestSSHClone(t *testing.T) {
+	c := &SSH{Address: "127.0.0.1", Port: 22, Bastion: &SSH{Address: "127.0.0.2", Port: 22}}
+	c.SetDefaults()
+	c.client = &ssh.Client{}
+	c.Bastion.client = &ssh.Client{}
+	require.Contains(t, c.String(), "127.0.0.1")
+
+	clone := c.Clone()
+	require.Nil(t, clone.client)
+	require.Nil(t, clone.Bastion.client)
+	require.NotSame(t, c.Bastion, clone.Bastion)
+	require.NotNil(t, c.client, "the original keeps its connection")
+	require.NotNil(t, c.Bastion.client)
+
+	clone.Address = "127.0.0.3"
+	clone.Bastion.Address = "127.0.0.4"
+	require.Contains(t, clone.String(), "127.0.0.3")
+	require.Contains(t, c.String(), "127.0.0.1")
+	require.Equal(t, "127.0.0.2", c.Bastion.Address)
+}
@@ -0,0 +1,168 @@
+package rig
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/k0sproject/rig/exec"
+	"github.com/k0sproject/rig/pkg/clock"
+	"gopkg.in/yaml.v3"
+)
+
+// TemplateFuncs are the functions available in templates rendered by UploadTemplate in addition
+// to the text/template builtins. They follow the naming of the commonly used sprig library. There is
+// no function for reading the environment variables of the local process, so that templates can't
+// leak secrets from it. Pass the needed values in the data, or add a function that only returns
+// the allowed variables.
+var TemplateFuncs = template.FuncMap{
+	"default":  tplDefault,
+	"empty":    tplEmpty,
+	"required": tplRequired,
+	"quote":    func(s any) string { return strconv.Quote(fmt.Sprint(s)) },
+	"squote":   func(s any) string { return "'" + strings.ReplaceAll(fmt.Sprint(s), "'", "''") + "'" },
+	"upper":    strings.ToUpper,
+	"lower":    strings.ToLower,
+	"trim":     strings.TrimSpace,
+	"replace":  func(old, replacement, s string) string { return strings.ReplaceAll(s, old, replacement) },
+	"contains": func(substr, s string) bool { return strings.Contains(s, substr) },
+	"split":    func(sep, s string) []string { return strings.Split(s, sep) },
+	"join":     tplJoin,
+	"indent":   tplIndent,
+	"nindent":  func(n int, s string) string { return "\n" + tplIndent(n, s) },
+	"toJson":   tplToJSON,
+	"toYaml":   tplToYAML,
+	"b64enc":   func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+	"b64dec":   tplB64Dec,
+}
+
+// UploadTemplate renders the local text/template file src with data and uploads the result to the
+// remote path dst. The functions in TemplateFuncs are available in the template. The template is
+// rendered in memory and written through the remote filesystem, so the rendered content never
+// touches the local disk. The file gets the mode of the template file and the checksum, sudo,
+// atomic and preserve options of Upload apply.
+func (c *Connection) UploadTemplate(src, dst string, data any, opts ...exec.Option) (err error) {
+	if err := c.checkConnected(); err != nil {
+		return err
+	}
+	opts = withCorrelationID(opts)
+	opts, span := c.startTransferSpan(AuditUpload, src, dst, opts)
+	defer func(start time.Time) {
+		err = c.correlateError(opts, err)
+		c.transferDone(AuditUpload, src, dst, start, span, err)
+	}(clock.Default.Now())
+
+	stat, err := os.Stat(src)
+	if err != nil {
+		return ErrInvalidPath.Wrapf("stat template %s: %w", src, err)
+	}
+
+	tpl, err := newTemplate(filepath.Base(src)).ParseFiles(src)
+	if err != nil {
+		return ErrValidationFailed.Wrapf("parse template %s: %w", src, err)
+	}
+
+	shasum, err := newChecksum(opts...)
+	if err != nil {
+		return ErrUploadFailed.Wrap(err)
+	}
+
+	content := bytes.NewBuffer(nil)
+	if err := tpl.Execute(io.MultiWriter(content, hashWriter(shasum)), data); err != nil {
+		return ErrValidationFailed.Wrapf("render template %s: %w", src, err)
+	}
+
+	if err := c.WriteFile(dst, content.Bytes(), stat.Mode().Perm(), opts...); err != nil {
+		return ErrUploadFailed.Wrap(err)
+	}
+
+	if err := c.verifyChecksum(dst, shasum, opts...); err != nil {
+		return ErrUploadFailed.Wrap(err)
+	}
+
+	return c.preserve(src, dst, opts...)
+}
+
+// newTemplate returns a template that has the TemplateFuncs available and fails on missing map keys
+func newTemplate(name string) *template.Template {
+	return template.New(name).Funcs(TemplateFuncs).Option("missingkey=error")
+}
+
+func tplEmpty(value any) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() { //nolint:exhaustive
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	default:
+		return v.IsZero()
+	}
+}
+
+func tplDefault(def any, value ...any) any {
+	if len(value) == 0 || tplEmpty(value[0]) {
+		return def
+	}
+	return value[0]
+}
+
+func tplRequired(msg string, value any) (any, error) {
+	if tplEmpty(value) {
+		return nil, ErrValidationFailed.Wrapf("%s", msg)
+	}
+	return value, nil
+}
+
+func tplJoin(sep string, list any) string {
+	v := reflect.ValueOf(list)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return fmt.Sprint(list)
+	}
+	parts := make([]string, v.Len())
+	for i := range parts {
+		parts[i] = fmt.Sprint(v.Index(i).Interface())
+	}
+	return strings.Join(parts, sep)
+}
+
+func tplIndent(n int, s string) string {
+	pad := strings.Repeat(" ", n)
+	return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+}
+
+func tplToJSON(value any) (string, error) {
+	out, err := json.Marshal(value)
+	if err != nil {
+		return "", ErrValidationFailed.Wrapf("toJson: %w", err)
+	}
+	return string(out), nil
+}
+
+func tplToYAML(value any) (string, error) {
+	out, err := yaml.Marshal(value)
+	if err != nil {
+		return "", ErrValidationFailed.Wrapf("toYaml: %w", err)
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+func tplB64Dec(s string) (string, error) {
+	out, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", ErrValidationFailed.Wrapf("b64dec: %w", err)
+	}
+	return string(out), nil
+}
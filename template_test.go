@@ -0,0 +1,78 @@
+package rig
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/creasty/defaults"
+	"github.com/k0sproject/rig/exec"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplateFuncs(t *testing.T) {
+	data := map[string]any{
+		"name":  "rig",
+		"empty": "",
+		"list":  []string{"a", "b"},
+		"nested": map[string]any{
+			"key": "value",
+		},
+	}
+	for _, tc := range []struct {
+		text string
+		want string
+	}{
+		{`{{ .empty | default "fallback" }}`, "fallback"},
+		{`{{ .name | default "fallback" }}`, "rig"},
+		{`{{ .name | upper | quote }}`, `"RIG"`},
+		{`{{ "it's" | squote }}`, `'it''s'`},
+		{`{{ .list | join "," }}`, "a,b"},
+		{`{{ "a-b" | replace "-" "_" }}`, "a_b"},
+		{`x:{{ .nested | toYaml | nindent 2 }}`, "x:\n  key: value"},
+		{`{{ .nested | toJson }}`, `{"key":"value"}`},
+		{`{{ "rig" | b64enc | b64dec }}`, "rig"},
+	} {
+		tpl, err := newTemplate("").Parse(tc.text)
+		require.NoError(t, err)
+		buf := bytes.NewBuffer(nil)
+		require.NoError(t, tpl.Execute(buf, data), tc.text)
+		require.Equal(t, tc.want, buf.String(), tc.text)
+	}
+
+	tpl, err := newTemplate("").Parse(`{{ required "name is required" .empty }}`)
+	require.NoError(t, err)
+	require.ErrorContains(t, tpl.Execute(bytes.NewBuffer(nil), data), "name is required")
+
+	tpl, err = newTemplate("").Parse(`{{ .missing }}`)
+	require.NoError(t, err)
+	require.Error(t, tpl.Execute(bytes.NewBuffer(nil), data))
+}
+
+func TestUploadTemplate(t *testing.T) {
+	c := &Connection{Localhost: &Localhost{Enabled: true}}
+	require.NoError(t, defaults.Set(c))
+	require.NoError(t, c.Connect())
+	t.Cleanup(func() { _ = c.Disconnect() })
+
+	// the rendered content must not be written to a local temporary file
+	t.Setenv("TMPDIR", filepath.Join(t.TempDir(), "missing"))
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "config.tpl")
+	require.NoError(t, os.WriteFile(src, []byte("password: {{ .password | quote }}\n"), 0o640))
+	dst := filepath.Join(dir, "config.yaml")
+
+	require.NoError(t, c.UploadTemplate(src, dst, map[string]any{"password": "secret"}, exec.Checksum(ChecksumSHA1)))
+
+	content, err := os.ReadFile(dst)
+	require.NoError(t, err)
+	require.Equal(t, "password: \"secret\"\n", string(content))
+	stat, err := os.Stat(dst)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o640), stat.Mode().Perm())
+
+	require.ErrorIs(t, c.UploadTemplate(src, dst, map[string]any{}), ErrValidationFailed)
+}
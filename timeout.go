@@ -0,0 +1,63 @@
+package rig
+
+import (
+	"sync"
+	"time"
+
+	"github.com/k0sproject/rig/pkg/clock"
+)
+
+// startTimeout calls stop when the duration d elapses. The returned function cancels the timeout and
+// returns true if it had already been exceeded. A zero duration disables the timeout.
+func startTimeout(d time.Duration, stop func()) func() bool {
+	if d <= 0 {
+		return func() bool { return false }
+	}
+
+	cancel := make(chan struct{})
+	expired := make(chan struct{})
+	go func() {
+		select {
+		case <-clock.Default.After(d):
+			close(expired)
+			stop()
+		case <-cancel:
+		}
+	}()
+
+	var once sync.Once
+	return func() bool {
+		once.Do(func() { close(cancel) })
+		select {
+		case <-expired:
+			return true
+		default:
+			return false
+		}
+	}
+}
+
+// timeoutWaiter is a Waiter for a command started with exec.Timeout
+type timeoutWaiter struct {
+	Waiter
+	timeout time.Duration
+	done    func() bool
+}
+
+// withTimeout returns a Waiter that makes waiter return ErrTimeout when stop was called because the
+// timeout d was exceeded
+func withTimeout(waiter Waiter, d time.Duration, stop func()) Waiter {
+	if d <= 0 {
+		return waiter
+	}
+	return &timeoutWaiter{Waiter: waiter, timeout: d, done: startTimeout(d, stop)}
+}
+
+// Wait blocks until the command finishes or the timeout is exceeded
+func (w *timeoutWaiter) Wait() error {
+	err := w.Waiter.Wait()
+	if w.done() {
+		return ErrTimeout.Wrapf("command did not finish in %s", w.timeout)
+	}
+	return err //nolint:wrapcheck
+}
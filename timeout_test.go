@@ -0,0 +1,28 @@
+package rig
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type blockingWaiter chan struct{}
+
+func (w blockingWaiter) Wait() error {
+	<-w
+	return errors.New("killed")
+}
+
+func TestWithTimeout(t *testing.T) {
+	w := make(blockingWaiter)
+	waiter := withTimeout(w, 10*time.Millisecond, func() { close(w) })
+	require.ErrorIs(t, waiter.Wait(), ErrTimeout)
+
+	done := startTimeout(time.Hour, func() { t.Fatal("stop called before the timeout") })
+	require.False(t, done())
+	require.False(t, done(), "can be called more than once")
+
+	require.False(t, startTimeout(0, nil)())
+}
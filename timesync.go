@@ -0,0 +1,104 @@
+package rig
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alessio/shellescape"
+	"github.com/k0sproject/rig/exec"
+	"github.com/k0sproject/rig/pkg/clock"
+	ps "github.com/k0sproject/rig/powershell"
+)
+
+// TimeSync describes the state of the clock of a host
+type TimeSync struct {
+	// Skew is how much the clock of the host is ahead of the local clock, negative when it is behind.
+	// The value is accurate to about half of the round trip time of a command.
+	Skew time.Duration
+	// Service is the name of the running time synchronization service, such as "chronyd", "ntpd",
+	// "systemd-timesyncd", "openntpd", "timed" or "w32time". It is empty when none is found.
+	Service string
+	// Synchronized is true when the host reports its clock as synchronized to a time source
+	Synchronized bool
+}
+
+// remoteTimeCommand prints the time as seconds since the epoch, with nanoseconds where supported
+const remoteTimeCommand = "date +%s.%N"
+
+var remoteTimeCommandWindows = ps.Cmd("[DateTimeOffset]::UtcNow.ToUnixTimeMilliseconds()")
+
+// timeSyncScript prints the name of the running time synchronization service and whether the clock
+// is synchronized as "service=name" and "synchronized=yes" or "synchronized=no" lines
+const timeSyncScript = `svc=""
+for p in chronyd:chronyd ntpd:ntpd systemd-timesyn:systemd-timesyncd openntpd:openntpd timed:timed; do
+  if pgrep -x "${p%%:*}" > /dev/null 2>&1; then svc="${p#*:}"; break; fi
+done
+echo "service=$svc"
+printf "synchronized="
+if command -v timedatectl > /dev/null 2>&1 && timedatectl show -p NTPSynchronized --value > /dev/null 2>&1; then timedatectl show -p NTPSynchronized --value
+elif command -v chronyc > /dev/null 2>&1; then chronyc tracking 2> /dev/null | grep -q "Leap status *: Normal" && echo yes || echo no
+elif command -v ntpstat > /dev/null 2>&1; then ntpstat > /dev/null 2>&1 && echo yes || echo no
+else echo no; fi`
+
+const timeSyncScriptWindows = `if ((Get-Service w32time -ErrorAction SilentlyContinue).Status -eq 'Running') { 'service=w32time'; if ((w32tm /query /source) -match 'Local CMOS Clock|Free-running System Clock') { 'synchronized=no' } else { 'synchronized=yes' } } else { 'service='; 'synchronized=no' }`
+
+// TimeSync compares the clock of the host to the local clock and checks if a time synchronization
+// service is running on the host, for example to detect clock drift that would break TLS before an
+// installation.
+func (c *Connection) TimeSync() (*TimeSync, error) {
+	timeCmd, syncCmd := remoteTimeCommand, "sh -c "+shellescape.Quote(timeSyncScript)
+	if c.IsWindows() {
+		timeCmd, syncCmd = remoteTimeCommandWindows, ps.Cmd(timeSyncScriptWindows)
+	}
+
+	start := clock.Default.Now()
+	out, err := c.ExecOutput(timeCmd, exec.HideOutput())
+	if err != nil {
+		return nil, ErrCommandFailed.Wrapf("get remote time: %w", err)
+	}
+	rtt := clock.Default.Since(start)
+	remote, err := parseRemoteTime(out, c.IsWindows())
+	if err != nil {
+		return nil, err
+	}
+	ts := &TimeSync{Skew: remote.Sub(start.Add(rtt / 2))}
+
+	out, err = c.ExecOutput(syncCmd, exec.HideOutput())
+	if err != nil {
+		return nil, ErrCommandFailed.Wrapf("check time synchronization: %w", err)
+	}
+	for _, line := range strings.Split(out, "\n") {
+		key, value, _ := strings.Cut(strings.TrimSpace(line), "=")
+		switch key {
+		case "service":
+			ts.Service = value
+		case "synchronized":
+			ts.Synchronized = value == "yes"
+		}
+	}
+	return ts, nil
+}
+
+// parseRemoteTime parses the output of remoteTimeCommand or remoteTimeCommandWindows when windows is true
+func parseRemoteTime(out string, windows bool) (time.Time, error) {
+	out = strings.TrimSpace(out)
+	if windows {
+		ms, err := strconv.ParseInt(out, 10, 64)
+		if err != nil {
+			return time.Time{}, ErrCommandFailed.Wrapf("parse remote time %q: %w", out, err)
+		}
+		return time.UnixMilli(ms), nil
+	}
+	secs, nsecs, _ := strings.Cut(out, ".")
+	sec, err := strconv.ParseInt(secs, 10, 64)
+	if err != nil {
+		return time.Time{}, ErrCommandFailed.Wrapf("parse remote time %q: %w", out, err)
+	}
+	// date on bsd and macos does not support %N and prints it as is
+	nsec, err := strconv.ParseInt(nsecs, 10, 64)
+	if err != nil || len(nsecs) != 9 {
+		nsec = 0
+	}
+	return time.Unix(sec, nsec), nil
+}
@@ -0,0 +1,25 @@
+package rig
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRemoteTime(t *testing.T) {
+	tm, err := parseRemoteTime("1700000000.123456789\n", false)
+	require.NoError(t, err)
+	require.Equal(t, time.Unix(1700000000, 123456789), tm)
+
+	tm, err = parseRemoteTime("1700000000.N", false)
+	require.NoError(t, err)
+	require.Equal(t, time.Unix(1700000000, 0), tm)
+
+	tm, err = parseRemoteTime("1700000000123\r\n", true)
+	require.NoError(t, err)
+	require.Equal(t, time.UnixMilli(1700000000123), tm)
+
+	_, err = parseRemoteTime("Thu Jan  1 00:00:00 UTC 1970", false)
+	require.ErrorIs(t, err, ErrCommandFailed)
+}
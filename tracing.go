@@ -0,0 +1,249 @@
+package rig
+
+import (
+	"context"
+	"io/fs"
+	"time"
+
+	"github.com/k0sproject/rig/exec"
+	"github.com/k0sproject/rig/pkg/clock"
+)
+
+// Tracer creates the tracing spans of the connection operations, for example for exporting them to
+// OpenTelemetry using the github.com/k0sproject/rig/pkg/tracing/otel module, which is kept separate
+// so that rig itself does not depend on OpenTelemetry. Set it using the Tracer field of Connection.
+// The same Tracer is usually shared by all of the connections, so it must be safe for concurrent use.
+type Tracer interface {
+	// Start starts a span as a child of the span in ctx and returns a context that carries the new span
+	Start(ctx context.Context, name string, attrs ...TraceAttribute) (context.Context, Span)
+}
+
+// Span is a traced operation that has been started using a Tracer
+type Span interface {
+	// SetAttributes adds attributes to the span
+	SetAttributes(attrs ...TraceAttribute)
+	// End ends the span and records err as its status when it is not nil
+	End(err error)
+}
+
+// TraceAttribute is a key and a value that describe a span. The value is a string or an int64.
+type TraceAttribute struct {
+	Key   string
+	Value any
+}
+
+// span attribute keys
+const (
+	attrProtocol = "rig.protocol"
+	attrAddress  = "rig.address"
+	attrCommand  = "rig.exec.command"
+	attrExitCode = "rig.exec.exit_code"
+	attrDuration = "rig.exec.duration_ms"
+	attrSource   = "rig.transfer.source"
+	attrDest     = "rig.transfer.destination"
+	attrPath     = "rig.fs.path"
+)
+
+func stringAttr(key, value string) TraceAttribute {
+	return TraceAttribute{Key: key, Value: value}
+}
+
+func intAttr(key string, value int64) TraceAttribute {
+	return TraceAttribute{Key: key, Value: value}
+}
+
+// nopSpan is used when tracing is not enabled
+type nopSpan struct{}
+
+func (nopSpan) SetAttributes(...TraceAttribute) {}
+func (nopSpan) End(error)                       {}
+
+// startSpan starts a span as a child of the span in the exec.TraceContext of opts, or of the
+// connect span while connecting. The returned options carry the context of the new span, so the
+// spans of the operations run using them become its children.
+func (c Connection) startSpan(name string, opts []exec.Option, attrs ...TraceAttribute) ([]exec.Option, Span) {
+	if c.Tracer == nil {
+		return opts, nopSpan{}
+	}
+	ctx := exec.Build(opts...).TraceContext
+	if ctx == nil {
+		ctx = c.traceContext
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	attrs = append(attrs, stringAttr(attrProtocol, c.Protocol()), stringAttr(attrAddress, c.Address()))
+	ctx, span := c.Tracer.Start(ctx, name, attrs...)
+	return append(opts[:len(opts):len(opts)], exec.TraceContext(ctx)), span
+}
+
+// startExecSpan starts the span of the command cmd
+func (c Connection) startExecSpan(cmd string, opts []exec.Option) ([]exec.Option, Span) {
+	if c.Tracer == nil {
+		return opts, nopSpan{}
+	}
+	return c.startSpan("rig.Exec", opts, stringAttr(attrCommand, exec.Build(opts...).Redact(cmd)))
+}
+
+// endExecSpan ends the span of a command that was started at start and returned err
+func endExecSpan(span Span, start time.Time, err error) {
+	if _, ok := span.(nopSpan); ok {
+		return
+	}
+	exitCode := 0
+	if err != nil {
+		exitCode = -1
+		if code, ok := exec.ExitCode(err); ok {
+			exitCode = code
+		}
+	}
+	span.SetAttributes(
+		intAttr(attrExitCode, int64(exitCode)),
+		intAttr(attrDuration, clock.Default.Since(start).Milliseconds()),
+	)
+	span.End(err)
+}
+
+// startTransferSpan starts the span of a file transfer
+func (c Connection) startTransferSpan(operation, src, dst string, opts []exec.Option) ([]exec.Option, Span) {
+	name := "rig.Upload"
+	if operation == AuditDownload {
+		name = "rig.Download"
+	}
+	return c.startSpan(name, opts, stringAttr(attrSource, src), stringAttr(attrDest, dst))
+}
+
+// traceContextFS is implemented by the filesystems that can run their commands as children of a span
+type traceContextFS interface {
+	withTraceContext(ctx context.Context) FS
+}
+
+// tracingFS records a span for each of the filesystem operations that change or read files
+type tracingFS struct {
+	FS
+	conn *Connection
+	// ctx carries the parent span of the operations
+	ctx context.Context
+}
+
+// withTraceContext returns a copy of t whose spans are children of the span in ctx
+func (t *tracingFS) withTraceContext(ctx context.Context) FS {
+	return &tracingFS{FS: bindTraceContext(t.FS, ctx), conn: t.conn, ctx: ctx}
+}
+
+// bindTraceContext returns fsys with its commands traced as children of the span in ctx when it
+// supports that
+func bindTraceContext(fsys FS, ctx context.Context) FS {
+	if tc, ok := fsys.(traceContextFS); ok && ctx != nil {
+		return tc.withTraceContext(ctx)
+	}
+	return fsys
+}
+
+// start starts the span of an operation and returns the filesystem to run it on, so that the
+// commands of the operation become children of the span
+func (t *tracingFS) start(op, name string) (FS, Span) {
+	opts, span := t.conn.startSpan("rig.FS."+op, []exec.Option{exec.TraceContext(t.ctx)}, stringAttr(attrPath, name))
+	return bindTraceContext(t.FS, exec.Build(opts...).TraceContext), span
+}
+
+// the files outlive the spans of Open and OpenFile, so their commands are children of the parent span
+
+func (t *tracingFS) Open(name string) (fs.File, error) {
+	_, span := t.start("Open", name)
+	f, err := t.FS.Open(name)
+	span.End(err)
+	return f, err //nolint:wrapcheck
+}
+
+func (t *tracingFS) OpenFile(name string, mode FileMode, perm int) (File, error) {
+	_, span := t.start("OpenFile", name)
+	f, err := t.FS.OpenFile(name, mode, perm)
+	span.End(err)
+	return f, err //nolint:wrapcheck
+}
+
+func (t *tracingFS) Stat(name string) (fs.FileInfo, error) {
+	fsys, span := t.start("Stat", name)
+	info, err := fsys.Stat(name)
+	span.End(err)
+	return info, err //nolint:wrapcheck
+}
+
+func (t *tracingFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	fsys, span := t.start("ReadDir", name)
+	entries, err := fsys.ReadDir(name)
+	span.End(err)
+	return entries, err //nolint:wrapcheck
+}
+
+func (t *tracingFS) ReadFile(name string) ([]byte, error) {
+	fsys, span := t.start("ReadFile", name)
+	data, err := fsys.ReadFile(name)
+	span.End(err)
+	return data, err //nolint:wrapcheck
+}
+
+func (t *tracingFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	fsys, span := t.start("WriteFile", name)
+	err := fsys.WriteFile(name, data, perm)
+	span.End(err)
+	return err //nolint:wrapcheck
+}
+
+func (t *tracingFS) Delete(name string) error {
+	fsys, span := t.start("Delete", name)
+	err := fsys.Delete(name)
+	span.End(err)
+	return err //nolint:wrapcheck
+}
+
+func (t *tracingFS) Remove(name string) error {
+	fsys, span := t.start("Remove", name)
+	err := fsys.Remove(name)
+	span.End(err)
+	return err //nolint:wrapcheck
+}
+
+func (t *tracingFS) RemoveAll(name string) error {
+	fsys, span := t.start("RemoveAll", name)
+	err := fsys.RemoveAll(name)
+	span.End(err)
+	return err //nolint:wrapcheck
+}
+
+func (t *tracingFS) MkdirAll(name string, perm fs.FileMode) error {
+	fsys, span := t.start("MkdirAll", name)
+	err := fsys.MkdirAll(name, perm)
+	span.End(err)
+	return err //nolint:wrapcheck
+}
+
+func (t *tracingFS) Rename(oldname, newname string) error {
+	fsys, span := t.start("Rename", oldname)
+	err := fsys.Rename(oldname, newname)
+	span.End(err)
+	return err //nolint:wrapcheck
+}
+
+func (t *tracingFS) Chmod(name string, mode fs.FileMode) error {
+	fsys, span := t.start("Chmod", name)
+	err := fsys.Chmod(name, mode)
+	span.End(err)
+	return err //nolint:wrapcheck
+}
+
+func (t *tracingFS) Chown(name, owner, group string) error {
+	fsys, span := t.start("Chown", name)
+	err := fsys.Chown(name, owner, group)
+	span.End(err)
+	return err //nolint:wrapcheck
+}
+
+// withTracing wraps fsys in a tracingFS when tracing is enabled
+func (c *Connection) withTracing(fsys FS) FS {
+	if c.Tracer == nil {
+		return fsys
+	}
+	return &tracingFS{FS: fsys, conn: c}
+}
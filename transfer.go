@@ -0,0 +1,169 @@
+package rig
+
+import (
+	"sync"
+
+	"github.com/k0sproject/rig/exec"
+)
+
+// Names of the built-in transfer strategies
+const (
+	TransferShell      = "shell-dd"   // TransferShell uses the bash helper and dd on unix hosts
+	TransferPowerShell = "powershell" // TransferPowerShell uses the powershell helper on windows hosts
+	TransferSCP        = "scp"        // TransferSCP uses the scp protocol
+	TransferSFTP       = "sftp"       // TransferSFTP uses the sftp subsystem of the ssh server, it can't elevate privileges
+)
+
+// TransferStrategy is a mechanism for copying files between the local host and a remote host.
+//
+// The strategy used by Upload and Download is chosen when a file is first transferred over a connection by
+// probing the registered strategies in order of preference. The first one that is supported by the host is
+// used until the connection is closed. The choice can be overridden per call using exec.TransferStrategy.
+type TransferStrategy interface {
+	// Name returns the name of the strategy
+	Name() string
+	// Probe returns nil if the strategy can be used with the connection
+	Probe(c *Connection) error
+	// Upload copies the local file src to the remote path dst
+	Upload(c *Connection, src, dst string, opts ...exec.Option) error
+	// Download copies the remote file src to the local path dst
+	Download(c *Connection, src, dst string, opts ...exec.Option) error
+}
+
+var (
+	transferStrategies = []TransferStrategy{
+		&fsysTransfer{name: TransferShell},
+		&fsysTransfer{name: TransferPowerShell, windows: true},
+		&sftpTransfer{},
+		&scpTransfer{},
+	}
+	transferMu sync.RWMutex
+)
+
+// RegisterTransferStrategy adds a transfer strategy. Strategies registered later are preferred over the
+// earlier ones and the built-in strategies. A strategy with the same name as an existing one replaces it.
+func RegisterTransferStrategy(strategy TransferStrategy) {
+	transferMu.Lock()
+	defer transferMu.Unlock()
+
+	strategies := []TransferStrategy{strategy}
+	for _, s := range transferStrategies {
+		if s.Name() != strategy.Name() {
+			strategies = append(strategies, s)
+		}
+	}
+	transferStrategies = strategies
+}
+
+// TransferStrategies returns the names of the known transfer strategies in order of preference
+func TransferStrategies() []string {
+	transferMu.RLock()
+	defer transferMu.RUnlock()
+
+	names := make([]string, len(transferStrategies))
+	for i, s := range transferStrategies {
+		names[i] = s.Name()
+	}
+	return names
+}
+
+func getTransferStrategy(name string) (TransferStrategy, bool) {
+	transferMu.RLock()
+	defer transferMu.RUnlock()
+
+	for _, s := range transferStrategies {
+		if s.Name() == name {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+// transferStrategy returns the strategy to use for file transfers over the connection
+func (c *Connection) transferStrategy(opts ...exec.Option) (TransferStrategy, error) {
+	if name := exec.Build(opts...).Transfer; name != "" {
+		strategy, ok := getTransferStrategy(name)
+		if !ok {
+			return nil, ErrNotSupported.Wrapf("unknown transfer strategy %q", name)
+		}
+		c.loggerFor(opts).Debugf("%s: using overridden transfer strategy %s", c, name)
+		return strategy, nil
+	}
+
+	if c.transfer != nil {
+		return c.transfer, nil
+	}
+
+	transferMu.RLock()
+	strategies := make([]TransferStrategy, len(transferStrategies))
+	copy(strategies, transferStrategies)
+	transferMu.RUnlock()
+
+	for _, strategy := range strategies {
+		if err := strategy.Probe(c); err != nil {
+			c.loggerFor(opts).Debugf("%s: transfer strategy %s not available: %v", c, strategy.Name(), err)
+			continue
+		}
+		c.loggerFor(opts).Debugf("%s: using transfer strategy %s", c, strategy.Name())
+		c.transfer = strategy
+		return strategy, nil
+	}
+
+	return nil, ErrNotSupported.Wrapf("no supported file transfer strategy found")
+}
+
+// fsysTransfer transfers files using the remote filesystem interface
+type fsysTransfer struct {
+	name    string
+	windows bool
+}
+
+func (t *fsysTransfer) Name() string {
+	return t.name
+}
+
+func (t *fsysTransfer) Probe(c *Connection) error {
+	if c.IsWindows() != t.windows {
+		return ErrNotSupported.Wrapf("host os not supported")
+	}
+	if t.windows {
+		return nil
+	}
+	if err := c.Exec("command -v bash && command -v dd", exec.Internal()); err != nil {
+		return ErrNotSupported.Wrapf("bash and dd are required: %w", err)
+	}
+	return nil
+}
+
+func (t *fsysTransfer) Upload(c *Connection, src, dst string, opts ...exec.Option) error {
+	return c.uploadFsys(src, dst, opts...)
+}
+
+func (t *fsysTransfer) Download(c *Connection, src, dst string, opts ...exec.Option) error {
+	return c.downloadFsys(src, dst, opts...)
+}
+
+// scpTransfer transfers files using the scp protocol
+type scpTransfer struct{}
+
+func (t *scpTransfer) Name() string {
+	return TransferSCP
+}
+
+func (t *scpTransfer) Probe(c *Connection) error {
+	if c.IsWindows() {
+		return ErrNotSupported.Wrapf("host os not supported")
+	}
+	if err := c.Exec("command -v scp", exec.Internal()); err != nil {
+		return ErrNotSupported.Wrapf("scp is required: %w", err)
+	}
+	return nil
+}
+
+func (t *scpTransfer) Upload(c *Connection, src, dst string, opts ...exec.Option) error {
+	return c.UploadSCP(src, dst, opts...)
+}
+
+func (t *scpTransfer) Download(c *Connection, src, dst string, opts ...exec.Option) error {
+	return c.DownloadSCP(src, dst, opts...)
+}
@@ -0,0 +1,52 @@
+package rig
+
+import (
+	"testing"
+
+	"github.com/k0sproject/rig/exec"
+	"github.com/stretchr/testify/require"
+)
+
+type mockTransfer struct {
+	name    string
+	uploads []string
+}
+
+func (t *mockTransfer) Name() string              { return t.name }
+func (t *mockTransfer) Probe(_ *Connection) error { return nil }
+func (t *mockTransfer) Upload(_ *Connection, src, dst string, _ ...exec.Option) error {
+	t.uploads = append(t.uploads, src+":"+dst)
+	return nil
+}
+func (t *mockTransfer) Download(_ *Connection, _, _ string, _ ...exec.Option) error { return nil }
+
+func TestTransferStrategy(t *testing.T) {
+	original := transferStrategies
+	t.Cleanup(func() { transferStrategies = original })
+
+	mt := &mockTransfer{name: "mock"}
+	RegisterTransferStrategy(mt)
+	require.Equal(t, []string{"mock", TransferShell, TransferPowerShell, TransferSFTP, TransferSCP}, TransferStrategies())
+
+	mc := mockClient{}
+	c := Connection{client: &mc}
+	require.NoError(t, c.Upload("src", "dst"))
+	require.Equal(t, []string{"src:dst"}, mt.uploads)
+	require.Same(t, mt, c.transfer)
+	require.Empty(t, mc.commands, "the mock strategy needs no probing commands")
+
+	err := c.Upload("src", "dst", exec.TransferStrategy("nonexistent"))
+	require.ErrorIs(t, err, ErrNotSupported)
+}
+
+func TestTransferProbesAreInternal(t *testing.T) {
+	confirm := exec.DefaultConfirmFunc
+	exec.DefaultConfirmFunc = func(string) bool { return false }
+	t.Cleanup(func() { exec.DefaultConfirmFunc = confirm })
+
+	mc := mockClient{}
+	c := Connection{client: &mc}
+	require.NoError(t, (&fsysTransfer{name: TransferShell}).Probe(&c))
+	require.NoError(t, (&scpTransfer{}).Probe(&c))
+	require.Len(t, mc.commands, 2, "probes are not subject to command confirmation")
+}
@@ -0,0 +1,441 @@
+package rig
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alessio/shellescape"
+	"github.com/k0sproject/rig/exec"
+	"github.com/k0sproject/rig/log"
+	ps "github.com/k0sproject/rig/powershell"
+)
+
+// UploadTree copies the contents of the local directory src into the remote directory dst, which is
+// created if it doesn't exist. Instead of transferring the files one by one, the tree is streamed as a
+// single tar archive that is extracted on the fly using tar on the remote host, which is much faster
+// when there are many small files. On windows hosts a zip archive is uploaded and extracted using
+// Expand-Archive.
+func (c *Connection) UploadTree(src, dst string, opts ...exec.Option) error {
+	if err := c.checkConnected(); err != nil {
+		return err
+	}
+
+	stat, err := os.Stat(src)
+	if err != nil {
+		return ErrInvalidPath.Wrap(err)
+	}
+	if !stat.IsDir() {
+		return ErrInvalidPath.Wrapf("%s is not a directory", src)
+	}
+
+	if c.IsWindows() {
+		return c.uploadTreeWindows(src, dst, opts...)
+	}
+
+	reader, writer := io.Pipe()
+	written := make(chan error, 1)
+	go func() {
+		err := writeTar(writer, src)
+		writer.CloseWithError(err)
+		written <- err
+	}()
+
+	cmd := fmt.Sprintf("sh -c %s", shellescape.Quote(fmt.Sprintf("mkdir -p -- %[1]s && tar -C %[1]s -xf -", shellescape.Quote(dst))))
+	errbuf := bytes.NewBuffer(nil)
+	waiter, err := c.ExecStreams(cmd, reader, io.Discard, errbuf, opts...)
+	if err != nil {
+		_ = reader.CloseWithError(err)
+		<-written
+		return ErrUploadFailed.Wrapf("start tar: %w", err)
+	}
+	err = waiter.Wait()
+	// the remote tar can exit without reading the padding at the end of the archive, closing the
+	// reader unblocks the writer
+	_ = reader.CloseWithError(err)
+	writeErr := <-written
+	if err != nil {
+		return ErrUploadFailed.Wrapf("tar: %w (%s)", err, strings.TrimSpace(errbuf.String()))
+	}
+	if writeErr != nil && !errors.Is(writeErr, io.ErrClosedPipe) {
+		return ErrUploadFailed.Wrapf("archive: %w", writeErr)
+	}
+
+	return nil
+}
+
+// DownloadTree copies the contents of the remote directory src into the local directory dst, which is
+// created if it doesn't exist. The tree is streamed as a single tar archive, or a zip archive on windows
+// hosts. See UploadTree.
+func (c *Connection) DownloadTree(src, dst string, opts ...exec.Option) error {
+	if err := c.checkConnected(); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dst, 0o755); err != nil {
+		return ErrInvalidPath.Wrap(err)
+	}
+
+	if c.IsWindows() {
+		return c.downloadTreeWindows(src, dst, opts...)
+	}
+
+	reader, writer := io.Pipe()
+	extracted := make(chan error, 1)
+	go func() {
+		err := readTar(reader, dst, c.Logger())
+		// drain the rest of the stream so that the remote command doesn't block
+		_, _ = io.Copy(io.Discard, reader)
+		extracted <- err
+	}()
+
+	cmd := fmt.Sprintf("tar -C %s -cf - .", shellescape.Quote(src))
+	errbuf := bytes.NewBuffer(nil)
+	waiter, err := c.ExecStreams(cmd, nil, writer, errbuf, opts...)
+	if err != nil {
+		_ = writer.Close()
+		return ErrDownloadFailed.Wrapf("start tar: %w", err)
+	}
+	err = waiter.Wait()
+	_ = writer.Close()
+	if err != nil {
+		return ErrDownloadFailed.Wrapf("tar: %w (%s)", err, strings.TrimSpace(errbuf.String()))
+	}
+	if err := <-extracted; err != nil {
+		return ErrDownloadFailed.Wrapf("extract: %w", err)
+	}
+
+	return nil
+}
+
+// windowsTempFile returns a path for a temporary file with the given extension on a windows host.
+// Expand-Archive refuses to work with files that don't have the .zip extension, so GetTempFileName
+// can't be used.
+func (c *Connection) windowsTempFile(ext string) (string, error) {
+	out, err := c.ExecOutput(ps.Cmd(fmt.Sprintf("[System.IO.Path]::Combine([System.IO.Path]::GetTempPath(), [System.IO.Path]::GetRandomFileName() + %s)", ps.SingleQuote(ext))))
+	if err != nil {
+		return "", ErrCommandFailed.Wrapf("get temporary file name: %w", err)
+	}
+	return out, nil
+}
+
+func (c *Connection) uploadTreeWindows(src, dst string, opts ...exec.Option) error {
+	local, err := os.CreateTemp("", "rig-*.zip")
+	if err != nil {
+		return ErrOS.Wrapf("create temporary file: %w", err)
+	}
+	defer os.Remove(local.Name())
+
+	if err := writeZip(local, src, c.Logger()); err != nil {
+		_ = local.Close()
+		return ErrUploadFailed.Wrapf("create zip archive: %w", err)
+	}
+	if err := local.Close(); err != nil {
+		return ErrUploadFailed.Wrapf("close zip archive: %w", err)
+	}
+
+	remote, err := c.windowsTempFile(".zip")
+	if err != nil {
+		return ErrUploadFailed.Wrap(err)
+	}
+	defer c.deleteTemp(remote, opts...)
+
+	if err := c.Upload(local.Name(), remote, opts...); err != nil {
+		return err
+	}
+
+	if err := c.Exec(ps.Cmd(fmt.Sprintf("Expand-Archive -LiteralPath %s -DestinationPath %s -Force", ps.SingleQuote(remote), ps.SingleQuote(filepath.FromSlash(dst)))), opts...); err != nil {
+		return ErrUploadFailed.Wrapf("expand archive: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Connection) downloadTreeWindows(src, dst string, opts ...exec.Option) error {
+	remote, err := c.windowsTempFile(".zip")
+	if err != nil {
+		return ErrDownloadFailed.Wrap(err)
+	}
+	defer c.deleteTemp(remote, opts...)
+
+	if err := c.Exec(ps.Cmd(fmt.Sprintf("Compress-Archive -Path %s -DestinationPath %s -Force", ps.SingleQuote(filepath.FromSlash(src)+`\*`), ps.SingleQuote(remote))), opts...); err != nil {
+		return ErrDownloadFailed.Wrapf("compress archive: %w", err)
+	}
+
+	local, err := os.CreateTemp("", "rig-*.zip")
+	if err != nil {
+		return ErrOS.Wrapf("create temporary file: %w", err)
+	}
+	_ = local.Close()
+	defer os.Remove(local.Name())
+
+	if err := c.Download(remote, local.Name(), opts...); err != nil {
+		return err
+	}
+
+	if err := readZip(local.Name(), dst); err != nil {
+		return ErrDownloadFailed.Wrapf("extract: %w", err)
+	}
+
+	return nil
+}
+
+// deleteTemp removes a temporary remote file, logging failures instead of returning them
+func (c *Connection) deleteTemp(path string, opts ...exec.Option) {
+	if err := c.fsysFor(opts...).Delete(path); err != nil {
+		c.Logger().Debugf("%s: failed to delete temporary file %s: %v", c, path, err)
+	}
+}
+
+// writeTar writes the contents of the directory src into w as a tar archive
+func writeTar(w io.Writer, src string) error {
+	tw := tar.NewWriter(w)
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil || rel == "." {
+			return err //nolint:wrapcheck
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		var link string
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err //nolint:wrapcheck
+			}
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err //nolint:wrapcheck
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err //nolint:wrapcheck
+	})
+	if err != nil {
+		return ErrOS.Wrapf("write tar: %w", err)
+	}
+	if err := tw.Close(); err != nil {
+		return ErrOS.Wrapf("close tar: %w", err)
+	}
+	return nil
+}
+
+// extractPath returns the local path for an archive entry, refusing entries that would end up outside dst,
+// either directly or through a symlink extracted from an earlier entry
+func extractPath(dst, name string) (string, error) {
+	dst = filepath.Clean(dst)
+	target := filepath.Join(dst, filepath.FromSlash(name))
+	if !insideDir(dst, target) {
+		return "", ErrInvalidPath.Wrapf("archive entry %s points outside of the destination directory", name)
+	}
+	rel, err := filepath.Rel(dst, filepath.Dir(target))
+	if err != nil {
+		return "", ErrInvalidPath.Wrap(err)
+	}
+	if rel == "." {
+		return target, nil
+	}
+	parent := dst
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		parent = filepath.Join(parent, part)
+		info, err := os.Lstat(parent)
+		if errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return "", ErrOS.Wrap(err)
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return "", ErrInvalidPath.Wrapf("archive entry %s would be written through the symlink %s", name, parent)
+		}
+	}
+	return target, nil
+}
+
+// checkLinkname refuses symlink entries that are absolute or point outside of dst
+func checkLinkname(dst, target, linkname string) error {
+	if filepath.IsAbs(linkname) || strings.HasPrefix(linkname, "/") || !insideDir(filepath.Clean(dst), filepath.Join(filepath.Dir(target), filepath.FromSlash(linkname))) {
+		return ErrInvalidPath.Wrapf("archive entry %s is a symlink to %s which is outside of the destination directory", target, linkname)
+	}
+	return nil
+}
+
+// insideDir returns true if path is dir or is inside of it. Both must be clean.
+func insideDir(dir, path string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// readTar extracts a tar archive from r into the directory dst, logging the skipped entries to logger
+func readTar(r io.Reader, dst string, logger log.Logger) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF { //nolint:errorlint
+			return nil
+		}
+		if err != nil {
+			return ErrOS.Wrapf("read tar: %w", err)
+		}
+		target, err := extractPath(dst, hdr.Name)
+		if err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, hdr.FileInfo().Mode().Perm()|0o700); err != nil {
+				return ErrOS.Wrap(err)
+			}
+		case tar.TypeReg:
+			if info, err := os.Lstat(target); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+				// replace the link instead of writing to wherever it points to
+				_ = os.Remove(target)
+			}
+			if err := writeLocalFile(target, tr, hdr.FileInfo().Mode().Perm()); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := checkLinkname(dst, target, hdr.Linkname); err != nil {
+				return err
+			}
+			_ = os.Remove(target)
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return ErrOS.Wrap(err)
+			}
+		default:
+			logger.Debugf("skipping unsupported tar entry %s (type %c)", hdr.Name, hdr.Typeflag)
+		}
+	}
+}
+
+func writeLocalFile(path string, r io.Reader, perm fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return ErrOS.Wrap(err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return ErrOS.Wrap(err)
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		_ = f.Close()
+		return ErrOS.Wrap(err)
+	}
+	if err := f.Close(); err != nil {
+		return ErrOS.Wrap(err)
+	}
+	return nil
+}
+
+// writeZip writes the contents of the directory src into w as a zip archive, logging the skipped files
+// to logger
+func writeZip(w io.Writer, src string, logger log.Logger) error {
+	zw := zip.NewWriter(w)
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil || rel == "." {
+			return err //nolint:wrapcheck
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			logger.Debugf("skipping %s: only regular files and directories are supported in zip archives", path)
+			return nil
+		}
+		hdr, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			hdr.Name += "/"
+		} else {
+			hdr.Method = zip.Deflate
+		}
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil || info.IsDir() {
+			return err //nolint:wrapcheck
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		defer f.Close()
+		_, err = io.Copy(fw, f)
+		return err //nolint:wrapcheck
+	})
+	if err != nil {
+		return ErrOS.Wrapf("write zip: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return ErrOS.Wrapf("close zip: %w", err)
+	}
+	return nil
+}
+
+// readZip extracts the zip archive at path into the directory dst
+func readZip(path, dst string) error {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return ErrOS.Wrapf("open zip: %w", err)
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		// Compress-Archive uses backslashes as path separators
+		name := strings.ReplaceAll(f.Name, `\`, "/")
+		target, err := extractPath(dst, name)
+		if err != nil {
+			return err
+		}
+		if strings.HasSuffix(name, "/") {
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return ErrOS.Wrap(err)
+			}
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return ErrOS.Wrapf("open zip entry %s: %w", name, err)
+		}
+		perm := f.Mode().Perm()
+		if perm == 0 {
+			perm = 0o644
+		}
+		err = writeLocalFile(target, rc, perm)
+		_ = rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package rig
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/k0sproject/rig/exec"
+	"github.com/k0sproject/rig/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTreeArchives(t *testing.T) {
+	src := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "sub dir", "empty"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "a.txt"), []byte("hello"), 0o640))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "sub dir", "b.txt"), []byte("world"), 0o600))
+
+	check := func(t *testing.T, dst string) {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(dst, "a.txt"))
+		require.NoError(t, err)
+		require.Equal(t, "hello", string(data))
+		data, err = os.ReadFile(filepath.Join(dst, "sub dir", "b.txt"))
+		require.NoError(t, err)
+		require.Equal(t, "world", string(data))
+		stat, err := os.Stat(filepath.Join(dst, "sub dir", "empty"))
+		require.NoError(t, err)
+		require.True(t, stat.IsDir())
+	}
+
+	t.Run("tar", func(t *testing.T) {
+		buf := bytes.NewBuffer(nil)
+		require.NoError(t, writeTar(buf, src))
+		dst := t.TempDir()
+		require.NoError(t, readTar(buf, dst, log.Global))
+		check(t, dst)
+	})
+
+	t.Run("zip", func(t *testing.T) {
+		archive := filepath.Join(t.TempDir(), "test.zip")
+		f, err := os.Create(archive)
+		require.NoError(t, err)
+		require.NoError(t, writeZip(f, src, log.Global))
+		require.NoError(t, f.Close())
+		dst := t.TempDir()
+		require.NoError(t, readZip(archive, dst))
+		check(t, dst)
+	})
+}
+
+// earlyExitClient runs the streamed commands as if they exited successfully without reading their input
+type earlyExitClient struct {
+	scriptClient
+}
+
+func (c *earlyExitClient) ExecStreams(_ string, _ io.ReadCloser, _, _ io.Writer, _ ...exec.Option) (Waiter, error) {
+	return nopWaiter{}, nil
+}
+
+type nopWaiter struct{}
+
+func (nopWaiter) Wait() error { return nil }
+
+func TestUploadTreeEarlyExit(t *testing.T) {
+	src := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(src, "a.txt"), bytes.Repeat([]byte("a"), 1<<16), 0o600))
+
+	client := &earlyExitClient{}
+	c := &Connection{Custom: &ClientConfig{Name: "script", Client: client}, OSVersion: &OSVersion{ID: "linux"}}
+	require.NoError(t, c.Connect())
+
+	before := runtime.NumGoroutine()
+	require.NoError(t, c.UploadTree(src, "/tmp/dst"))
+	// require.Eventually can't be used as it runs the condition in a goroutine of its own
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.LessOrEqual(t, runtime.NumGoroutine(), before, "the archive writer was left running")
+}
+
+func TestExtractPath(t *testing.T) {
+	_, err := extractPath("/tmp/dst", "../etc/passwd")
+	require.ErrorIs(t, err, ErrInvalidPath)
+	path, err := extractPath("/tmp/dst", "foo/bar")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join("/tmp/dst", "foo", "bar"), path)
+}
+
+func TestReadTarSymlinkEscape(t *testing.T) {
+	archive := func(entries ...*tar.Header) *bytes.Buffer {
+		buf := bytes.NewBuffer(nil)
+		tw := tar.NewWriter(buf)
+		for _, hdr := range entries {
+			require.NoError(t, tw.WriteHeader(hdr))
+			if hdr.Size > 0 {
+				_, err := tw.Write(bytes.Repeat([]byte("x"), int(hdr.Size)))
+				require.NoError(t, err)
+			}
+		}
+		require.NoError(t, tw.Close())
+		return buf
+	}
+
+	t.Run("absolute link", func(t *testing.T) {
+		buf := archive(
+			&tar.Header{Name: "a", Typeflag: tar.TypeSymlink, Linkname: "/etc"},
+			&tar.Header{Name: "a/passwd", Typeflag: tar.TypeReg, Mode: 0o644, Size: 4},
+		)
+		require.ErrorIs(t, readTar(buf, t.TempDir(), log.Global), ErrInvalidPath)
+	})
+
+	t.Run("relative link outside", func(t *testing.T) {
+		buf := archive(&tar.Header{Name: "sub/a", Typeflag: tar.TypeSymlink, Linkname: "../../outside"})
+		require.ErrorIs(t, readTar(buf, t.TempDir(), log.Global), ErrInvalidPath)
+	})
+
+	t.Run("write through link", func(t *testing.T) {
+		outside := t.TempDir()
+		dst := t.TempDir()
+		require.NoError(t, os.Symlink(outside, filepath.Join(dst, "a")))
+		buf := archive(&tar.Header{Name: "a/passwd", Typeflag: tar.TypeReg, Mode: 0o644, Size: 4})
+		require.ErrorIs(t, readTar(buf, dst, log.Global), ErrInvalidPath)
+		_, err := os.Stat(filepath.Join(outside, "passwd"))
+		require.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("link inside", func(t *testing.T) {
+		dst := t.TempDir()
+		buf := archive(
+			&tar.Header{Name: "sub/", Typeflag: tar.TypeDir, Mode: 0o755},
+			&tar.Header{Name: "sub/file", Typeflag: tar.TypeReg, Mode: 0o644, Size: 4},
+			&tar.Header{Name: "sub/link", Typeflag: tar.TypeSymlink, Linkname: "../sub/file"},
+		)
+		require.NoError(t, readTar(buf, dst, log.Global))
+		data, err := os.ReadFile(filepath.Join(dst, "sub", "link"))
+		require.NoError(t, err)
+		require.Equal(t, "xxxx", string(data))
+	})
+}
@@ -2,18 +2,23 @@ package rig
 
 import (
 	"bytes"
+	"context"
 	_ "embed"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/fs"
 	"math/big"
+	"os"
+	"path"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/alessio/shellescape"
 	"github.com/k0sproject/rig/errstring"
 	"github.com/k0sproject/rig/exec"
+	"github.com/k0sproject/rig/pkg/clock"
 )
 
 // rigHelper is a helper script to avoid having to write complex bash oneliners in Go
@@ -37,6 +42,11 @@ func newUnixFsys(conn *Connection, opts ...exec.Option) *unixFsys {
 	return &unixFsys{conn: conn, opts: opts}
 }
 
+// withTraceContext returns a copy of fsys whose commands are traced as children of the span in ctx
+func (fsys *unixFsys) withTraceContext(ctx context.Context) FS {
+	return &unixFsys{conn: fsys.conn, opts: append(fsys.opts[:len(fsys.opts):len(fsys.opts)], exec.TraceContext(ctx))}
+}
+
 type unixFSFile struct {
 	fsys   *unixFsys
 	path   string
@@ -54,9 +64,6 @@ type unixFSDir struct {
 }
 
 func (f *unixFSDir) ReadDir(n int) ([]fs.DirEntry, error) {
-	if n == 0 {
-		return f.unixFSFile.fsys.ReadDir(f.path)
-	}
 	if f.entries == nil {
 		entries, err := f.unixFSFile.fsys.ReadDir(f.path)
 		if err != nil {
@@ -65,6 +72,11 @@ func (f *unixFSDir) ReadDir(n int) ([]fs.DirEntry, error) {
 		f.entries = entries
 		f.hw = 0
 	}
+	if n <= 0 {
+		old := f.hw
+		f.hw = len(f.entries)
+		return f.entries[old:], nil
+	}
 	if f.hw >= len(f.entries) {
 		return nil, io.EOF
 	}
@@ -115,6 +127,9 @@ func (f *unixFSFile) Read(p []byte) (int, error) {
 	if !f.isReadable() {
 		return 0, ErrCommandFailed.Wrapf("file %s is not open for reading", f.path)
 	}
+	if len(p) == 0 {
+		return 0, nil
+	}
 	bs, skip, count := f.ddParams(f.pos, len(p))
 	errbuf := bytes.NewBuffer(nil)
 	buf := bytes.NewBuffer(nil)
@@ -136,63 +151,69 @@ func (f *unixFSFile) Write(p []byte) (int, error) {
 	if !f.isWritable() {
 		return 0, ErrCommandFailed.Wrapf("file %s is not open for writing", f.path)
 	}
-	bs, skip, count := f.ddParams(f.pos, len(p))
+	if len(p) == 0 {
+		return 0, nil
+	}
 	errbuf := bytes.NewBuffer(nil)
-	cmd, err := f.fsys.conn.ExecStreams(fmt.Sprintf("dd if=/dev/stdin of=%s bs=%d count=%d seek=%d", shellescape.Quote(f.path), bs, count, skip), io.NopCloser(bytes.NewReader(p)), io.Discard, errbuf, f.fsys.opts...)
+	cmd, err := f.fsys.conn.ExecStreams(f.writeCmd(), io.NopCloser(bytes.NewReader(p)), io.Discard, errbuf, f.fsys.opts...)
 	if err != nil {
 		return 0, ErrCommandFailed.Wrapf("write (dd): %w", err)
 	}
 	if err := cmd.Wait(); err != nil {
 		return 0, ErrCommandFailed.Wrapf("write (dd): %w (%s)", err, errbuf.String())
 	}
-	f.pos += int64(len(p))
-	if f.pos > f.size {
+	f.advance(int64(len(p)))
+	return len(p), nil
+}
+
+// writeCmd returns a command that writes its stdin into the file at the current position without
+// truncating the rest of the file, or to the end of the file when it was opened for appending. The
+// file is opened by dd, so that it is opened with the privileges of the command.
+func (f *unixFSFile) writeCmd() string {
+	const blockSize = 1 << 20
+	if f.mode&ModeAppend == ModeAppend {
+		return fmt.Sprintf("dd if=/dev/stdin of=%s bs=%d oflag=append conv=notrunc", shellescape.Quote(f.path), blockSize)
+	}
+	if f.pos%blockSize == 0 {
+		return fmt.Sprintf("dd if=/dev/stdin of=%s bs=%d seek=%d conv=notrunc", shellescape.Quote(f.path), blockSize, f.pos/blockSize)
+	}
+	// dd seeks in whole output blocks unless told to seek in bytes
+	return fmt.Sprintf("dd if=/dev/stdin of=%s bs=%d seek=%d oflag=seek_bytes conv=notrunc", shellescape.Quote(f.path), blockSize, f.pos)
+}
+
+// advance moves the position forward after n bytes have been written
+func (f *unixFSFile) advance(n int64) {
+	if f.mode&ModeAppend == ModeAppend {
+		f.pos = f.size
+	}
+	f.pos += n
+	if f.pos >= f.size {
 		f.size = f.pos
 		f.isEOF = true
 	}
-	return len(p), nil
 }
 
 func (f *unixFSFile) CopyFromN(src io.Reader, num int64, alt io.Writer) (int64, error) {
 	if !f.isWritable() {
 		return 0, ErrCommandFailed.Wrapf("file %s is not open for writing", f.path)
 	}
-	var ddCmd string
-	if f.pos+num >= f.size {
-		if _, err := f.fsys.helper("truncate", f.path, fmt.Sprintf("%d", f.pos)); err != nil {
-			return 0, ErrCommandFailed.Wrapf("truncate for writing: %w", err)
-		}
-		ddCmd = fmt.Sprintf("dd if=/dev/stdin of=%s bs=16M oflag=append conv=notrunc", shellescape.Quote(f.path))
-	} else {
-		ddCmd = fmt.Sprintf("dd if=/dev/stdin of=%s bs=1 seek=%d conv=notrunc", shellescape.Quote(f.path), f.pos)
+	if num == 0 {
+		return 0, nil
 	}
-	limited := io.LimitReader(src, num)
-	var reader io.Reader
+	var reader io.Reader = io.LimitReader(src, num)
 	if alt != nil {
-		reader = io.TeeReader(limited, alt)
-	} else {
-		reader = limited
+		reader = io.TeeReader(reader, alt)
 	}
 
 	errbuf := bytes.NewBuffer(nil)
-	cmd, err := f.fsys.conn.ExecStreams(ddCmd, io.NopCloser(reader), io.Discard, errbuf, f.fsys.opts...)
-	if err != nil {
-		return 0, ErrCommandFailed.Wrapf("failed to execute dd (copy-from): %w (%s)", err, errbuf.String())
-	}
-	if err != nil {
-		return 0, ErrCommandFailed.Wrapf("copy-from: %w", err)
-	}
-	f.pos += num
-	if f.pos >= f.size {
-		f.isEOF = true
-		f.size = f.pos
-	}
+	cmd, err := f.fsys.conn.ExecStreams(f.writeCmd(), io.NopCloser(reader), io.Discard, errbuf, f.fsys.opts...)
 	if err != nil {
-		return 0, &fs.PathError{Op: "copy-from", Path: f.path, Err: ErrRcpCommandFailed.Wrapf("error while copying: %w", err)}
+		return 0, &fs.PathError{Op: "copy-from", Path: f.path, Err: ErrCommandFailed.Wrapf("failed to execute dd (copy-from): %w (%s)", err, errbuf.String())}
 	}
 	if err := cmd.Wait(); err != nil {
-		return 0, &fs.PathError{Op: "copy-from", Path: f.path, Err: ErrRcpCommandFailed.Wrapf("error while copying: %w (%s)", err, errbuf.String())}
+		return 0, &fs.PathError{Op: "copy-from", Path: f.path, Err: ErrCommandFailed.Wrapf("error while copying: %w (%s)", err, errbuf.String())}
 	}
+	f.advance(num)
 	return num, nil
 }
 
@@ -203,7 +224,12 @@ func (f *unixFSFile) Copy(dst io.Writer) (int, error) {
 	if !f.isReadable() {
 		return 0, ErrCommandFailed.Wrapf("file %s is not open for reading", f.path)
 	}
-	bs, skip, count := f.ddParams(f.pos, int(f.size-f.pos))
+	if f.pos >= f.size {
+		f.isEOF = true
+		return 0, nil
+	}
+	toRead := f.size - f.pos
+	bs, skip, count := f.ddParams(f.pos, int(toRead))
 	errbuf := bytes.NewBuffer(nil)
 	cmd, err := f.fsys.conn.ExecStreams(fmt.Sprintf("dd if=%s bs=%d skip=%d count=%d", shellescape.Quote(f.path), bs, skip, count), nil, dst, errbuf, f.fsys.opts...)
 	if err != nil {
@@ -214,7 +240,7 @@ func (f *unixFSFile) Copy(dst io.Writer) (int, error) {
 	}
 	f.pos = f.size
 	f.isEOF = true
-	return int(f.size - f.pos), nil
+	return int(toRead), nil
 }
 
 func (f *unixFSFile) Close() error {
@@ -239,16 +265,18 @@ func (f *unixFSFile) Seek(offset int64, whence int) (int64, error) {
 }
 
 type helperResponse struct {
-	Err       error        `json:"-"`
-	ErrString string       `json:"error"`
-	Stat      *FileInfo    `json:"stat"`
-	Dir       []*FileInfo  `json:"dir"`
-	Sum       *sumResponse `json:"sum"`
+	Err       error               `json:"-"`
+	ErrString string              `json:"error"`
+	Stat      *FileInfo           `json:"stat"`
+	Dir       []*FileInfo         `json:"dir"`
+	Sum       *sumResponse        `json:"sum"`
+	Manifest  []*manifestResponse `json:"manifest"`
+	Rm        []*rmResponse       `json:"rm"`
 }
 
 func (h *helperResponse) UnmarshalJSON(b []byte) error {
-	type helperresponse *helperResponse
-	hr := helperresponse(h)
+	type helperresponse helperResponse
+	hr := (*helperresponse)(h)
 	if err := json.Unmarshal(b, hr); err != nil {
 		return ErrCommandFailed.Wrapf("unmarshal helper response: %w", err)
 	}
@@ -286,6 +314,19 @@ func (fsys *unixFsys) Stat(name string) (fs.FileInfo, error) {
 	return res.Stat, nil
 }
 
+// Lstat returns the FileInfo structure describing the named file. If the file is a symbolic link,
+// the returned FileInfo describes the link itself.
+func (fsys *unixFsys) Lstat(name string) (fs.FileInfo, error) {
+	res, err := fsys.helper("lstat", name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "lstat", Path: name, Err: fmt.Errorf("%w: %s", fs.ErrNotExist, err)}
+	}
+	if res.Stat == nil {
+		return nil, ErrCommandFailed.Wrapf("helper lstat response empty")
+	}
+	return res.Stat, nil
+}
+
 func (fsys *unixFsys) Sha256(name string) (string, error) {
 	res, err := fsys.helper("sum", name)
 	if err != nil {
@@ -321,7 +362,7 @@ func (fsys *unixFsys) OpenFile(name string, mode FileMode, perm int) (File, erro
 				return nil, err
 			}
 		}
-		info = &FileInfo{FName: name, FUnix: fs.FileMode(perm), FSize: 0, FIsDir: false, FModTime: time.Now(), fsys: fsys}
+		info = &FileInfo{FName: name, FUnix: fs.FileMode(perm), FSize: 0, FIsDir: false, FModTime: clock.Default.Now(), fsys: fsys}
 	}
 	if info.IsDir() {
 		return nil, &fs.PathError{Op: "open", Path: name, Err: ErrCommandFailed.Wrapf("%w: is a directory", fs.ErrPermission)}
@@ -343,16 +384,12 @@ func (fsys *unixFsys) ReadDir(name string) ([]fs.DirEntry, error) {
 	}
 	res, err := fsys.helper("dir", name)
 	if err != nil {
-		return nil, err
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fmt.Errorf("%w: %s", fs.ErrNotExist, err)}
 	}
 	if res.Dir == nil {
 		return nil, ErrCommandFailed.Wrapf("helper dir response empty")
 	}
-	entries := make([]fs.DirEntry, len(res.Dir))
-	for i, entry := range res.Dir {
-		entries[i] = entry
-	}
-	return entries, nil
+	return sortedEntries(res.Dir), nil
 }
 
 // Delete removes the named file or (empty) directory.
@@ -362,3 +399,275 @@ func (fsys *unixFsys) Delete(name string) error {
 	}
 	return nil
 }
+
+// Manifest returns a list of the regular files under root with their sizes, modes and checksums.
+// The list is produced using a single remote command.
+func (fsys *unixFsys) Manifest(root string) (Manifest, error) {
+	res, err := fsys.helper("manifest", root)
+	if err != nil {
+		return nil, &fs.PathError{Op: "manifest", Path: root, Err: err}
+	}
+	if res.Manifest == nil {
+		return Manifest{}, nil
+	}
+	return newManifest(res.Manifest), nil
+}
+
+// maxUnixBatchBytes is the maximum combined length of paths passed to a single command
+const maxUnixBatchBytes = 65536
+
+// DeleteMany removes the named files or (empty) directories. It continues after failures and returns
+// PathErrors wrapped in ErrCommandFailed listing the paths that could not be removed. The progress
+// function is called after each path has been processed, it can be nil.
+func (fsys *unixFsys) DeleteMany(names []string, progress DeleteProgressFunc) error {
+	var errs PathErrors
+	for _, batch := range batchPaths(names, maxUnixBatchBytes) {
+		res, err := fsys.helper(append([]string{"rm"}, batch...)...)
+		if err != nil {
+			// the whole batch failed
+			for _, name := range batch {
+				pathErr := &fs.PathError{Op: "delete", Path: name, Err: err}
+				errs = append(errs, pathErr)
+				if progress != nil {
+					progress(name, pathErr)
+				}
+			}
+			continue
+		}
+		errs = append(errs, rmResults(res.Rm, progress)...)
+	}
+	if len(errs) > 0 {
+		return ErrCommandFailed.Wrap(errs)
+	}
+	return nil
+}
+
+// RemoveAll removes the named path and any children it contains. It returns nil if the path does not exist.
+func (fsys *unixFsys) RemoveAll(name string) error {
+	if err := fsys.conn.Exec(fmt.Sprintf("rm -rf -- %s", shellescape.Quote(name)), fsys.opts...); err != nil {
+		return &fs.PathError{Op: "removeall", Path: name, Err: ErrCommandFailed.Wrap(err)}
+	}
+	return nil
+}
+
+// ReadFile reads the named file and returns its contents
+func (fsys *unixFsys) ReadFile(name string) ([]byte, error) {
+	return readFile(fsys, name)
+}
+
+// WriteFile writes data to the named file, creating it with the permissions perm if necessary
+func (fsys *unixFsys) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return writeFile(fsys, name, data, perm)
+}
+
+// WriteFileAtomic writes data to the named file by writing it into a temporary file in the same
+// directory and renaming it over the target, so that the file is never observed half-written
+func (fsys *unixFsys) WriteFileAtomic(name string, data []byte, perm fs.FileMode) error {
+	return writeFileAtomic(fsys, name, data, perm)
+}
+
+// Remove removes the named file or empty directory. A symbolic link is removed instead of its target.
+func (fsys *unixFsys) Remove(name string) error {
+	info, err := fsys.Lstat(name)
+	if err != nil {
+		return err
+	}
+	cmd := "rm"
+	if info.IsDir() {
+		cmd = "rmdir"
+	}
+	if err := fsys.conn.Exec(fmt.Sprintf("%s -- %s", cmd, shellescape.Quote(name)), fsys.opts...); err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: ErrCommandFailed.Wrap(err)}
+	}
+	return nil
+}
+
+// MkdirAll creates the named directory along with any missing parents. The permission bits are
+// applied to the last directory in the path when it is created.
+func (fsys *unixFsys) MkdirAll(name string, perm fs.FileMode) error {
+	if err := fsys.conn.Exec(fmt.Sprintf("mkdir -p -m %#o -- %s", perm.Perm(), shellescape.Quote(name)), fsys.opts...); err != nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: ErrCommandFailed.Wrap(err)}
+	}
+	return nil
+}
+
+// Rename renames (moves) oldname to newname, replacing newname if it is an existing file
+func (fsys *unixFsys) Rename(oldname, newname string) error {
+	if err := fsys.conn.Exec(fmt.Sprintf("mv -f -- %s %s", shellescape.Quote(oldname), shellescape.Quote(newname)), fsys.opts...); err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: ErrCommandFailed.Wrap(err)}
+	}
+	return nil
+}
+
+// Chmod changes the mode of the named file
+func (fsys *unixFsys) Chmod(name string, mode fs.FileMode) error {
+	if err := fsys.conn.Exec(fmt.Sprintf("chmod %#o -- %s", mode.Perm(), shellescape.Quote(name)), fsys.opts...); err != nil {
+		return &fs.PathError{Op: "chmod", Path: name, Err: ErrCommandFailed.Wrap(err)}
+	}
+	return nil
+}
+
+// Chown changes the owner and group of the named file. The owner and group can be names or numeric
+// ids. The group is left unchanged when empty.
+func (fsys *unixFsys) Chown(name, owner, group string) error {
+	spec := owner
+	if group != "" {
+		spec += ":" + group
+	}
+	if err := fsys.conn.Exec(fmt.Sprintf("chown %s -- %s", shellescape.Quote(spec), shellescape.Quote(name)), fsys.opts...); err != nil {
+		return &fs.PathError{Op: "chown", Path: name, Err: ErrCommandFailed.Wrap(err)}
+	}
+	return nil
+}
+
+// Chtimes changes the access and modification times of the named file. The times are set with a
+// precision of one second.
+func (fsys *unixFsys) Chtimes(name string, atime, mtime time.Time) error {
+	const touchTime = "200601021504.05"
+	path := shellescape.Quote(name)
+	script := fmt.Sprintf("TZ=UTC touch -c -a -t %s -- %s && TZ=UTC touch -c -m -t %s -- %s", atime.UTC().Format(touchTime), path, mtime.UTC().Format(touchTime), path)
+	// a single command, so that sudo elevates both of the touches
+	cmd := "sh -c " + shellescape.Quote(script)
+	if err := fsys.conn.Exec(cmd, fsys.opts...); err != nil {
+		return &fs.PathError{Op: "chtimes", Path: name, Err: ErrCommandFailed.Wrap(err)}
+	}
+	return nil
+}
+
+// Symlink creates newname as a symbolic link to oldname
+func (fsys *unixFsys) Symlink(oldname, newname string) error {
+	if err := fsys.conn.Exec(fmt.Sprintf("ln -s -- %s %s", shellescape.Quote(oldname), shellescape.Quote(newname)), fsys.opts...); err != nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: ErrCommandFailed.Wrap(err)}
+	}
+	return nil
+}
+
+// Readlink returns the destination of the named symbolic link
+func (fsys *unixFsys) Readlink(name string) (string, error) {
+	out, err := fsys.conn.ExecOutput(fmt.Sprintf("readlink -- %s", shellescape.Quote(name)), fsys.opts...)
+	if err != nil {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: ErrCommandFailed.Wrap(err)}
+	}
+	return out, nil
+}
+
+func (fsys *unixFsys) dir(name string) string {
+	return path.Dir(name)
+}
+
+func (fsys *unixFsys) list(root string, depth int) ([]*FileInfo, error) {
+	args := []string{"walk", root}
+	if depth > 0 {
+		args = append(args, strconv.Itoa(depth))
+	}
+	res, err := fsys.helper(args...)
+	if err != nil {
+		return nil, &fs.PathError{Op: "walk", Path: root, Err: err}
+	}
+	return res.Dir, nil
+}
+
+// WalkDir walks the file tree rooted at root, calling fn for each file or directory in the tree,
+// including root, like fs.WalkDir. The tree is listed with a single find command.
+func (fsys *unixFsys) WalkDir(root string, fn fs.WalkDirFunc) error {
+	return walkDir(fsys, root, 0, fn)
+}
+
+// Glob returns the names of all files matching pattern like fs.Glob
+func (fsys *unixFsys) Glob(pattern string) ([]string, error) {
+	return glob(fsys, pattern)
+}
+
+// Find returns the paths of the files under root that match the filters in opts. The search is
+// performed with a single find command.
+func (fsys *unixFsys) Find(root string, opts FindOptions) ([]string, error) {
+	args := []string{"find", shellescape.Quote(root), "-mindepth", "1"}
+	if opts.MaxDepth > 0 {
+		args = append(args, "-maxdepth", strconv.Itoa(opts.MaxDepth))
+	}
+	if opts.Name != "" {
+		args = append(args, "-name", shellescape.Quote(opts.Name))
+	}
+	if opts.Type != "" {
+		args = append(args, "-type", shellescape.Quote(string(opts.Type)))
+	}
+	if opts.ModifiedWithin > 0 {
+		args = append(args, "-mmin", fmt.Sprintf("-%d", minutes(opts.ModifiedWithin)))
+	}
+	if opts.ModifiedBefore > 0 {
+		args = append(args, "-mmin", fmt.Sprintf("+%d", minutes(opts.ModifiedBefore)))
+	}
+	if opts.MinSize > 0 || opts.MaxSize > 0 {
+		// size filters only apply to files
+		args = append(args, "!", "-type", "d")
+	}
+	if opts.MinSize > 0 {
+		args = append(args, "-size", fmt.Sprintf("+%dc", opts.MinSize-1))
+	}
+	if opts.MaxSize > 0 {
+		args = append(args, "-size", fmt.Sprintf("-%dc", opts.MaxSize+1))
+	}
+	args = append(args, "-print0")
+
+	out, err := fsys.conn.ExecOutput(strings.Join(args, " "), fsys.opts...)
+	if err != nil {
+		return nil, &fs.PathError{Op: "find", Path: root, Err: ErrCommandFailed.Wrap(err)}
+	}
+	var paths []string
+	for _, p := range strings.Split(out, "\x00") {
+		if p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths, nil
+}
+
+// Sub returns a DirFS corresponding to the subtree rooted at dir
+func (fsys *unixFsys) Sub(dir string) (fs.FS, error) {
+	return NewDirFS(fsys, dir), nil
+}
+
+// mktemp runs mktemp with a template built from dir and pattern, the default temporary directory
+// is used when dir is empty
+func (fsys *unixFsys) mktemp(dir, pattern string, args ...string) (string, error) {
+	prefix, suffix, err := splitTempPattern(pattern)
+	if err != nil {
+		return "", err
+	}
+	tmpdir := `"${TMPDIR:-/tmp}"`
+	if dir != "" {
+		tmpdir = shellescape.Quote(dir)
+	}
+	args = append(args, tmpdir+"/"+shellescape.Quote(prefix+"XXXXXXXXXX"))
+	cmd := "mktemp " + strings.Join(args, " ")
+	if suffix != "" {
+		// mktemp --suffix is GNU only, the suffix is added by renaming the created file instead
+		target := `"$t"` + shellescape.Quote(suffix)
+		cmd = "sh -c " + shellescape.Quote(fmt.Sprintf(`t=$(%s) || exit 1; if [ ! -e %[2]s ] && mv -- "$t" %[2]s; then printf '%%s\n' %[2]s; else rm -rf -- "$t"; exit 1; fi`, cmd, target))
+	}
+	out, err := fsys.conn.ExecOutput(cmd, fsys.opts...)
+	if err != nil {
+		return "", ErrCommandFailed.Wrapf("mktemp: %w", err)
+	}
+	return out, nil
+}
+
+// MkdirTemp creates a new temporary directory in the directory dir and returns its path. The name
+// is generated by replacing the last "*" in pattern with a random string, or by appending one. The
+// default temporary directory is used when dir is empty.
+func (fsys *unixFsys) MkdirTemp(dir, pattern string) (string, error) {
+	return fsys.mktemp(dir, pattern, "-d")
+}
+
+// CreateTemp creates a new empty temporary file in the directory dir and returns its path. The name
+// is generated like in MkdirTemp.
+func (fsys *unixFsys) CreateTemp(dir, pattern string) (string, error) {
+	return fsys.mktemp(dir, pattern)
+}
+
+// Watch polls the named file every interval and sends an event on the returned channel when it is
+// created, modified or removed. Changes are detected by comparing the size, modification time and
+// checksum of the file. Call the returned function to stop watching, which also closes the channel.
+func (fsys *unixFsys) Watch(name string, interval time.Duration) (<-chan FileEvent, func()) {
+	return watch(fsys, name, interval)
+}
@@ -0,0 +1,163 @@
+package rig
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/creasty/defaults"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnixWriteCmd(t *testing.T) {
+	f := &unixFSFile{path: "/tmp/file", mode: ModeReadWrite}
+	require.Equal(t, "dd if=/dev/stdin of=/tmp/file bs=1048576 seek=0 conv=notrunc", f.writeCmd())
+
+	f.pos = 3 << 20
+	require.Equal(t, "dd if=/dev/stdin of=/tmp/file bs=1048576 seek=3 conv=notrunc", f.writeCmd())
+
+	f.pos = 13
+	require.Equal(t, "dd if=/dev/stdin of=/tmp/file bs=1048576 seek=13 oflag=seek_bytes conv=notrunc", f.writeCmd())
+
+	f.mode = ModeAppend
+	require.Equal(t, "dd if=/dev/stdin of=/tmp/file bs=1048576 oflag=append conv=notrunc", f.writeCmd())
+}
+
+func TestUnixWriteAt(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses the unix filesystem")
+	}
+	h := Host{Connection: Connection{Localhost: &Localhost{Enabled: true}}}
+	require.NoError(t, defaults.Set(&h))
+	require.NoError(t, h.Connect())
+	path := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(path, []byte("0123456789"), 0o600))
+
+	f, err := h.Fsys().OpenFile(path, ModeReadWrite, 0o600)
+	require.NoError(t, err)
+	_, err = f.Seek(3, io.SeekStart)
+	require.NoError(t, err)
+	_, err = f.Write([]byte("abc"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	f, err = h.Fsys().OpenFile(path, ModeAppend, 0o600)
+	require.NoError(t, err)
+	_, err = f.Write([]byte("xyz"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "012abc6789xyz", string(content))
+}
+
+func TestUnixHelperControlCharacters(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses the unix helper")
+	}
+	name := "a\x01b\nc\td\x1f"
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte("x"), 0o600))
+
+	h := Host{Connection: Connection{Localhost: &Localhost{Enabled: true}}}
+	require.NoError(t, defaults.Set(&h))
+	require.NoError(t, h.Connect())
+	info, err := h.Fsys().Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, name, info.Name())
+}
+
+func TestUnixHelperChecksumEscapedName(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses the unix helper")
+	}
+	// sha256sum prefixes the line with a backslash when the file name needs escaping
+	name := "a\\b\nc"
+	dir := t.TempDir()
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte("hello"), 0o600))
+	const sum = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+
+	h := Host{Connection: Connection{Localhost: &Localhost{Enabled: true}}}
+	require.NoError(t, defaults.Set(&h))
+	require.NoError(t, h.Connect())
+	got, err := h.Fsys().Sha256(path)
+	require.NoError(t, err)
+	require.Equal(t, sum, got)
+
+	manifest, err := h.Fsys().Manifest(dir)
+	require.NoError(t, err)
+	entry, ok := manifest.Get(name)
+	require.True(t, ok)
+	require.Equal(t, sum, entry.Sha256)
+}
+
+func TestUnixCreateTempSuffix(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses the unix filesystem")
+	}
+	dir := t.TempDir()
+	h := Host{Connection: Connection{Localhost: &Localhost{Enabled: true}}}
+	require.NoError(t, defaults.Set(&h))
+	require.NoError(t, h.Connect())
+
+	name, err := h.Fsys().CreateTemp(dir, "test-*.conf")
+	require.NoError(t, err)
+	require.Equal(t, dir, filepath.Dir(name))
+	require.True(t, strings.HasPrefix(filepath.Base(name), "test-"), name)
+	require.True(t, strings.HasSuffix(name, ".conf"), name)
+	require.FileExists(t, name)
+
+	name, err = h.Fsys().MkdirTemp(dir, "dir-*.d")
+	require.NoError(t, err)
+	require.True(t, strings.HasSuffix(name, ".d"), name)
+	require.DirExists(t, name)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2, "no leftovers from the renames")
+}
+
+func TestUnixChtimesSudo(t *testing.T) {
+	installFakeSudo(t, "")
+	c := elevatedLocalhost(t, elevation{name: ElevateSudo, sudo: sudoSudo, runAs: runAsSudo})
+
+	path := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(path, []byte("x"), 0o600))
+	atime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	mtime := time.Date(2021, 6, 7, 8, 9, 10, 0, time.UTC)
+	require.NoError(t, c.SudoFsys().Chtimes(path, atime, mtime))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.True(t, mtime.Equal(info.ModTime()), info.ModTime())
+}
+
+func TestUnixRemoveSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses the unix filesystem")
+	}
+	h := Host{Connection: Connection{Localhost: &Localhost{Enabled: true}}}
+	require.NoError(t, defaults.Set(&h))
+	require.NoError(t, h.Connect())
+
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target")
+	require.NoError(t, os.Mkdir(target, 0o755))
+	link := filepath.Join(dir, "link")
+	require.NoError(t, os.Symlink(target, link))
+	dangling := filepath.Join(dir, "dangling")
+	require.NoError(t, os.Symlink(filepath.Join(dir, "missing"), dangling))
+
+	require.NoError(t, h.Fsys().Remove(link))
+	require.NoFileExists(t, link)
+	require.DirExists(t, target)
+
+	require.NoError(t, h.Fsys().Remove(dangling))
+	_, err := os.Lstat(dangling)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,135 @@
+package rig
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/creasty/defaults"
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldError is a validation failure of a single configuration field
+type FieldError struct {
+	// Field is the path of the field in the YAML configuration, such as ssh.port or winRM.caCertPath
+	Field   string
+	Message string
+}
+
+// Error returns the field path and the message
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ValidationErrors holds all the validation failures of a configuration. It matches
+// ErrValidationFailed in errors.Is.
+type ValidationErrors []FieldError
+
+// Error lists the failures, one per line
+func (e ValidationErrors) Error() string {
+	lines := make([]string, len(e))
+	for i, fe := range e {
+		lines[i] = fe.Error()
+	}
+	return ErrValidationFailed.Error() + ":\n" + strings.Join(lines, "\n")
+}
+
+// Is returns true for ErrValidationFailed
+func (e ValidationErrors) Is(target error) bool {
+	return target == ErrValidationFailed //nolint:goerr113
+}
+
+var (
+	validate     *validator.Validate
+	validateOnce sync.Once
+)
+
+func getValidator() *validator.Validate {
+	validateOnce.Do(func() {
+		validate = validator.New()
+		// name the fields like in yaml, the fields without a yaml tag are not validated
+		validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+			if field.Tag.Get("yaml") == "" {
+				return "-"
+			}
+			return yamlFieldName(field)
+		})
+	})
+	return validate
+}
+
+// fieldMessage describes the failed validation rule
+func fieldMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "required_without":
+		return fmt.Sprintf("is required when %s is not set", strings.ToLower(fe.Param()))
+	case "hostname|ip":
+		return fmt.Sprintf("%q is not a valid hostname or IP address", fe.Value())
+	case "oneof":
+		return fmt.Sprintf("%q is not one of %s", fe.Value(), strings.ReplaceAll(fe.Param(), " ", ", "))
+	case "file":
+		return fmt.Sprintf("file %q does not exist", fe.Value())
+	case "gt":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("must be longer than %s characters", fe.Param())
+		}
+		return fmt.Sprintf("%v must be greater than %s", fe.Value(), fe.Param())
+	case "lte":
+		return fmt.Sprintf("%v must be at most %s", fe.Value(), fe.Param())
+	}
+	return fmt.Sprintf("%v fails the %s check", fe.Value(), fe.Tag())
+}
+
+// validateStruct validates the fields of s and returns the failures with the paths prefixed with
+// prefix
+func validateStruct(s any, prefix string) ValidationErrors {
+	err := getValidator().Struct(s)
+	var fieldErrors validator.ValidationErrors
+	if !errors.As(err, &fieldErrors) {
+		return nil
+	}
+	result := make(ValidationErrors, 0, len(fieldErrors))
+	for _, fe := range fieldErrors {
+		// the namespace starts with the name of the struct type
+		_, path, _ := strings.Cut(fe.Namespace(), ".")
+		if prefix != "" {
+			path = prefix + "." + path
+		}
+		result = append(result, FieldError{Field: path, Message: fieldMessage(fe)})
+	}
+	return result
+}
+
+// Validate checks the whole configuration of the connection after setting the defaults and returns
+// all the problems found as ValidationErrors, so that they can be fixed in one go. Validate is not
+// called by Connect.
+func (c *Connection) Validate() error {
+	if c.client == nil {
+		if err := defaults.Set(c); err != nil {
+			return ErrValidationFailed.Wrapf("set defaults: %w", err)
+		}
+	}
+
+	errs := validateStruct(c, "")
+
+	if c.Custom != nil && c.Custom.Client != nil && reflect.Indirect(reflect.ValueOf(c.Custom.Client)).Kind() == reflect.Struct {
+		errs = append(errs, validateStruct(c.Custom.Client, "connection."+c.Custom.Name)...)
+	}
+
+	if c.Elevate != nil && c.Elevate.Method == ElevateCustom {
+		if c.Elevate.Template == "" {
+			errs = append(errs, FieldError{Field: "elevate.template", Message: "is required for the custom method"})
+		} else if _, err := templateRunAs(c.Elevate.Template); err != nil {
+			errs = append(errs, FieldError{Field: "elevate.template", Message: errors.Unwrap(err).Error()})
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
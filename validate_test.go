@@ -0,0 +1,32 @@
+package rig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	c := &Connection{
+		WinRM: &WinRM{
+			Address:    "not a host",
+			Port:       70000,
+			CACertPath: "/nonexistent/ca.pem",
+			Bastion:    &SSH{Address: "10.0.0.1", Port: -1},
+		},
+		Elevate: &Elevate{Method: ElevateCustom},
+	}
+	err := c.Validate()
+	require.ErrorIs(t, err, ErrValidationFailed)
+	var errs ValidationErrors
+	require.ErrorAs(t, err, &errs)
+	fields := make([]string, len(errs))
+	for i, fe := range errs {
+		fields[i] = fe.Field
+	}
+	require.ElementsMatch(t, []string{"winRM.address", "winRM.port", "winRM.caCertPath", "winRM.bastion.port", "elevate.template"}, fields)
+	require.Contains(t, err.Error(), "winRM.port: 70000 must be at most 65535")
+
+	c = &Connection{SSH: &SSH{Address: "10.0.0.1"}}
+	require.NoError(t, c.Validate())
+}
@@ -0,0 +1,142 @@
+package rig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/alessio/shellescape"
+	"github.com/k0sproject/rig/errstring"
+	"github.com/k0sproject/rig/exec"
+	"github.com/k0sproject/rig/pkg/clock"
+	"github.com/k0sproject/rig/pkg/ssh/hostkey"
+	ps "github.com/k0sproject/rig/powershell"
+)
+
+// WaitPollInterval is the time between the checks of WaitForTCPPort and WaitForHTTP
+var WaitPollInterval = 2 * time.Second
+
+var (
+	errNotReady = errstring.New("not ready")
+
+	// waitAddressRe matches host names and IPv4 and IPv6 addresses
+	waitAddressRe = regexp.MustCompile(`^[\w.:-]+$`)
+)
+
+// WaitForConnection calls conn.Connect every interval until it succeeds or the context is done, for
+// example to wait for a freshly created virtual machine or its bastion host to boot up. Network
+// failures are retried. Errors that retrying won't fix, such as failed authentication, a rejected
+// host key or an invalid configuration, are returned immediately. When the context is done, the
+// returned error wraps the error of the last attempt.
+func WaitForConnection(ctx context.Context, conn *Connection, interval time.Duration) error {
+	for attempt := 1; ; attempt++ {
+		err := conn.Connect()
+		if err == nil {
+			return nil
+		}
+		if !isRetryableConnectError(err) {
+			return err
+		}
+		conn.Logger().Debugf("%s: host is not reachable yet (attempt %d): %v", conn, attempt, err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("gave up waiting for the host after %d attempts: %v: %w", attempt, ctx.Err(), err)
+		case <-clock.Default.After(interval):
+		}
+	}
+}
+
+// isRetryableConnectError returns false for connection errors caused by authentication or the
+// configuration. ErrCantConnect is retried when it wraps a network error.
+func isRetryableConnectError(err error) bool {
+	switch {
+	case errors.Is(err, ErrAuthFailed), errors.Is(err, ErrValidationFailed), errors.Is(err, ErrInvalidPath):
+		return false
+	case errors.Is(err, hostkey.ErrHostKeyMismatch), errors.Is(err, hostkey.ErrHostKeyRejected):
+		return false
+	case errors.Is(err, ErrCantConnect):
+		var netErr net.Error
+		return errors.As(err, &netErr)
+	default:
+		return true
+	}
+}
+
+// waitFor runs check every WaitPollInterval until it succeeds or the context is done
+func (c *Connection) waitFor(ctx context.Context, what string, check func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := check()
+		if err == nil {
+			return nil
+		}
+		c.Logger().Debugf("%s: waiting for %s (attempt %d): %v", c, what, attempt, err)
+		select {
+		case <-ctx.Done():
+			return ErrTimeout.Wrapf("gave up waiting for %s after %d attempts: %w", what, attempt, err)
+		case <-clock.Default.After(WaitPollInterval):
+		}
+	}
+}
+
+// WaitForTCPPort waits until a TCP port accepts connections when connected to from the host, for
+// example to wait for a service listening on the host itself with addr "127.0.0.1". The check uses
+// nc or bash on unix hosts.
+func (c *Connection) WaitForTCPPort(ctx context.Context, addr string, port int) error {
+	if err := c.checkConnected(); err != nil {
+		return err
+	}
+	if !waitAddressRe.MatchString(addr) {
+		return ErrValidationFailed.Wrapf("invalid address %q", addr)
+	}
+	var cmd string
+	if c.IsWindows() {
+		cmd = ps.Cmd(fmt.Sprintf(`$c = New-Object Net.Sockets.TcpClient; try { if (-not $c.ConnectAsync(%s, %d).Wait(2000)) { exit 1 } } catch { exit 1 } finally { $c.Dispose() }`, ps.SingleQuote(addr), port))
+	} else {
+		script := fmt.Sprintf(
+			`if command -v nc > /dev/null 2>&1; then nc -z -w 2 %[1]s %[2]d; else timeout 2 bash -c %[3]s; fi`,
+			shellescape.Quote(addr), port, shellescape.Quote(fmt.Sprintf("exec 3<> /dev/tcp/%s/%d", addr, port)),
+		)
+		cmd = "sh -c " + shellescape.Quote(script)
+	}
+	return c.waitFor(ctx, fmt.Sprintf("port %s:%d", addr, port), func() error {
+		return c.Exec(cmd, exec.HideOutput(), exec.HideCommand())
+	})
+}
+
+// WaitForHTTP waits until a request made from the host to the url gets a response with the
+// expectStatus status code, or any 2xx status code when expectStatus is 0. The certificates of https
+// urls are not verified. The request is made using curl or wget on unix hosts and
+// Invoke-WebRequest on windows.
+func (c *Connection) WaitForHTTP(ctx context.Context, url string, expectStatus int) error {
+	if err := c.checkConnected(); err != nil {
+		return err
+	}
+	var cmd string
+	if c.IsWindows() {
+		cmd = ps.Cmd(fmt.Sprintf(`[Net.ServicePointManager]::ServerCertificateValidationCallback = { $true }; try { [int](Invoke-WebRequest -UseBasicParsing -TimeoutSec 5 -Uri %s).StatusCode } catch { if ($_.Exception.Response) { [int]$_.Exception.Response.StatusCode } else { 0 } }`, ps.SingleQuote(url)))
+	} else {
+		script := fmt.Sprintf(
+			`if command -v curl > /dev/null 2>&1; then curl -k -s -o /dev/null -w '%%{http_code}' --max-time 5 %[1]s; else wget --no-check-certificate -S -O /dev/null -T 5 %[1]s 2>&1 | awk '/^ +HTTP\// { c = $2 } END { print c }'; fi`,
+			shellescape.Quote(url),
+		)
+		cmd = "sh -c " + shellescape.Quote(script)
+	}
+	return c.waitFor(ctx, url, func() error {
+		out, err := c.ExecOutput(cmd, exec.HideOutput(), exec.HideCommand())
+		status, _ := strconv.Atoi(out)
+		switch {
+		case status == 0 && err != nil:
+			return err
+		case status == 0:
+			return errNotReady.Wrapf("no response")
+		case expectStatus == 0 && status >= 200 && status < 300, status == expectStatus:
+			return nil
+		default:
+			return errNotReady.Wrapf("unexpected status %d", status)
+		}
+	})
+}
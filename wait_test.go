@@ -0,0 +1,194 @@
+package rig
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	osexec "os/exec"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/creasty/defaults"
+	"github.com/k0sproject/rig/pkg/ssh/hostkey"
+	"github.com/k0sproject/rig/pkg/ssh/sshtest"
+	"github.com/stretchr/testify/require"
+)
+
+func closedPort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+	require.NoError(t, l.Close())
+	return port
+}
+
+func TestIsRetryableConnectError(t *testing.T) {
+	dialErr := &net.OpError{Op: "dial", Net: "tcp", Err: fmt.Errorf("connection refused")}
+	require.True(t, isRetryableConnectError(fmt.Errorf("ssh dial: %w", dialErr)))
+	require.True(t, isRetryableConnectError(ErrNotConnected.Wrapf("client connect: %w", ErrCantConnect.Wrapf("bastion dial: %w", dialErr))))
+	require.False(t, isRetryableConnectError(ErrCantConnect.Wrapf("create config: invalid key")))
+	require.False(t, isRetryableConnectError(ErrNotConnected.Wrapf("client connect: %w", ErrAuthFailed.Wrapf("denied"))))
+	require.False(t, isRetryableConnectError(ErrCantConnect.Wrapf("bastion connect: %w", hostkey.ErrHostKeyMismatch)))
+	require.False(t, isRetryableConnectError(ErrValidationFailed.Wrapf("set defaults")))
+}
+
+func TestWaitForConnectionRetriesUnreachable(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "id_ed25519")
+	_, err := sshtest.GenerateKeyFile(keyPath)
+	require.NoError(t, err)
+	knownHosts := filepath.Join(dir, "known_hosts")
+
+	for name, c := range map[string]*SSH{
+		"direct":  {Address: "127.0.0.1", Port: closedPort(t), User: "test", KeyPath: &keyPath, KnownHostsPath: knownHosts},
+		"bastion": {Address: "127.0.0.1", Port: 22, User: "test", KeyPath: &keyPath, KnownHostsPath: knownHosts, Bastion: &SSH{Address: "127.0.0.1", Port: closedPort(t), User: "test", KeyPath: &keyPath, KnownHostsPath: knownHosts}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			conn := &Connection{SSH: c}
+			var attempts int
+			conn.OnConnect(func(_ *Connection, _ error) { attempts++ })
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+			err := WaitForConnection(ctx, conn, 10*time.Millisecond)
+			require.Error(t, err)
+			require.ErrorIs(t, err, ErrNotConnected)
+			require.Greater(t, attempts, 1)
+		})
+	}
+}
+
+func TestWaitForConnectionHostKeyRejected(t *testing.T) {
+	server, err := sshtest.NewServer()
+	require.NoError(t, err)
+	defer server.Close()
+
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "id_ed25519")
+	_, err = sshtest.GenerateKeyFile(keyPath)
+	require.NoError(t, err)
+
+	c := &SSH{Address: server.Host(), Port: server.Port(), User: "test", KeyPath: &keyPath, KnownHostsPath: filepath.Join(dir, "known_hosts")}
+	c.HostKeyConfirmCallback = func(_, _ string) bool { return false }
+	conn := &Connection{SSH: c}
+	var attempts int
+	conn.OnConnect(func(_ *Connection, _ error) { attempts++ })
+	err = WaitForConnection(context.Background(), conn, 10*time.Millisecond)
+	require.ErrorIs(t, err, hostkey.ErrHostKeyRejected)
+	require.Equal(t, 1, attempts)
+}
+
+func TestWaitForConnection(t *testing.T) {
+	dialErr := &net.OpError{Op: "dial", Net: "tcp", Err: fmt.Errorf("connection refused")}
+	client := &scriptClient{connectErrs: []error{dialErr, ErrCantConnect.Wrapf("dial: %w", dialErr)}}
+	conn := &Connection{Custom: &ClientConfig{Name: "script", Client: client}, OSVersion: &OSVersion{ID: "linux"}}
+	var attempts int
+	conn.OnConnect(func(_ *Connection, _ error) { attempts++ })
+	require.NoError(t, WaitForConnection(context.Background(), conn, time.Millisecond))
+	require.Equal(t, 3, attempts)
+	require.True(t, client.IsConnected())
+
+	client = &scriptClient{connectErrs: []error{dialErr, ErrAuthFailed.Wrapf("denied"), dialErr}}
+	conn = &Connection{Custom: &ClientConfig{Name: "script", Client: client}, OSVersion: &OSVersion{ID: "linux"}}
+	err := WaitForConnection(context.Background(), conn, time.Millisecond)
+	require.ErrorIs(t, err, ErrAuthFailed)
+	require.Len(t, client.connectErrs, 1, "gave up after the authentication failure")
+
+	client = &scriptClient{connectErrs: []error{dialErr, dialErr, dialErr}}
+	conn = &Connection{Custom: &ClientConfig{Name: "script", Client: client}, OSVersion: &OSVersion{ID: "linux"}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = WaitForConnection(ctx, conn, time.Hour)
+	require.ErrorContains(t, err, context.Canceled.Error())
+	require.ErrorIs(t, err, dialErr, "wraps the error of the last attempt")
+}
+
+func TestWaitForTCPPort(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses the unix check")
+	}
+	defer func(interval time.Duration) { WaitPollInterval = interval }(WaitPollInterval)
+	WaitPollInterval = 50 * time.Millisecond
+
+	c := &Connection{Localhost: &Localhost{Enabled: true}}
+	require.NoError(t, defaults.Set(c))
+	require.NoError(t, c.Connect())
+	t.Cleanup(func() { _ = c.Disconnect() })
+
+	require.ErrorIs(t, c.WaitForTCPPort(context.Background(), "127.0.0.1; reboot", 22), ErrValidationFailed)
+
+	port := closedPort(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, c.WaitForTCPPort(ctx, "127.0.0.1", port), ErrTimeout)
+
+	// the port starts listening while waiting
+	listening := make(chan net.Listener, 1)
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		l, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		if err != nil {
+			close(listening)
+			return
+		}
+		listening <- l
+	}()
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := c.WaitForTCPPort(ctx, "127.0.0.1", port)
+	if l, ok := <-listening; ok {
+		defer l.Close()
+	} else {
+		t.Skip("the port was taken")
+	}
+	require.NoError(t, err)
+}
+
+func TestWaitForHTTP(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses the unix check")
+	}
+	_, curlErr := osexec.LookPath("curl")
+	_, wgetErr := osexec.LookPath("wget")
+	if curlErr != nil && wgetErr != nil {
+		t.Skip("requires curl or wget")
+	}
+	defer func(interval time.Duration) { WaitPollInterval = interval }(WaitPollInterval)
+	WaitPollInterval = 50 * time.Millisecond
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case requests.Add(1) < 3:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	c := &Connection{Localhost: &Localhost{Enabled: true}}
+	require.NoError(t, defaults.Set(c))
+	require.NoError(t, c.Connect())
+	t.Cleanup(func() { _ = c.Disconnect() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	require.NoError(t, c.WaitForHTTP(ctx, server.URL+"/ready", 0))
+	require.Equal(t, int32(3), requests.Load(), "retried until the status was 2xx")
+
+	require.NoError(t, c.WaitForHTTP(ctx, server.URL+"/missing", http.StatusNotFound))
+
+	short, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	err := c.WaitForHTTP(short, server.URL+"/missing", 0)
+	require.ErrorIs(t, err, ErrTimeout)
+	require.ErrorContains(t, err, "unexpected status 404")
+}
@@ -0,0 +1,137 @@
+package rig
+
+import (
+	"errors"
+	"io/fs"
+	"sync"
+	"time"
+
+	"github.com/k0sproject/rig/pkg/clock"
+)
+
+// FileOp is the kind of change reported by a FileEvent
+type FileOp int
+
+const (
+	FileCreated  FileOp = iota + 1 // FileCreated is reported when a watched file appears
+	FileModified                   // FileModified is reported when the content, size or modification time of a watched file changes
+	FileRemoved                    // FileRemoved is reported when a watched file disappears
+	FileError                      // FileError is reported when the state of a watched file can't be determined
+)
+
+// String returns the name of the operation
+func (o FileOp) String() string {
+	switch o {
+	case FileCreated:
+		return "created"
+	case FileModified:
+		return "modified"
+	case FileRemoved:
+		return "removed"
+	case FileError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// FileEvent describes a change to a file watched with FS.Watch
+type FileEvent struct {
+	Path string
+	Op   FileOp
+	Info fs.FileInfo // Info is the state of the file after the change, nil for removed files
+	Err  error       // Err is set for FileError events
+}
+
+// fileState is the polled state of a watched file
+type fileState struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+	sum     string
+}
+
+func (s fileState) changed(other fileState) bool {
+	return s.size != other.size || !s.modTime.Equal(other.modTime) || s.sum != other.sum
+}
+
+// pollFile returns the current state of a file. The checksum is only calculated for regular files.
+func pollFile(fsys FS, name string) (fileState, fs.FileInfo, error) {
+	info, err := fsys.Stat(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fileState{}, nil, nil
+	}
+	if err != nil {
+		return fileState{}, nil, err //nolint:wrapcheck
+	}
+	state := fileState{exists: true, size: info.Size(), modTime: info.ModTime()}
+	if info.Mode().IsRegular() {
+		sum, err := fsys.Sha256(name)
+		if err != nil {
+			return fileState{}, nil, err //nolint:wrapcheck
+		}
+		state.sum = sum
+	}
+	return state, info, nil
+}
+
+// watch polls the file name every interval and sends an event on the returned channel when it
+// changes. The returned function stops the polling and closes the channel.
+func watch(fsys FS, name string, interval time.Duration) (<-chan FileEvent, func()) {
+	events := make(chan FileEvent)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		defer close(events)
+
+		send := func(event FileEvent) bool {
+			select {
+			case events <- event:
+				return true
+			case <-stop:
+				return false
+			}
+		}
+
+		prev, _, err := pollFile(fsys, name)
+		if err != nil && !send(FileEvent{Path: name, Op: FileError, Err: err}) {
+			return
+		}
+		for {
+			select {
+			case <-stop:
+				return
+			case <-clock.Default.After(interval):
+			}
+
+			state, info, err := pollFile(fsys, name)
+			var event *FileEvent
+			switch {
+			case err != nil:
+				event = &FileEvent{Path: name, Op: FileError, Err: err}
+			case state.exists && !prev.exists:
+				event = &FileEvent{Path: name, Op: FileCreated, Info: info}
+			case !state.exists && prev.exists:
+				event = &FileEvent{Path: name, Op: FileRemoved}
+			case state.exists && state.changed(prev):
+				event = &FileEvent{Path: name, Op: FileModified, Info: info}
+			}
+			if err == nil {
+				prev = state
+			}
+			if event != nil && !send(*event) {
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return events, func() {
+		once.Do(func() {
+			close(stop)
+			<-done
+		})
+	}
+}
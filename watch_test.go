@@ -0,0 +1,82 @@
+package rig
+
+import (
+	"io/fs"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type watchFS struct {
+	FS
+	mu    sync.Mutex
+	info  *FileInfo
+	sum   string
+	polls chan struct{}
+}
+
+func (w *watchFS) set(info *FileInfo, sum string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.info = info
+	w.sum = sum
+}
+
+func (w *watchFS) Stat(name string) (fs.FileInfo, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	select {
+	case w.polls <- struct{}{}:
+	default:
+	}
+	if w.info == nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return w.info, nil
+}
+
+func (w *watchFS) Sha256(string) (string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.sum, nil
+}
+
+func TestWatch(t *testing.T) {
+	fsys := &watchFS{polls: make(chan struct{})}
+	events, stop := watch(fsys, "/etc/app.conf", time.Millisecond)
+	defer stop()
+	// wait for the initial state to be recorded
+	<-fsys.polls
+
+	next := func() FileEvent {
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for an event")
+		}
+		return FileEvent{}
+	}
+
+	modTime := time.Unix(1700000000, 0)
+	fsys.set(&FileInfo{FName: "/etc/app.conf", FSize: 3, FModTime: modTime}, "abc")
+	event := next()
+	require.Equal(t, FileCreated, event.Op)
+	require.Equal(t, "/etc/app.conf", event.Path)
+	require.Equal(t, int64(3), event.Info.Size())
+
+	// same size and modification time, different content
+	fsys.set(&FileInfo{FName: "/etc/app.conf", FSize: 3, FModTime: modTime}, "def")
+	require.Equal(t, FileModified, next().Op)
+
+	fsys.set(nil, "")
+	event = next()
+	require.Equal(t, FileRemoved, event.Op)
+	require.Nil(t, event.Info)
+
+	stop()
+	_, ok := <-events
+	require.False(t, ok, "channel should be closed after stop")
+}
@@ -9,13 +9,15 @@ import (
 	"io"
 	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/k0sproject/rig/errstring"
 	"github.com/k0sproject/rig/exec"
-	"github.com/k0sproject/rig/log"
 	ps "github.com/k0sproject/rig/powershell"
 )
 
@@ -59,18 +61,22 @@ type sumResponse struct {
 }
 
 type rigrcpResponse struct {
-	Err       error         `json:"-"`
-	ErrString string        `json:"error"`
-	Stat      *FileInfo     `json:"stat"`
-	Dir       []*FileInfo   `json:"dir"`
-	Seek      *seekResponse `json:"seek"`
-	Read      *readResponse `json:"read"`
-	Sum       *sumResponse  `json:"sum"`
+	Err       error               `json:"-"`
+	ErrString string              `json:"error"`
+	Stat      *FileInfo           `json:"stat"`
+	Dir       []*FileInfo         `json:"dir"`
+	Seek      *seekResponse       `json:"seek"`
+	Read      *readResponse       `json:"read"`
+	Sum       *sumResponse        `json:"sum"`
+	Manifest  []*manifestResponse `json:"manifest"`
+	Path      string              `json:"path"`
+	Paths     []string            `json:"paths"`
+	Rm        []*rmResponse       `json:"rm"`
 }
 
 func (r *rigrcpResponse) UnmarshalJSON(b []byte) error {
-	type rigresponse *rigrcpResponse
-	rr := rigresponse(r)
+	type rigresponse rigrcpResponse
+	rr := (*rigresponse)(r)
 	if err := json.Unmarshal(b, rr); err != nil {
 		return ErrCommandFailed.Wrapf("failed to unmarshal rigrcp response: %w", err)
 	}
@@ -101,7 +107,7 @@ type rigrcp struct {
 }
 
 func (rcp *rigrcp) run() error {
-	log.Debugf("starting rigrcp")
+	rcp.conn.Logger().Debugf("starting rigrcp")
 	rcp.mu.Lock()
 	defer rcp.mu.Unlock()
 
@@ -117,14 +123,14 @@ func (rcp *rigrcp) run() error {
 		return ErrCommandFailed.Wrapf("failed to start rigrcp: %w", err)
 	}
 	rcp.running = true
-	log.Tracef("started rigrcp")
+	rcp.conn.Logger().Tracef("started rigrcp")
 
 	go func() {
 		err := waiter.Wait()
 		if err != nil {
-			log.Errorf("rigrcp: %v", err)
+			rcp.conn.Logger().Errorf("rigrcp: %v", err)
 		}
-		log.Debugf("rigrcp exited")
+		rcp.conn.Logger().Debugf("rigrcp exited")
 		close(rcp.done)
 		rcp.running = false
 	}()
@@ -132,6 +138,8 @@ func (rcp *rigrcp) run() error {
 	return nil
 }
 
+// command sends a command to the rigrcp process and decodes its response. The commands and the
+// responses are sent as frames, see writeFrame.
 func (rcp *rigrcp) command(cmd string) (rigrcpResponse, error) {
 	var res rigrcpResponse
 	if !rcp.running {
@@ -144,25 +152,25 @@ func (rcp *rigrcp) command(cmd string) (rigrcpResponse, error) {
 
 	resp := make(chan []byte, 1)
 	go func() {
-		b, err := rcp.stdout.ReadBytes(0)
+		b, err := readFrame(rcp.stdout)
 		if err != nil {
-			log.Errorf("failed to read response: %v", err)
+			rcp.conn.Logger().Errorf("failed to read response: %v", err)
 			close(resp)
 			return
 		}
-		resp <- b[:len(b)-1] // drop the zero byte
+		resp <- b
 	}()
 
-	log.Tracef("writing rigrcp command: %s", cmd)
-	if _, err := rcp.stdin.Write([]byte(cmd + "\n")); err != nil {
+	rcp.conn.Logger().Tracef("writing rigrcp command: %s", cmd)
+	if err := writeFrame(rcp.stdin, []byte(cmd)); err != nil {
 		return res, ErrRcpCommandFailed.Wrap(err)
 	}
 	select {
 	case <-rcp.done:
 		return res, ErrRcpCommandFailed.Wrapf("rigrcp exited")
-	case data := <-resp:
-		if data == nil {
-			return res, nil
+	case data, ok := <-resp:
+		if !ok {
+			return res, ErrRcpCommandFailed.Wrapf("failed to read response")
 		}
 		if len(data) == 0 {
 			return res, nil
@@ -170,7 +178,7 @@ func (rcp *rigrcp) command(cmd string) (rigrcpResponse, error) {
 		if err := json.Unmarshal(data, &res); err != nil {
 			return res, ErrRcpCommandFailed.Wrapf("failed to unmarshal response: %w", err)
 		}
-		log.Tracef("rigrcp response: %+v", res)
+		rcp.conn.Logger().Tracef("rigrcp response: %+v", res)
 		if res.Err != nil {
 			if res.Err.Error() == "eof" {
 				return res, io.EOF
@@ -181,6 +189,56 @@ func (rcp *rigrcp) command(cmd string) (rigrcpResponse, error) {
 	}
 }
 
+// writeFrame writes a frame of the rigrcp protocol: the length of the payload in bytes in decimal and
+// a newline followed by the payload. The frame is written in a single call so that it can't be split.
+func writeFrame(w io.Writer, payload []byte) error {
+	frame := make([]byte, 0, len(payload)+8)
+	frame = strconv.AppendInt(frame, int64(len(payload)), 10)
+	frame = append(frame, '\n')
+	frame = append(frame, payload...)
+	_, err := w.Write(frame)
+	return err //nolint:wrapcheck
+}
+
+// readFrame reads a frame written like with writeFrame and returns the payload, which is empty for
+// the acknowledgements of the commands that have no response
+func readFrame(r *bufio.Reader) ([]byte, error) {
+	header, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	size, err := strconv.Atoi(strings.TrimSpace(header))
+	if err != nil || size < 0 {
+		return nil, ErrRcpCommandFailed.Wrapf("invalid frame header %q", header)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	return payload, nil
+}
+
+// call sends a command that takes its arguments as a JSON object, which allows passing any number of
+// paths regardless of the characters they contain
+func (rcp *rigrcp) call(cmd string, args map[string]any) (rigrcpResponse, error) {
+	data, err := json.Marshal(args)
+	if err != nil {
+		return rigrcpResponse{}, ErrRcpCommandFailed.Wrapf("marshal arguments: %w", err)
+	}
+	return rcp.command(cmd + " " + string(data))
+}
+
+// close stops the rigrcp process by closing its stdin and waits for it to exit
+func (rcp *rigrcp) close() {
+	if !rcp.running {
+		return
+	}
+	rcp.mu.Lock()
+	defer rcp.mu.Unlock()
+	_ = rcp.stdin.Close()
+	<-rcp.done
+}
+
 // winfsFile is a file on a Windows target. It implements fs.File.
 type winfsFile struct {
 	fsys *windowsFsys
@@ -213,10 +271,12 @@ type winfsDir struct {
 // ReadDir reads the contents of the directory and returns
 // a slice of up to n fs.DirEntry values in directory order.
 // Subsequent calls on the same file will yield further DirEntry values.
+// Close closes the directory. Directories are not opened in the rigrcp process, so there is nothing to do.
+func (d *winfsDir) Close() error {
+	return nil
+}
+
 func (d *winfsDir) ReadDir(n int) ([]fs.DirEntry, error) {
-	if n == 0 {
-		return d.winfsFile.fsys.ReadDir(d.path)
-	}
 	if d.entries == nil {
 		entries, err := d.winfsFile.fsys.ReadDir(d.path)
 		if err != nil {
@@ -225,6 +285,11 @@ func (d *winfsDir) ReadDir(n int) ([]fs.DirEntry, error) {
 		d.entries = entries
 		d.hw = 0
 	}
+	if n <= 0 {
+		old := d.hw
+		d.hw = len(d.entries)
+		return d.entries[old:], nil
+	}
 	if d.hw >= len(d.entries) {
 		return nil, io.EOF
 	}
@@ -243,6 +308,9 @@ func (d *winfsDir) ReadDir(n int) ([]fs.DirEntry, error) {
 // The alt io.Writer parameter can be set to a non nil value if a progress bar or such
 // is desired.
 func (f *winfsFile) CopyFromN(src io.Reader, num int64, alt io.Writer) (int64, error) {
+	if num == 0 {
+		return 0, nil
+	}
 	_, err := f.fsys.rcp.command(fmt.Sprintf("w %d", num))
 	if err != nil {
 		return 0, &fs.PathError{Op: "copy-to", Path: f.path, Err: ErrRcpCommandFailed.Wrapf("failed to copy: %w", err)}
@@ -295,6 +363,9 @@ func (f *winfsFile) Copy(dst io.Writer) (int, error) {
 
 // Write writes len(p) bytes from p to the remote file.
 func (f *winfsFile) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
 	_, err := f.fsys.rcp.command(fmt.Sprintf("w %d", len(p)))
 	if errors.Is(err, io.EOF) {
 		return 0, io.EOF
@@ -353,6 +424,13 @@ func (f *winfsFile) Close() error {
 // Use OpenFile to get a file that can be written to or if you need any of the methods not
 // available on fs.File interface without type assertion.
 func (fsys *windowsFsys) Open(name string) (fs.File, error) {
+	info, err := fsys.Stat(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if info.IsDir() {
+		return &winfsDir{winfsFile: winfsFile{fsys: fsys, path: name}}, nil
+	}
 	f, err := fsys.OpenFile(name, ModeRead, 0o644)
 	if err != nil {
 		return nil, err
@@ -378,7 +456,7 @@ func (fsys *windowsFsys) OpenFile(name string, mode FileMode, perm int) (File, e
 		return nil, &fs.PathError{Op: "open", Path: name, Err: ErrRcpCommandFailed.Wrapf("invalid mode: %d", mode)}
 	}
 
-	log.Debugf("opening remote file %s (mode %s)", name, modeStr, perm)
+	fsys.conn.Logger().Debugf("opening remote file %s (mode %s)", name, modeStr, perm)
 	_, err := fsys.rcp.command(fmt.Sprintf("o %s %s", modeStr, filepath.FromSlash(name)))
 	if err != nil {
 		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
@@ -386,7 +464,7 @@ func (fsys *windowsFsys) OpenFile(name string, mode FileMode, perm int) (File, e
 	return &winfsFile{fsys: fsys, path: name}, nil
 }
 
-// Stat returns fs.FileInfo for the remote file.
+// Stat returns fs.FileInfo for the remote file, following symbolic links and junctions.
 func (fsys *windowsFsys) Stat(name string) (fs.FileInfo, error) {
 	resp, err := fsys.rcp.command(fmt.Sprintf("stat %s", filepath.FromSlash(name)))
 	if err != nil {
@@ -417,20 +495,271 @@ func (fsys *windowsFsys) ReadDir(name string) ([]fs.DirEntry, error) {
 	if err != nil {
 		return nil, &fs.PathError{Op: "readdir", Path: name, Err: ErrRcpCommandFailed.Wrapf("failed to readdir: %v: %w", err, fs.ErrNotExist)}
 	}
-	if resp.Dir == nil {
-		return nil, nil
-	}
-	entries := make([]fs.DirEntry, len(resp.Dir))
-	for i, entry := range resp.Dir {
-		entries[i] = entry
-	}
-	return entries, nil
+	return sortedEntries(resp.Dir), nil
 }
 
-// Delete removes the named file or (empty) directory.
+// Delete removes the named file
 func (fsys *windowsFsys) Delete(name string) error {
-	if err := fsys.conn.Exec(fmt.Sprintf("del %s", ps.DoubleQuote(filepath.FromSlash(name)))); err != nil {
+	if _, err := fsys.rcp.call("rm", map[string]any{"path": filepath.FromSlash(name)}); err != nil {
 		return ErrCommandFailed.Wrapf("delete %s: %w", name, err)
 	}
 	return nil
 }
+
+// Manifest returns a list of the regular files under root with their sizes, modes and checksums.
+// The list is produced using a single rigrcp command.
+func (fsys *windowsFsys) Manifest(root string) (Manifest, error) {
+	resp, err := fsys.rcp.command(fmt.Sprintf("manifest %s", filepath.FromSlash(root)))
+	if err != nil {
+		return nil, &fs.PathError{Op: "manifest", Path: root, Err: ErrRcpCommandFailed.Wrapf("failed to build manifest: %w", err)}
+	}
+	if resp.Manifest == nil {
+		return Manifest{}, nil
+	}
+	return newManifest(resp.Manifest), nil
+}
+
+// maxWindowsBatchBytes is the maximum combined length of the paths removed with a single rigrcp
+// command, so that the progress function gets called while removing a long list of paths
+const maxWindowsBatchBytes = 65536
+
+// DeleteMany removes the named files or (empty) directories. It continues after failures and returns
+// PathErrors wrapped in ErrCommandFailed listing the paths that could not be removed. The progress
+// function is called after each path has been processed, it can be nil.
+func (fsys *windowsFsys) DeleteMany(names []string, progress DeleteProgressFunc) error {
+	var errs PathErrors
+	for _, batch := range batchPaths(names, maxWindowsBatchBytes) {
+		paths := make([]string, len(batch))
+		for i, name := range batch {
+			paths[i] = filepath.FromSlash(name)
+		}
+		resp, err := fsys.rcp.call("rmmany", map[string]any{"paths": paths})
+		if err != nil {
+			// the whole batch failed
+			for _, name := range batch {
+				pathErr := &fs.PathError{Op: "delete", Path: name, Err: ErrCommandFailed.Wrap(err)}
+				errs = append(errs, pathErr)
+				if progress != nil {
+					progress(name, pathErr)
+				}
+			}
+			continue
+		}
+		for i, res := range resp.Rm {
+			if i < len(batch) {
+				// report the paths as they were given
+				res.Path = batch[i]
+			}
+		}
+		errs = append(errs, rmResults(resp.Rm, progress)...)
+	}
+	if len(errs) > 0 {
+		return ErrCommandFailed.Wrap(errs)
+	}
+	return nil
+}
+
+// RemoveAll removes the named file or directory and everything it contains. It succeeds if the
+// path does not exist.
+func (fsys *windowsFsys) RemoveAll(name string) error {
+	if _, err := fsys.rcp.call("rm", map[string]any{"path": filepath.FromSlash(name), "recursive": true}); err != nil {
+		return &fs.PathError{Op: "removeall", Path: name, Err: ErrCommandFailed.Wrap(err)}
+	}
+	return nil
+}
+
+// ReadFile reads the named file and returns its contents
+func (fsys *windowsFsys) ReadFile(name string) ([]byte, error) {
+	return readFile(fsys, name)
+}
+
+// WriteFile writes data to the named file, creating it with the permissions perm if necessary
+func (fsys *windowsFsys) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return writeFile(fsys, name, data, perm)
+}
+
+// WriteFileAtomic writes data to the named file by writing it into a temporary file in the same
+// directory and renaming it over the target, so that the file is never observed half-written
+func (fsys *windowsFsys) WriteFileAtomic(name string, data []byte, perm fs.FileMode) error {
+	return writeFileAtomic(fsys, name, data, perm)
+}
+
+// Remove removes the named file or empty directory. A symbolic link is removed instead of its target.
+func (fsys *windowsFsys) Remove(name string) error {
+	if _, err := fsys.Lstat(name); err != nil {
+		return err
+	}
+	if _, err := fsys.rcp.call("rm", map[string]any{"path": filepath.FromSlash(name)}); err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: ErrCommandFailed.Wrap(err)}
+	}
+	return nil
+}
+
+// MkdirAll creates the named directory along with any missing parents. The permission bits are
+// ignored on windows.
+func (fsys *windowsFsys) MkdirAll(name string, _ fs.FileMode) error {
+	if _, err := fsys.rcp.call("mkdir", map[string]any{"path": filepath.FromSlash(name)}); err != nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: ErrCommandFailed.Wrap(err)}
+	}
+	return nil
+}
+
+// Rename renames (moves) oldname to newname, replacing newname if it is an existing file
+func (fsys *windowsFsys) Rename(oldname, newname string) error {
+	if _, err := fsys.rcp.call("mv", map[string]any{"old": filepath.FromSlash(oldname), "new": filepath.FromSlash(newname)}); err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: ErrCommandFailed.Wrap(err)}
+	}
+	return nil
+}
+
+// Chmod changes the mode of the named file. Windows files have no mode bits, the read-only attribute
+// is set when the mode lacks the owner write bit.
+func (fsys *windowsFsys) Chmod(name string, mode fs.FileMode) error {
+	if _, err := fsys.rcp.call("chmod", map[string]any{"path": filepath.FromSlash(name), "readonly": mode.Perm()&0o200 == 0}); err != nil {
+		return &fs.PathError{Op: "chmod", Path: name, Err: ErrCommandFailed.Wrap(err)}
+	}
+	return nil
+}
+
+// Chown changes the owner of the named file. Windows has no group ownership, the group is ignored.
+func (fsys *windowsFsys) Chown(name, owner, _ string) error {
+	if _, err := fsys.rcp.call("chown", map[string]any{"path": filepath.FromSlash(name), "owner": owner}); err != nil {
+		return &fs.PathError{Op: "chown", Path: name, Err: ErrCommandFailed.Wrap(err)}
+	}
+	return nil
+}
+
+// Chtimes changes the access and modification times of the named file
+func (fsys *windowsFsys) Chtimes(name string, atime, mtime time.Time) error {
+	if _, err := fsys.rcp.call("chtimes", map[string]any{"path": filepath.FromSlash(name), "atime": fileTime(atime), "mtime": fileTime(mtime)}); err != nil {
+		return &fs.PathError{Op: "chtimes", Path: name, Err: ErrCommandFailed.Wrap(err)}
+	}
+	return nil
+}
+
+// fileTime converts a time to a windows file time, the number of 100-nanosecond intervals since
+// January 1, 1601 UTC
+func fileTime(t time.Time) int64 {
+	const epochDiff = 116444736000000000 // 1601-01-01 to 1970-01-01 in 100ns intervals
+	return t.UnixNano()/100 + epochDiff
+}
+
+// Lstat returns the FileInfo structure describing the named file. If the file is a symbolic link or
+// a junction, the returned FileInfo describes the link and its mode has fs.ModeSymlink set.
+func (fsys *windowsFsys) Lstat(name string) (fs.FileInfo, error) {
+	resp, err := fsys.rcp.call("lstat", map[string]any{"path": filepath.FromSlash(name)})
+	if err != nil {
+		return nil, &fs.PathError{Op: "lstat", Path: name, Err: ErrRcpCommandFailed.Wrapf("failed to lstat: %w", err)}
+	}
+	if resp.Stat == nil {
+		return nil, &fs.PathError{Op: "lstat", Path: name, Err: ErrRcpCommandFailed.Wrapf("invalid response: %v", resp)}
+	}
+	return resp.Stat, nil
+}
+
+// Symlink creates newname as a symbolic link to oldname. Creating symbolic links requires the
+// SeCreateSymbolicLinkPrivilege or developer mode on windows.
+func (fsys *windowsFsys) Symlink(oldname, newname string) error {
+	if _, err := fsys.rcp.call("symlink", map[string]any{"old": filepath.FromSlash(oldname), "new": filepath.FromSlash(newname)}); err != nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: ErrCommandFailed.Wrap(err)}
+	}
+	return nil
+}
+
+// Readlink returns the destination of the named symbolic link
+func (fsys *windowsFsys) Readlink(name string) (string, error) {
+	resp, err := fsys.rcp.call("readlink", map[string]any{"path": filepath.FromSlash(name)})
+	if err != nil {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: ErrCommandFailed.Wrap(err)}
+	}
+	return resp.Path, nil
+}
+
+// dir returns the parent directory of name, which can use either of the path separators
+func (fsys *windowsFsys) dir(name string) string {
+	return path.Dir(strings.ReplaceAll(name, `\`, "/"))
+}
+
+func (fsys *windowsFsys) list(root string, depth int) ([]*FileInfo, error) {
+	resp, err := fsys.rcp.command(fmt.Sprintf("walk %d %s", depth, filepath.FromSlash(root)))
+	if err != nil {
+		return nil, &fs.PathError{Op: "walk", Path: root, Err: ErrRcpCommandFailed.Wrap(err)}
+	}
+	return resp.Dir, nil
+}
+
+// WalkDir walks the file tree rooted at root, calling fn for each file or directory in the tree,
+// including root, like fs.WalkDir. The tree is listed with a single Get-ChildItem command.
+func (fsys *windowsFsys) WalkDir(root string, fn fs.WalkDirFunc) error {
+	return walkDir(fsys, root, 0, fn)
+}
+
+// Glob returns the names of all files matching pattern like fs.Glob. The pattern must use forward
+// slashes as the path separator.
+func (fsys *windowsFsys) Glob(pattern string) ([]string, error) {
+	return glob(fsys, pattern)
+}
+
+// Find returns the paths of the files under root that match the filters in opts. The search is
+// performed with a single rigrcp command. The name pattern is matched using the PowerShell -like
+// operator.
+func (fsys *windowsFsys) Find(root string, opts FindOptions) ([]string, error) {
+	args := map[string]any{
+		"path":           filepath.FromSlash(root),
+		"depth":          opts.MaxDepth,
+		"type":           string(opts.Type),
+		"name":           opts.Name,
+		"modifiedWithin": minutes(opts.ModifiedWithin),
+		"modifiedBefore": minutes(opts.ModifiedBefore),
+		"minSize":        opts.MinSize,
+		"maxSize":        opts.MaxSize,
+	}
+	resp, err := fsys.rcp.call("find", args)
+	if err != nil {
+		return nil, &fs.PathError{Op: "find", Path: root, Err: ErrCommandFailed.Wrap(err)}
+	}
+	var paths []string
+	for _, p := range resp.Paths {
+		paths = append(paths, strings.ReplaceAll(p, "\\", "/"))
+	}
+	return paths, nil
+}
+
+// Sub returns a DirFS corresponding to the subtree rooted at dir
+func (fsys *windowsFsys) Sub(dir string) (fs.FS, error) {
+	return NewDirFS(fsys, dir), nil
+}
+
+// newTemp creates a file or a directory with a random name in dir, or in the default temporary
+// directory when dir is empty
+func (fsys *windowsFsys) newTemp(directory bool, dir, pattern string) (string, error) {
+	prefix, suffix, err := splitTempPattern(pattern)
+	if err != nil {
+		return "", err
+	}
+	resp, err := fsys.rcp.call("mktemp", map[string]any{"dir": filepath.FromSlash(dir), "prefix": prefix, "suffix": suffix, "directory": directory})
+	if err != nil {
+		return "", ErrCommandFailed.Wrapf("create temporary file: %w", err)
+	}
+	return resp.Path, nil
+}
+
+// MkdirTemp creates a new temporary directory in the directory dir and returns its path. The name
+// is generated by replacing the last "*" in pattern with a random string, or by appending one. The
+// default temporary directory is used when dir is empty.
+func (fsys *windowsFsys) MkdirTemp(dir, pattern string) (string, error) {
+	return fsys.newTemp(true, dir, pattern)
+}
+
+// CreateTemp creates a new empty temporary file in the directory dir and returns its path. The name
+// is generated like in MkdirTemp.
+func (fsys *windowsFsys) CreateTemp(dir, pattern string) (string, error) {
+	return fsys.newTemp(false, dir, pattern)
+}
+
+// Watch polls the named file every interval and sends an event on the returned channel when it is
+// created, modified or removed. Changes are detected by comparing the size, modification time and
+// checksum of the file. Call the returned function to stop watching, which also closes the channel.
+func (fsys *windowsFsys) Watch(name string, interval time.Duration) (<-chan FileEvent, func()) {
+	return watch(fsys, name, interval)
+}
@@ -0,0 +1,158 @@
+package rig
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newFakeRigrcp returns a windowsFsys connected to a fake rigrcp process that answers each command
+// with the response returned by handler
+func newFakeRigrcp(t *testing.T, handler func(name string, args map[string]any) any) *windowsFsys {
+	t.Helper()
+	stdinR, stdinW := io.Pipe()
+	stdoutR, stdoutW := io.Pipe()
+	rcp := &rigrcp{
+		conn:    &Connection{},
+		stdin:   stdinW,
+		stdout:  bufio.NewReader(stdoutR),
+		done:    make(chan struct{}),
+		running: true,
+	}
+	go func() {
+		defer stdoutW.Close()
+		r := bufio.NewReader(stdinR)
+		for {
+			cmd, err := readFrame(r)
+			if err != nil {
+				return
+			}
+			name, data, _ := strings.Cut(string(cmd), " ")
+			var args map[string]any
+			if err := json.Unmarshal([]byte(data), &args); err != nil {
+				args = map[string]any{"raw": data}
+			}
+			resp, err := json.Marshal(handler(name, args))
+			if err != nil {
+				return
+			}
+			if err := writeFrame(stdoutW, resp); err != nil {
+				return
+			}
+		}
+	}()
+	t.Cleanup(func() { _ = stdinW.Close() })
+	return &windowsFsys{conn: rcp.conn, rcp: rcp, buf: make([]byte, bufSize)}
+}
+
+func TestRigrcpFrame(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, writeFrame(buf, []byte("stat C:\\a\nb")))
+	require.NoError(t, writeFrame(buf, nil))
+	require.Equal(t, "11\nstat C:\\a\nb0\n", buf.String())
+
+	r := bufio.NewReader(buf)
+	payload, err := readFrame(r)
+	require.NoError(t, err)
+	require.Equal(t, "stat C:\\a\nb", string(payload))
+	payload, err = readFrame(r)
+	require.NoError(t, err)
+	require.Empty(t, payload)
+	_, err = readFrame(r)
+	require.ErrorIs(t, err, io.EOF)
+
+	_, err = readFrame(bufio.NewReader(strings.NewReader("x\n")))
+	require.ErrorIs(t, err, ErrRcpCommandFailed)
+}
+
+func TestWindowsFsysDeleteMany(t *testing.T) {
+	var calls []string
+	var args map[string]any
+	fsys := newFakeRigrcp(t, func(name string, a map[string]any) any {
+		calls = append(calls, name)
+		args = a
+		return map[string]any{"rm": []map[string]string{{"path": "a"}, {"path": "b", "error": "access denied"}}}
+	})
+
+	var progress []string
+	err := fsys.DeleteMany([]string{"C:/a", "C:/with\nnewline"}, func(name string, err error) {
+		progress = append(progress, name)
+	})
+	require.ErrorIs(t, err, ErrCommandFailed)
+	require.ErrorContains(t, err, "access denied")
+	require.Equal(t, []string{"C:/a", "C:/with\nnewline"}, progress)
+	require.Equal(t, []string{"rmmany"}, calls)
+	require.Equal(t, []any{filepath.FromSlash("C:/a"), filepath.FromSlash("C:/with\nnewline")}, args["paths"])
+}
+
+func TestWindowsFsysFind(t *testing.T) {
+	var calls []string
+	var args map[string]any
+	fsys := newFakeRigrcp(t, func(name string, a map[string]any) any {
+		calls = append(calls, name)
+		args = a
+		return map[string]any{"paths": []string{`C:\root\a.conf`, `C:\root\b\c.conf`}}
+	})
+
+	paths, err := fsys.Find("C:/root", FindOptions{Name: "*.conf", Type: FindFile, MaxDepth: 2, ModifiedWithin: time.Hour, MinSize: 10})
+	require.NoError(t, err)
+	require.Equal(t, []string{"C:/root/a.conf", "C:/root/b/c.conf"}, paths)
+	require.Equal(t, []string{"find"}, calls)
+	require.Equal(t, filepath.FromSlash("C:/root"), args["path"])
+	require.Equal(t, "f", args["type"])
+	require.Equal(t, "*.conf", args["name"])
+	require.EqualValues(t, 2, args["depth"])
+	require.EqualValues(t, 60, args["modifiedWithin"])
+	require.EqualValues(t, 0, args["modifiedBefore"])
+	require.EqualValues(t, 10, args["minSize"])
+}
+
+func TestWindowsFsysChown(t *testing.T) {
+	var calls []string
+	var args map[string]any
+	fsys := newFakeRigrcp(t, func(name string, a map[string]any) any {
+		calls = append(calls, name)
+		args = a
+		return map[string]any{}
+	})
+	require.NoError(t, fsys.Chown("C:/a b", `DOMAIN\user`, "ignored"))
+	require.Equal(t, []string{"chown"}, calls)
+	require.Equal(t, map[string]any{"path": filepath.FromSlash("C:/a b"), "owner": `DOMAIN\user`}, args)
+
+	fsys = newFakeRigrcp(t, func(string, map[string]any) any {
+		return map[string]any{"error": "access denied"}
+	})
+	require.ErrorIs(t, fsys.Chown("C:/a", "user", ""), ErrCommandFailed)
+}
+
+func TestWindowsFsysLstat(t *testing.T) {
+	var calls []string
+	fsys := newFakeRigrcp(t, func(name string, _ map[string]any) any {
+		calls = append(calls, name)
+		// ReparsePoint and Directory attributes
+		return map[string]any{"stat": map[string]any{"name": `C:\link`, "mode": 1024 | 16, "isDir": true, "isLink": true, "linkType": "Junction"}}
+	})
+	info, err := fsys.Lstat("C:/link")
+	require.NoError(t, err)
+	require.Equal(t, []string{"lstat"}, calls)
+	require.Equal(t, "link", info.Name())
+	require.NotZero(t, info.Mode()&fs.ModeSymlink)
+	require.Zero(t, info.Mode()&fs.ModeIrregular)
+
+	fsys = newFakeRigrcp(t, func(string, map[string]any) any {
+		// a reparse point that is not a link, such as a deduplicated file
+		return map[string]any{"stat": map[string]any{"name": `C:\file`, "mode": 1024}}
+	})
+	info, err = fsys.Lstat("C:/file")
+	require.NoError(t, err)
+	require.Zero(t, info.Mode()&fs.ModeSymlink)
+	require.NotZero(t, info.Mode()&fs.ModeIrregular)
+}
@@ -6,29 +6,31 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/k0sproject/rig/exec"
 	"github.com/k0sproject/rig/log"
+	"github.com/k0sproject/rig/pkg/redact"
 	"github.com/masterzen/winrm"
 	"github.com/mitchellh/go-homedir"
 )
 
 // WinRM describes a WinRM connection with its configuration options
 type WinRM struct {
-	Address       string `yaml:"address" validate:"required,hostname|ip"`
-	User          string `yaml:"user" validate:"omitempty,gt=2" default:"Administrator"`
-	Port          int    `yaml:"port" default:"5985" validate:"gt=0,lte=65535"`
-	Password      string `yaml:"password,omitempty"`
-	UseHTTPS      bool   `yaml:"useHTTPS" default:"false"`
-	Insecure      bool   `yaml:"insecure" default:"false"`
-	UseNTLM       bool   `yaml:"useNTLM" default:"false"`
-	CACertPath    string `yaml:"caCertPath,omitempty" validate:"omitempty,file"`
-	CertPath      string `yaml:"certPath,omitempty" validate:"omitempty,file"`
-	KeyPath       string `yaml:"keyPath,omitempty" validate:"omitempty,file"`
-	TLSServerName string `yaml:"tlsServerName,omitempty" validate:"omitempty,hostname|ip"`
-	Bastion       *SSH   `yaml:"bastion,omitempty"`
+	Address       string `yaml:"address" json:"address" mapstructure:"address" validate:"required,hostname|ip"`
+	User          string `yaml:"user" json:"user" mapstructure:"user" validate:"omitempty,gt=2"`
+	Port          int    `yaml:"port" json:"port" mapstructure:"port" validate:"gt=0,lte=65535"`
+	Password      string `yaml:"password,omitempty" json:"password,omitempty" mapstructure:"password"`
+	UseHTTPS      bool   `yaml:"useHTTPS" json:"useHTTPS" mapstructure:"useHTTPS" default:"false"`
+	Insecure      bool   `yaml:"insecure" json:"insecure" mapstructure:"insecure" default:"false"`
+	UseNTLM       bool   `yaml:"useNTLM" json:"useNTLM" mapstructure:"useNTLM" default:"false"`
+	CACertPath    string `yaml:"caCertPath,omitempty" json:"caCertPath,omitempty" mapstructure:"caCertPath" validate:"omitempty,file"`
+	CertPath      string `yaml:"certPath,omitempty" json:"certPath,omitempty" mapstructure:"certPath" validate:"omitempty,file"`
+	KeyPath       string `yaml:"keyPath,omitempty" json:"keyPath,omitempty" mapstructure:"keyPath" validate:"omitempty,file"`
+	TLSServerName string `yaml:"tlsServerName,omitempty" json:"tlsServerName,omitempty" mapstructure:"tlsServerName" validate:"omitempty,hostname|ip"`
+	Bastion       *SSH   `yaml:"bastion,omitempty" json:"bastion,omitempty" mapstructure:"bastion"`
 
 	name string
 
@@ -37,9 +39,19 @@ type WinRM struct {
 	cert   []byte
 
 	client *winrm.Client
+
+	// credentials is the source of the password when none is configured, set by Connection
+	credentials CredentialSource
+	// redactor is where the password is registered for redaction, set by Connection
+	redactor *redact.Redactor
+	// deprecations are the warnings about deprecated fields found while decoding, logged by Connection
+	deprecations deprecationWarnings
+
+	log log.Logger
 }
 
-// SetDefaults sets various default values
+// SetDefaults sets various default values, see SetDefaultWinRMUser, SetDefaultWinRMPort and
+// SetDefaultWinRMHTTPSPort
 func (c *WinRM) SetDefaults() {
 	if p, err := homedir.Expand(c.CACertPath); err == nil {
 		c.CACertPath = p
@@ -53,11 +65,34 @@ func (c *WinRM) SetDefaults() {
 		c.KeyPath = p
 	}
 
-	if c.Port == 5985 && c.UseHTTPS {
-		c.Port = 5986
+	user, port, httpsPort := winrmDefaults()
+	if c.User == "" {
+		c.User = user
+	}
+	if c.UseHTTPS && (c.Port == 0 || c.Port == port) {
+		c.Port = httpsPort
+	}
+	if c.Port == 0 {
+		c.Port = port
 	}
 }
 
+// SetLogger sets the logger for the messages about the connection, the global logger is used when
+// none is set. Called by Connection when its Log is set.
+func (c *WinRM) SetLogger(l log.Logger) {
+	c.log = l
+	if c.Bastion != nil {
+		c.Bastion.SetLogger(l)
+	}
+}
+
+func (c *WinRM) logger() log.Logger {
+	if c.log != nil {
+		return c.log
+	}
+	return log.Global
+}
+
 // Protocol returns the protocol name, "WinRM"
 func (c *WinRM) Protocol() string {
 	return "WinRM"
@@ -153,6 +188,12 @@ func (c *WinRM) Connect() error {
 			return fmt.Errorf("bastion connect: %w", err)
 		}
 		params.Dial = c.Bastion.client.Dial
+		defer func() {
+			// don't leave the bastion connection open when the connection fails
+			if c.client == nil {
+				_ = c.Bastion.Disconnect()
+			}
+		}()
 	}
 
 	if c.UseNTLM {
@@ -163,26 +204,91 @@ func (c *WinRM) Connect() error {
 		params.TransportDecorator = func() winrm.Transporter { return &winrm.ClientAuthRequest{} }
 	}
 
-	client, err := winrm.NewClientWithParameters(endpoint, c.User, c.Password, params)
+	password := c.Password
+	if password == "" {
+		if secret, ok, err := lookupCredential(secretsOrDefault(c.redactor), c.credentials, CredentialPassword, c.Address); err != nil {
+			return err
+		} else if ok {
+			password = secret
+		}
+	} else {
+		secretsOrDefault(c.redactor).Value(password)
+	}
+
+	client, err := winrm.NewClientWithParameters(endpoint, c.User, password, params)
 	if err != nil {
 		return fmt.Errorf("create winrm client: %w", err)
 	}
 
-	log.Debugf("%s: testing connection", c)
+	c.logger().Debugf("%s: testing connection", c)
 	_, err = client.RunWithContext(context.Background(), "echo ok", io.Discard, io.Discard)
 	if err != nil {
+		// the winrm package only reports the http status in the error message
+		if strings.Contains(err.Error(), "http response error: 401") {
+			return ErrAuthFailed.Wrapf("test connection: %w", err)
+		}
 		return fmt.Errorf("test connection: %w", err)
 	}
-	log.Debugf("%s: test passed", c)
+	c.logger().Debugf("%s: test passed", c)
 
 	c.client = client
 
 	return nil
 }
 
-// Disconnect closes the WinRM connection
-func (c *WinRM) Disconnect() {
+// Disconnect closes the WinRM connection and the connection to the bastion host. WinRM runs each
+// command in a request of its own, so there is nothing else to close. It is safe to call Disconnect
+// when not connected and more than once.
+func (c *WinRM) Disconnect() error {
+	c.client = nil
+	if c.Bastion != nil {
+		return c.Bastion.Disconnect()
+	}
+	return nil
+}
+
+// Reset closes the connection and clears the state derived from the configuration, such as the loaded
+// certificates, so that SetDefaults and Connect can start over after the configuration has been changed.
+func (c *WinRM) Reset() {
+	c.clearState()
+
+	if c.Bastion != nil {
+		c.Bastion.Reset()
+	}
+}
+
+// Clone returns a copy of the configuration that does not share the connection or the loaded
+// certificates with c. Unlike with Reset, the bastion connection of c is left open.
+func (c *WinRM) Clone() *WinRM {
+	clone := *c
+	clone.clearState()
+	if c.Bastion != nil {
+		clone.Bastion = c.Bastion.Clone()
+	}
+	return &clone
+}
+
+// clearState forgets the client and the state set up by SetDefaults and Connect
+func (c *WinRM) clearState() {
 	c.client = nil
+	c.name = ""
+	c.caCert = nil
+	c.key = nil
+	c.cert = nil
+}
+
+// exitError is returned when a command exits with a non-zero exit code, see exec.ExitCode
+type exitError struct {
+	code int
+}
+
+func (e *exitError) Error() string {
+	return fmt.Sprintf("exit code %d", e.code)
+}
+
+// ExitCode returns the exit code of the command
+func (e *exitError) ExitCode() int {
+	return e.code
 }
 
 // Command implements the Waiter interface
@@ -192,6 +298,7 @@ type Command struct {
 	stdin  io.ReadCloser
 	stdout io.Writer
 	stderr io.Writer
+	log    log.Logger
 }
 
 // Wait blocks until the command finishes
@@ -206,10 +313,10 @@ func (c *Command) Wait() error {
 		go func() {
 			defer c.cmd.Stdin.Close()
 			defer wg.Done()
-			log.Debugf("copying data to stdin")
+			c.log.Debugf("copying data to stdin")
 			_, err := io.Copy(c.cmd.Stdin, c.stdin)
 			if err != nil {
-				log.Errorf("copying data to command stdin failed: %v", err)
+				c.log.Errorf("copying data to command stdin failed: %v", err)
 			}
 		}()
 	}
@@ -224,10 +331,10 @@ func (c *Command) Wait() error {
 	}()
 
 	c.cmd.Wait()
-	log.Debugf("command finished")
+	c.log.Debugf("command finished")
 	var err error
 	if c.cmd.ExitCode() != 0 {
-		err = ErrCommandFailed.Wrapf("exit code %d", c.cmd.ExitCode())
+		err = ErrCommandFailed.Wrap(&exitError{code: c.cmd.ExitCode()})
 	}
 	wg.Wait()
 	return err
@@ -254,7 +361,7 @@ func (c *WinRM) ExecStreams(cmd string, stdin io.ReadCloser, stdout, stderr io.W
 	if err != nil {
 		return nil, ErrCommandFailed.Wrapf("execute command: %w", err)
 	}
-	return &Command{sh: shell, cmd: proc, stdin: stdin, stdout: stdout, stderr: stderr}, nil
+	return withTimeout(&Command{sh: shell, cmd: proc, stdin: stdin, stdout: stdout, stderr: stderr, log: c.logger()}, execOpts.Timeout, func() { _ = proc.Close() }), nil
 }
 
 // Exec executes a command on the host
@@ -272,16 +379,19 @@ func (c *WinRM) Exec(cmd string, opts ...exec.Option) error { //nolint:funlen,cy
 	if err != nil {
 		return fmt.Errorf("execute command: %w", err)
 	}
+	timedOut := startTimeout(execOpts.Timeout, func() { _ = command.Close() })
 
 	var wg sync.WaitGroup
 
-	if execOpts.Stdin != "" {
+	if src := execOpts.StdinSource(); src != nil {
 		execOpts.LogStdin(c.String())
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
 			defer command.Stdin.Close()
-			_, _ = command.Stdin.Write([]byte(execOpts.Stdin))
+			if _, err := io.Copy(command.Stdin, src); err != nil {
+				execOpts.LogErrorf("%s: failed to write stdin: %v", c, err)
+			}
 		}()
 	}
 
@@ -311,6 +421,14 @@ func (c *WinRM) Exec(cmd string, opts ...exec.Option) error { //nolint:funlen,cy
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
+		if execOpts.ErrWriter != nil {
+			n, err := io.Copy(execOpts.ErrWriter, command.Stderr)
+			gotErrors = n > 0
+			if err != nil {
+				execOpts.LogErrorf("%s: failed to stream stderr: %v", c, err)
+			}
+			return
+		}
 		outputScanner := bufio.NewScanner(command.Stderr)
 
 		for outputScanner.Scan() {
@@ -328,11 +446,15 @@ func (c *WinRM) Exec(cmd string, opts ...exec.Option) error { //nolint:funlen,cy
 	command.Wait()
 
 	wg.Wait()
+	execOpts.FlushOutput()
 
 	command.Close()
 
+	if timedOut() {
+		return ErrTimeout.Wrapf("command did not finish in %s", execOpts.Timeout)
+	}
 	if ec := command.ExitCode(); ec > 0 {
-		return ErrCommandFailed.Wrapf("non-zero exit code %d", ec)
+		return ErrCommandFailed.Wrapf("non-zero %w", &exitError{code: ec})
 	}
 	if !execOpts.AllowWinStderr && gotErrors {
 		return ErrCommandFailed.Wrapf("received data in stderr")
@@ -343,10 +465,21 @@ func (c *WinRM) Exec(cmd string, opts ...exec.Option) error { //nolint:funlen,cy
 
 // ExecInteractive executes a command on the host and copies stdin/stdout/stderr from local host
 func (c *WinRM) ExecInteractive(cmd string) error {
+	return c.ExecInteractiveWithOutput(cmd, nil)
+}
+
+// ExecInteractiveWithOutput is like ExecInteractive but also copies the output of the session into
+// output when it is not nil
+func (c *WinRM) ExecInteractiveWithOutput(cmd string, output io.Writer) error {
 	if cmd == "" {
 		cmd = "cmd"
 	}
-	_, err := c.client.RunWithContextWithInput(context.Background(), cmd, os.Stdout, os.Stderr, os.Stdin)
+	var stdout, stderr io.Writer = os.Stdout, os.Stderr
+	if output != nil {
+		stdout = io.MultiWriter(os.Stdout, output)
+		stderr = io.MultiWriter(os.Stderr, output)
+	}
+	_, err := c.client.RunWithContextWithInput(context.Background(), cmd, stdout, stderr, os.Stdin)
 	if err != nil {
 		return fmt.Errorf("execute command interactive: %w", err)
 	}